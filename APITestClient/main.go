@@ -2,36 +2,34 @@
 package main
 
 import (
-	"TestProject/auth"
 	"TestProject/cache"
 	"TestProject/utils"
-	"bufio"
-	"crypto/tls"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"net"
-	"os"
 )
 
 const (
 	DEFAULT_ADDRESS = "localhost:8086"
 )
 
+var tlsOptions = utils.RegisterTLSFlags(flag.CommandLine)
+
 func main() {
 
-	if len(os.Args) != 3 {
-		fmt.Println("Application requires at least 2 parameters: user password")
+	flag.Parse()
+	if flag.NArg() != 2 && flag.NArg() != 4 && !(tlsOptions.CertFile != "" && flag.NArg() == 0) {
+		fmt.Println("Usage: [-ca file] [-pin fingerprint] [-cert file -key file] [-insecure] user password [host port]")
+		fmt.Println("User and password can be omitted when a client certificate is passed.")
 		return
 	}
 
-	conn, err := connect(getAddress())
+	options, err := clientOptions()
 	panicError(err)
-	defer conn.Close()
-
-	connectToCache(conn, "TestCache")
-
-	cache := cache.NewRemoteCache(conn)
+	cache, err := cache.DialRemoteCache(options)
+	panicError(err)
+	defer cache.Close()
 
 	value, _ := cache.Put("A", "B")
 	fmt.Println("cache.Put(\"A\", \"B\")")
@@ -44,47 +42,27 @@ func main() {
 	fmt.Println("Replaced: ", value)
 }
 
-func connect(address string) (net.Conn, error) {
-	conn, err := tls.Dial("tcp", address, &tls.Config{InsecureSkipVerify: true})
-	if err != nil {
-		return nil, err
+//Returns options of a pooled client, a client certificate is used for login when user and password are omitted.
+func clientOptions() (cache.ClientOptions, error) {
+	options := cache.DefaultClientOptions()
+	options.Address = getAddress()
+	options.CacheId = "TestCache"
+	if flag.NArg() > 0 {
+		options.User = flag.Arg(0)
+		options.Password = flag.Arg(1)
 	}
-	return conn, nil
-}
-
-func connectToCache(conn net.Conn, cacheId string) {
-
-	sendCredentials(conn)
-
-	data := []byte("connect-to " + cacheId)
-	data = append(data, '\n')
-	conn.Write(data)
-}
-
-func sendCredentials(conn net.Conn) {
-	user := &auth.User{Name: os.Args[1], Pass: auth.EncryptPass(os.Args[2]), IsMachine: true}
-
-	data, err := auth.UserToJson(user)
-	panicError(err)
 
-	data = append(data, '\n')
-	conn.Write(data)
-
-	data, _, err = bufio.NewReader(conn).ReadLine()
-	panicError(err)
-	response, err := cache.JsonToResponse(data)
-	panicError(err)
-	if response.Err != "" {
-		panic(response.Err)
-	}
+	var err error
+	options.TLSConfig, err = utils.NewClientTLSConfig(tlsOptions)
+	return options, err
 }
 
 func getAddress() string {
-	if len(os.Args) > 4 {
-		if utils.CheckPort(os.Args[4]) != nil {
+	if flag.NArg() == 4 {
+		if utils.CheckPort(flag.Arg(3)) != nil {
 			panic(errors.New("Wrong port defined"))
 		}
-		return os.Args[3] + ":" + os.Args[4]
+		return flag.Arg(2) + ":" + flag.Arg(3)
 	}
 	return DEFAULT_ADDRESS
 }
@@ -2,11 +2,12 @@
 package main
 
 import (
+	"TestProject/cache"
 	"TestProject/utils"
-	"Testproject/auth"
 	"bufio"
 	"crypto/tls"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"net"
@@ -20,14 +21,20 @@ const (
 
 var connectionClosed atomic.Value
 
+var tlsOptions = utils.RegisterTLSFlags(flag.CommandLine)
+
 func main() {
 
-	if len(os.Args) != 3 {
-		fmt.Println("Application requires at least 2 parameters: user password")
+	flag.Parse()
+	if flag.NArg() != 2 && flag.NArg() != 4 && !(tlsOptions.CertFile != "" && flag.NArg() == 0) {
+		fmt.Println("Usage: [-ca file] [-pin fingerprint] [-cert file -key file] [-insecure] user password [host port]")
+		fmt.Println("User and password can be omitted when a client certificate is passed.")
 		return
 	}
 
-	conn, err := tls.Dial("tcp", getAddress(), &tls.Config{InsecureSkipVerify: true})
+	config, err := utils.NewClientTLSConfig(tlsOptions)
+	panicError(err)
+	conn, err := tls.Dial("tcp", getAddress(), config)
 	panicError(err)
 
 	defer conn.Close()
@@ -40,13 +47,12 @@ func main() {
 }
 
 func sendCredentials(conn net.Conn) {
-	user := &auth.User{Name: os.Args[1], Pass: auth.EncryptPass(os.Args[2]), IsMachine: false}
-
-	data, err := auth.UserToJson(user)
-	panicError(err)
-
-	data = append(data, '\n')
-	conn.Write(data)
+	if flag.NArg() == 0 {
+		_, err := cache.LoginWithCertificate(conn, "", false)
+		panicError(err)
+		return
+	}
+	panicError(cache.Login(conn, flag.Arg(0), flag.Arg(1), false))
 }
 
 func readMessages(conn net.Conn) {
@@ -85,11 +91,11 @@ func handleUserMessages(conn net.Conn) {
 }
 
 func getAddress() string {
-	if len(os.Args) > 4 {
-		if utils.CheckPort(os.Args[4]) != nil {
+	if flag.NArg() == 4 {
+		if utils.CheckPort(flag.Arg(3)) != nil {
 			panic(errors.New("Wrong port defined"))
 		}
-		return os.Args[3] + ":" + os.Args[4]
+		return flag.Arg(2) + ":" + flag.Arg(3)
 	}
 	return DEFAULT_ADDRESS
 }
@@ -0,0 +1,222 @@
+package audit
+
+import (
+	"TestProject/cache"
+	"TestProject/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+//Defines how much of a command is written into the audit log.
+type Policy string
+
+const (
+	AUDIT_FILE         = "audit.log"
+	AUDIT_OPTIONS_FILE = "audit.json"
+
+	EVENT_LOGIN   = "login"
+	EVENT_COMMAND = "command"
+
+	METHOD_PASSWORD    = "password"
+	METHOD_CERTIFICATE = "certificate"
+	METHOD_SESSION     = "session"
+	//Clients of unix sockets logged in by their OS users or by file permissions of the socket.
+	METHOD_PEER  = "peer"
+	METHOD_TRUST = "trust"
+
+	//Commands of a cache are not written.
+	POLICY_NONE Policy = "none"
+	//A command is written with its key, values are not written.
+	POLICY_KEYS Policy = "keys"
+	//A command is written with all its parameters.
+	POLICY_VALUES Policy = "values"
+)
+
+//Policy of caches with names matching a pattern, e.g. "secrets-*".
+type CachePolicy struct {
+	Pattern string
+	Policy  Policy
+}
+
+//Options of an audit log.
+type AuditOptions struct {
+	//The file is rotated when it is bigger than this size, and this number of old files is kept.
+	MaxSize    int64
+	MaxBackups int
+
+	//Policy of caches that don't match any pattern of Caches.
+	DefaultPolicy Policy
+	//Policies of caches, the first matching pattern is used.
+	Caches []CachePolicy
+}
+
+//Returns default options of an audit log, values of commands are not written.
+func DefaultAuditOptions() AuditOptions {
+	return AuditOptions{MaxSize: utils.DEFAULT_ROTATE_SIZE, MaxBackups: utils.DEFAULT_ROTATE_BACKUPS, DefaultPolicy: POLICY_KEYS}
+}
+
+//Reads options of an audit log from a Json file, options that are missing in the file keep default values.
+//Default options are returned if the file doesn't exist.
+func ReadAuditOptions(fileName string) (AuditOptions, error) {
+	options := DefaultAuditOptions()
+	data, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return options, nil
+	} else if err != nil {
+		return options, err
+	}
+
+	err = json.Unmarshal(data, &options)
+	if err != nil {
+		return options, err
+	}
+	return options, options.Validate()
+}
+
+//Checks cache patterns and policies of options.
+func (this *AuditOptions) Validate() error {
+	policies := []Policy{this.DefaultPolicy}
+	for _, cachePolicy := range this.Caches {
+		if _, err := path.Match(cachePolicy.Pattern, ""); err != nil {
+			return errors.New(fmt.Sprintf("Wrong cache pattern [%v]", cachePolicy.Pattern))
+		}
+		policies = append(policies, cachePolicy.Policy)
+	}
+
+	for _, policy := range policies {
+		switch policy {
+		case POLICY_NONE, POLICY_KEYS, POLICY_VALUES:
+		default:
+			return errors.New(fmt.Sprintf("Unknown audit policy [%v]", policy))
+		}
+	}
+	return nil
+}
+
+//One line of an audit log, either a login attempt or a mutating command.
+type Record struct {
+	Time  time.Time
+	Event string
+	//Name of a user who logged in or tried to, it can be empty when a client didn't send a name.
+	User      string
+	Remote    string `json:",omitempty"`
+	Method    string `json:",omitempty"`
+	IsMachine bool   `json:",omitempty"`
+
+	Cache   string   `json:",omitempty"`
+	Command string   `json:",omitempty"`
+	Key     string   `json:",omitempty"`
+	Params  []string `json:",omitempty"`
+
+	Success bool
+	//Code and message of an error.
+	Code  cache.ErrorCode `json:",omitempty"`
+	Error string          `json:",omitempty"`
+}
+
+//Writes login attempts and mutating commands as Json lines, one record per line.
+//Records are written synchronously, so nothing is lost when the server stops. A <nil> Auditor writes nothing.
+type Auditor struct {
+	lock    sync.Mutex
+	writer  io.Writer
+	options AuditOptions
+	log     *slog.Logger
+}
+
+//Creates an auditor that writes records into <writer>, write errors are written into <log>.
+func NewAuditor(writer io.Writer, options AuditOptions, log *slog.Logger) *Auditor {
+	auditor := new(Auditor)
+	auditor.writer = writer
+	auditor.options = options
+	auditor.log = log
+	return auditor
+}
+
+//Creates an auditor that writes records into a file <fileName> that is rotated according to <options>.
+func OpenAuditor(fileName string, options AuditOptions, log *slog.Logger) (*Auditor, error) {
+	file, err := utils.OpenRotatingFile(fileName, options.MaxSize, options.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuditor(file, options, log), nil
+}
+
+//Returns a policy of a cache.
+func (this *Auditor) Policy(cacheId string) Policy {
+	for _, cachePolicy := range this.options.Caches {
+		if matched, _ := path.Match(cachePolicy.Pattern, cacheId); matched {
+			return cachePolicy.Policy
+		}
+	}
+	return this.options.DefaultPolicy
+}
+
+//Writes a login <attempt>, <err> is the reason of a failure.
+func (this *Auditor) Login(attempt Record, err error) {
+	if this == nil {
+		return
+	}
+	attempt.Event = EVENT_LOGIN
+	this.write(attempt, err)
+}
+
+//Writes a command of a <user>, <err> is the result of the command.
+//Commands without a cache, e.g. management of users, are written with their first parameter only, so passwords are not written.
+func (this *Auditor) Command(user, cacheId, command string, params []string, err error) {
+	if this == nil {
+		return
+	}
+	policy := POLICY_KEYS
+	if cacheId != "" {
+		policy = this.Policy(cacheId)
+	}
+	if policy == POLICY_NONE {
+		return
+	}
+
+	record := Record{Event: EVENT_COMMAND, User: user, Cache: cacheId, Command: command}
+	if len(params) > 0 {
+		record.Key = params[0]
+	}
+	if policy == POLICY_VALUES && len(params) > 1 {
+		record.Params = params[1:]
+	}
+	this.write(record, err)
+}
+
+func (this *Auditor) write(record Record, err error) {
+	record.Time = time.Now().UTC()
+	record.Success = err == nil
+	if err != nil {
+		record.Code = cache.ErrorCodeOf(err)
+		record.Error = err.Error()
+	}
+
+	data, err := json.Marshal(record)
+	if err == nil {
+		this.lock.Lock()
+		_, err = this.writer.Write(append(data, '\n'))
+		this.lock.Unlock()
+	}
+	if err != nil {
+		this.log.Error("Cannot write audit log", utils.LOG_ERROR, err)
+	}
+}
+
+//Closes the file of the auditor if it writes into a file.
+func (this *Auditor) Close() error {
+	if this == nil {
+		return nil
+	}
+	if closer, ok := this.writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"TestProject/cache"
+	"TestProject/utils"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readRecords(t *testing.T, data []byte) []Record {
+	records := []Record{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var record Record
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			t.Fatal("Audit record is not Json", scanner.Text())
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAuditor(t *testing.T) {
+	options := DefaultAuditOptions()
+	options.Caches = []CachePolicy{{Pattern: "secrets-*", Policy: POLICY_NONE}, {Pattern: "debug", Policy: POLICY_VALUES}}
+	buffer := new(bytes.Buffer)
+	auditor := NewAuditor(buffer, options, slog.Default())
+
+	auditor.Login(Record{User: "admin", Remote: "127.0.0.1:5000", Method: METHOD_PASSWORD, IsMachine: true}, nil)
+	auditor.Login(Record{User: "admin", Remote: "127.0.0.1:5001", Method: METHOD_PASSWORD}, cache.ErrAuthFailed)
+	auditor.Command("admin", "users", "set", []string{"key", "secret"}, nil)
+	auditor.Command("admin", "secrets-a", "set", []string{"key", "secret"}, nil)
+	auditor.Command("admin", "debug", "dset", []string{"key", "field", "value"}, cache.ErrWrongType)
+	auditor.Command("admin", "", "user-passwd", []string{"bob", "password"}, nil)
+
+	records := readRecords(t, buffer.Bytes())
+	if len(records) != 5 {
+		t.Fatal("Wrong number of audit records", len(records))
+	}
+
+	login := records[0]
+	if login.Event != EVENT_LOGIN || login.User != "admin" || login.Remote != "127.0.0.1:5000" || !login.IsMachine || !login.Success || login.Time.IsZero() {
+		t.Error("Wrong behavior of Login function", login)
+	}
+	if records[1].Success || records[1].Code != cache.AUTH_FAILED {
+		t.Error("Failed login should be written with its error", records[1])
+	}
+
+	command := records[2]
+	if command.Event != EVENT_COMMAND || command.Cache != "users" || command.Command != "set" || command.Key != "key" || command.Params != nil || !command.Success {
+		t.Error("Values should not be written by default", command)
+	}
+	if records[3].Cache != "debug" || !reflect.DeepEqual(records[3].Params, []string{"field", "value"}) || records[3].Code != cache.WRONG_TYPE {
+		t.Error("Values should be written for caches with POLICY_VALUES", records[3])
+	}
+	if records[4].Command != "user-passwd" || records[4].Key != "bob" || records[4].Params != nil {
+		t.Error("Only the first parameter of commands without a cache should be written", records[4])
+	}
+
+	var nilAuditor *Auditor
+	nilAuditor.Login(Record{User: "admin"}, nil)
+	nilAuditor.Command("admin", "users", "set", []string{"key", "value"}, nil)
+}
+
+func TestReadAuditOptions(t *testing.T) {
+	dir := t.TempDir()
+
+	options, err := ReadAuditOptions(filepath.Join(dir, "missing.json"))
+	if err != nil || !reflect.DeepEqual(options, DefaultAuditOptions()) {
+		t.Error("Default options should be returned for a missing file", err)
+	}
+
+	fileName := filepath.Join(dir, AUDIT_OPTIONS_FILE)
+	os.WriteFile(fileName, []byte(`{"MaxBackups":2,"Caches":[{"Pattern":"secrets-*","Policy":"none"}]}`), 0600)
+	options, err = ReadAuditOptions(fileName)
+	if err != nil || options.MaxBackups != 2 || options.MaxSize != utils.DEFAULT_ROTATE_SIZE || options.DefaultPolicy != POLICY_KEYS {
+		t.Error("Wrong behavior of ReadAuditOptions function", options, err)
+	}
+
+	os.WriteFile(fileName, []byte(`{"DefaultPolicy":"all"}`), 0600)
+	_, err = ReadAuditOptions(fileName)
+	if err == nil {
+		t.Error("Unknown policy should not be accepted")
+	}
+}
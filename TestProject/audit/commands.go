@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"TestProject/cache"
+)
+
+//Decorates commands of a named cache, every mutating command of a user is written into the audit log
+//together with its result, denials included.
+type AuditedCommands struct {
+	cache.CacheCommands
+	auditor *Auditor
+	user    string
+	cacheId string
+}
+
+//Wraps passed commands of a cache <cacheId> executed by a <user>, a <nil> Auditor returns <cmds> as they are.
+func (this *Auditor) Wrap(cmds cache.CacheCommands, user, cacheId string) cache.CacheCommands {
+	if this == nil {
+		return cmds
+	}
+	return &AuditedCommands{CacheCommands: cmds, auditor: this, user: user, cacheId: cacheId}
+}
+
+func (this *AuditedCommands) audit(command string, params []string, err error) {
+	this.auditor.Command(this.user, this.cacheId, command, params, err)
+}
+
+func (this *AuditedCommands) SetValue(params []string) (interface{}, error) {
+	value, err := this.CacheCommands.SetValue(params)
+	this.audit("set", params, err)
+	return value, err
+}
+
+func (this *AuditedCommands) UpdateValue(params []string) (bool, error) {
+	updated, err := this.CacheCommands.UpdateValue(params)
+	this.audit("update", params, err)
+	return updated, err
+}
+
+func (this *AuditedCommands) RemoveValue(params []string) (interface{}, bool, error) {
+	value, removed, err := this.CacheCommands.RemoveValue(params)
+	this.audit("delete", params, err)
+	return value, removed, err
+}
+
+func (this *AuditedCommands) AppendListValue(params []string) error {
+	err := this.CacheCommands.AppendListValue(params)
+	this.audit("lappend", params, err)
+	return err
+}
+
+func (this *AuditedCommands) DeleteListValue(params []string) (interface{}, error) {
+	value, err := this.CacheCommands.DeleteListValue(params)
+	this.audit("ldelete", params, err)
+	return value, err
+}
+
+func (this *AuditedCommands) SetDictValue(params []string) (interface{}, error) {
+	value, err := this.CacheCommands.SetDictValue(params)
+	this.audit("dset", params, err)
+	return value, err
+}
+
+func (this *AuditedCommands) AppendDictValue(params []string) (bool, error) {
+	appended, err := this.CacheCommands.AppendDictValue(params)
+	this.audit("dappend", params, err)
+	return appended, err
+}
+
+func (this *AuditedCommands) DeleteDictValue(params []string) (interface{}, error) {
+	value, err := this.CacheCommands.DeleteDictValue(params)
+	this.audit("ddelete", params, err)
+	return value, err
+}
+
+func (this *AuditedCommands) UpdateTTL(params []string) (bool, error) {
+	updated, err := this.CacheCommands.UpdateTTL(params)
+	this.audit("ttl", params, err)
+	return updated, err
+}
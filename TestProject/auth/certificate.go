@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"crypto/x509"
+)
+
+//Returns names a client certificate is mapped to a user by: the common name of the subject, DNS names, emails and URIs of SAN.
+func CertificateNames(cert *x509.Certificate) []string {
+	names := []string{}
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
+
+//Returns <true> if a user logs in with a passed client certificate, i.e. one of its names is listed in Certificates of the user.
+//The certificate has to be verified by a caller.
+func (this *User) MatchesCertificate(cert *x509.Certificate) bool {
+	for _, name := range CertificateNames(cert) {
+		for _, allowed := range this.Certificates {
+			if name == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
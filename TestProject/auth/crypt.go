@@ -1,8 +1,29 @@
 package auth
 
 import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	//Tag of a password verifier in the users file, it defines the version of the hashing scheme.
+	VERIFIER_TAG = "scram-sha-256"
+
+	//The number of PBKDF2 iterations of new verifiers.
+	DEFAULT_ITERATIONS = 100000
+
+	//The minimal number of PBKDF2 iterations accepted by the server and clients, the same as RFC 7677 requires.
+	MIN_ITERATIONS = 4096
+
+	SALT_SIZE = 16
 )
 
 //Encrypts user's password before it is sent to server
@@ -10,3 +31,102 @@ func EncryptPass(password string) string {
 	b := sha512.Sum512([]byte(password))
 	return string(base64.StdEncoding.EncodeToString(b[:]))
 }
+
+//Salted SCRAM-SHA-256 verifier of a password, it is stored in the users file instead of the password.
+//A password is hashed with EncryptPass before PBKDF2 is applied,
+//so entries of the old users file that contain EncryptPass hashes can be converted without knowing passwords.
+//
+//The string form is "$scram-sha-256$<iterations>$<salt>$<stored key>$<server key>" with base64 encoded values.
+type Verifier struct {
+	Iterations int
+	Salt       []byte
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+//Creates a verifier of a password with a random salt.
+func NewVerifier(password string, iterations int) (*Verifier, error) {
+	return NewVerifierFromHash(EncryptPass(password), iterations)
+}
+
+//Creates a verifier with a random salt from an EncryptPass <hash> of a password, e.g. from an entry of the old users file.
+func NewVerifierFromHash(hash string, iterations int) (*Verifier, error) {
+	if iterations < MIN_ITERATIONS {
+		return nil, errors.New(fmt.Sprintf("At least %d iterations are required", MIN_ITERATIONS))
+	}
+
+	salt := make([]byte, SALT_SIZE)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	saltedPass, err := saltPassword(hash, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+
+	storedKey := sha256.Sum256(computeHmac(saltedPass, "Client Key"))
+	return &Verifier{Iterations: iterations, Salt: salt, StoredKey: storedKey[:], ServerKey: computeHmac(saltedPass, "Server Key")}, nil
+}
+
+//Returns <true> if a value of the users file is a verifier rather than an old unsalted hash.
+func IsVerifier(value string) bool {
+	return strings.HasPrefix(value, "$")
+}
+
+//Parses the string form of a verifier.
+func ParseVerifier(value string) (*Verifier, error) {
+	parts := strings.Split(value, "$")
+	if len(parts) != 6 || parts[0] != "" {
+		return nil, errors.New("Invalid format of a password verifier")
+	}
+	if parts[1] != VERIFIER_TAG {
+		return nil, errors.New(fmt.Sprintf("Unknown password hashing scheme [%v]", parts[1]))
+	}
+
+	iterations, err := strconv.Atoi(parts[2])
+	if err != nil || iterations < MIN_ITERATIONS {
+		return nil, errors.New(fmt.Sprintf("Invalid number of iterations [%v]", parts[2]))
+	}
+
+	verifier := &Verifier{Iterations: iterations}
+	values := []*[]byte{&verifier.Salt, &verifier.StoredKey, &verifier.ServerKey}
+	for i := range values {
+		*values[i], err = base64.StdEncoding.DecodeString(parts[i+3])
+		if err != nil {
+			return nil, errors.New("Invalid format of a password verifier")
+		}
+	}
+	if len(verifier.StoredKey) != sha256.Size || len(verifier.ServerKey) != sha256.Size {
+		return nil, errors.New("Invalid format of a password verifier")
+	}
+	return verifier, nil
+}
+
+func (this *Verifier) String() string {
+	return fmt.Sprintf("$%v$%d$%v$%v$%v", VERIFIER_TAG, this.Iterations,
+		base64.StdEncoding.EncodeToString(this.Salt),
+		base64.StdEncoding.EncodeToString(this.StoredKey),
+		base64.StdEncoding.EncodeToString(this.ServerKey))
+}
+
+//Checks a password sent as plain text, e.g. by Redis clients.
+func (this *Verifier) Check(password string) bool {
+	saltedPass, err := saltPassword(EncryptPass(password), this.Salt, this.Iterations)
+	if err != nil {
+		return false
+	}
+	storedKey := sha256.Sum256(computeHmac(saltedPass, "Client Key"))
+	return hmac.Equal(storedKey[:], this.StoredKey)
+}
+
+func saltPassword(hash string, salt []byte, iterations int) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, hash, salt, iterations, sha256.Size)
+}
+
+func computeHmac(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_MAX_FAILURES   = 5
+	DEFAULT_BASE_DELAY     = time.Second
+	DEFAULT_MAX_DELAY      = 30 * time.Second
+	DEFAULT_LOCKOUT        = 15 * time.Minute
+	DEFAULT_FAILURE_WINDOW = 15 * time.Minute
+
+	//Counters are cleaned up when there are more of them, so random user names don't fill the memory.
+	LIMITER_PRUNE_SIZE = 1024
+)
+
+//Thresholds of LoginLimiter.
+type LimiterOptions struct {
+	//Number of failures in a row after which a user or a source is locked out.
+	MaxFailures int
+	//Delay after the first failure, it is doubled by every next failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	//How long logins are rejected after MaxFailures.
+	Lockout time.Duration
+	//Failures are forgotten when there were no new ones during this time.
+	FailureWindow time.Duration
+	//Returns the current time, a fake clock can be passed in tests.
+	Now func() time.Time
+}
+
+func DefaultLimiterOptions() LimiterOptions {
+	return LimiterOptions{
+		MaxFailures:   DEFAULT_MAX_FAILURES,
+		BaseDelay:     DEFAULT_BASE_DELAY,
+		MaxDelay:      DEFAULT_MAX_DELAY,
+		Lockout:       DEFAULT_LOCKOUT,
+		FailureWindow: DEFAULT_FAILURE_WINDOW,
+		Now:           time.Now,
+	}
+}
+
+//Failed logins of a user or of a source address.
+type Lockout struct {
+	//"user:<name>" or "ip:<address>".
+	Key      string
+	Failures int
+	//Logins are rejected till this time.
+	Until  time.Time
+	Locked bool
+	last   time.Time
+}
+
+func (this *Lockout) String() string {
+	state := "backoff"
+	if this.Locked {
+		state = "locked"
+	}
+	return fmt.Sprintf("%v failures=%d %v until %v", this.Key, this.Failures, state, this.Until.Format(time.RFC3339))
+}
+
+//Counts failed logins per user and per source address.
+//Every failure delays the next attempt exponentially, MaxFailures failures in a row lock logins out for a while.
+type LoginLimiter struct {
+	lock     sync.Mutex
+	options  LimiterOptions
+	lockouts map[string]*Lockout
+}
+
+func NewLoginLimiter(options LimiterOptions) *LoginLimiter {
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+
+	limiter := new(LoginLimiter)
+	limiter.options = options
+	limiter.lockouts = make(map[string]*Lockout)
+	return limiter
+}
+
+//Returns keys of counters of a user and of a source address, empty ones are skipped.
+func limiterKeys(user, source string) []string {
+	keys := []string{}
+	if user != "" {
+		keys = append(keys, "user:"+user)
+	}
+	if source != "" {
+		keys = append(keys, "ip:"+source)
+	}
+	return keys
+}
+
+//Checks if a <user> can try to log in from a <source> address now.
+//Returns a Lockout that rejects the attempt, or <nil> if the attempt is allowed.
+func (this *LoginLimiter) Check(user, source string) *Lockout {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	now := this.options.Now()
+	for _, key := range limiterKeys(user, source) {
+		lockout := this.lockouts[key]
+		if lockout != nil && now.Before(lockout.Until) {
+			copied := *lockout
+			return &copied
+		}
+	}
+	return nil
+}
+
+//Records a failed login of a <user> from a <source> address.
+func (this *LoginLimiter) Fail(user, source string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	now := this.options.Now()
+	if len(this.lockouts) >= LIMITER_PRUNE_SIZE {
+		this.prune(now)
+	}
+
+	for _, key := range limiterKeys(user, source) {
+		lockout := this.lockouts[key]
+		if lockout == nil || this.expired(lockout, now) {
+			lockout = &Lockout{Key: key}
+			this.lockouts[key] = lockout
+		}
+
+		lockout.Failures++
+		lockout.last = now
+		if lockout.Failures >= this.options.MaxFailures {
+			lockout.Locked = true
+			lockout.Until = now.Add(this.options.Lockout)
+		} else {
+			lockout.Until = now.Add(this.delay(lockout.Failures))
+		}
+	}
+}
+
+//Records a successful login of a <user>, failures of the user are forgotten.
+//Failures of a source address are kept, so one known password doesn't let a source guess passwords of other users.
+func (this *LoginLimiter) Succeed(user string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	delete(this.lockouts, "user:"+user)
+}
+
+//Returns counters of failures that are not forgotten yet, sorted by key.
+func (this *LoginLimiter) List() []Lockout {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.prune(this.options.Now())
+	list := make([]Lockout, 0, len(this.lockouts))
+	for _, lockout := range this.lockouts {
+		list = append(list, *lockout)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
+
+//Forgets failures of a <key> ("user:<name>" or "ip:<address>"), all failures are forgotten for "all".
+//Returns <false> if there were no failures of the key.
+func (this *LoginLimiter) Clear(key string) bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if key == "all" {
+		cleared := len(this.lockouts) > 0
+		this.lockouts = make(map[string]*Lockout)
+		return cleared
+	}
+
+	_, ok := this.lockouts[key]
+	delete(this.lockouts, key)
+	return ok
+}
+
+//Returns a delay after <failures> failures in a row: BaseDelay, 2*BaseDelay, 4*BaseDelay... up to MaxDelay.
+func (this *LoginLimiter) delay(failures int) time.Duration {
+	delay := this.options.BaseDelay
+	for i := 1; i < failures && delay < this.options.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > this.options.MaxDelay {
+		delay = this.options.MaxDelay
+	}
+	return delay
+}
+
+func (this *LoginLimiter) expired(lockout *Lockout, now time.Time) bool {
+	return !now.Before(lockout.Until) && now.Sub(lockout.last) >= this.options.FailureWindow
+}
+
+func (this *LoginLimiter) prune(now time.Time) {
+	for key, lockout := range this.lockouts {
+		if this.expired(lockout, now) {
+			delete(this.lockouts, key)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+//Clock of tests that moves only when it is told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (this *fakeClock) Now() time.Time {
+	return this.now
+}
+
+func (this *fakeClock) Advance(duration time.Duration) {
+	this.now = this.now.Add(duration)
+}
+
+func newTestLimiter() (*LoginLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	options := DefaultLimiterOptions()
+	options.MaxFailures = 3
+	options.Now = clock.Now
+	return NewLoginLimiter(options), clock
+}
+
+func TestLimiterBackoff(t *testing.T) {
+	limiter, clock := newTestLimiter()
+
+	if limiter.Check("admin", "10.0.0.1") != nil {
+		t.Error("Wrong behavior of Check function")
+	}
+
+	limiter.Fail("admin", "10.0.0.1")
+	lockout := limiter.Check("admin", "10.0.0.2")
+	if lockout == nil || lockout.Key != "user:admin" || lockout.Locked || !lockout.Until.Equal(clock.Now().Add(time.Second)) {
+		t.Error("Login should be delayed after a failure", lockout)
+	}
+	if limiter.Check("other", "10.0.0.1") == nil {
+		t.Error("Login from the same address should be delayed after a failure")
+	}
+
+	clock.Advance(time.Second)
+	if limiter.Check("admin", "10.0.0.1") != nil {
+		t.Error("Login should be allowed after the delay")
+	}
+
+	limiter.Fail("admin", "10.0.0.1")
+	clock.Advance(time.Second)
+	if limiter.Check("admin", "") == nil {
+		t.Error("Delay should be doubled by the second failure")
+	}
+	clock.Advance(time.Second)
+	if limiter.Check("admin", "") != nil {
+		t.Error("Login should be allowed after the doubled delay")
+	}
+
+	limiter.Succeed("admin")
+	if limiter.Check("admin", "") != nil || limiter.Check("", "10.0.0.1") != nil {
+		t.Error("Wrong behavior of Succeed function")
+	}
+	list := limiter.List()
+	if len(list) != 1 || list[0].Key != "ip:10.0.0.1" || list[0].Failures != 2 {
+		t.Error("Failures of an address should be kept after a successful login", list)
+	}
+}
+
+func TestLimiterLockout(t *testing.T) {
+	limiter, clock := newTestLimiter()
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Minute)
+		limiter.Fail("admin", "")
+	}
+
+	lockout := limiter.Check("admin", "")
+	if lockout == nil || !lockout.Locked || lockout.Failures != 3 {
+		t.Error("User should be locked out after MaxFailures failures", lockout)
+	}
+	clock.Advance(DEFAULT_LOCKOUT - time.Second)
+	if limiter.Check("admin", "") == nil {
+		t.Error("User should be locked out till the end of the lockout")
+	}
+	clock.Advance(time.Second)
+	if limiter.Check("admin", "") != nil {
+		t.Error("User should not be locked out after the lockout")
+	}
+
+	limiter.Fail("admin", "")
+	if lockout = limiter.Check("admin", ""); lockout == nil || lockout.Locked || lockout.Failures != 1 {
+		t.Error("Failures should be counted from the beginning after the lockout", lockout)
+	}
+
+	limiter.Fail("other", "")
+	clock.Advance(DEFAULT_FAILURE_WINDOW - time.Second)
+	limiter.Fail("other", "")
+	if lockout = limiter.Check("other", ""); lockout == nil || lockout.Failures != 2 {
+		t.Error("Failures should be counted till the failure window passes", lockout)
+	}
+	clock.Advance(DEFAULT_FAILURE_WINDOW)
+	limiter.Fail("other", "")
+	if lockout = limiter.Check("other", ""); lockout == nil || lockout.Failures != 1 {
+		t.Error("Failures should be forgotten after the failure window", lockout)
+	}
+
+	clock.Advance(DEFAULT_FAILURE_WINDOW)
+	if len(limiter.List()) != 0 {
+		t.Error("Forgotten failures should not be listed", limiter.List())
+	}
+}
+
+func TestLimiterMaxDelay(t *testing.T) {
+	limiter, clock := newTestLimiter()
+	limiter.options.MaxFailures = 100
+
+	for i := 0; i < 10; i++ {
+		limiter.Fail("admin", "")
+	}
+	lockout := limiter.Check("admin", "")
+	if lockout == nil || !lockout.Until.Equal(clock.Now().Add(DEFAULT_MAX_DELAY)) {
+		t.Error("Delay should not exceed MaxDelay", lockout)
+	}
+}
+
+func TestLimiterClear(t *testing.T) {
+	limiter, _ := newTestLimiter()
+	limiter.Fail("admin", "10.0.0.1")
+	limiter.Fail("other", "")
+
+	if !limiter.Clear("user:admin") || limiter.Check("admin", "") != nil {
+		t.Error("Wrong behavior of Clear function")
+	}
+	if limiter.Clear("user:admin") {
+		t.Error("Cleared failures should not be cleared again")
+	}
+	if limiter.Check("", "10.0.0.1") == nil {
+		t.Error("Failures of an address should not be cleared with a user")
+	}
+
+	if !limiter.Clear("all") || len(limiter.List()) != 0 {
+		t.Error("All failures should be cleared")
+	}
+}
@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	NONCE_SIZE = 18
+
+	//GS2 header of a client that doesn't use channel binding.
+	GS2_HEADER = "n,,"
+)
+
+//Returned when a client proof or a server signature doesn't match.
+var ErrWrongProof = errors.New("User/password pair is incorrect")
+
+//Key of fake verifiers of unknown users, it is random for every process.
+var fakeKey = randomBytes(32)
+
+//Server side of a SCRAM-SHA-256 exchange (RFC 5802 without channel binding).
+//
+//	client: n,,n=<user>,r=<client nonce>
+//	server: r=<client nonce><server nonce>,s=<salt>,i=<iterations>
+//	client: c=biws,r=<nonce>,p=<client proof>
+//	server: v=<server signature>
+//
+//Neither a password nor its verifier is sent, a client proves that it knows the password and the server proves that it knows the verifier.
+type ScramServer struct {
+	user            string
+	verifier        *Verifier
+	clientFirstBare string
+	serverFirst     string
+	nonce           string
+}
+
+//Starts an exchange with a client-first message, verifiers of users are returned by <lookup>.
+//Unknown users get a challenge of a fake verifier, so they cannot be told apart from a wrong password.
+func NewScramServer(clientFirst string, lookup func(name string) *Verifier) (*ScramServer, error) {
+	if !strings.HasPrefix(clientFirst, GS2_HEADER) {
+		return nil, errors.New("Channel binding is not supported")
+	}
+
+	clientFirstBare := clientFirst[len(GS2_HEADER):]
+	attrs, err := parseAttributes(clientFirstBare, "n", "r")
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := decodeName(attrs["n"])
+	if err != nil {
+		return nil, err
+	}
+
+	verifier := lookup(user)
+	if verifier == nil {
+		verifier = fakeVerifier(user)
+	}
+
+	server := new(ScramServer)
+	server.user = user
+	server.verifier = verifier
+	server.clientFirstBare = clientFirstBare
+	server.nonce = attrs["r"] + base64.RawStdEncoding.EncodeToString(randomBytes(NONCE_SIZE))
+	server.serverFirst = fmt.Sprintf("r=%v,s=%v,i=%d", server.nonce, base64.StdEncoding.EncodeToString(verifier.Salt), verifier.Iterations)
+	return server, nil
+}
+
+//Returns the name of a user that logs in.
+func (this *ScramServer) User() string {
+	return this.user
+}
+
+//Returns the server-first message, a challenge for the client.
+func (this *ScramServer) ServerFirst() string {
+	return this.serverFirst
+}
+
+//Checks a client-final message and returns the server-final message.
+//Returns ErrWrongProof if the client doesn't know the password.
+func (this *ScramServer) Finish(clientFinal string) (string, error) {
+	index := strings.LastIndex(clientFinal, ",p=")
+	if index < 0 {
+		return "", errors.New("Client proof is missing")
+	}
+	clientFinalWithoutProof := clientFinal[:index]
+
+	attrs, err := parseAttributes(clientFinalWithoutProof, "c", "r")
+	if err != nil {
+		return "", err
+	}
+	if attrs["c"] != base64.StdEncoding.EncodeToString([]byte(GS2_HEADER)) || attrs["r"] != this.nonce {
+		return "", ErrWrongProof
+	}
+
+	proof, err := base64.StdEncoding.DecodeString(clientFinal[index+len(",p="):])
+	if err != nil || len(proof) != sha256.Size {
+		return "", ErrWrongProof
+	}
+
+	authMessage := this.clientFirstBare + "," + this.serverFirst + "," + clientFinalWithoutProof
+	clientKey := xor(proof, computeHmac(this.verifier.StoredKey, authMessage))
+	storedKey := sha256.Sum256(clientKey)
+	if !hmac.Equal(storedKey[:], this.verifier.StoredKey) {
+		return "", ErrWrongProof
+	}
+
+	return "v=" + base64.StdEncoding.EncodeToString(computeHmac(this.verifier.ServerKey, authMessage)), nil
+}
+
+//Client side of a SCRAM-SHA-256 exchange, see ScramServer.
+type ScramClient struct {
+	user            string
+	hash            string
+	clientFirstBare string
+	serverSignature []byte
+}
+
+//Creates a client of a user with a passed password.
+func NewScramClient(user, password string) *ScramClient {
+	client := new(ScramClient)
+	client.user = user
+	client.hash = EncryptPass(password)
+	client.clientFirstBare = fmt.Sprintf("n=%v,r=%v", encodeName(user), base64.RawStdEncoding.EncodeToString(randomBytes(NONCE_SIZE)))
+	return client
+}
+
+//Returns the client-first message that starts an exchange.
+func (this *ScramClient) ClientFirst() string {
+	return GS2_HEADER + this.clientFirstBare
+}
+
+//Answers a challenge of the server with the client-final message that contains a proof of the password.
+func (this *ScramClient) ClientFinal(serverFirst string) (string, error) {
+	attrs, err := parseAttributes(serverFirst, "r", "s", "i")
+	if err != nil {
+		return "", err
+	}
+
+	clientNonce := this.clientFirstBare[strings.Index(this.clientFirstBare, ",r=")+len(",r="):]
+	if !strings.HasPrefix(attrs["r"], clientNonce) || len(attrs["r"]) == len(clientNonce) {
+		return "", errors.New("Server nonce is invalid")
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil {
+		return "", errors.New("Salt is invalid")
+	}
+
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations < MIN_ITERATIONS {
+		return "", errors.New(fmt.Sprintf("Invalid number of iterations [%v]", attrs["i"]))
+	}
+
+	saltedPass, err := saltPassword(this.hash, salt, iterations)
+	if err != nil {
+		return "", err
+	}
+
+	clientKey := computeHmac(saltedPass, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	clientFinalWithoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte(GS2_HEADER)) + ",r=" + attrs["r"]
+	authMessage := this.clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof
+
+	proof := xor(clientKey, computeHmac(storedKey[:], authMessage))
+	this.serverSignature = computeHmac(computeHmac(saltedPass, "Server Key"), authMessage)
+	return clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+//Checks the server-final message, so a client knows that the server has the verifier of the user.
+func (this *ScramClient) Verify(serverFinal string) error {
+	attrs, err := parseAttributes(serverFinal, "v")
+	if err != nil {
+		return err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(attrs["v"])
+	if err != nil || this.serverSignature == nil || !hmac.Equal(signature, this.serverSignature) {
+		return ErrWrongProof
+	}
+	return nil
+}
+
+//Parses a message of comma-separated "<name>=<value>" attributes.
+//Returns an error if one of <required> attributes is missing, unknown attributes are ignored.
+func parseAttributes(message string, required ...string) (map[string]string, error) {
+	attrs := make(map[string]string)
+	for _, attr := range strings.Split(message, ",") {
+		if len(attr) < 2 || attr[1] != '=' {
+			return nil, errors.New(fmt.Sprintf("Invalid attribute [%v]", attr))
+		}
+		attrs[attr[:1]] = attr[2:]
+	}
+
+	for _, name := range required {
+		if _, ok := attrs[name]; !ok {
+			return nil, errors.New(fmt.Sprintf("Attribute [%v] is missing", name))
+		}
+	}
+	return attrs, nil
+}
+
+//Escapes "=" and "," in a user name as RFC 5802 requires.
+func encodeName(name string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(name)
+}
+
+func decodeName(name string) (string, error) {
+	decoded := strings.NewReplacer("=3D", "=", "=2C", ",").Replace(name)
+	if strings.Count(name, "=") != strings.Count(name, "=3D")+strings.Count(name, "=2C") {
+		return "", errors.New("Invalid user name")
+	}
+	return decoded, nil
+}
+
+//Creates a verifier of an unknown user that no password matches.
+//The salt depends on the name only, so repeated challenges of the same user look the same.
+func fakeVerifier(name string) *Verifier {
+	salt := computeHmac(fakeKey, "Salt "+name)
+	return &Verifier{
+		Iterations: DEFAULT_ITERATIONS,
+		Salt:       salt[:SALT_SIZE],
+		StoredKey:  computeHmac(fakeKey, "Stored Key "+name),
+		ServerKey:  computeHmac(fakeKey, "Server Key "+name),
+	}
+}
+
+func xor(a, b []byte) []byte {
+	result := make([]byte, len(a))
+	for i := range a {
+		result[i] = a[i] ^ b[i]
+	}
+	return result
+}
+
+func randomBytes(size int) []byte {
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//Runs a SCRAM exchange of a client with a password <password> against a server that knows <verifier>.
+func runExchange(t *testing.T, verifier *Verifier, password string) (*ScramClient, string, error) {
+	client := NewScramClient("admin", password)
+	server, err := NewScramServer(client.ClientFirst(), func(name string) *Verifier {
+		if name == "admin" {
+			return verifier
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("Unexpected error during starting exchange", err)
+	}
+
+	clientFinal, err := client.ClientFinal(server.ServerFirst())
+	if err != nil {
+		t.Fatal("Unexpected error during answering challenge", err)
+	}
+
+	serverFinal, err := server.Finish(clientFinal)
+	return client, serverFinal, err
+}
+
+func TestVerifier(t *testing.T) {
+	verifier, err := NewVerifier("secret", MIN_ITERATIONS)
+	if err != nil {
+		t.Fatal("Unexpected error during creating verifier", err)
+	}
+
+	if !verifier.Check("secret") || verifier.Check("wrong") {
+		t.Error("Wrong behavior of Check function")
+	}
+
+	value := verifier.String()
+	if !strings.HasPrefix(value, "$"+VERIFIER_TAG+"$4096$") || !IsVerifier(value) || strings.Contains(value, EncryptPass("secret")) {
+		t.Error("Wrong format of a verifier", value)
+	}
+
+	parsed, err := ParseVerifier(value)
+	if err != nil || parsed.String() != value || !parsed.Check("secret") {
+		t.Error("Wrong behavior of ParseVerifier function", err)
+	}
+
+	_, err = ParseVerifier("$bcrypt$10$abc")
+	if err == nil {
+		t.Error("Unknown hashing scheme should not be parsed")
+	}
+
+	_, err = NewVerifier("secret", MIN_ITERATIONS-1)
+	if err == nil {
+		t.Error("Too few iterations should not be accepted")
+	}
+
+	other, _ := NewVerifier("secret", MIN_ITERATIONS)
+	if other.String() == value {
+		t.Error("Verifiers of the same password should have different salts")
+	}
+}
+
+func TestScramExchange(t *testing.T) {
+	verifier, _ := NewVerifier("secret", MIN_ITERATIONS)
+
+	client, serverFinal, err := runExchange(t, verifier, "secret")
+	if err != nil {
+		t.Fatal("Right password should be accepted", err)
+	}
+	if client.Verify(serverFinal) != nil {
+		t.Error("Server signature should be accepted")
+	}
+	if client.Verify("v=AAAA") != ErrWrongProof {
+		t.Error("Wrong server signature should not be accepted")
+	}
+
+	_, _, err = runExchange(t, verifier, "wrong")
+	if err != ErrWrongProof {
+		t.Error("Wrong password should not be accepted", err)
+	}
+
+	_, _, err = runExchange(t, nil, "secret")
+	if err != ErrWrongProof {
+		t.Error("Unknown user should not be accepted", err)
+	}
+}
+
+func TestScramServerRejectsReplayedProof(t *testing.T) {
+	verifier, _ := NewVerifier("secret", MIN_ITERATIONS)
+	lookup := func(name string) *Verifier {
+		return verifier
+	}
+
+	client := NewScramClient("admin", "secret")
+	server, _ := NewScramServer(client.ClientFirst(), lookup)
+	clientFinal, _ := client.ClientFinal(server.ServerFirst())
+
+	otherServer, _ := NewScramServer(client.ClientFirst(), lookup)
+	_, err := otherServer.Finish(clientFinal)
+	if err != ErrWrongProof {
+		t.Error("Proof of another exchange should not be accepted", err)
+	}
+}
+
+func TestScramClientRejectsWeakChallenge(t *testing.T) {
+	client := NewScramClient("admin", "secret")
+	nonce := client.ClientFirst()[strings.Index(client.ClientFirst(), ",r=")+3:]
+
+	_, err := client.ClientFinal("r=" + nonce + "abc,s=c2FsdA==,i=1")
+	if err == nil {
+		t.Error("Too few iterations should not be accepted")
+	}
+
+	_, err = client.ClientFinal("r=other,s=c2FsdA==,i=4096")
+	if err == nil {
+		t.Error("Nonce of another client should not be accepted")
+	}
+}
+
+func TestUserNames(t *testing.T) {
+	name, err := decodeName(encodeName("a=b,c"))
+	if err != nil || name != "a=b,c" {
+		t.Error("Wrong behavior of encodeName/decodeName functions")
+	}
+
+	_, err = decodeName("a=b")
+	if err == nil {
+		t.Error("Wrong behavior of decodeName function")
+	}
+}
+
+//Returns <true> if a stored <user> has a verifier of a <password>.
+func checkStoredUser(user *User, password string) bool {
+	if user == nil {
+		return false
+	}
+	verifier, err := user.Verifier()
+	return err == nil && verifier.Check(password)
+}
+
+func TestMigrateUsersFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+	legacy := `[{"Name": "admin", "Pass": "` + EncryptPass("secret") + `"}]`
+	os.WriteFile(path, []byte(legacy), 0600)
+
+	users, err := ReadUsersFile(path)
+	if err != nil {
+		t.Fatal("Unexpected error during reading users", err)
+	}
+	if !checkStoredUser(users["admin"], "secret") {
+		t.Error("Old entry was not migrated")
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), EncryptPass("secret")) || !strings.Contains(string(data), VERIFIER_TAG) {
+		t.Error("Users file was not rewritten", string(data))
+	}
+
+	users, err = ReadUsersFile(path)
+	if err != nil || !checkStoredUser(users["admin"], "secret") {
+		t.Error("Migrated file was not read", err)
+	}
+}
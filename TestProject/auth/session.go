@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	SESSION_KEY_FILE = "session.key"
+	SESSION_KEY_SIZE = 32
+
+	//How long a session token can be used to resume a session.
+	SESSION_TTL = 12 * time.Hour
+)
+
+//Returned when a session token is forged, expired or revoked.
+var ErrInvalidSession = errors.New("Session is invalid or expired")
+
+//Session of a user that a client can resume on another connection without a password.
+type Session struct {
+	User      string
+	IsMachine bool `json:",omitempty"`
+	IssuedAt  int64
+	ExpiresAt int64
+}
+
+//Issues and checks session tokens: "<base64 Json of Session>.<base64 HMAC-SHA256 of it>".
+//Tokens are not stored by the server, they are revoked per user, see UserStore.RevokeSessions().
+type SessionSigner struct {
+	key []byte
+	ttl time.Duration
+}
+
+//Creates a signer of tokens that are valid for <ttl> with a secret <key>.
+func NewSessionSigner(key []byte, ttl time.Duration) *SessionSigner {
+	signer := new(SessionSigner)
+	signer.key = key
+	signer.ttl = ttl
+	return signer
+}
+
+//Reads a secret key of session tokens from a file <fileName>, a random key is created if the file doesn't exist.
+//The key is kept in a file, so sessions can be resumed after the server is restarted.
+func LoadSessionKey(fileName string) ([]byte, error) {
+	key, err := os.ReadFile(fileName)
+	if err == nil {
+		if len(key) < SESSION_KEY_SIZE {
+			return nil, errors.New("Session key is too short")
+		}
+		return key, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key = randomBytes(SESSION_KEY_SIZE)
+	return key, os.WriteFile(fileName, key, 0600)
+}
+
+//Issues a token of a new session of a user.
+func (this *SessionSigner) Issue(user string, isMachine bool) (string, error) {
+	now := time.Now()
+	payload, err := json.Marshal(Session{User: user, IsMachine: isMachine, IssuedAt: now.UnixNano(), ExpiresAt: now.Add(this.ttl).UnixNano()})
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(computeHmac(this.key, encoded)), nil
+}
+
+//Checks a signature and expiration time of a token and returns its session.
+//Returns ErrInvalidSession if the token cannot be used, revocation has to be checked by a caller.
+func (this *SessionSigner) Parse(token string) (*Session, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidSession
+	}
+
+	expected, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, computeHmac(this.key, encoded)) {
+		return nil, ErrInvalidSession
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+	session := new(Session)
+	err = json.Unmarshal(payload, session)
+	if err != nil || time.Now().UnixNano() >= session.ExpiresAt {
+		return nil, ErrInvalidSession
+	}
+	return session, nil
+}
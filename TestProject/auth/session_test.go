@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionSigner(t *testing.T) {
+	signer := NewSessionSigner(randomBytes(SESSION_KEY_SIZE), time.Hour)
+
+	token, err := signer.Issue("admin", true)
+	if err != nil {
+		t.Fatal("Unexpected error during issuing token", err)
+	}
+
+	session, err := signer.Parse(token)
+	if err != nil || session.User != "admin" || !session.IsMachine {
+		t.Error("Wrong behavior of Parse function", err)
+	}
+
+	_, err = NewSessionSigner(randomBytes(SESSION_KEY_SIZE), time.Hour).Parse(token)
+	if err != ErrInvalidSession {
+		t.Error("Token of another key should not be accepted", err)
+	}
+
+	other, _ := signer.Issue("other", true)
+	_, err = signer.Parse(other[:len(other)/2] + token[len(token)/2:])
+	if err != ErrInvalidSession {
+		t.Error("Forged token should not be accepted", err)
+	}
+
+	expired, _ := NewSessionSigner(signer.key, -time.Second).Issue("admin", true)
+	_, err = signer.Parse(expired)
+	if err != ErrInvalidSession {
+		t.Error("Expired token should not be accepted", err)
+	}
+}
+
+func TestRevokeSessions(t *testing.T) {
+	signer := NewSessionSigner(randomBytes(SESSION_KEY_SIZE), time.Hour)
+	store := NewUserStore(map[string]*User{"admin": {Name: "admin"}})
+
+	token, _ := signer.Issue("admin", false)
+	session, _ := signer.Parse(token)
+	if store.FindBySession(session) == nil {
+		t.Error("Wrong behavior of FindBySession function")
+	}
+
+	store.RevokeSessions("admin")
+	if store.FindBySession(session) != nil {
+		t.Error("Revoked session should not be accepted")
+	}
+
+	token, _ = signer.Issue("admin", false)
+	session, _ = signer.Parse(token)
+	if store.FindBySession(session) == nil {
+		t.Error("Session issued after revocation should be accepted")
+	}
+
+	store.Delete("admin")
+	if store.FindBySession(session) != nil {
+		t.Error("Session of a removed user should not be accepted")
+	}
+
+	store.Add("admin", "secret")
+	if store.FindBySession(session) != nil {
+		t.Error("Session of a removed user should not be accepted for a new user of the same name")
+	}
+	token, _ = signer.Issue("admin", false)
+	session, _ = signer.Parse(token)
+	if store.FindBySession(session) == nil {
+		t.Error("Session of a new user should be accepted")
+	}
+}
+
+func TestLoadSessionKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SESSION_KEY_FILE)
+
+	key, err := LoadSessionKey(path)
+	if err != nil || len(key) != SESSION_KEY_SIZE {
+		t.Fatal("Session key was not created", err)
+	}
+
+	loaded, err := LoadSessionKey(path)
+	if err != nil || !bytes.Equal(key, loaded) {
+		t.Error("Session key was not read from the file", err)
+	}
+
+	os.WriteFile(path, []byte("short"), 0600)
+	_, err = LoadSessionKey(path)
+	if err == nil {
+		t.Error("Short session key should not be accepted")
+	}
+}
@@ -0,0 +1,301 @@
+package auth
+
+import (
+	"TestProject/utils"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Returned when a user doesn't exist.
+var ErrUnknownUser = errors.New("Unknown user")
+
+//Returned when a user already exists.
+var ErrUserExists = errors.New("User already exists")
+
+//Users with their permissions and password verifiers that are stored in a file.
+//Every change is written into the file atomically, the file can be reloaded when it is changed by somebody else.
+//Users are returned as copies, so a connection keeps permissions it got at login while the store changes.
+type UserStore struct {
+	lock     sync.RWMutex
+	fileName string
+	users    map[string]*User
+	modTime  time.Time
+}
+
+//Opens a store of users kept in a file <fileName>.
+func OpenUserStore(fileName string) (*UserStore, error) {
+	store := new(UserStore)
+	store.fileName = fileName
+	err := store.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+//Creates a store of passed <users> that is not backed by a file, changes are kept in memory only.
+func NewUserStore(users map[string]*User) *UserStore {
+	store := new(UserStore)
+	store.users = users
+	return store
+}
+
+//Reads the file of the store again, a file with errors is rejected and current users are kept.
+func (this *UserStore) Reload() error {
+	users, err := ReadUsersFile(this.fileName)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(this.fileName)
+	if err != nil {
+		return err
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.users = users
+	this.modTime = info.ModTime()
+	return nil
+}
+
+//Checks the file of the store every <interval> and reloads it if it was changed, errors are written into <log>.
+//Returns a function that stops watching.
+func (this *UserStore) Watch(interval time.Duration, log *slog.Logger) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if !this.changed() {
+					continue
+				}
+				if err := this.Reload(); err != nil {
+					log.Error("Cannot reload users", utils.LOG_ERROR, err)
+				} else {
+					log.Info("Users were reloaded")
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func (this *UserStore) changed() bool {
+	info, err := os.Stat(this.fileName)
+	if err != nil {
+		return false
+	}
+
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return !info.ModTime().Equal(this.modTime)
+}
+
+//Returns a copy of a user, or <nil> if the user doesn't exist.
+func (this *UserStore) Get(name string) *User {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	user := this.users[name]
+	if user == nil {
+		return nil
+	}
+	copied := *user
+	return &copied
+}
+
+//Returns a copy of a user a verified client certificate belongs to,
+//or <nil> if no user or more than one user matches the certificate.
+func (this *UserStore) FindByCertificate(cert *x509.Certificate) *User {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	var found *User
+	for _, user := range this.users {
+		if !user.MatchesCertificate(cert) {
+			continue
+		}
+		if found != nil {
+			return nil
+		}
+		found = user
+	}
+	if found == nil {
+		return nil
+	}
+	copied := *found
+	return &copied
+}
+
+//Returns copies of all users sorted by name, password verifiers are not returned.
+func (this *UserStore) List() []User {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	list := make([]User, 0, len(this.users))
+	for _, user := range this.users {
+		copied := *user
+		copied.Pass = ""
+		list = append(list, copied)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+//Adds a new user with a passed <password> and no permissions.
+//Sessions issued before, e.g. to a removed user of the same name, are not accepted for the new user.
+func (this *UserStore) Add(name, password string) error {
+	if name == "" {
+		return errors.New("User name is empty")
+	}
+	verifier, err := NewVerifier(password, DEFAULT_ITERATIONS)
+	if err != nil {
+		return err
+	}
+
+	return this.update(func(users map[string]*User) error {
+		if users[name] != nil {
+			return ErrUserExists
+		}
+		users[name] = &User{Name: name, Pass: verifier.String(), SessionsNotBefore: time.Now().UnixNano()}
+		return nil
+	})
+}
+
+//Removes a user, connections of the user are not closed.
+func (this *UserStore) Delete(name string) error {
+	return this.update(func(users map[string]*User) error {
+		if users[name] == nil {
+			return ErrUnknownUser
+		}
+		delete(users, name)
+		return nil
+	})
+}
+
+//Changes a password of a user, sessions of the user are revoked.
+func (this *UserStore) SetPassword(name, password string) error {
+	verifier, err := NewVerifier(password, DEFAULT_ITERATIONS)
+	if err != nil {
+		return err
+	}
+
+	return this.update(func(users map[string]*User) error {
+		if users[name] == nil {
+			return ErrUnknownUser
+		}
+		users[name].Pass = verifier.String()
+		users[name].SessionsNotBefore = time.Now().UnixNano()
+		return nil
+	})
+}
+
+//Revokes all sessions of a user issued so far, connections that are already open are not closed.
+func (this *UserStore) RevokeSessions(name string) error {
+	return this.update(func(users map[string]*User) error {
+		if users[name] == nil {
+			return ErrUnknownUser
+		}
+		users[name].SessionsNotBefore = time.Now().UnixNano()
+		return nil
+	})
+}
+
+//Returns a copy of the user of a session, or <nil> if the user doesn't exist anymore or the session is revoked.
+func (this *UserStore) FindBySession(session *Session) *User {
+	user := this.Get(session.User)
+	if user == nil || session.IssuedAt < user.SessionsNotBefore {
+		return nil
+	}
+	return user
+}
+
+//Replaces permissions of a user with permissions of <permissions>, a name and a password of the user are not changed.
+func (this *UserStore) Grant(name string, permissions User) error {
+	permissions.Name = name
+	err := permissions.validate()
+	if err != nil {
+		return err
+	}
+
+	return this.update(func(users map[string]*User) error {
+		if users[name] == nil {
+			return ErrUnknownUser
+		}
+		permissions.Pass = users[name].Pass
+		permissions.SessionsNotBefore = users[name].SessionsNotBefore
+		users[name] = &permissions
+		return nil
+	})
+}
+
+//Applies a change to a copy of users and writes the result into the file, users are replaced only if the file is written.
+func (this *UserStore) update(change func(users map[string]*User) error) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	users := make(map[string]*User, len(this.users))
+	for name, user := range this.users {
+		copied := *user
+		users[name] = &copied
+	}
+	err := change(users)
+	if err != nil {
+		return err
+	}
+
+	if this.fileName != "" {
+		list := make([]User, 0, len(users))
+		for _, user := range users {
+			list = append(list, *user)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].Name < list[j].Name
+		})
+
+		err = WriteUsersFile(this.fileName, list)
+		if err != nil {
+			return err
+		}
+		if info, statErr := os.Stat(this.fileName); statErr == nil {
+			this.modTime = info.ModTime()
+		}
+	}
+
+	this.users = users
+	return nil
+}
+
+//Parses permissions of "user-grant" command: "cache=<pattern>", "category=<name>", "cert=<certificate name>", "readonly" and "admin".
+func ParsePermissions(params []string) (User, error) {
+	var permissions User
+	for _, param := range params {
+		if pattern, ok := strings.CutPrefix(param, "cache="); ok && pattern != "" {
+			permissions.Caches = append(permissions.Caches, pattern)
+		} else if category, ok := strings.CutPrefix(param, "category="); ok && category != "" {
+			permissions.Categories = append(permissions.Categories, category)
+		} else if name, ok := strings.CutPrefix(param, "cert="); ok && name != "" {
+			permissions.Certificates = append(permissions.Certificates, name)
+		} else if param == "readonly" {
+			permissions.ReadOnly = true
+		} else if param == "admin" {
+			permissions.Admin = true
+		} else {
+			return permissions, errors.New(fmt.Sprintf("Unknown permission [%v]", param))
+		}
+	}
+	return permissions, nil
+}
@@ -1,27 +1,123 @@
 package auth
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
+)
+
+const (
+	USERS_FILE = "users"
+
+	//Categories of commands a user can be allowed to execute.
+	CATEGORY_LIST  = "list"
+	CATEGORY_DICT  = "dict"
+	CATEGORY_ADMIN = "admin"
 )
 
 //Defines a serializable structure that can be sent between client and server,
 //or that can be stored.
+//A stored user has a password verifier as Pass and permissions, a client that logs in sends the client-first message of a SCRAM exchange as Scram.
+//A client asks for a session token with Session, or resumes a session with a Token instead of a password.
 type User struct {
 	Name      string
-	Pass      string
-	IsMachine bool
+	Pass      string `json:",omitempty"`
+	IsMachine bool   `json:",omitempty"`
+	Scram     string `json:",omitempty"`
+	Session   bool   `json:",omitempty"`
+	Token     string `json:",omitempty"`
+
+	//Patterns of names of caches a user can connect to, the syntax of path.Match is used, e.g. "*" or "team-*".
+	//A user without patterns cannot connect to any cache.
+	Caches []string `json:",omitempty"`
+
+	//A read-only user cannot change caches.
+	ReadOnly bool `json:",omitempty"`
+
+	//Categories of commands a user can execute besides commands of string values and keys: "list", "dict", "admin".
+	Categories []string `json:",omitempty"`
+
+	//An admin can connect to any cache and execute any command.
+	Admin bool `json:",omitempty"`
+
+	//Names of client certificates a user logs in with instead of a password:
+	//a common name of the subject, a DNS name, an email or a URI of SAN, e.g. "spiffe://example.org/billing".
+	Certificates []string `json:",omitempty"`
+
+	//Sessions issued before this time in Unix nanoseconds are revoked.
+	SessionsNotBefore int64 `json:",omitempty"`
+}
+
+//Returns <true> if a user can connect to a cache with passed <cacheId>.
+func (this *User) CanAccessCache(cacheId string) bool {
+	if this.Admin {
+		return true
+	}
+	for _, pattern := range this.Caches {
+		if matched, _ := path.Match(pattern, cacheId); matched {
+			return true
+		}
+	}
+	return false
+}
+
+//Returns <true> if a user can execute a command of passed <category>, an empty category is used for commands of string values and keys.
+//Commands that change caches are <mutating>.
+func (this *User) CanExecute(category string, mutating bool) bool {
+	if this.Admin {
+		return true
+	}
+	if mutating && this.ReadOnly {
+		return false
+	}
+	if category == "" {
+		return true
+	}
+	for _, c := range this.Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+//Checks that cache patterns and categories of a user are valid.
+func (this *User) validate() error {
+	for _, pattern := range this.Caches {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.New(fmt.Sprintf("Invalid cache pattern [%v] of the user [%v]", pattern, this.Name))
+		}
+	}
+	for _, category := range this.Categories {
+		switch category {
+		case CATEGORY_LIST, CATEGORY_DICT, CATEGORY_ADMIN:
+		default:
+			return errors.New(fmt.Sprintf("Unknown command category [%v] of the user [%v]", category, this.Name))
+		}
+	}
+	return nil
 }
 
 //Reads the list of users allowed to connect to the In-memory cache
-func ReadUsers() (map[string]string, error) {
-	file, err := os.Open("users")
+func ReadUsers() (map[string]*User, error) {
+	return ReadUsersFile(USERS_FILE)
+}
+
+//Reads users with their permissions and password verifiers from a file <fileName>.
+//Entries of the old format that contain EncryptPass hashes are converted to verifiers and the file is rewritten,
+//so unsalted hashes don't stay on a disk.
+func ReadUsersFile(fileName string) (map[string]*User, error) {
+	file, err := os.Open(fileName)
 	if err != nil {
 		return nil, err
 	}
 
 	data, err := ioutil.ReadAll(file)
+	file.Close()
 	if err != nil {
 		return nil, err
 	}
@@ -32,14 +128,69 @@ func ReadUsers() (map[string]string, error) {
 		return nil, err
 	}
 
-	m := make(map[string]string)
+	migrated := false
+	m := make(map[string]*User)
 	for i := range users {
-		m[users[i].Name] = users[i].Pass
+		err = users[i].validate()
+		if err != nil {
+			return nil, err
+		}
+
+		var verifier *Verifier
+		if IsVerifier(users[i].Pass) {
+			verifier, err = ParseVerifier(users[i].Pass)
+		} else {
+			verifier, err = NewVerifierFromHash(users[i].Pass, DEFAULT_ITERATIONS)
+			migrated = true
+		}
+		if err != nil {
+			return nil, err
+		}
+		users[i].Pass = verifier.String()
+		m[users[i].Name] = &users[i]
+	}
+
+	if migrated {
+		err = WriteUsersFile(fileName, users)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return m, nil
 }
 
+//Writes users into a file <fileName>, one user per line.
+//The file is replaced atomically and is readable by its owner only.
+func WriteUsersFile(fileName string, users []User) error {
+	var buf bytes.Buffer
+	buf.WriteString("[\n")
+	for i := range users {
+		data, err := UserToJson(&users[i])
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		if i < len(users)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("]\n")
+
+	tmpPath := fileName + ".tmp"
+	err := os.WriteFile(tmpPath, buf.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, fileName)
+}
+
+//Returns the password verifier of a stored user.
+func (this *User) Verifier() (*Verifier, error) {
+	return ParseVerifier(this.Pass)
+}
+
 //Converts Json string to User structure
 func JsonToUser(jsonUserData []byte) (*User, error) {
 	var user User
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCanAccessCache(t *testing.T) {
+	user := &User{Name: "user", Caches: []string{"team-*", "shared"}}
+
+	if !user.CanAccessCache("team-a") || !user.CanAccessCache("shared") || user.CanAccessCache("private") {
+		t.Error("Wrong behavior of CanAccessCache function")
+	}
+
+	if (&User{Name: "user"}).CanAccessCache("shared") {
+		t.Error("User without patterns should not access caches")
+	}
+
+	if !(&User{Name: "admin", Admin: true}).CanAccessCache("private") {
+		t.Error("Admin should access any cache")
+	}
+}
+
+func TestCanExecute(t *testing.T) {
+	user := &User{Name: "user", Categories: []string{CATEGORY_LIST}}
+
+	if !user.CanExecute("", true) || !user.CanExecute(CATEGORY_LIST, true) || user.CanExecute(CATEGORY_DICT, false) || user.CanExecute(CATEGORY_ADMIN, true) {
+		t.Error("Wrong behavior of CanExecute function")
+	}
+
+	user.ReadOnly = true
+	if !user.CanExecute(CATEGORY_LIST, false) || user.CanExecute(CATEGORY_LIST, true) || user.CanExecute("", true) {
+		t.Error("Read-only user should not execute mutating commands")
+	}
+
+	if !(&User{Name: "admin", Admin: true, ReadOnly: true}).CanExecute(CATEGORY_ADMIN, true) {
+		t.Error("Admin should execute any command")
+	}
+}
+
+func TestReadUsersWithPermissions(t *testing.T) {
+	verifier, _ := NewVerifier("secret", MIN_ITERATIONS)
+	path := filepath.Join(t.TempDir(), "users")
+
+	os.WriteFile(path, []byte(`[{"Name": "user", "Pass": "`+verifier.String()+`", "Caches": ["team-*"], "ReadOnly": true, "Categories": ["dict"]}]`), 0600)
+	users, err := ReadUsersFile(path)
+	if err != nil || !users["user"].ReadOnly || !users["user"].CanAccessCache("team-a") || !users["user"].CanExecute(CATEGORY_DICT, false) {
+		t.Error("Permissions were not read", err)
+	}
+
+	os.WriteFile(path, []byte(`[{"Name": "user", "Pass": "`+verifier.String()+`", "Categories": ["unknown"]}]`), 0600)
+	_, err = ReadUsersFile(path)
+	if err == nil {
+		t.Error("Unknown category should not be accepted")
+	}
+
+	os.WriteFile(path, []byte(`[{"Name": "user", "Pass": "`+verifier.String()+`", "Caches": ["team-["]}]`), 0600)
+	_, err = ReadUsersFile(path)
+	if err == nil {
+		t.Error("Invalid cache pattern should not be accepted")
+	}
+}
+
+func TestUserStore(t *testing.T) {
+	verifier, _ := NewVerifier("secret", MIN_ITERATIONS)
+	path := filepath.Join(t.TempDir(), "users")
+	os.WriteFile(path, []byte(`[{"Name": "admin", "Pass": "`+verifier.String()+`", "Admin": true}]`), 0600)
+
+	store, err := OpenUserStore(path)
+	if err != nil || store.Get("admin") == nil || !store.Get("admin").Admin {
+		t.Fatal("Wrong behavior of OpenUserStore function", err)
+	}
+
+	err = store.Add("bob", "bobSecret")
+	if err != nil || store.Add("bob", "other") != ErrUserExists {
+		t.Error("Wrong behavior of Add function", err)
+	}
+
+	permissions, err := ParsePermissions([]string{"cache=team-*", "category=list", "readonly"})
+	if err != nil {
+		t.Fatal("Wrong behavior of ParsePermissions function", err)
+	}
+	err = store.Grant("bob", permissions)
+	if err != nil || store.Grant("unknown", permissions) != ErrUnknownUser {
+		t.Error("Wrong behavior of Grant function", err)
+	}
+
+	_, err = ParsePermissions([]string{"cache="})
+	if err == nil {
+		t.Error("Empty cache pattern should not be accepted")
+	}
+
+	reopened, err := OpenUserStore(path)
+	if err != nil || !checkStoredUser(reopened.Get("bob"), "bobSecret") || !reopened.Get("bob").CanAccessCache("team-a") || !reopened.Get("bob").ReadOnly {
+		t.Error("Changes were not written into the file", err)
+	}
+
+	list := store.List()
+	if len(list) != 2 || list[0].Name != "admin" || list[1].Name != "bob" || list[1].Pass != "" {
+		t.Error("Wrong behavior of List function", list)
+	}
+
+	err = store.SetPassword("bob", "changed")
+	if err != nil || !checkStoredUser(store.Get("bob"), "changed") {
+		t.Error("Wrong behavior of SetPassword function", err)
+	}
+
+	err = store.Delete("bob")
+	if err != nil || store.Get("bob") != nil || store.Delete("bob") != ErrUnknownUser {
+		t.Error("Wrong behavior of Delete function", err)
+	}
+
+	user := store.Get("admin")
+	user.Admin = false
+	if !store.Get("admin").Admin {
+		t.Error("Store should return copies of users")
+	}
+}
+
+func TestUserStoreReload(t *testing.T) {
+	verifier, _ := NewVerifier("secret", MIN_ITERATIONS)
+	path := filepath.Join(t.TempDir(), "users")
+	os.WriteFile(path, []byte(`[{"Name": "admin", "Pass": "`+verifier.String()+`"}]`), 0600)
+
+	store, err := OpenUserStore(path)
+	if err != nil {
+		t.Fatal("Unexpected error during opening store", err)
+	}
+	stop := store.Watch(10*time.Millisecond, slog.Default())
+	defer stop()
+
+	os.WriteFile(path, []byte(`[{"Name": "other", "Pass": "`+verifier.String()+`"}]`), 0600)
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	for i := 0; i < 100 && store.Get("other") == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if store.Get("other") == nil || store.Get("admin") != nil {
+		t.Error("Changed file was not reloaded")
+	}
+
+	os.WriteFile(path, []byte(`[{"Name": "broken", "Categories": ["unknown"]}]`), 0600)
+	if store.Reload() == nil || store.Get("other") == nil {
+		t.Error("Broken file should not replace users")
+	}
+}
+
+func TestFindByCertificate(t *testing.T) {
+	store := NewUserStore(map[string]*User{
+		"billing": {Name: "billing", Certificates: []string{"spiffe://example.org/billing"}},
+		"orders":  {Name: "orders", Certificates: []string{"orders", "shared"}},
+		"other":   {Name: "other", Certificates: []string{"shared"}},
+	})
+
+	uri, _ := url.Parse("spiffe://example.org/billing")
+	user := store.FindByCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "service"}, URIs: []*url.URL{uri}})
+	if user == nil || user.Name != "billing" {
+		t.Error("User should be found by URI of SAN", user)
+	}
+
+	user = store.FindByCertificate(&x509.Certificate{DNSNames: []string{"orders"}})
+	if user == nil || user.Name != "orders" {
+		t.Error("User should be found by DNS name", user)
+	}
+
+	if store.FindByCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "shared"}}) != nil {
+		t.Error("Certificate of several users should not be accepted")
+	}
+	if store.FindByCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "unknown"}}) != nil {
+		t.Error("Certificate without a user should not be accepted")
+	}
+}
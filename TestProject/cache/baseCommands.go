@@ -2,8 +2,6 @@ package cache
 
 import (
 	"TestProject/utils"
-	"errors"
-	"fmt"
 	"strconv"
 	"time"
 )
@@ -26,7 +24,7 @@ func BaseCommands(cache Cache) CacheCommands {
 func (this *BaseCacheCommands) RemoveValue(params []string) (interface{}, bool, error) {
 	length := len(params)
 	if length < 1 || length > 2 {
-		return nil, false, errors.New("Wrong params count")
+		return nil, false, wrongParamsCount()
 	}
 
 	if length == 1 {
@@ -40,26 +38,26 @@ func (this *BaseCacheCommands) RemoveValue(params []string) (interface{}, bool,
 func (this *BaseCacheCommands) UpdateValue(params []string) (bool, error) {
 	length := len(params)
 	if length < 3 || length > 4 {
-		return false, errors.New("Wrong params count")
+		return false, wrongParamsCount()
 	}
 
 	ttl := DEFAULT_TTL
 	if length == 4 {
 		value, err := strconv.Atoi(params[3])
 		if err != nil {
-			return false, err
+			return false, WrapError(BAD_ARGUMENTS, err)
 		} else {
 			ttl = value * int(time.Second)
 		}
 	}
 
-	return this.c.ReplaceValueExpirable(params[0], params[1], params[2], int64(ttl)), nil
+	return this.c.ReplaceValueExpirable(params[0], params[1], params[2], int64(ttl))
 }
 
 func (this *BaseCacheCommands) GetKeys(params []string) ([]string, error) {
 	length := len(params)
 	if length > 2 {
-		return nil, errors.New("Wrong params count")
+		return nil, wrongParamsCount()
 	}
 
 	keys := this.c.GetKeys()
@@ -70,11 +68,11 @@ func (this *BaseCacheCommands) GetKeys(params []string) ([]string, error) {
 
 	startIndex, err := strconv.Atoi(params[0])
 	if err != nil {
-		return nil, err
+		return nil, WrapError(BAD_ARGUMENTS, err)
 	}
 
 	if startIndex > length {
-		return nil, errors.New(fmt.Sprintf("Too big integer [%v]", params[0]))
+		return nil, NewError(BAD_ARGUMENTS, "Too big integer [%v]", params[0])
 	}
 
 	if length == 1 {
@@ -83,11 +81,11 @@ func (this *BaseCacheCommands) GetKeys(params []string) ([]string, error) {
 
 	stopIndex, err := strconv.Atoi(params[1])
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Invalid integer [%v]", params[1]))
+		return nil, NewError(BAD_ARGUMENTS, "Invalid integer [%v]", params[1])
 	}
 
 	if startIndex > length {
-		return nil, errors.New(fmt.Sprintf("Too big integer [%v]", params[1]))
+		return nil, NewError(BAD_ARGUMENTS, "Too big integer [%v]", params[1])
 	}
 
 	return keys[startIndex:stopIndex], nil
@@ -95,7 +93,7 @@ func (this *BaseCacheCommands) GetKeys(params []string) ([]string, error) {
 
 func (this *BaseCacheCommands) GetValue(params []string) (interface{}, error) {
 	if len(params) != 1 {
-		return nil, errors.New("Wrong params count")
+		return nil, wrongParamsCount()
 	}
 
 	return this.c.Get(params[0]), nil
@@ -104,30 +102,30 @@ func (this *BaseCacheCommands) GetValue(params []string) (interface{}, error) {
 func (this *BaseCacheCommands) SetValue(params []string) (interface{}, error) {
 	length := len(params)
 	if length < 2 || length > 3 {
-		return nil, errors.New("Wrong params count")
+		return nil, wrongParamsCount()
 	}
 
 	ttl := DEFAULT_TTL
 	if length == 3 {
 		value, err := strconv.Atoi(params[2])
 		if err != nil {
-			return nil, errors.New("Invalid \"ttl\" value")
+			return nil, NewError(BAD_ARGUMENTS, "Invalid \"ttl\" value")
 		} else {
 			ttl = value * int(time.Second)
 		}
 	}
 
-	return this.c.PutExpirable(params[0], params[1], int64(ttl)), nil
+	return this.c.PutExpirable(params[0], params[1], int64(ttl))
 }
 
 func (this *BaseCacheCommands) GetListValue(params []string) (interface{}, error) {
 	if len(params) != 2 {
-		return nil, errors.New("Wrong params count")
+		return nil, wrongParamsCount()
 	}
 
 	index, err := strconv.Atoi(params[1])
 	if err != nil {
-		return nil, err
+		return nil, WrapError(BAD_ARGUMENTS, err)
 	}
 
 	value := this.c.Get(params[0])
@@ -137,12 +135,12 @@ func (this *BaseCacheCommands) GetListValue(params []string) (interface{}, error
 
 	listValue, ok := value.(utils.List)
 	if !ok {
-		return nil, errors.New(fmt.Sprintf("The value for the key [%v] is not a list.", params[0]))
+		return nil, notList(params[0])
 	}
 
 	value, err = listValue.Get(index)
 	if err != nil {
-		return nil, err
+		return nil, WrapError(BAD_ARGUMENTS, err)
 	}
 
 	return value, nil
@@ -151,14 +149,14 @@ func (this *BaseCacheCommands) GetListValue(params []string) (interface{}, error
 func (this *BaseCacheCommands) AppendListValue(params []string) error {
 	length := len(params)
 	if length < 2 || length > 3 {
-		return errors.New("Wrong params count")
+		return wrongParamsCount()
 	}
 
 	ttl := DEFAULT_TTL
 	if length == 3 {
 		ttlValue, err := strconv.Atoi(params[2])
 		if err != nil {
-			return errors.New("Wrong \"ttl\" value")
+			return NewError(BAD_ARGUMENTS, "Wrong \"ttl\" value")
 		}
 		ttl = ttlValue * int(time.Second)
 	}
@@ -167,14 +165,16 @@ func (this *BaseCacheCommands) AppendListValue(params []string) error {
 		value := this.c.Get(params[0])
 		if value == nil {
 			list := utils.NewSyncList(params[1])
-			existingValue := this.c.PutExpirableIfAbsent(params[0], list, int64(ttl))
-			if existingValue == nil {
+			existingValue, err := this.c.PutExpirableIfAbsent(params[0], list, int64(ttl))
+			if err != nil {
+				return err
+			} else if existingValue == nil {
 				break
 			}
 		} else {
 			list, ok := value.(utils.List)
 			if !ok {
-				return errors.New(fmt.Sprintf("The value for the key [%v] is not a list.", params[0]))
+				return notList(params[0])
 			}
 			list.Append(params[1])
 			break
@@ -186,28 +186,28 @@ func (this *BaseCacheCommands) AppendListValue(params []string) error {
 
 func (this *BaseCacheCommands) DeleteListValue(params []string) (interface{}, error) {
 	if len(params) != 2 {
-		return nil, errors.New("Wrong params count")
+		return nil, wrongParamsCount()
 	}
 
 	index, err := strconv.Atoi(params[1])
 	if err != nil {
-		return nil, errors.New("Invalid \"index\" parameter")
+		return nil, NewError(BAD_ARGUMENTS, "Invalid \"index\" parameter")
 	}
 
 	for {
 		value := this.c.Get(params[0])
 		if value == nil {
-			return nil, errors.New("Index out of bounds")
+			return nil, NewError(BAD_ARGUMENTS, "Index out of bounds")
 		}
 
 		list, ok := value.(utils.List)
 		if !ok {
-			return nil, errors.New(fmt.Sprintf("The value for the key [%v] is not a list.", params[0]))
+			return nil, notList(params[0])
 		}
 
 		value, err := list.Remove(index)
 		if err != nil {
-			return nil, err
+			return nil, WrapError(BAD_ARGUMENTS, err)
 		}
 
 		return value, nil
@@ -216,7 +216,7 @@ func (this *BaseCacheCommands) DeleteListValue(params []string) (interface{}, er
 
 func (this *BaseCacheCommands) GetListSize(params []string) (int, error) {
 	if len(params) != 1 {
-		return -1, errors.New("Wrong params count")
+		return -1, wrongParamsCount()
 	}
 
 	value := this.c.Get(params[0])
@@ -226,7 +226,7 @@ func (this *BaseCacheCommands) GetListSize(params []string) (int, error) {
 
 	list, ok := value.(utils.List)
 	if !ok {
-		return -1, errors.New(fmt.Sprintf("The value for the key [%v] is not a list.", params[0]))
+		return -1, notList(params[0])
 	}
 
 	return list.Size(), nil
@@ -234,7 +234,7 @@ func (this *BaseCacheCommands) GetListSize(params []string) (int, error) {
 
 func (this *BaseCacheCommands) GetDictValue(params []string) (interface{}, error) {
 	if len(params) != 2 {
-		return nil, errors.New("Wrong params count")
+		return nil, wrongParamsCount()
 	}
 
 	value := this.c.Get(params[0])
@@ -244,7 +244,7 @@ func (this *BaseCacheCommands) GetDictValue(params []string) (interface{}, error
 
 	dict, ok := value.(utils.Dict)
 	if !ok {
-		return nil, errors.New(fmt.Sprintf("The value for the key [%v] is not a dictionary.", params[0]))
+		return nil, notDict(params[0])
 	}
 
 	return dict.Get(params[1]), nil
@@ -252,7 +252,7 @@ func (this *BaseCacheCommands) GetDictValue(params []string) (interface{}, error
 
 func (this *BaseCacheCommands) SetDictValue(params []string) (interface{}, error) {
 	if len(params) != 3 {
-		return nil, errors.New("Wrong params count")
+		return nil, wrongParamsCount()
 	}
 
 	for {
@@ -260,14 +260,16 @@ func (this *BaseCacheCommands) SetDictValue(params []string) (interface{}, error
 		if value == nil {
 			dict := utils.NewDict()
 			dict.Put(params[1], params[2])
-			existingValue := this.c.PutIfAbsent(params[0], dict)
-			if existingValue == nil {
+			existingValue, err := this.c.PutExpirableIfAbsent(params[0], dict, DEFAULT_TTL)
+			if err != nil {
+				return nil, err
+			} else if existingValue == nil {
 				return nil, nil
 			}
 		} else {
 			dict, ok := value.(utils.Dict)
 			if !ok {
-				return nil, errors.New(fmt.Sprintf("The value for the key [%v] is not a dictionary.", params[0]))
+				return nil, notDict(params[0])
 			}
 			return dict.Put(params[1], params[2]), nil
 		}
@@ -276,7 +278,7 @@ func (this *BaseCacheCommands) SetDictValue(params []string) (interface{}, error
 
 func (this *BaseCacheCommands) AppendDictValue(params []string) (bool, error) {
 	if len(params) != 3 {
-		return false, errors.New("Wrong params count")
+		return false, wrongParamsCount()
 	}
 
 	for {
@@ -284,14 +286,16 @@ func (this *BaseCacheCommands) AppendDictValue(params []string) (bool, error) {
 		if value == nil {
 			dict := utils.NewDict()
 			dict.Put(params[1], params[2])
-			existingValue := this.c.PutIfAbsent(params[0], dict)
-			if existingValue == nil {
+			existingValue, err := this.c.PutExpirableIfAbsent(params[0], dict, DEFAULT_TTL)
+			if err != nil {
+				return false, err
+			} else if existingValue == nil {
 				return true, nil
 			}
 		} else {
 			dict, ok := value.(utils.Dict)
 			if !ok {
-				return false, errors.New(fmt.Sprintf("The value for the key [%v] is not a dictionary.", params[0]))
+				return false, notDict(params[0])
 			}
 			existingValue := dict.PutIfAbsent(params[1], params[2])
 			if existingValue == nil {
@@ -305,7 +309,7 @@ func (this *BaseCacheCommands) AppendDictValue(params []string) (bool, error) {
 
 func (this *BaseCacheCommands) DeleteDictValue(params []string) (interface{}, error) {
 	if len(params) != 2 {
-		return nil, errors.New("Wrong params count")
+		return nil, wrongParamsCount()
 	}
 
 	value := this.c.Get(params[0])
@@ -314,7 +318,7 @@ func (this *BaseCacheCommands) DeleteDictValue(params []string) (interface{}, er
 	} else {
 		dict, ok := value.(utils.Dict)
 		if !ok {
-			return nil, errors.New(fmt.Sprintf("The value for the key [%v] is not a dictionary.", params[0]))
+			return nil, notDict(params[0])
 		}
 
 		return dict.Remove(params[1]), nil
@@ -323,7 +327,7 @@ func (this *BaseCacheCommands) DeleteDictValue(params []string) (interface{}, er
 
 func (this *BaseCacheCommands) GetDictSize(params []string) (int, error) {
 	if len(params) != 1 {
-		return 0, errors.New("Wrong params count")
+		return 0, wrongParamsCount()
 	}
 
 	value := this.c.Get(params[0])
@@ -332,7 +336,7 @@ func (this *BaseCacheCommands) GetDictSize(params []string) (int, error) {
 	} else {
 		dict, ok := value.(utils.Dict)
 		if !ok {
-			return 0, errors.New(fmt.Sprintf("The value for the key [%v] is not a dictionary.", params[0]))
+			return 0, notDict(params[0])
 		}
 
 		return dict.Size(), nil
@@ -341,12 +345,12 @@ func (this *BaseCacheCommands) GetDictSize(params []string) (int, error) {
 
 func (this *BaseCacheCommands) UpdateTTL(params []string) (bool, error) {
 	if len(params) != 2 {
-		return false, errors.New("Wrong params count")
+		return false, wrongParamsCount()
 	}
 
 	ttl, err := strconv.Atoi(params[1])
 	if err != nil {
-		return false, errors.New(fmt.Sprintf("Invalid integer [%v]", params[1]))
+		return false, NewError(BAD_ARGUMENTS, "Invalid integer [%v]", params[1])
 	}
 
 	return this.c.UpdateTTL(params[0], int64(ttl*int(time.Second))), nil
@@ -357,6 +361,6 @@ func (this *BaseCacheCommands) GetSize() int {
 }
 
 type UserFriendlyCacheCommands struct {
-	BaseCacheCommands
-	log utils.Logger
+	CacheCommands
+	replies utils.ReplyWriter
 }
@@ -8,6 +8,7 @@ import (
 
 func BenchmarkGetValueCommands(b *testing.B) {
 	cache := NewCache()
+	defer cache.Stop()
 	cmds := BaseCommands(cache)
 
 	for i := 0; i < 1000; i++ {
@@ -23,6 +24,7 @@ func BenchmarkGetValueCommands(b *testing.B) {
 
 func BenchmarkSetValueCommands(b *testing.B) {
 	cache := NewCache()
+	defer cache.Stop()
 	cmds := BaseCommands(cache)
 
 	params := []string{"A", "B"}
@@ -36,6 +38,7 @@ func BenchmarkSetValueCommands(b *testing.B) {
 
 func BenchmarkSetExpirapbleCommands(b *testing.B) {
 	cache := NewCache()
+	defer cache.Stop()
 	cmds := BaseCommands(cache)
 
 	params := []string{"A", "B", "100000"}
@@ -49,6 +52,7 @@ func BenchmarkSetExpirapbleCommands(b *testing.B) {
 
 func BenchmarkAppendListValuesCommands(b *testing.B) {
 	cache := NewCache()
+	defer cache.Stop()
 	cmds := BaseCommands(cache)
 
 	for i := 0; i < 1000; i++ {
@@ -67,6 +71,7 @@ func BenchmarkAppendListValuesCommands(b *testing.B) {
 
 func BenchmarkGetListValuesCommands(b *testing.B) {
 	cache := NewCache()
+	defer cache.Stop()
 	cmds := BaseCommands(cache)
 
 	for i := 0; i < 1000; i++ {
@@ -86,6 +91,7 @@ func BenchmarkGetListValuesCommands(b *testing.B) {
 
 func BenchmarkSetDictValuesCommands(b *testing.B) {
 	cache := NewCache()
+	defer cache.Stop()
 	cmds := BaseCommands(cache)
 
 	for i := 0; i < 1000; i++ {
@@ -107,6 +113,7 @@ func BenchmarkSetDictValuesCommands(b *testing.B) {
 
 func BenchmarkGetDictValuesCommands(b *testing.B) {
 	cache := NewCache()
+	defer cache.Stop()
 	cmds := BaseCommands(cache)
 
 	for i := 0; i < 1000; i++ {
@@ -126,3 +133,47 @@ func BenchmarkGetDictValuesCommands(b *testing.B) {
 	}
 
 }
+
+func BenchmarkParallelGetValueCommandsSingleShard(b *testing.B) {
+	benchmarkParallelCommands(1, "155", b)
+}
+
+func BenchmarkParallelGetValueCommandsSharded(b *testing.B) {
+	benchmarkParallelCommands(DEFAULT_SHARDS, "155", b)
+}
+
+func BenchmarkParallelSetValueCommandsSingleShard(b *testing.B) {
+	benchmarkParallelCommands(1, "", b)
+}
+
+func BenchmarkParallelSetValueCommandsSharded(b *testing.B) {
+	benchmarkParallelCommands(DEFAULT_SHARDS, "", b)
+}
+
+//Reads a passed <key> by every goroutine, or sets different keys if <key> is empty
+func benchmarkParallelCommands(shards int, key string, b *testing.B) {
+	options := DefaultCacheOptions()
+	options.Shards = shards
+	cache := NewCacheWithOptions(options)
+	defer cache.Stop()
+	cmds := BaseCommands(cache)
+
+	for i := 0; i < 1000; i++ {
+		cache.Put(strconv.Itoa(i), i)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		params := []string{key, "value"}
+		i := 0
+		for pb.Next() {
+			if key == "" {
+				params[0] = strconv.Itoa(i % 1000)
+				cmds.SetValue(params)
+			} else {
+				cmds.GetValue(params[:1])
+			}
+			i++
+		}
+	})
+}
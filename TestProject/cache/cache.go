@@ -2,90 +2,243 @@ package cache
 
 import (
 	"TestProject/utils"
+	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 //Represents an interface for a Cache
+//
+//Methods of utils.SyncMap have no error result: Put(), PutIfAbsent() and Replace() return ErrCacheFull instead of a value
+//and ReplaceValue() returns <false> in case a Cache is full, methods with time to live return ErrCacheFull as an error.
 type Cache interface {
 	utils.SyncMap
 
 	//Provides an ability to put a key-value pair with a specific time to live.
-	//Returns a value that was replaced during the putting a new key-value pair.
-	PutExpirable(key string, value interface{}, ttl int64) interface{}
+	//Returns a value that was replaced during the putting a new key-value pair,
+	//or ErrCacheFull in case a Cache is full and its eviction policy doesn't allow to free space.
+	PutExpirable(key string, value interface{}, ttl int64) (interface{}, error)
 
 	//Provides an ability to put a key-value pair with a specific time to live in case there is no value in a Cache yet.
-	//Returns <nil> if a key-value pair was put into a Cache, or a value of an existing key-value pair.
-	PutExpirableIfAbsent(key string, value interface{}, ttl int64) interface{}
+	//Returns <nil> if a key-value pair was put into a Cache, or a value of an existing key-value pair,
+	//or ErrCacheFull in case a Cache is full and its eviction policy doesn't allow to free space.
+	PutExpirableIfAbsent(key string, value interface{}, ttl int64) (interface{}, error)
 
 	//Provides an ability to replace an existing key-value pair with a new value with a specific time to live.
-	//Returns <nil> in case a key-value pair was not put into a Cache, otherwise returns a value that was replaced
-	ReplaceExpirable(key string, value interface{}, ttl int64) interface{}
+	//Returns <nil> in case a key-value pair was not put into a Cache, otherwise returns a value that was replaced,
+	//or ErrCacheFull in case a Cache is full and its eviction policy doesn't allow to free space.
+	ReplaceExpirable(key string, value interface{}, ttl int64) (interface{}, error)
 
 	//Provides an ability to replace an existing key-value pair with a new value with a specific time to live.
 	//Replacement happens in case an existig value is equal to a passed <oldValue>.
-	//Returns <true> if the replacement was successful, otherwise returns <false>.
-	ReplaceValueExpirable(key string, oldValue, newValue interface{}, ttl int64) bool
+	//Returns <true> if the replacement was successful, otherwise returns <false>,
+	//or ErrCacheFull in case a Cache is full and its eviction policy doesn't allow to free space.
+	ReplaceValueExpirable(key string, oldValue, newValue interface{}, ttl int64) (bool, error)
+
+	//Returns a value for a passed <key> together with its version, zero version is returned if there is no value.
+	//A new version is assigned every time a value is put, replaced or changed with ReplaceVersion.
+	GetWithVersion(key string) (interface{}, uint64)
+
+	//Provides an ability to replace an existing value with a new value with a specific time to live
+	//in case the version of the existing value is equal to a passed <version>. KEEP_TTL keeps time to live of the existing value.
+	//Returns ErrNotFound if there is no value for the <key>, ErrVersionMismatch if the value has another version,
+	//or ErrCacheFull in case a Cache is full and its eviction policy doesn't allow to free space.
+	ReplaceVersion(key string, version uint64, value interface{}, ttl int64) error
 
 	//Provides an ability to update time to live for any key in a Cache.
 	//Returns <true> in case of replacement was successful, otherwise returns <false>.
 	UpdateTTL(key string, ttl int64) bool
+
+	//Updates time to live of a value counting it from now, the way Redis EXPIRE and memcached "touch" do it.
+	//UpdateTTL() counts it from the time the value was stored.
+	//Returns <true> if a Cache contains the <key>, otherwise returns <false>.
+	Expire(key string, ttl int64) bool
+
+	//Returns expiration time of a value stored for a passed <key>, zero time for values without time to live.
+	//Returns <false> if a Cache doesn't contain the <key>.
+	ExpiresAt(key string) (time.Time, bool)
+
+	//Calls <f> for every not expired key-value pair of a Cache with its expiration time,
+	//zero time is passed for values without time to live. Iteration stops when <f> returns <false>.
+	//Every segment of a Cache is copied under its lock, so <f> can use a Cache freely.
+	Range(f func(key string, value interface{}, expiresAt time.Time) bool)
+
+	//Returns options a Cache was created with.
+	Options() CacheOptions
+
+	//Stops background activities of a Cache, e.g. removal of expired values.
+	//A Cache stays usable after it is stopped, expired values are removed only when they are accessed.
+	Stop()
+}
+
+//Time to live passed to ReplaceVersion to keep time to live of an existing value.
+const KEEP_TTL = -2
+
+//Options to tune a Cache instance
+type CacheOptions struct {
+	//How often expired values are actively removed from a Cache.
+	//Non-positive value disables the background removal.
+	SweepInterval time.Duration
+
+	//The number of values with time to live that are checked during one sweep pass.
+	SweepBudget int
+
+	//Max count of key-value pairs in a Cache. Non-positive value means no limit.
+	MaxEntries int
+
+	//Max approximate size of a Cache in bytes. Non-positive value means no limit.
+	//The size of a value is calculated when it is put, later changes of stored lists and dictionaries are not counted.
+	MaxBytes int64
+
+	//Defines which values are removed when a Cache reaches one of its limits.
+	//NO_EVICTION is used if nothing is defined.
+	Policy EvictionPolicy
+
+	//The number of independently locked segments of a Cache.
+	//DEFAULT_SHARDS is used for non-positive value.
+	Shards int
 }
 
 type cacheValue struct {
 	storedTime time.Time
 	ttl        time.Duration
 	value      interface{}
+	size       int64
+	version    uint64
+	lastAccess atomic.Int64
+	hits       atomic.Uint32
 }
 
+//Totals of a Cache shared between its segments.
+type usage struct {
+	entries atomic.Int64
+	bytes   atomic.Int64
+}
+
+//Source of value versions, versions are unique across all Caches of a process.
+var versions atomic.Uint64
+
+//One segment of a Cache, a map protected by its own lock.
 type syncMap struct {
 	sync.RWMutex
-	m map[string]*cacheValue
+	m        map[string]*cacheValue
+	volatile map[string]*cacheValue
+	usage    *usage
 }
 
-func NewCache() Cache {
+func newSyncMap(usage *usage) *syncMap {
 	cache := new(syncMap)
 	cache.m = make(map[string]*cacheValue)
+	cache.volatile = make(map[string]*cacheValue)
+	cache.usage = usage
 	return cache
 }
 
+func newCacheValue(key string, value interface{}, ttl int64, t time.Time) *cacheValue {
+	v := &cacheValue{
+		storedTime: t,
+		ttl:        time.Duration(ttl),
+		value:      value,
+		size:       approximateSize(key, value),
+		version:    versions.Add(1),
+	}
+	v.lastAccess.Store(t.UnixNano())
+	v.hits.Store(1)
+	return v
+}
+
+//Remembers an access to a value for LRU and LFU eviction policies.
+//Can be called under read lock.
+func (this *cacheValue) touch(t time.Time) {
+	this.lastAccess.Store(t.UnixNano())
+	if hits := this.hits.Load(); hits < math.MaxUint32 {
+		this.hits.CompareAndSwap(hits, hits+1)
+	}
+}
+
 func (this *cacheValue) isExpired(currentTime time.Time) bool {
 	if this.ttl <= 0 {
 		return false
 	}
-	return currentTime.After(this.storedTime.Add(this.ttl))
+	return currentTime.After(this.expiresAt())
+}
+
+func (this *cacheValue) expiresAt() time.Time {
+	return this.storedTime.Add(this.ttl)
 }
 
 func (cache *syncMap) Get(key string) interface{} {
+	value := cache.getValue(key)
+	if value == nil {
+		return nil
+	}
+	return value.value
+}
+
+func (cache *syncMap) GetWithVersion(key string) (interface{}, uint64) {
+	value := cache.getValue(key)
+	if value == nil {
+		return nil, 0
+	}
+	return value.value, value.version
+}
+
+//Returns a not expired value for a passed <key> and counts it as an access, an expired value is removed.
+func (cache *syncMap) getValue(key string) *cacheValue {
+	t := time.Now()
+
+	cache.RLock()
+	value := cache.m[key]
+	if value == nil {
+		cache.RUnlock()
+		return nil
+	}
+	if !value.isExpired(t) {
+		value.touch(t)
+		cache.RUnlock()
+		return value
+	}
+	cache.RUnlock()
+
 	cache.Lock()
 	defer cache.Unlock()
-	value := cache.m[key]
+	value = cache.m[key]
 	if value == nil {
 		return nil
 	}
 
-	if value.isExpired(time.Now()) {
+	if value.isExpired(t) {
 		cache.remove(key)
 		return nil
 	}
 
-	return value.value
+	value.touch(t)
+	return value
 }
 
-func (cache *syncMap) Put(key string, value interface{}) interface{} {
-	return cache.PutExpirable(key, value, -1)
+//Returns a not expired value for a passed <key> without counting it as an access.
+func (cache *syncMap) lookup(key string) *cacheValue {
+	cache.RLock()
+	defer cache.RUnlock()
+
+	value := cache.m[key]
+	if value == nil || value.isExpired(time.Now()) {
+		return nil
+	}
+	return value
 }
 
-func (cache *syncMap) PutExpirable(key string, value interface{}, ttl int64) interface{} {
+func (cache *syncMap) PutValue(key string, value *cacheValue) interface{} {
 	cache.Lock()
 	defer cache.Unlock()
-	return cache.put(key, value, ttl)
+	return cache.put(key, value)
 }
 
-func (cache *syncMap) put(key string, value interface{}, ttl int64) interface{} {
+func (cache *syncMap) put(key string, value *cacheValue) interface{} {
 	currValue := cache.m[key]
-	cache.m[key] = &cacheValue{time.Now(), time.Duration(ttl), value}
-	if currValue == nil || currValue.isExpired(time.Now()) {
+	cache.set(key, value)
+	if currValue == nil || currValue.isExpired(value.storedTime) {
 		return nil
 	} else {
 		return currValue.value
@@ -103,29 +256,56 @@ func (cache *syncMap) Remove(key string) interface{} {
 	return value.value
 }
 
+func (cache *syncMap) set(key string, value *cacheValue) {
+	if oldValue := cache.m[key]; oldValue != nil {
+		cache.usage.bytes.Add(value.size - oldValue.size)
+	} else {
+		cache.usage.entries.Add(1)
+		cache.usage.bytes.Add(value.size)
+	}
+	cache.m[key] = value
+	if value.ttl > 0 {
+		cache.volatile[key] = value
+	} else {
+		delete(cache.volatile, key)
+	}
+}
+
 func (cache *syncMap) remove(key string) *cacheValue {
 	oldValue := cache.m[key]
+	if oldValue == nil {
+		return nil
+	}
+	cache.usage.entries.Add(-1)
+	cache.usage.bytes.Add(-oldValue.size)
 	delete(cache.m, key)
+	delete(cache.volatile, key)
 	return oldValue
 }
 
-func (cache *syncMap) PutIfAbsent(key string, value interface{}) interface{} {
-	return cache.PutExpirableIfAbsent(key, value, -1)
+//Removes a key-value pair only in case the map still contains exactly passed <value> for the <key>.
+func (cache *syncMap) removeValue(key string, value *cacheValue) bool {
+	cache.Lock()
+	defer cache.Unlock()
+
+	if cache.m[key] != value {
+		return false
+	}
+	cache.remove(key)
+	return true
 }
 
-func (cache *syncMap) PutExpirableIfAbsent(key string, value interface{}, ttl int64) interface{} {
+func (cache *syncMap) PutValueIfAbsent(key string, value *cacheValue) interface{} {
 	cache.Lock()
 	defer cache.Unlock()
-	t := time.Now()
 	oldValue := cache.m[key]
-	if oldValue == nil {
-		cache.m[key] = &cacheValue{t, time.Duration(ttl), value}
-		return nil
+	if oldValue != nil && oldValue.isExpired(value.storedTime) {
+		cache.remove(key)
+		oldValue = nil
 	}
 
-	if oldValue.isExpired(t) {
-		cache.remove(key)
-		cache.m[key] = &cacheValue{t, time.Duration(ttl), value}
+	if oldValue == nil {
+		cache.set(key, value)
 		return nil
 	}
 
@@ -133,8 +313,8 @@ func (cache *syncMap) PutExpirableIfAbsent(key string, value interface{}, ttl in
 }
 
 func (cache *syncMap) GetKeys() []string {
-	cache.Lock()
-	defer cache.Unlock()
+	cache.RLock()
+	defer cache.RUnlock()
 
 	keys := []string{}
 
@@ -171,11 +351,7 @@ func (cache *syncMap) RemovePair(key string, value interface{}) bool {
 	return false
 }
 
-func (cache *syncMap) Replace(key string, value interface{}) interface{} {
-	return cache.ReplaceExpirable(key, value, -1)
-}
-
-func (cache *syncMap) ReplaceExpirable(key string, value interface{}, ttl int64) interface{} {
+func (cache *syncMap) ReplaceWithValue(key string, value *cacheValue) interface{} {
 	cache.Lock()
 	defer cache.Unlock()
 
@@ -184,17 +360,19 @@ func (cache *syncMap) ReplaceExpirable(key string, value interface{}, ttl int64)
 		return nil
 	}
 
-	if existingValue.isExpired(time.Now()) {
+	if existingValue.isExpired(value.storedTime) {
 		cache.remove(key)
 		return nil
 	}
 
-	cache.put(key, value, ttl)
+	cache.put(key, value)
 
 	return existingValue.value
 }
 
-func (cache *syncMap) ReplaceValue(key string, oldValue, newValue interface{}) bool {
+//Replaces an existing value in case it is equal to <oldValue>.
+//Time to live of the existing value is kept if <keepTTL> is <true>.
+func (cache *syncMap) ReplaceEqualValue(key string, oldValue interface{}, newValue *cacheValue, keepTTL bool) bool {
 	cache.Lock()
 	defer cache.Unlock()
 
@@ -203,7 +381,7 @@ func (cache *syncMap) ReplaceValue(key string, oldValue, newValue interface{}) b
 		return false
 	}
 
-	if existingValue.isExpired(time.Now()) {
+	if existingValue.isExpired(newValue.storedTime) {
 		cache.remove(key)
 		return false
 	}
@@ -212,42 +390,52 @@ func (cache *syncMap) ReplaceValue(key string, oldValue, newValue interface{}) b
 		return false
 	}
 
-	cache.put(key, newValue, int64(existingValue.ttl))
+	if keepTTL {
+		newValue.ttl = existingValue.ttl
+	}
+	cache.put(key, newValue)
 
 	return true
 }
 
-func (cache *syncMap) ReplaceValueExpirable(key string, oldValue, newValue interface{}, ttl int64) bool {
+//Replaces an existing value in case its version is equal to passed <version>.
+//Time to live of the existing value is kept if <keepTTL> is <true>.
+func (cache *syncMap) ReplaceVersionedValue(key string, version uint64, newValue *cacheValue, keepTTL bool) error {
 	cache.Lock()
 	defer cache.Unlock()
 
 	existingValue := cache.m[key]
 	if existingValue == nil {
-		return false
+		return ErrNotFound
 	}
 
-	if existingValue.isExpired(time.Now()) {
+	if existingValue.isExpired(newValue.storedTime) {
 		cache.remove(key)
-		return false
+		return ErrNotFound
 	}
 
-	if existingValue.value != oldValue {
-		return false
+	if existingValue.version != version {
+		return ErrVersionMismatch
 	}
 
-	cache.put(key, newValue, ttl)
+	if keepTTL {
+		newValue.storedTime = existingValue.storedTime
+		newValue.ttl = existingValue.ttl
+	}
+	cache.put(key, newValue)
 
-	return true
+	return nil
 }
 
 func (cache *syncMap) Size() int {
-	cache.Lock()
-	defer cache.Unlock()
+	cache.RLock()
+	defer cache.RUnlock()
 
 	return len(cache.m)
 }
 
-func (cache *syncMap) UpdateTTL(key string, ttl int64) bool {
+//Updates time to live of an existing value, it is counted from now if <fromNow> is <true>, otherwise from the time the value was stored.
+func (cache *syncMap) UpdateTTL(key string, ttl int64, fromNow bool) bool {
 	cache.Lock()
 	defer cache.Unlock()
 
@@ -262,9 +450,77 @@ func (cache *syncMap) UpdateTTL(key string, ttl int64) bool {
 		return false
 	}
 
+	if fromNow {
+		value.storedTime = currentTime
+	}
 	value.ttl = time.Duration(ttl)
 	if value.isExpired(currentTime) {
 		cache.remove(key)
+	} else {
+		cache.set(key, value)
 	}
 	return true
 }
+
+func (cache *syncMap) ExpiresAt(key string) (time.Time, bool) {
+	cache.RLock()
+	defer cache.RUnlock()
+
+	value := cache.m[key]
+	if value == nil || value.isExpired(time.Now()) {
+		return time.Time{}, false
+	}
+	if value.ttl <= 0 {
+		return time.Time{}, true
+	}
+	return value.expiresAt(), true
+}
+
+//Describes a stored key-value pair outside of a segment lock.
+type entry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+//Returns a copy of not expired key-value pairs.
+func (cache *syncMap) entries() []entry {
+	cache.RLock()
+	defer cache.RUnlock()
+
+	t := time.Now()
+	entries := make([]entry, 0, len(cache.m))
+	for key, value := range cache.m {
+		if value.isExpired(t) {
+			continue
+		}
+		var expiresAt time.Time
+		if value.ttl > 0 {
+			expiresAt = value.expiresAt()
+		}
+		entries = append(entries, entry{key, value.value, expiresAt})
+	}
+	return entries
+}
+
+//Checks up to <budget> values with time to live and removes expired ones.
+//Returns the number of removed values.
+func (cache *syncMap) sweep(budget int) int {
+	cache.Lock()
+	defer cache.Unlock()
+
+	t := time.Now()
+	checked, expired := 0, 0
+	for key, value := range cache.volatile {
+		if checked >= budget {
+			break
+		}
+		checked++
+		if value.isExpired(t) {
+			cache.remove(key)
+			expired++
+		}
+	}
+
+	return expired
+}
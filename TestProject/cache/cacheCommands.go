@@ -1,5 +1,13 @@
 package cache
 
+//Commands that change a Cache content.
+var MUTATING_COMMANDS = map[string]bool{
+	"set": true, "update": true, "delete": true,
+	"lappend": true, "ldelete": true,
+	"dset": true, "dappend": true, "ddelete": true,
+	"ttl": true,
+}
+
 //Represents a Telnet-kind interface for a Cache conection.
 //Shows allowed functionality.
 type CacheCommands interface {
@@ -76,3 +84,62 @@ type CacheCommands interface {
 	//Or error if something goes wrong, e.g. <params> are wrong.
 	GetSize() int
 }
+
+//Executes a command by its name, e.g. "get", with passed <params>.
+//Returns an error if the command is unknown or fails.
+func ExecuteCommand(cmds CacheCommands, command string, params []string) error {
+	var err error
+	switch command {
+	case "get":
+		_, err = cmds.GetValue(params)
+		break
+	case "set":
+		_, err = cmds.SetValue(params)
+		break
+	case "update":
+		_, err = cmds.UpdateValue(params)
+		break
+	case "delete":
+		_, _, err = cmds.RemoveValue(params)
+		break
+	case "keys":
+		_, err = cmds.GetKeys(params)
+		break
+	case "size":
+		cmds.GetSize()
+	case "lget":
+		_, err = cmds.GetListValue(params)
+		break
+	case "lappend":
+		err = cmds.AppendListValue(params)
+		break
+	case "ldelete":
+		_, err = cmds.DeleteListValue(params)
+		break
+	case "lsize":
+		_, err = cmds.GetListSize(params)
+		break
+	case "dget":
+		_, err = cmds.GetDictValue(params)
+		break
+	case "dset":
+		_, err = cmds.SetDictValue(params)
+		break
+	case "dappend":
+		_, err = cmds.AppendDictValue(params)
+		break
+	case "ddelete":
+		_, err = cmds.DeleteDictValue(params)
+		break
+	case "dsize":
+		_, err = cmds.GetDictSize(params)
+		break
+	case "ttl":
+		_, err = cmds.UpdateTTL(params)
+		break
+	default:
+		err = ErrUnknownCommand
+	}
+
+	return err
+}
@@ -3,10 +3,12 @@ package cache
 import (
 	"strconv"
 	"testing"
+	"time"
 )
 
 func TestPutGetValues(t *testing.T) {
 	cache := NewCache()
+	defer cache.Stop()
 	result := cache.Get("A")
 	if result != nil {
 		t.Error("Result of Get method on empty cache should be <nil>")
@@ -32,6 +34,7 @@ func TestPutGetValues(t *testing.T) {
 
 func BenchmarkGetValues(b *testing.B) {
 	cache := NewCache()
+	defer cache.Stop()
 	for i := 0; i < 1000; i++ {
 		cache.Put(strconv.Itoa(i), i)
 	}
@@ -43,6 +46,7 @@ func BenchmarkGetValues(b *testing.B) {
 
 func TestPutMethods(t *testing.T) {
 	cache := NewCache()
+	defer cache.Stop()
 	result := cache.Put("A", "B")
 	if result != nil {
 		t.Error("The result must be <nil> for non-existing key")
@@ -71,6 +75,7 @@ func TestPutMethods(t *testing.T) {
 
 func BenchmarkPutMethod(b *testing.B) {
 	cache := NewCache()
+	defer cache.Stop()
 	for n := 0; n < b.N; n++ {
 		cache.Put(strconv.Itoa(n), n)
 	}
@@ -78,6 +83,7 @@ func BenchmarkPutMethod(b *testing.B) {
 
 func TestReplacingMethods(t *testing.T) {
 	cache := NewCache()
+	defer cache.Stop()
 
 	cache.Put("A", "B")
 	cache.Put("C", "D")
@@ -106,6 +112,7 @@ func TestReplacingMethods(t *testing.T) {
 
 func BenchmarkReplaceMethod(b *testing.B) {
 	cache := NewCache()
+	defer cache.Stop()
 	cache.Put("A", "B")
 
 	for n := 0; n < b.N; n++ {
@@ -113,8 +120,45 @@ func BenchmarkReplaceMethod(b *testing.B) {
 	}
 }
 
+func TestReplaceVersionMethod(t *testing.T) {
+	cache := NewCache()
+	defer cache.Stop()
+	cache.PutExpirable("A", "B", int64(time.Hour))
+
+	value, version := cache.GetWithVersion("A")
+	if value != "B" || version == 0 {
+		t.Error("Wrong behavior of GetWithVersion function")
+	}
+
+	if _, missing := cache.GetWithVersion("Z"); missing != 0 {
+		t.Error("Wrong behavior of GetWithVersion function")
+	}
+
+	if cache.ReplaceVersion("A", version+1, "C", KEEP_TTL) != ErrVersionMismatch {
+		t.Error("Wrong behavior of ReplaceVersion function")
+	}
+
+	if cache.ReplaceVersion("Z", version, "C", KEEP_TTL) != ErrNotFound {
+		t.Error("Wrong behavior of ReplaceVersion function")
+	}
+
+	expiresAt, _ := cache.ExpiresAt("A")
+	if cache.ReplaceVersion("A", version, "C", KEEP_TTL) != nil || cache.Get("A") != "C" {
+		t.Error("Wrong behavior of ReplaceVersion function")
+	}
+	if keptExpiresAt, _ := cache.ExpiresAt("A"); !keptExpiresAt.Equal(expiresAt) {
+		t.Error("ReplaceVersion should keep time to live")
+	}
+
+	_, newVersion := cache.GetWithVersion("A")
+	if newVersion == version || cache.ReplaceVersion("A", version, "D", -1) != ErrVersionMismatch {
+		t.Error("Replaced value should get a new version")
+	}
+}
+
 func TestSizeMethod(t *testing.T) {
 	cache := NewCache()
+	defer cache.Stop()
 
 	cache.Put("A", "B")
 	cache.Put("C", "D")
@@ -151,6 +195,7 @@ func TestSizeMethod(t *testing.T) {
 
 func TestRemoveMethods(t *testing.T) {
 	cache := NewCache()
+	defer cache.Stop()
 
 	cache.Put("A", "B")
 	cache.Put("C", "D")
@@ -178,6 +223,7 @@ func TestRemoveMethods(t *testing.T) {
 
 func TestGetKeysMethods(t *testing.T) {
 	cache := NewCache()
+	defer cache.Stop()
 
 	cache.Put("1", "2")
 	cache.Put("3", "4")
@@ -198,6 +244,7 @@ func TestGetKeysMethods(t *testing.T) {
 
 func BenchmarkGetKeysMethod(b *testing.B) {
 	cache := NewCache()
+	defer cache.Stop()
 	for i := 0; i < 1000; i++ {
 		cache.Put(strconv.Itoa(i), i)
 	}
@@ -206,3 +253,160 @@ func BenchmarkGetKeysMethod(b *testing.B) {
 		cache.GetKeys()
 	}
 }
+
+func TestExpiredValuesAreSwept(t *testing.T) {
+	cache := NewCacheWithOptions(CacheOptions{SweepInterval: 5 * time.Millisecond, SweepBudget: 10})
+	defer cache.Stop()
+
+	for i := 0; i < 100; i++ {
+		cache.PutExpirable(strconv.Itoa(i), i, int64(time.Millisecond))
+	}
+	cache.Put("A", "B")
+
+	time.Sleep(200 * time.Millisecond)
+
+	if cache.Size() != 1 {
+		t.Error("Expired values were not removed by the sweeper")
+	}
+
+	if cache.Get("A") != "B" {
+		t.Error("Not expirable value was removed by the sweeper")
+	}
+}
+
+func TestUpdateTTLAndExpire(t *testing.T) {
+	cache := NewCache()
+	defer cache.Stop()
+	cache.Put("A", "B")
+	cache.Put("C", "D")
+	shardedCache := cache.(*shardedCache)
+	for _, key := range []string{"A", "C"} {
+		shardedCache.shard(key).m[key].storedTime = time.Now().Add(-time.Hour)
+	}
+
+	if !cache.UpdateTTL("A", int64(30*time.Minute)) || cache.Get("A") != nil {
+		t.Error("UpdateTTL function should count time to live from the time a value was stored")
+	}
+
+	if !cache.Expire("C", int64(30*time.Minute)) || cache.Get("C") != "D" {
+		t.Error("Expire function should count time to live from now")
+	}
+	expiresAt, _ := cache.ExpiresAt("C")
+	if time.Until(expiresAt) < 29*time.Minute {
+		t.Error("Wrong behavior of Expire function", expiresAt)
+	}
+
+	if cache.Expire("Z", int64(time.Minute)) {
+		t.Error("Expire function should return false for a missing key")
+	}
+}
+
+func TestStopCaches(t *testing.T) {
+	caches := NewRegistry()
+	named := NewCache()
+	caches.Put("A", named)
+	StopCaches(caches)
+
+	for _, c := range []Cache{caches, named} {
+		select {
+		case <-c.(*shardedCache).sweeper.stopped:
+		default:
+			t.Error("Sweeper should be stopped by StopCaches function")
+		}
+	}
+}
+
+func TestStoppedCacheKeepsExpiredValues(t *testing.T) {
+	cache := NewCacheWithOptions(CacheOptions{SweepInterval: 5 * time.Millisecond, SweepBudget: 10})
+	cache.Stop()
+	cache.Stop()
+
+	cache.PutExpirable("A", "B", int64(time.Millisecond))
+
+	time.Sleep(50 * time.Millisecond)
+
+	if cache.Size() != 1 {
+		t.Error("Stopped cache should not remove expired values in background")
+	}
+
+	if cache.Get("A") != nil || cache.Size() != 0 {
+		t.Error("Expired value should be removed on access")
+	}
+}
+
+func TestUpdatedTTLIsSwept(t *testing.T) {
+	cache := NewCacheWithOptions(CacheOptions{SweepInterval: 5 * time.Millisecond, SweepBudget: 10})
+	defer cache.Stop()
+
+	cache.Put("A", "B")
+	cache.PutExpirable("C", "D", int64(time.Millisecond))
+	cache.UpdateTTL("A", int64(time.Millisecond))
+	cache.UpdateTTL("C", -1)
+
+	time.Sleep(100 * time.Millisecond)
+
+	if cache.Size() != 1 || cache.Get("C") != "D" {
+		t.Error("Wrong behavior of the sweeper after UpdateTTL function")
+	}
+}
+
+func BenchmarkParallelGetValuesSingleShard(b *testing.B) {
+	benchmarkParallelGetValues(1, b)
+}
+
+func BenchmarkParallelGetValuesSharded(b *testing.B) {
+	benchmarkParallelGetValues(DEFAULT_SHARDS, b)
+}
+
+func BenchmarkParallelMixedSingleShard(b *testing.B) {
+	benchmarkParallelMixed(1, b)
+}
+
+func BenchmarkParallelMixedSharded(b *testing.B) {
+	benchmarkParallelMixed(DEFAULT_SHARDS, b)
+}
+
+func newShardedCache(shards int) Cache {
+	options := DefaultCacheOptions()
+	options.Shards = shards
+	cache := NewCacheWithOptions(options)
+	defer cache.Stop()
+	for i := 0; i < 1000; i++ {
+		cache.Put(strconv.Itoa(i), i)
+	}
+	return cache
+}
+
+func benchmarkParallelGetValues(shards int, b *testing.B) {
+	cache := newShardedCache(shards)
+	defer cache.Stop()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			cache.Get(strconv.Itoa(i % 1000))
+			i++
+		}
+	})
+}
+
+//Every tenth operation is a write
+func benchmarkParallelMixed(shards int, b *testing.B) {
+	cache := newShardedCache(shards)
+	defer cache.Stop()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := strconv.Itoa(i % 1000)
+			if i%10 == 0 {
+				cache.Put(key, i)
+			} else {
+				cache.Get(key)
+			}
+			i++
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+)
+
+//Stable code of an error that is sent to clients together with its message.
+type ErrorCode string
+
+const (
+	//A stored value has another type than a command expects, e.g. "lget" for a string value.
+	WRONG_TYPE ErrorCode = "WRONG_TYPE"
+	//Wrong number of parameters or a parameter that cannot be parsed.
+	BAD_ARGUMENTS ErrorCode = "BAD_ARGUMENTS"
+	//A command is not supported by the server.
+	UNKNOWN_COMMAND ErrorCode = "UNKNOWN_COMMAND"
+	//User/password pair was not accepted.
+	AUTH_FAILED ErrorCode = "AUTH_FAILED"
+	//A user is not allowed to access a cache or to execute a command.
+	PERMISSION_DENIED ErrorCode = "PERMISSION_DENIED"
+	//Connection with the server is broken.
+	CONNECTION_LOST ErrorCode = "CONNECTION_LOST"
+	//A value cannot be put because of the Cache limits.
+	CACHE_FULL ErrorCode = "CACHE_FULL"
+	//Response of the server cannot be understood by a client.
+	UNEXPECTED_RESPONSE ErrorCode = "UNEXPECTED_RESPONSE"
+	//There is no value for a requested key.
+	NOT_FOUND ErrorCode = "NOT_FOUND"
+	//A value was changed since its version was read.
+	VERSION_MISMATCH ErrorCode = "VERSION_MISMATCH"
+	//Any other failure on the server side.
+	SERVER_ERROR ErrorCode = "SERVER_ERROR"
+)
+
+//Error of a Cache command that has a stable code.
+//Two errors match with errors.Is when their codes are equal, so a particular error can be checked against sentinel errors, e.g.
+//	errors.Is(err, cache.ErrWrongType)
+type CacheError struct {
+	Code ErrorCode
+	Msg  string
+	err  error
+}
+
+var (
+	ErrWrongType        error = &CacheError{Code: WRONG_TYPE, Msg: "Wrong type of a value"}
+	ErrBadArguments     error = &CacheError{Code: BAD_ARGUMENTS, Msg: "Wrong params"}
+	ErrUnknownCommand   error = &CacheError{Code: UNKNOWN_COMMAND, Msg: "Unknown command"}
+	ErrAuthFailed       error = &CacheError{Code: AUTH_FAILED, Msg: "User/password pair is incorrect"}
+	ErrPermissionDenied error = &CacheError{Code: PERMISSION_DENIED, Msg: "Permission denied"}
+	ErrConnectionLost   error = &CacheError{Code: CONNECTION_LOST, Msg: "Connection is lost"}
+	ErrNotFound         error = &CacheError{Code: NOT_FOUND, Msg: "No value found"}
+	ErrVersionMismatch  error = &CacheError{Code: VERSION_MISMATCH, Msg: "Value was changed"}
+)
+
+//Creates an error with passed <code>, the message is formatted the same way as fmt.Sprintf does.
+func NewError(code ErrorCode, format string, params ...interface{}) error {
+	return &CacheError{Code: code, Msg: fmt.Sprintf(format, params...)}
+}
+
+//Wraps <err> with an error of passed <code>, the message of <err> is kept.
+//The original error is still available with errors.Unwrap.
+func WrapError(code ErrorCode, err error) error {
+	return &CacheError{Code: code, Msg: err.Error(), err: err}
+}
+
+func (this *CacheError) Error() string {
+	return this.Msg
+}
+
+func (this *CacheError) Unwrap() error {
+	return this.err
+}
+
+func (this *CacheError) Is(target error) bool {
+	cacheErr, ok := target.(*CacheError)
+	return ok && cacheErr.Code == this.Code
+}
+
+//Returns the code of passed <err>, errors without a code are SERVER_ERROR.
+func ErrorCodeOf(err error) ErrorCode {
+	var cacheErr *CacheError
+	if errors.As(err, &cacheErr) {
+		return cacheErr.Code
+	}
+	return SERVER_ERROR
+}
+
+func wrongParamsCount() error {
+	return NewError(BAD_ARGUMENTS, "Wrong params count")
+}
+
+func notList(key string) error {
+	return NewError(WRONG_TYPE, "The value for the key [%v] is not a list.", key)
+}
+
+func notDict(key string) error {
+	return NewError(WRONG_TYPE, "The value for the key [%v] is not a dictionary.", key)
+}
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+//Defines which values are removed from a Cache when it reaches its limits.
+type EvictionPolicy string
+
+const (
+	//New values are rejected with ErrCacheFull, nothing is evicted.
+	NO_EVICTION EvictionPolicy = "no-eviction"
+	//The least recently used value is evicted.
+	LRU EvictionPolicy = "lru"
+	//The least frequently used value is evicted.
+	LFU EvictionPolicy = "lfu"
+	//A random value is evicted.
+	RANDOM EvictionPolicy = "random"
+	//A value with the nearest expiration time is evicted, values without time to live are never evicted.
+	VOLATILE_TTL EvictionPolicy = "volatile-ttl"
+
+	//The number of values checked to find a value for eviction, the same approach as Redis uses.
+	EVICTION_SAMPLES = 5
+
+	//Approximate memory used by a key-value pair apart from the key and the value themselves.
+	ENTRY_OVERHEAD = 64
+
+	//Max number of evictions done to put one value.
+	MAX_EVICTIONS_PER_WRITE = 1000
+)
+
+//Returned by a Cache instead of a value in case a new value cannot be put because of the Cache limits.
+var ErrCacheFull error = &CacheError{Code: CACHE_FULL, Msg: "Cache is full"}
+
+//Converts a string to an eviction policy.
+//Returns an error if the string is not a known policy.
+func ParseEvictionPolicy(policy string) (EvictionPolicy, error) {
+	switch p := EvictionPolicy(policy); p {
+	case NO_EVICTION, LRU, LFU, RANDOM, VOLATILE_TTL:
+		return p, nil
+	}
+	return NO_EVICTION, NewError(BAD_ARGUMENTS, "Unknown eviction policy [%v]", policy)
+}
+
+//Describes a value that can be evicted, the metrics are copied while a segment is locked.
+type victim struct {
+	key        string
+	value      *cacheValue
+	expired    bool
+	lastAccess int64
+	hits       uint32
+	expiresAt  time.Time
+}
+
+//Checks up to <count> values of a segment and returns the best one to be evicted according to a passed <policy>
+//together with the number of checked values. Returns <nil> if there is nothing to evict.
+func (cache *syncMap) sample(policy EvictionPolicy, exceptKey string, count int, t time.Time) (*victim, int) {
+	cache.RLock()
+	defer cache.RUnlock()
+
+	candidates := cache.m
+	if policy == VOLATILE_TTL {
+		candidates = cache.volatile
+	}
+
+	var best *victim
+	checked := 0
+	for key, value := range candidates {
+		if checked >= count {
+			break
+		}
+		if key == exceptKey {
+			continue
+		}
+		checked++
+
+		candidate := &victim{key, value, value.isExpired(t), value.lastAccess.Load(), value.hits.Load(), value.expiresAt()}
+		if candidate.expired {
+			return candidate, checked
+		}
+		if best == nil || candidate.isBetterThan(best, policy) {
+			best = candidate
+		}
+	}
+	return best, checked
+}
+
+func (this *victim) isBetterThan(other *victim, policy EvictionPolicy) bool {
+	if this.expired != other.expired {
+		return this.expired
+	}
+
+	switch policy {
+	case LRU:
+		return this.lastAccess < other.lastAccess
+	case LFU:
+		if this.hits == other.hits {
+			return this.lastAccess < other.lastAccess
+		}
+		return this.hits < other.hits
+	case VOLATILE_TTL:
+		return this.expiresAt.Before(other.expiresAt)
+	}
+	return false
+}
+
+//Returns an approximate number of bytes used by a key-value pair.
+func approximateSize(key string, value interface{}) int64 {
+	size := int64(ENTRY_OVERHEAD + len(key))
+	switch v := value.(type) {
+	case string:
+		size += int64(len(v))
+	case []byte:
+		size += int64(len(v))
+	case fmt.Stringer:
+		size += int64(len(v.String()))
+	default:
+		size += 8
+	}
+	return size
+}
@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newBoundedCache(maxEntries int, maxBytes int64, policy EvictionPolicy) Cache {
+	options := DefaultCacheOptions()
+	options.MaxEntries = maxEntries
+	options.MaxBytes = maxBytes
+	options.Policy = policy
+	return NewCacheWithOptions(options)
+}
+
+func TestNoEvictionPolicy(t *testing.T) {
+	cache := newBoundedCache(2, 0, NO_EVICTION)
+	defer cache.Stop()
+
+	cache.Put("A", "B")
+	cache.Put("C", "D")
+
+	if cache.Put("E", "F") != ErrCacheFull {
+		t.Error("Put function should reject values when cache is full")
+	}
+
+	if _, err := cache.PutExpirableIfAbsent("E", "F", -1); err != ErrCacheFull {
+		t.Error("PutExpirableIfAbsent function should reject values when cache is full")
+	}
+
+	if cache.Put("A", "Z") != "B" {
+		t.Error("Existing values should be replaced when cache is full")
+	}
+
+	if cache.Size() != 2 || cache.Get("E") != nil {
+		t.Error("Wrong behavior of no-eviction policy")
+	}
+}
+
+func TestLRUPolicy(t *testing.T) {
+	cache := newBoundedCache(3, 0, LRU)
+	defer cache.Stop()
+
+	cache.Put("A", "1")
+	cache.Put("B", "2")
+	cache.Put("C", "3")
+
+	time.Sleep(time.Millisecond)
+	cache.Get("A")
+	cache.Get("C")
+
+	cache.Put("D", "4")
+
+	if cache.Size() != 3 || cache.Get("B") != nil || cache.Get("A") == nil {
+		t.Error("The least recently used value should be evicted")
+	}
+}
+
+func TestLFUPolicy(t *testing.T) {
+	cache := newBoundedCache(3, 0, LFU)
+	defer cache.Stop()
+
+	cache.Put("A", "1")
+	cache.Put("B", "2")
+	cache.Put("C", "3")
+
+	for i := 0; i < 3; i++ {
+		cache.Get("A")
+		cache.Get("B")
+	}
+	cache.Get("C")
+
+	cache.PutExpirableIfAbsent("D", "4", -1)
+
+	if cache.Size() != 3 || cache.Get("C") != nil || cache.Get("D") != "4" {
+		t.Error("The least frequently used value should be evicted")
+	}
+}
+
+func TestRandomPolicy(t *testing.T) {
+	cache := newBoundedCache(10, 0, RANDOM)
+	defer cache.Stop()
+
+	for i := 0; i < 100; i++ {
+		if cache.Put(strconv.Itoa(i), i) == ErrCacheFull {
+			t.Error("Random policy should not reject values")
+		}
+	}
+
+	if cache.Size() != 10 || cache.Get("99") != 99 {
+		t.Error("Wrong behavior of random policy")
+	}
+}
+
+func TestVolatileTTLPolicy(t *testing.T) {
+	cache := newBoundedCache(3, 0, VOLATILE_TTL)
+	defer cache.Stop()
+
+	cache.Put("A", "1")
+	cache.PutExpirable("B", "2", int64(time.Hour))
+	cache.PutExpirable("C", "3", int64(time.Minute))
+
+	cache.Put("D", "4")
+	if cache.Get("C") != nil || cache.Get("B") == nil {
+		t.Error("The value with the nearest expiration should be evicted")
+	}
+
+	cache.Put("E", "5")
+	if cache.Put("F", "6") != ErrCacheFull {
+		t.Error("Values without time to live should never be evicted by volatile-ttl policy")
+	}
+
+	if cache.Get("A") != "1" || cache.Get("D") != "4" || cache.Get("E") != "5" {
+		t.Error("Wrong behavior of volatile-ttl policy")
+	}
+}
+
+func TestMaxBytesLimit(t *testing.T) {
+	cache := newBoundedCache(0, 3*(ENTRY_OVERHEAD+2), LRU)
+	defer cache.Stop()
+
+	cache.Put("A", "1")
+	cache.Put("B", "2")
+	cache.Put("C", "3")
+	if cache.Size() != 3 {
+		t.Error("Values within the size limit should not be evicted")
+	}
+
+	cache.ReplaceExpirable("A", "1234", -1)
+	if cache.Size() != 2 || cache.Get("A") != "1234" {
+		t.Error("Wrong behavior of the size limit")
+	}
+}
+
+func TestCommandsOnFullCache(t *testing.T) {
+	cache := newBoundedCache(1, 0, NO_EVICTION)
+	defer cache.Stop()
+	cmds := BaseCommands(cache)
+
+	cmds.SetValue([]string{"A", "B"})
+
+	if _, err := cmds.SetValue([]string{"C", "D"}); err != ErrCacheFull {
+		t.Error("SetValue command should fail on full cache")
+	}
+
+	if err := cmds.AppendListValue([]string{"C", "D"}); err != ErrCacheFull {
+		t.Error("AppendListValue command should fail on full cache")
+	}
+
+	if _, err := cmds.SetDictValue([]string{"C", "D", "E"}); err != ErrCacheFull {
+		t.Error("SetDictValue command should fail on full cache")
+	}
+
+	bounded := newBoundedCache(0, 1<<20, NO_EVICTION).(*shardedCache)
+	defer bounded.Stop()
+	bounded.Put("A", "B")
+	bounded.options.MaxBytes = bounded.usage.bytes.Load()
+	cmds = BaseCommands(bounded)
+
+	if updated, err := cmds.UpdateValue([]string{"A", "B", strings.Repeat("x", ENTRY_OVERHEAD)}); updated || err != ErrCacheFull {
+		t.Error("UpdateValue command should fail on full cache")
+	}
+	if updated, err := cmds.UpdateValue([]string{"A", "wrong", "C"}); updated || err != nil {
+		t.Error("UpdateValue command should not replace a value that is not equal to the old one")
+	}
+}
+
+func TestFailedReplaceDoesNotEvict(t *testing.T) {
+	cache := newBoundedCache(0, 1<<20, LRU).(*shardedCache)
+	defer cache.Stop()
+	cache.Put("A", "1")
+	cache.Put("B", "2")
+	cache.options.MaxBytes = cache.usage.bytes.Load() + ENTRY_OVERHEAD/2
+
+	_, version := cache.GetWithVersion("A")
+	big := strings.Repeat("x", ENTRY_OVERHEAD)
+	if replaced, err := cache.ReplaceValueExpirable("A", "wrong", big, 10); cache.ReplaceValue("A", "wrong", big) || replaced || err != nil {
+		t.Error("Value that is not equal to the old one should not be replaced")
+	}
+	if cache.ReplaceVersion("A", version+1, big, -1) != ErrVersionMismatch {
+		t.Error("Value with another version should not be replaced")
+	}
+	if cache.Get("B") != "2" {
+		t.Error("Failed replace should not evict other values")
+	}
+
+	if cache.ReplaceVersion("A", version, big, -1) != nil || cache.Get("B") != nil {
+		t.Error("Successful replace should evict other values")
+	}
+}
+
+func TestParseEvictionPolicy(t *testing.T) {
+	policy, err := ParseEvictionPolicy("lfu")
+	if err != nil || policy != LFU {
+		t.Error("Wrong behavior of ParseEvictionPolicy function")
+	}
+
+	_, err = ParseEvictionPolicy("fifo")
+	if err == nil {
+		t.Error("Wrong behavior of ParseEvictionPolicy function")
+	}
+}
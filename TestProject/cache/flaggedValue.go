@@ -0,0 +1,20 @@
+package cache
+
+import (
+	"encoding/json"
+)
+
+//String value together with opaque flags of a client, e.g. flags a memcached client stores with its values.
+//The flags are kept only for clients that know about them, other clients get the string.
+type FlaggedValue struct {
+	Value string
+	Flags uint32
+}
+
+func (this FlaggedValue) String() string {
+	return this.Value
+}
+
+func (this FlaggedValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(this.Value)
+}
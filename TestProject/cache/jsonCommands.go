@@ -2,44 +2,52 @@ package cache
 
 import (
 	"TestProject/utils"
-
+	"log/slog"
 	"net"
 )
 
+//Commands of machine clients, result of every command is written as a response.
 type JsonCacheCommands struct {
-	BaseCacheCommands
-	conn net.Conn
-	log  utils.Logger
+	CacheCommands
+	writer ResponseWriter
+	log    *slog.Logger
+}
+
+//Creates commands that write results as JsonResponse lines.
+func NewJsonCacheCommands(cache Cache, conn net.Conn, log *slog.Logger) CacheCommands {
+	return NewMachineCacheCommands(BaseCommands(cache), NewJsonResponseWriter(conn), log)
 }
 
-func NewJsonCacheCommands(cache Cache, conn net.Conn, log utils.Logger) CacheCommands {
-	cmds := new(JsonCacheCommands)
-	cmds.c = cache
-	cmds.conn = conn
-	cmds.log = log
-	return cmds
+//Creates commands that execute passed <cmds>, e.g. BaseCommands(), and write results with <writer>.
+//Errors of writing are written into <log>.
+func NewMachineCacheCommands(cmds CacheCommands, writer ResponseWriter, log *slog.Logger) CacheCommands {
+	machine := new(JsonCacheCommands)
+	machine.CacheCommands = cmds
+	machine.writer = writer
+	machine.log = log
+	return machine
 }
 
 func (this *JsonCacheCommands) GetValue(params []string) (interface{}, error) {
-	value, err := this.BaseCacheCommands.GetValue(params)
+	value, err := this.CacheCommands.GetValue(params)
 	this.writeResponse(value, err)
 	return value, err
 }
 
 func (this *JsonCacheCommands) SetValue(params []string) (interface{}, error) {
-	value, err := this.BaseCacheCommands.SetValue(params)
+	value, err := this.CacheCommands.SetValue(params)
 	this.writeResponse(value, err)
 	return value, err
 }
 
 func (this *JsonCacheCommands) UpdateValue(params []string) (bool, error) {
-	value, err := this.BaseCacheCommands.UpdateValue(params)
+	value, err := this.CacheCommands.UpdateValue(params)
 	this.writeResponse(value, err)
 	return value, err
 }
 
 func (this *JsonCacheCommands) RemoveValue(params []string) (interface{}, bool, error) {
-	value, removed, err := this.BaseCacheCommands.RemoveValue(params)
+	value, removed, err := this.CacheCommands.RemoveValue(params)
 	if removed {
 		this.writeResponse(value, err)
 	} else {
@@ -49,79 +57,79 @@ func (this *JsonCacheCommands) RemoveValue(params []string) (interface{}, bool,
 }
 
 func (this *JsonCacheCommands) GetListValue(params []string) (interface{}, error) {
-	value, err := this.BaseCacheCommands.GetListValue(params)
+	value, err := this.CacheCommands.GetListValue(params)
 	this.writeResponse(value, err)
 	return value, err
 }
 
 func (this *JsonCacheCommands) AppendListValue(params []string) error {
-	err := this.BaseCacheCommands.AppendListValue(params)
+	err := this.CacheCommands.AppendListValue(params)
 	this.writeResponse(nil, err)
 	return err
 }
 
 func (this *JsonCacheCommands) DeleteListValue(params []string) (interface{}, error) {
-	value, err := this.BaseCacheCommands.DeleteListValue(params)
+	value, err := this.CacheCommands.DeleteListValue(params)
 	this.writeResponse(value, err)
 	return value, err
 }
 
 func (this *JsonCacheCommands) GetListSize(params []string) (int, error) {
-	size, err := this.BaseCacheCommands.GetListSize(params)
+	size, err := this.CacheCommands.GetListSize(params)
 	this.writeResponse(size, err)
 	return size, err
 }
 
 func (this *JsonCacheCommands) GetDictValue(params []string) (interface{}, error) {
-	value, err := this.BaseCacheCommands.GetDictValue(params)
+	value, err := this.CacheCommands.GetDictValue(params)
 	this.writeResponse(value, err)
 	return value, err
 }
 
 func (this *JsonCacheCommands) SetDictValue(params []string) (interface{}, error) {
-	value, err := this.BaseCacheCommands.SetDictValue(params)
+	value, err := this.CacheCommands.SetDictValue(params)
 	this.writeResponse(value, err)
 	return value, err
 }
 
 func (this *JsonCacheCommands) AppendDictValue(params []string) (bool, error) {
-	appended, err := this.BaseCacheCommands.AppendDictValue(params)
+	appended, err := this.CacheCommands.AppendDictValue(params)
 	this.writeResponse(appended, err)
 	return appended, err
 }
 
 func (this *JsonCacheCommands) DeleteDictValue(params []string) (interface{}, error) {
-	value, err := this.BaseCacheCommands.DeleteDictValue(params)
+	value, err := this.CacheCommands.DeleteDictValue(params)
 	this.writeResponse(value, err)
 	return value, err
 }
 
 func (this *JsonCacheCommands) GetDictSize(params []string) (int, error) {
-	size, err := this.BaseCacheCommands.GetDictSize(params)
+	size, err := this.CacheCommands.GetDictSize(params)
 	this.writeResponse(size, err)
 	return size, err
 }
 
 func (this *JsonCacheCommands) GetKeys(params []string) ([]string, error) {
-	keys, err := this.BaseCacheCommands.GetKeys(params)
+	keys, err := this.CacheCommands.GetKeys(params)
 	this.writeResponse(keys, err)
 	return keys, err
 }
 
 func (this *JsonCacheCommands) UpdateTTL(params []string) (bool, error) {
-	updated, err := this.BaseCacheCommands.UpdateTTL(params)
+	updated, err := this.CacheCommands.UpdateTTL(params)
 	this.writeResponse(updated, err)
 	return updated, err
 }
 
 func (this *JsonCacheCommands) GetSize() int {
-	size := this.BaseCacheCommands.GetSize()
+	size := this.CacheCommands.GetSize()
 	this.writeResponse(size, nil)
 	return size
 }
 
 func (this *JsonCacheCommands) writeResponse(value interface{}, err error) {
-	if WriteResponse(this.conn, value, err) != nil {
-		this.log.Log(err)
+	if writeErr := this.writer.WriteResponse(value, err); writeErr != nil {
+		this.log.Warn("Cannot write response", utils.LOG_ERROR, writeErr)
 	}
 }
@@ -6,10 +6,12 @@ import (
 )
 
 //Serializable response that is used to communicate between client and server
-//for Cache API
+//for Cache API.
+//Code is a stable ErrorCode of Err, clients should check it instead of the message.
 type JsonResponse struct {
 	Value interface{}
 	Err   string
+	Code  ErrorCode `json:",omitempty"`
 }
 
 //Writes a JsonResponse serializable structure with passed error
@@ -17,19 +19,21 @@ func WriteErrorResponse(conn net.Conn, err error) error {
 	return WriteResponse(conn, nil, err)
 }
 
-//Writes a JsonResponse serializable structure with both passed value and error
-func WriteResponse(conn net.Conn, value interface{}, err error) error {
-	var e string
+//Creates a JsonResponse with both passed value and error
+func NewJsonResponse(value interface{}, err error) *JsonResponse {
+	response := &JsonResponse{Value: value}
 	if err != nil {
-		e = err.Error()
+		response.Err = err.Error()
+		response.Code = ErrorCodeOf(err)
 	}
+	return response
+}
 
-	bytes, marshalErr := json.Marshal(&JsonResponse{Value: value, Err: e})
+//Writes a JsonResponse serializable structure with both passed value and error
+func WriteResponse(conn net.Conn, value interface{}, err error) error {
+	bytes, marshalErr := json.Marshal(NewJsonResponse(value, err))
 	if marshalErr != nil {
-		err := handleMarshalError(conn, marshalErr)
-		if err != nil {
-			return err
-		}
+		return handleMarshalError(conn, marshalErr)
 	}
 	writeErr := writeBytes(conn, append(bytes, '\n'))
 	if writeErr != nil {
@@ -39,11 +43,11 @@ func WriteResponse(conn net.Conn, value interface{}, err error) error {
 }
 
 func handleMarshalError(conn net.Conn, err error) error {
-	bytes, marshalErr := json.Marshal(&JsonResponse{nil, err.Error()})
+	bytes, marshalErr := json.Marshal(&JsonResponse{Err: err.Error(), Code: SERVER_ERROR})
 	if marshalErr != nil {
 		return marshalErr
 	}
-	return writeBytes(conn, bytes)
+	return writeBytes(conn, append(bytes, '\n'))
 }
 
 func writeBytes(conn net.Conn, bytes []byte) error {
@@ -60,3 +64,17 @@ func JsonToResponse(data []byte) (*JsonResponse, error) {
 	}
 	return response, nil
 }
+
+//Returns an error sent by the server, or <nil> if the response is successful.
+//The error matches sentinel errors of its code with errors.Is.
+func (this *JsonResponse) ToError() error {
+	if this.Err == "" {
+		return nil
+	}
+
+	code := this.Code
+	if code == "" {
+		code = SERVER_ERROR
+	}
+	return &CacheError{Code: code, Msg: this.Err}
+}
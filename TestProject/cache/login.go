@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"TestProject/auth"
+	"encoding/json"
+	"io"
+	"net"
+)
+
+//Logs a user in over a new connection with a challenge-response exchange, neither the password nor its verifier is sent.
+//The server is checked as well, an error is returned if it doesn't know the verifier of the user.
+//Pass <isMachine> to use the connection with OpenRemoteCache() or NewRemoteCache() afterwards.
+func Login(conn net.Conn, name, password string, isMachine bool) error {
+	return login(conn, &auth.User{Name: name, IsMachine: isMachine}, password)
+}
+
+//Logs a user in the same way as Login() does and returns a token of a new session.
+//The token resumes the session on other connections without the password, see ResumeSession() and OpenResumableRemoteCache().
+func LoginWithSession(conn net.Conn, name, password string, isMachine bool) (string, error) {
+	err := login(conn, &auth.User{Name: name, IsMachine: isMachine, Session: true}, password)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := readLine(conn)
+	if err != nil {
+		return "", WrapError(CONNECTION_LOST, err)
+	}
+	return decodeStringResponse(data)
+}
+
+//Logs a user in over a new connection with a session token instead of a password.
+//Returns the name of the user of the session, ErrAuthFailed is returned if the session is expired or revoked.
+func ResumeSession(conn net.Conn, token string, isMachine bool) (string, error) {
+	data, err := auth.UserToJson(&auth.User{Token: token, IsMachine: isMachine})
+	if err != nil {
+		return "", err
+	}
+	return exchangeLine(conn, data)
+}
+
+func login(conn net.Conn, user *auth.User, password string) error {
+	client := auth.NewScramClient(user.Name, password)
+	user.Scram = client.ClientFirst()
+
+	data, err := auth.UserToJson(user)
+	if err != nil {
+		return err
+	}
+
+	serverFirst, err := exchangeLine(conn, data)
+	if err != nil {
+		return err
+	}
+
+	clientFinal, err := client.ClientFinal(serverFirst)
+	if err != nil {
+		return WrapError(AUTH_FAILED, err)
+	}
+
+	serverFinal, err := exchangeLine(conn, []byte(clientFinal))
+	if err != nil {
+		return err
+	}
+
+	err = client.Verify(serverFinal)
+	if err != nil {
+		return WrapError(AUTH_FAILED, err)
+	}
+	return nil
+}
+
+//Logs a user in over a TLS connection with a client certificate instead of a password.
+//The server maps the certificate to a user, <name> can be empty or has to be the name of that user.
+//Clients of unix sockets with "peer" or "trust" auth policy log in the same way, the socket is mapped to a user.
+//Returns the name of the user.
+func LoginWithCertificate(conn net.Conn, name string, isMachine bool) (string, error) {
+	data, err := auth.UserToJson(&auth.User{Name: name, IsMachine: isMachine})
+	if err != nil {
+		return "", err
+	}
+	return exchangeLine(conn, data)
+}
+
+//Sends a line and reads a JsonResponse with a string value.
+func exchangeLine(conn net.Conn, line []byte) (string, error) {
+	_, err := conn.Write(append(line, '\n'))
+	if err != nil {
+		return "", WrapError(CONNECTION_LOST, err)
+	}
+
+	data, err := readLine(conn)
+	if err != nil {
+		return "", WrapError(CONNECTION_LOST, err)
+	}
+	return decodeStringResponse(data)
+}
+
+//Decodes a JsonResponse with a string value.
+func decodeStringResponse(data []byte) (string, error) {
+	response := new(JsonResponse)
+	err := json.Unmarshal(data, response)
+	if err != nil {
+		return "", WrapError(UNEXPECTED_RESPONSE, err)
+	}
+	if err = response.ToError(); err != nil {
+		return "", err
+	}
+
+	value, ok := response.Value.(string)
+	if !ok {
+		return "", unexpectedValue(response.Value, "string")
+	}
+	return value, nil
+}
+
+//Reads one line without buffering, so data sent after the line stays in the connection.
+func readLine(reader io.Reader) ([]byte, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		_, err := reader.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		if b[0] == '\n' {
+			return line, nil
+		}
+		line = append(line, b[0])
+	}
+}
@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"TestProject/auth"
+	"TestProject/utils"
+	"log/slog"
+)
+
+//Categories of commands that are checked against permissions of users.
+//Commands of string values and keys have no category, they are available to every user of a cache.
+var COMMAND_CATEGORIES = map[string]string{
+	"lget": auth.CATEGORY_LIST, "lappend": auth.CATEGORY_LIST, "ldelete": auth.CATEGORY_LIST, "lsize": auth.CATEGORY_LIST,
+	"dget": auth.CATEGORY_DICT, "dset": auth.CATEGORY_DICT, "dappend": auth.CATEGORY_DICT, "ddelete": auth.CATEGORY_DICT, "dsize": auth.CATEGORY_DICT,
+	"save": auth.CATEGORY_ADMIN, "stop-server": auth.CATEGORY_ADMIN,
+	"user-add": auth.CATEGORY_ADMIN, "user-del": auth.CATEGORY_ADMIN, "user-passwd": auth.CATEGORY_ADMIN, "user-list": auth.CATEGORY_ADMIN, "user-grant": auth.CATEGORY_ADMIN,
+	"session-revoke": auth.CATEGORY_ADMIN, "lockout-list": auth.CATEGORY_ADMIN, "lockout-clear": auth.CATEGORY_ADMIN,
+}
+
+//Returns ErrPermissionDenied if a <user> cannot connect to a cache with passed <cacheId>.
+func CheckCacheAccess(user *auth.User, cacheId string) error {
+	if !user.CanAccessCache(cacheId) {
+		return NewError(PERMISSION_DENIED, "User [%v] is not allowed to access the cache [%v]", user.Name, cacheId)
+	}
+	return nil
+}
+
+//Returns ErrPermissionDenied if a <user> cannot execute a <command>.
+//Admin commands are considered to be mutating.
+func CheckPermission(user *auth.User, command string) error {
+	category := COMMAND_CATEGORIES[command]
+	if !user.CanExecute(category, MUTATING_COMMANDS[command] || category == auth.CATEGORY_ADMIN) {
+		return NewError(PERMISSION_DENIED, "User [%v] is not allowed to execute [%v]", user.Name, command)
+	}
+	return nil
+}
+
+//Decorates commands of a cache, every command is checked against permissions of a user before it is executed.
+//Denied commands return ErrPermissionDenied and are written into a log.
+type RestrictedCommands struct {
+	CacheCommands
+	user *auth.User
+	log  *slog.Logger
+}
+
+//Creates commands of a cache that check permissions of passed <user>, denials are written into <log>.
+func NewRestrictedCommands(cmds CacheCommands, user *auth.User, log *slog.Logger) CacheCommands {
+	restricted := new(RestrictedCommands)
+	restricted.CacheCommands = cmds
+	restricted.user = user
+	restricted.log = log
+	return restricted
+}
+
+func (this *RestrictedCommands) check(command string) error {
+	err := CheckPermission(this.user, command)
+	if err != nil {
+		this.log.Warn("Command is denied", utils.LOG_USER, this.user.Name, utils.LOG_ERROR, err)
+	}
+	return err
+}
+
+//A whole list or dictionary is returned only to a user who can execute commands of lists or dictionaries.
+func (this *RestrictedCommands) GetValue(params []string) (interface{}, error) {
+	if err := this.check("get"); err != nil {
+		return nil, err
+	}
+
+	value, err := this.CacheCommands.GetValue(params)
+	switch value.(type) {
+	case utils.List:
+		err = this.check("lget")
+	case utils.Dict:
+		err = this.check("dget")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (this *RestrictedCommands) SetValue(params []string) (interface{}, error) {
+	if err := this.check("set"); err != nil {
+		return nil, err
+	}
+	return this.CacheCommands.SetValue(params)
+}
+
+func (this *RestrictedCommands) UpdateValue(params []string) (bool, error) {
+	if err := this.check("update"); err != nil {
+		return false, err
+	}
+	return this.CacheCommands.UpdateValue(params)
+}
+
+func (this *RestrictedCommands) RemoveValue(params []string) (interface{}, bool, error) {
+	if err := this.check("delete"); err != nil {
+		return nil, false, err
+	}
+	return this.CacheCommands.RemoveValue(params)
+}
+
+func (this *RestrictedCommands) GetListValue(params []string) (interface{}, error) {
+	if err := this.check("lget"); err != nil {
+		return nil, err
+	}
+	return this.CacheCommands.GetListValue(params)
+}
+
+func (this *RestrictedCommands) AppendListValue(params []string) error {
+	if err := this.check("lappend"); err != nil {
+		return err
+	}
+	return this.CacheCommands.AppendListValue(params)
+}
+
+func (this *RestrictedCommands) DeleteListValue(params []string) (interface{}, error) {
+	if err := this.check("ldelete"); err != nil {
+		return nil, err
+	}
+	return this.CacheCommands.DeleteListValue(params)
+}
+
+func (this *RestrictedCommands) GetListSize(params []string) (int, error) {
+	if err := this.check("lsize"); err != nil {
+		return 0, err
+	}
+	return this.CacheCommands.GetListSize(params)
+}
+
+func (this *RestrictedCommands) GetDictValue(params []string) (interface{}, error) {
+	if err := this.check("dget"); err != nil {
+		return nil, err
+	}
+	return this.CacheCommands.GetDictValue(params)
+}
+
+func (this *RestrictedCommands) SetDictValue(params []string) (interface{}, error) {
+	if err := this.check("dset"); err != nil {
+		return nil, err
+	}
+	return this.CacheCommands.SetDictValue(params)
+}
+
+func (this *RestrictedCommands) AppendDictValue(params []string) (bool, error) {
+	if err := this.check("dappend"); err != nil {
+		return false, err
+	}
+	return this.CacheCommands.AppendDictValue(params)
+}
+
+func (this *RestrictedCommands) DeleteDictValue(params []string) (interface{}, error) {
+	if err := this.check("ddelete"); err != nil {
+		return nil, err
+	}
+	return this.CacheCommands.DeleteDictValue(params)
+}
+
+func (this *RestrictedCommands) GetDictSize(params []string) (int, error) {
+	if err := this.check("dsize"); err != nil {
+		return 0, err
+	}
+	return this.CacheCommands.GetDictSize(params)
+}
+
+func (this *RestrictedCommands) GetKeys(params []string) ([]string, error) {
+	if err := this.check("keys"); err != nil {
+		return nil, err
+	}
+	return this.CacheCommands.GetKeys(params)
+}
+
+func (this *RestrictedCommands) UpdateTTL(params []string) (bool, error) {
+	if err := this.check("ttl"); err != nil {
+		return false, err
+	}
+	return this.CacheCommands.UpdateTTL(params)
+}
@@ -0,0 +1,306 @@
+package cache
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_POOL_SIZE    = 8
+	DEFAULT_DIAL_TIMEOUT = 5 * time.Second
+	//Connections that were idle longer are checked before they are used.
+	DEFAULT_HEALTH_CHECK_AGE = 30 * time.Second
+	DEFAULT_MIN_BACKOFF      = 100 * time.Millisecond
+	DEFAULT_MAX_BACKOFF      = 10 * time.Second
+	DEFAULT_MAX_RETRIES      = 3
+)
+
+//Options of a RemoteCache with a pool of connections, see DialRemoteCache().
+type ClientOptions struct {
+	//"tcp" or "unix", TCP is used if it is empty.
+	Network string
+	Address string
+	//Credentials of a user. Without a password the user is logged in by a client certificate of TLSConfig
+	//or by a unix socket of the server, see LoginWithCertificate().
+	User     string
+	Password string
+	CacheId  string
+	//Connections use TLS if the config is set, see utils.NewClientTLSConfig().
+	TLSConfig *tls.Config
+
+	//Max number of open connections, commands wait for a free connection when all of them are busy.
+	PoolSize int
+	//How long opening a connection, logging in and connecting to the cache may take.
+	DialTimeout time.Duration
+	//Connections that were idle longer are checked with "size" command before they are used, broken ones are replaced.
+	HealthCheckAge time.Duration
+	//Delay after a failed connection attempt, it is doubled by every next failure of the pool up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	//How many times a failed connection attempt is repeated before a command returns ErrConnectionLost.
+	MaxRetries int
+}
+
+func DefaultClientOptions() ClientOptions {
+	return ClientOptions{
+		Network:        "tcp",
+		PoolSize:       DEFAULT_POOL_SIZE,
+		DialTimeout:    DEFAULT_DIAL_TIMEOUT,
+		HealthCheckAge: DEFAULT_HEALTH_CHECK_AGE,
+		MinBackoff:     DEFAULT_MIN_BACKOFF,
+		MaxBackoff:     DEFAULT_MAX_BACKOFF,
+		MaxRetries:     DEFAULT_MAX_RETRIES,
+	}
+}
+
+func (this *ClientOptions) validate() error {
+	switch {
+	case this.Address == "":
+		return NewError(BAD_ARGUMENTS, "Address is required")
+	case this.CacheId == "":
+		return NewError(BAD_ARGUMENTS, "Cache id is required")
+	case this.PoolSize <= 0:
+		return NewError(BAD_ARGUMENTS, "Pool size should be positive")
+	case this.DialTimeout <= 0:
+		return NewError(BAD_ARGUMENTS, "Dial timeout should be positive")
+	case this.MinBackoff <= 0 || this.MaxBackoff < this.MinBackoff:
+		return NewError(BAD_ARGUMENTS, "Backoff should be positive and MaxBackoff should not be less than MinBackoff")
+	case this.MaxRetries < 0:
+		return NewError(BAD_ARGUMENTS, "Retries should not be negative")
+	}
+	return nil
+}
+
+//RemoteCache that is safe for concurrent use, every command takes a connection of the pool for the time of its execution.
+//Broken connections are dropped and new ones are opened and logged in again with backoff after failures.
+//A command whose connection is lost returns ErrConnectionLost, it is not repeated because it could be executed already.
+type RemoteCachePool struct {
+	BaseRemoteCache
+	options ClientOptions
+
+	//A command takes a slot before it takes an idle connection or opens a new one, so at most PoolSize connections are open.
+	slots chan struct{}
+
+	lock   sync.Mutex
+	idle   []*pooledConn
+	closed bool
+	//Failed connection attempts in a row, new connections are not opened before <retryAt>.
+	failures int
+	retryAt  time.Time
+}
+
+type pooledConn struct {
+	remote   *BaseRemoteCache
+	lastUsed time.Time
+}
+
+var errPoolClosed = NewError(CONNECTION_LOST, "Remote cache is closed")
+
+//Creates a RemoteCache with a pool of connections to a cache of a server, one connection is opened at once,
+//so wrong addresses and credentials are reported here. The pool should be closed by Close() when it is not needed.
+func DialRemoteCache(options ClientOptions) (*RemoteCachePool, error) {
+	err := options.validate()
+	if err != nil {
+		return nil, err
+	}
+	if options.Network == "" {
+		options.Network = "tcp"
+	}
+
+	pool := new(RemoteCachePool)
+	pool.options = options
+	pool.framed = true
+	pool.pool = pool
+	pool.slots = make(chan struct{}, options.PoolSize)
+
+	conn, err := pool.get(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	pool.put(conn, nil)
+	return pool, nil
+}
+
+//Closes idle connections, busy ones are closed when their commands finish. Later commands return ErrConnectionLost.
+func (this *RemoteCachePool) Close() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.closed = true
+	for _, conn := range this.idle {
+		conn.remote.conn.Close()
+	}
+	this.idle = nil
+	return nil
+}
+
+//Executes a command over a connection of the pool within <ctx>, the connection is dropped if it is broken or interrupted.
+func (this *RemoteCachePool) exec(ctx context.Context, args []string) (interface{}, error) {
+	conn, err := this.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	value, err := conn.remote.withContext(ctx, func() (interface{}, error) {
+		return conn.remote.execFrame(args)
+	})
+	this.put(conn, err)
+	return value, err
+}
+
+//Takes a slot and an idle connection that passes a health check, or opens a new connection if there is no such one.
+//Waiting for a slot, health checks and connecting are interrupted when <ctx> is done.
+func (this *RemoteCachePool) get(ctx context.Context) (*pooledConn, error) {
+	select {
+	case this.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, WrapError(CONNECTION_LOST, ctx.Err())
+	}
+
+	for {
+		this.lock.Lock()
+		if this.closed || ctx.Err() != nil {
+			this.lock.Unlock()
+			<-this.slots
+			if this.closed {
+				return nil, errPoolClosed
+			}
+			return nil, WrapError(CONNECTION_LOST, ctx.Err())
+		}
+		count := len(this.idle)
+		if count == 0 {
+			this.lock.Unlock()
+			break
+		}
+		conn := this.idle[count-1]
+		this.idle = this.idle[:count-1]
+		this.lock.Unlock()
+
+		if time.Since(conn.lastUsed) < this.options.HealthCheckAge {
+			return conn, nil
+		}
+		_, err := conn.remote.withContext(ctx, func() (interface{}, error) {
+			return conn.remote.execFrame([]string{"size"})
+		})
+		if !isBroken(err) {
+			return conn, nil
+		}
+	}
+
+	remote, err := this.reconnect(ctx)
+	if err != nil {
+		<-this.slots
+		return nil, err
+	}
+	return &pooledConn{remote: remote}, nil
+}
+
+//Returns a connection to idle ones and frees its slot, a connection broken by <err> is closed instead.
+func (this *RemoteCachePool) put(conn *pooledConn, err error) {
+	this.lock.Lock()
+	if isBroken(err) || this.closed {
+		conn.remote.conn.Close()
+	} else {
+		conn.lastUsed = time.Now()
+		this.idle = append(this.idle, conn)
+	}
+	this.lock.Unlock()
+	<-this.slots
+}
+
+//Returns true if an error of a command means that its connection can't be used anymore.
+//Errors sent by the server leave the connection usable.
+func isBroken(err error) bool {
+	if err == nil {
+		return false
+	}
+	code := ErrorCodeOf(err)
+	return code == CONNECTION_LOST || code == UNEXPECTED_RESPONSE
+}
+
+//Opens a new connection, failed attempts are repeated up to MaxRetries times after the backoff of the pool.
+//Login failures are not repeated, attempts interrupted by <ctx> are not counted as failures.
+func (this *RemoteCachePool) reconnect(ctx context.Context) (*BaseRemoteCache, error) {
+	for attempt := 0; ; attempt++ {
+		this.lock.Lock()
+		delay := time.Until(this.retryAt)
+		this.lock.Unlock()
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, WrapError(CONNECTION_LOST, ctx.Err())
+			}
+		}
+
+		remote, err := this.connect(ctx)
+		if ctx.Err() != nil {
+			return remote, err
+		}
+		this.lock.Lock()
+		if err == nil {
+			this.failures = 0
+		} else if errors.Is(err, ErrConnectionLost) {
+			this.failures++
+			this.retryAt = time.Now().Add(this.backoff())
+		}
+		this.lock.Unlock()
+
+		if err == nil || !errors.Is(err, ErrConnectionLost) || attempt >= this.options.MaxRetries {
+			return remote, err
+		}
+	}
+}
+
+//Returns the delay after the current number of failures in a row.
+func (this *RemoteCachePool) backoff() time.Duration {
+	delay := this.options.MinBackoff
+	for i := 1; i < this.failures && delay < this.options.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, this.options.MaxBackoff)
+}
+
+//Dials the server, logs the user in and connects to the cache, all of it has to be done within DialTimeout and <ctx>.
+func (this *RemoteCachePool) connect(ctx context.Context) (*BaseRemoteCache, error) {
+	options := this.options
+	ctx, cancel := context.WithTimeout(ctx, options.DialTimeout)
+	defer cancel()
+
+	var conn net.Conn
+	var err error
+	if options.TLSConfig != nil {
+		dialer := &tls.Dialer{Config: options.TLSConfig}
+		conn, err = dialer.DialContext(ctx, options.Network, options.Address)
+	} else {
+		dialer := new(net.Dialer)
+		conn, err = dialer.DialContext(ctx, options.Network, options.Address)
+	}
+	if err != nil {
+		return nil, WrapError(CONNECTION_LOST, err)
+	}
+
+	stop := watchContext(ctx, conn)
+	if options.Password != "" {
+		err = Login(conn, options.User, options.Password, true)
+	} else {
+		_, err = LoginWithCertificate(conn, options.User, true)
+	}
+	var remote RemoteCache
+	if err == nil {
+		remote, err = OpenRemoteCache(conn, options.CacheId)
+	}
+	if cause := stop(); err != nil {
+		conn.Close()
+		if cause != nil {
+			err = WrapError(CONNECTION_LOST, cause)
+		}
+		return nil, err
+	}
+	return remote.(*BaseRemoteCache), nil
+}
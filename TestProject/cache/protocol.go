@@ -0,0 +1,282 @@
+package cache
+
+import (
+	"TestProject/utils"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+)
+
+const (
+	//Version of the framed machine protocol, it is sent by a client right after MAGIC_CMD.
+	PROTOCOL_VERSION = 1
+
+	//Max number of arguments in one command frame.
+	MAX_FRAME_ARGS = 1024
+
+	//Max size of all arguments of one command frame in bytes.
+	MAX_FRAME_SIZE = 64 << 20
+)
+
+//Tags of typed values in responses of the framed protocol.
+const (
+	nilTag byte = iota
+	stringTag
+	boolTag
+	intTag
+	listTag
+	dictTag
+	errorTag
+)
+
+//Writes results of commands to a machine client.
+type ResponseWriter interface {
+	//Writes a value, or an error if it is not <nil>.
+	WriteResponse(value interface{}, err error) error
+}
+
+type jsonResponseWriter struct {
+	conn net.Conn
+}
+
+//Creates a ResponseWriter that writes responses as JsonResponse lines, the original machine protocol.
+func NewJsonResponseWriter(conn net.Conn) ResponseWriter {
+	return &jsonResponseWriter{conn}
+}
+
+func (this *jsonResponseWriter) WriteResponse(value interface{}, err error) error {
+	return WriteResponse(this.conn, value, err)
+}
+
+type framedResponseWriter struct {
+	conn net.Conn
+}
+
+//Creates a ResponseWriter that writes responses as typed binary values of the framed protocol.
+func NewFramedResponseWriter(conn net.Conn) ResponseWriter {
+	return &framedResponseWriter{conn}
+}
+
+func (this *framedResponseWriter) WriteResponse(value interface{}, err error) error {
+	var data []byte
+	if err != nil {
+		data = appendError(data, err)
+	} else {
+		data = appendValue(data, value)
+	}
+	return writeBytes(this.conn, data)
+}
+
+//Returns bytes a client sends before the first command to switch a connection to the framed protocol.
+func createFirstCmd() []byte {
+	command := []byte{}
+	command = append(command, MAGIC_CMD...)
+	command = append(command, PROTOCOL_VERSION)
+	return command
+}
+
+//Checks if a client switches a connection to the framed protocol, see createFirstCmd().
+//Returns <true> if the connection uses the framed protocol, or an error if its version is not supported.
+func ReadHandshake(reader *bufio.Reader) (bool, error) {
+	magic, err := reader.Peek(len(MAGIC_CMD))
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(magic, MAGIC_CMD) {
+		return false, nil
+	}
+
+	reader.Discard(len(MAGIC_CMD))
+	version, err := reader.ReadByte()
+	if err != nil {
+		return true, err
+	}
+	if version != PROTOCOL_VERSION {
+		return true, NewError(BAD_ARGUMENTS, "Unsupported protocol version [%v]", version)
+	}
+	return true, nil
+}
+
+//Writes a command with its arguments as one frame of the framed protocol.
+//A frame is a number of arguments followed by length-prefixed arguments, all numbers are big-endian uint32.
+func WriteFrame(w io.Writer, args []string) error {
+	data := binary.BigEndian.AppendUint32(nil, uint32(len(args)))
+	for _, arg := range args {
+		data = appendString(data, arg)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+//Reads a frame written by WriteFrame().
+//Arguments are returned as is, so they can contain spaces, new lines or any binary data.
+func ReadFrame(reader *bufio.Reader) ([]string, error) {
+	count, err := readUint32(reader)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 || count > MAX_FRAME_ARGS {
+		return nil, NewError(BAD_ARGUMENTS, "Invalid number of arguments [%v]", count)
+	}
+
+	args := make([]string, count)
+	size := 0
+	for i := range args {
+		length, err := readUint32(reader)
+		if err != nil {
+			return nil, err
+		}
+		size += int(length)
+		if size > MAX_FRAME_SIZE {
+			return nil, NewError(BAD_ARGUMENTS, "Frame is bigger than [%v] bytes", MAX_FRAME_SIZE)
+		}
+
+		arg := make([]byte, length)
+		_, err = io.ReadFull(reader, arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = string(arg)
+	}
+	return args, nil
+}
+
+//Reads a typed value written by a framed ResponseWriter.
+//Lists are returned as []interface{}, dictionaries as map[string]interface{} and integers as int64,
+//an error sent by the server is returned as CacheError.
+func ReadValue(reader *bufio.Reader) (interface{}, error) {
+	tag, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag {
+	case nilTag:
+		return nil, nil
+	case stringTag:
+		return readString(reader)
+	case boolTag:
+		value, err := reader.ReadByte()
+		return value != 0, err
+	case intTag:
+		var value int64
+		err = binary.Read(reader, binary.BigEndian, &value)
+		return value, err
+	case listTag:
+		count, err := readUint32(reader)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, 0, utils.Min(int(count), MAX_FRAME_ARGS))
+		for i := uint32(0); i < count; i++ {
+			value, err := ReadValue(reader)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case dictTag:
+		count, err := readUint32(reader)
+		if err != nil {
+			return nil, err
+		}
+		pairs := make(map[string]interface{})
+		for i := uint32(0); i < count; i++ {
+			key, err := readString(reader)
+			if err != nil {
+				return nil, err
+			}
+			pairs[key], err = ReadValue(reader)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return pairs, nil
+	case errorTag:
+		code, err := readString(reader)
+		if err != nil {
+			return nil, err
+		}
+		msg, err := readString(reader)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &CacheError{Code: ErrorCode(code), Msg: msg}
+	}
+	return nil, NewError(UNEXPECTED_RESPONSE, "Unknown value tag [%v]", tag)
+}
+
+func appendValue(data []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return append(data, nilTag)
+	case string:
+		return appendString(append(data, stringTag), v)
+	case bool:
+		if v {
+			return append(data, boolTag, 1)
+		}
+		return append(data, boolTag, 0)
+	case int:
+		return binary.BigEndian.AppendUint64(append(data, intTag), uint64(v))
+	case int64:
+		return binary.BigEndian.AppendUint64(append(data, intTag), uint64(v))
+	case []string:
+		data = binary.BigEndian.AppendUint32(append(data, listTag), uint32(len(v)))
+		for _, s := range v {
+			data = appendValue(data, s)
+		}
+		return data
+	case utils.List:
+		return appendValue(data, v.Values())
+	case []interface{}:
+		data = binary.BigEndian.AppendUint32(append(data, listTag), uint32(len(v)))
+		for _, listValue := range v {
+			data = appendValue(data, listValue)
+		}
+		return data
+	case utils.Dict:
+		return appendValue(data, v.Pairs())
+	case map[string]interface{}:
+		data = binary.BigEndian.AppendUint32(append(data, dictTag), uint32(len(v)))
+		for key, dictValue := range v {
+			data = appendValue(appendString(data, key), dictValue)
+		}
+		return data
+	}
+	return appendString(append(data, stringTag), fmt.Sprint(value))
+}
+
+func appendError(data []byte, err error) []byte {
+	data = appendString(append(data, errorTag), string(ErrorCodeOf(err)))
+	return appendString(data, err.Error())
+}
+
+func appendString(data []byte, s string) []byte {
+	data = binary.BigEndian.AppendUint32(data, uint32(len(s)))
+	return append(data, s...)
+}
+
+func readUint32(reader *bufio.Reader) (uint32, error) {
+	var value uint32
+	err := binary.Read(reader, binary.BigEndian, &value)
+	return value, err
+}
+
+func readString(reader *bufio.Reader) (string, error) {
+	length, err := readUint32(reader)
+	if err != nil {
+		return "", err
+	}
+	if length > MAX_FRAME_SIZE {
+		return "", NewError(UNEXPECTED_RESPONSE, "String is bigger than [%v] bytes", MAX_FRAME_SIZE)
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(reader, data)
+	return string(data), err
+}
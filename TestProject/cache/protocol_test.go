@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"TestProject/utils"
+	"bufio"
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	args := []string{"set", "key with spaces", "line\nbreak", "", "\x00\xff"}
+
+	buffer := new(bytes.Buffer)
+	err := WriteFrame(buffer, args)
+	if err != nil {
+		t.Fatal("Unexpected error during writing frame", err)
+	}
+
+	read, err := ReadFrame(bufio.NewReader(buffer))
+	if err != nil || !reflect.DeepEqual(read, args) {
+		t.Error("Wrong behavior of ReadFrame function")
+	}
+}
+
+func TestReadInvalidFrame(t *testing.T) {
+	_, err := ReadFrame(bufio.NewReader(bytes.NewReader([]byte{0, 0, 0, 0})))
+	if !errors.Is(err, ErrBadArguments) {
+		t.Error("Empty frame should not be accepted")
+	}
+
+	_, err = ReadFrame(bufio.NewReader(bytes.NewReader([]byte{0, 0, 0, 1, 0xff, 0xff, 0xff, 0xff})))
+	if !errors.Is(err, ErrBadArguments) {
+		t.Error("Too big frame should not be accepted")
+	}
+}
+
+func TestValueRoundTrip(t *testing.T) {
+	dict := utils.NewDict()
+	dict.Put("K", "V")
+
+	values := []interface{}{nil, "\x00 binary\n", true, 42, utils.NewSyncList("1", "2"), dict, []string{"A"}}
+	expected := []interface{}{nil, "\x00 binary\n", true, int64(42), []interface{}{"1", "2"}, map[string]interface{}{"K": "V"}, []interface{}{"A"}}
+
+	buffer := new(bytes.Buffer)
+	for _, value := range values {
+		buffer.Write(appendValue(nil, value))
+	}
+	buffer.Write(appendError(nil, notList("A")))
+
+	reader := bufio.NewReader(buffer)
+	for i := range expected {
+		value, err := ReadValue(reader)
+		if err != nil || !reflect.DeepEqual(value, expected[i]) {
+			t.Errorf("Wrong behavior of ReadValue function for [%v]", values[i])
+		}
+	}
+
+	_, err := ReadValue(reader)
+	if !errors.Is(err, ErrWrongType) || err.Error() != "The value for the key [A] is not a list." {
+		t.Error("Wrong behavior of ReadValue function for errors")
+	}
+}
+
+func TestReadHandshake(t *testing.T) {
+	framed, err := ReadHandshake(bufio.NewReader(bytes.NewReader(createFirstCmd())))
+	if !framed || err != nil {
+		t.Error("Wrong behavior of ReadHandshake function")
+	}
+
+	framed, err = ReadHandshake(bufio.NewReader(bytes.NewReader([]byte("connect-to A\n"))))
+	if framed || err != nil {
+		t.Error("Wrong behavior of ReadHandshake function")
+	}
+
+	framed, err = ReadHandshake(bufio.NewReader(bytes.NewReader(append(MAGIC_CMD, 99))))
+	if !framed || err == nil {
+		t.Error("Unsupported protocol version should not be accepted")
+	}
+}
@@ -1,12 +1,15 @@
 package cache
 
 import (
+	"TestProject/utils"
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
 	"strings"
+	"time"
 )
 
 var MAGIC_CMD = []byte{0, 0, 0}
@@ -14,6 +17,8 @@ var buffer [1024]byte
 
 //Represents an API for remote Cache instance usage.
 //Will be useful on any client side.
+//Returned errors are *CacheError, their kind can be checked with errors.Is against ErrWrongType, ErrBadArguments,
+//ErrUnknownCommand, ErrAuthFailed, ErrConnectionLost and ErrCacheFull.
 type RemoteCache interface {
 
 	//Returns a value for a passed <key> that remove Cache contains, or <nil> in case there is no such <key> in a Cache.
@@ -59,13 +64,94 @@ type RemoteCache interface {
 	//Returns size of a remote Cache, the nmber of its key-value pairs at current time.
 	//Can return error, e.g. when a remove Cache is unavailable.
 	Size() (int, error)
+
+	//Returns all keys of a remote Cache.
+	//Can return error, e.g. when a remove Cache is unavailable.
+	GetKeys() ([]string, error)
+
+	//Returns a value by <index> from a list stored in a remote Cache by <key>, or <nil> if there is no such list.
+	//Can return error, e.g. when the value is not a list or <index> is out of bounds.
+	GetListValue(key string, index int) (interface{}, error)
+
+	//Appends a value to a list stored in a remote Cache by <key>, the list is created if it doesn't exist.
+	//Can return error, e.g. when the value is not a list.
+	AppendListValue(key string, value interface{}) error
+
+	//Appends a value to a list stored in a remote Cache by <key>,
+	//the list is created with a specific time to live if it doesn't exist.
+	//Can return error, e.g. when the value is not a list.
+	AppendListValueExpirable(key string, value interface{}, ttl int64) error
+
+	//Removes a value by <index> from a list stored in a remote Cache by <key>.
+	//Returns a removed value.
+	//Can return error, e.g. when the value is not a list or <index> is out of bounds.
+	DeleteListValue(key string, index int) (interface{}, error)
+
+	//Returns size of a list stored in a remote Cache by <key>, or 0 if there is no such list.
+	//Can return error, e.g. when the value is not a list.
+	GetListSize(key string) (int, error)
+
+	//Returns a value by <dictKey> from a dictionary stored in a remote Cache by <key>, or <nil> if there is no such value.
+	//Can return error, e.g. when the value is not a dictionary.
+	GetDictValue(key, dictKey string) (interface{}, error)
+
+	//Puts a key-value pair into a dictionary stored in a remote Cache by <key>, the dictionary is created if it doesn't exist.
+	//Returns a replaced value, or <nil> if the dictionary doesn't contain <dictKey>.
+	//Can return error, e.g. when the value is not a dictionary.
+	SetDictValue(key, dictKey string, value interface{}) (interface{}, error)
+
+	//Puts a key-value pair into a dictionary stored in a remote Cache by <key> if the dictionary doesn't contain <dictKey>.
+	//Returns <true> if the pair was put, otherwise returns <false>.
+	//Can return error, e.g. when the value is not a dictionary.
+	AppendDictValue(key, dictKey string, value interface{}) (bool, error)
+
+	//Removes a key-value pair from a dictionary stored in a remote Cache by <key>.
+	//Returns a removed value, or <nil> if the dictionary doesn't contain <dictKey>.
+	//Can return error, e.g. when the value is not a dictionary.
+	DeleteDictValue(key, dictKey string) (interface{}, error)
+
+	//Returns size of a dictionary stored in a remote Cache by <key>, or 0 if there is no such dictionary.
+	//Can return error, e.g. when the value is not a dictionary.
+	GetDictSize(key string) (int, error)
+
+	//Variants of the methods above that take a context. The deadline of <ctx> is applied to the connection
+	//and a command is interrupted when ctx is cancelled, then ErrConnectionLost wrapping ctx.Err() is returned
+	//and the connection is discarded, because a response of the command could come later.
+	GetContext(ctx context.Context, key string) (interface{}, error)
+	PutContext(ctx context.Context, key string, value interface{}) (interface{}, error)
+	PutExpirableContext(ctx context.Context, key string, value interface{}, ttl int64) (interface{}, error)
+	RemoveContext(ctx context.Context, key string) (interface{}, error)
+	RemovePairContext(ctx context.Context, key string, value interface{}) (bool, error)
+	ReplaceValueContext(ctx context.Context, key string, oldValue, newValue interface{}) (bool, error)
+	ReplaceValueExpirableContext(ctx context.Context, key string, oldValue, newValue interface{}, ttl int64) (bool, error)
+	UpdateTTLContext(ctx context.Context, key string, ttl int64) (bool, error)
+	SizeContext(ctx context.Context) (int, error)
+	GetKeysContext(ctx context.Context) ([]string, error)
+	GetListValueContext(ctx context.Context, key string, index int) (interface{}, error)
+	AppendListValueContext(ctx context.Context, key string, value interface{}) error
+	AppendListValueExpirableContext(ctx context.Context, key string, value interface{}, ttl int64) error
+	DeleteListValueContext(ctx context.Context, key string, index int) (interface{}, error)
+	GetListSizeContext(ctx context.Context, key string) (int, error)
+	GetDictValueContext(ctx context.Context, key, dictKey string) (interface{}, error)
+	SetDictValueContext(ctx context.Context, key, dictKey string, value interface{}) (interface{}, error)
+	AppendDictValueContext(ctx context.Context, key, dictKey string, value interface{}) (bool, error)
+	DeleteDictValueContext(ctx context.Context, key, dictKey string) (interface{}, error)
+	GetDictSizeContext(ctx context.Context, key string) (int, error)
 }
 
 type BaseRemoteCache struct {
 	conn   net.Conn
 	reader *bufio.Reader
+	framed bool
+
+	//A session that is resumed over a new connection when the current one is lost, see OpenResumableRemoteCache()
+	session *resumableSession
+	//Pool whose connections execute commands instead of conn, see DialRemoteCache()
+	pool *RemoteCachePool
 }
 
+//Creates a RemoteCache that uses the original line-based protocol over an already connected cache.
+//Values with spaces or new lines cannot be passed through this protocol, OpenRemoteCache() should be used instead.
 func NewRemoteCache(conn net.Conn) RemoteCache {
 	cache := new(BaseRemoteCache)
 	cache.conn = conn
@@ -73,85 +159,190 @@ func NewRemoteCache(conn net.Conn) RemoteCache {
 	return cache
 }
 
+//Switches an authenticated connection to the framed protocol and connects to a cache with passed <cacheId>.
+//Any string, including binary data, can be passed as a key or a value through the returned RemoteCache.
+func OpenRemoteCache(conn net.Conn, cacheId string) (RemoteCache, error) {
+	cache := new(BaseRemoteCache)
+	cache.conn = conn
+	cache.reader = bufio.NewReader(conn)
+	cache.framed = true
+
+	_, err := conn.Write(createFirstCmd())
+	if err != nil {
+		return nil, WrapError(CONNECTION_LOST, err)
+	}
+
+	_, err = cache.exec(context.Background(), "connect-to", cacheId)
+	if err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
 func (this *BaseRemoteCache) Get(key string) (interface{}, error) {
-	return this.execCmd(assembleCmd("get", key))
+	return this.GetContext(context.Background(), key)
+}
+
+func (this *BaseRemoteCache) GetContext(ctx context.Context, key string) (interface{}, error) {
+	return toValue(this.exec(ctx, "get", key))
 }
 
 func (this *BaseRemoteCache) Put(key string, value interface{}) (interface{}, error) {
-	return this.execCmd(assembleCmd("set", key, value))
+	return this.PutContext(context.Background(), key, value)
+}
+
+func (this *BaseRemoteCache) PutContext(ctx context.Context, key string, value interface{}) (interface{}, error) {
+	return toValue(this.exec(ctx, "set", key, value))
 }
 
 func (this *BaseRemoteCache) PutExpirable(key string, value interface{}, ttl int64) (interface{}, error) {
-	return this.execCmd(assembleCmd("set", key, value, ttl))
+	return this.PutExpirableContext(context.Background(), key, value, ttl)
+}
+
+func (this *BaseRemoteCache) PutExpirableContext(ctx context.Context, key string, value interface{}, ttl int64) (interface{}, error) {
+	return toValue(this.exec(ctx, "set", key, value, ttl))
 }
 
 func (this *BaseRemoteCache) Remove(key string) (interface{}, error) {
-	return this.execCmd(assembleCmd("delete", key))
+	return this.RemoveContext(context.Background(), key)
+}
+
+func (this *BaseRemoteCache) RemoveContext(ctx context.Context, key string) (interface{}, error) {
+	return toValue(this.exec(ctx, "delete", key))
 }
 
 func (this *BaseRemoteCache) RemovePair(key string, value interface{}) (bool, error) {
-	result, err := this.execCmd(assembleCmd("delete", key, value))
+	return this.RemovePairContext(context.Background(), key, value)
+}
+
+func (this *BaseRemoteCache) RemovePairContext(ctx context.Context, key string, value interface{}) (bool, error) {
+	result, err := this.exec(ctx, "delete", key, value)
 	if err != nil {
 		return false, err
 	}
-
-	removed, ok := result.(bool)
-	if !ok {
-		return false, errors.New("Unexpected non-bool value")
-	}
-	return removed, err
+	return result != nil, nil
 }
 
 func (this *BaseRemoteCache) ReplaceValue(key string, oldValue, newValue interface{}) (bool, error) {
-	result, err := this.execCmd(assembleCmd("update", key, oldValue, newValue))
-	if err != nil {
-		return false, err
-	}
+	return this.ReplaceValueContext(context.Background(), key, oldValue, newValue)
+}
 
-	updated, ok := result.(bool)
-	if !ok {
-		return false, errors.New("Unexpected non-bool value")
-	}
-	return updated, err
+func (this *BaseRemoteCache) ReplaceValueContext(ctx context.Context, key string, oldValue, newValue interface{}) (bool, error) {
+	return toBool(this.exec(ctx, "update", key, oldValue, newValue))
 }
 
 func (this *BaseRemoteCache) ReplaceValueExpirable(key string, oldValue, newValue interface{}, ttl int64) (bool, error) {
-	result, err := this.execCmd(assembleCmd("update", key, oldValue, newValue, ttl))
-	if err != nil {
-		return false, err
-	}
+	return this.ReplaceValueExpirableContext(context.Background(), key, oldValue, newValue, ttl)
+}
 
-	updated, ok := result.(bool)
-	if !ok {
-		return false, errors.New("Unexpected non-bool value")
-	}
-	return updated, err
+func (this *BaseRemoteCache) ReplaceValueExpirableContext(ctx context.Context, key string, oldValue, newValue interface{}, ttl int64) (bool, error) {
+	return toBool(this.exec(ctx, "update", key, oldValue, newValue, ttl))
 }
 
 func (this *BaseRemoteCache) UpdateTTL(key string, ttl int64) (bool, error) {
-	result, err := this.execCmd(assembleCmd("ttl", key, ttl))
-	if err != nil {
-		return false, err
-	}
+	return this.UpdateTTLContext(context.Background(), key, ttl)
+}
 
-	updated, ok := result.(bool)
-	if !ok {
-		return false, errors.New("Unexpected non-bool value")
-	}
-	return updated, err
+func (this *BaseRemoteCache) UpdateTTLContext(ctx context.Context, key string, ttl int64) (bool, error) {
+	return toBool(this.exec(ctx, "ttl", key, ttl))
 }
 
 func (this *BaseRemoteCache) Size() (int, error) {
-	result, err := this.execCmd("size")
-	if err != nil {
-		return -1, err
-	}
+	return this.SizeContext(context.Background())
+}
 
-	size, ok := result.(int)
-	if !ok {
-		return -1, errors.New("Unexpected non-bool value")
-	}
-	return size, err
+func (this *BaseRemoteCache) SizeContext(ctx context.Context) (int, error) {
+	return toInt(this.exec(ctx, "size"))
+}
+
+func (this *BaseRemoteCache) GetKeys() ([]string, error) {
+	return this.GetKeysContext(context.Background())
+}
+
+func (this *BaseRemoteCache) GetKeysContext(ctx context.Context) ([]string, error) {
+	return toStrings(this.exec(ctx, "keys"))
+}
+
+func (this *BaseRemoteCache) GetListValue(key string, index int) (interface{}, error) {
+	return this.GetListValueContext(context.Background(), key, index)
+}
+
+func (this *BaseRemoteCache) GetListValueContext(ctx context.Context, key string, index int) (interface{}, error) {
+	return toValue(this.exec(ctx, "lget", key, index))
+}
+
+func (this *BaseRemoteCache) AppendListValue(key string, value interface{}) error {
+	return this.AppendListValueContext(context.Background(), key, value)
+}
+
+func (this *BaseRemoteCache) AppendListValueContext(ctx context.Context, key string, value interface{}) error {
+	_, err := this.exec(ctx, "lappend", key, value)
+	return err
+}
+
+func (this *BaseRemoteCache) AppendListValueExpirable(key string, value interface{}, ttl int64) error {
+	return this.AppendListValueExpirableContext(context.Background(), key, value, ttl)
+}
+
+func (this *BaseRemoteCache) AppendListValueExpirableContext(ctx context.Context, key string, value interface{}, ttl int64) error {
+	_, err := this.exec(ctx, "lappend", key, value, ttl)
+	return err
+}
+
+func (this *BaseRemoteCache) DeleteListValue(key string, index int) (interface{}, error) {
+	return this.DeleteListValueContext(context.Background(), key, index)
+}
+
+func (this *BaseRemoteCache) DeleteListValueContext(ctx context.Context, key string, index int) (interface{}, error) {
+	return toValue(this.exec(ctx, "ldelete", key, index))
+}
+
+func (this *BaseRemoteCache) GetListSize(key string) (int, error) {
+	return this.GetListSizeContext(context.Background(), key)
+}
+
+func (this *BaseRemoteCache) GetListSizeContext(ctx context.Context, key string) (int, error) {
+	return toInt(this.exec(ctx, "lsize", key))
+}
+
+func (this *BaseRemoteCache) GetDictValue(key, dictKey string) (interface{}, error) {
+	return this.GetDictValueContext(context.Background(), key, dictKey)
+}
+
+func (this *BaseRemoteCache) GetDictValueContext(ctx context.Context, key, dictKey string) (interface{}, error) {
+	return toValue(this.exec(ctx, "dget", key, dictKey))
+}
+
+func (this *BaseRemoteCache) SetDictValue(key, dictKey string, value interface{}) (interface{}, error) {
+	return this.SetDictValueContext(context.Background(), key, dictKey, value)
+}
+
+func (this *BaseRemoteCache) SetDictValueContext(ctx context.Context, key, dictKey string, value interface{}) (interface{}, error) {
+	return toValue(this.exec(ctx, "dset", key, dictKey, value))
+}
+
+func (this *BaseRemoteCache) AppendDictValue(key, dictKey string, value interface{}) (bool, error) {
+	return this.AppendDictValueContext(context.Background(), key, dictKey, value)
+}
+
+func (this *BaseRemoteCache) AppendDictValueContext(ctx context.Context, key, dictKey string, value interface{}) (bool, error) {
+	return toBool(this.exec(ctx, "dappend", key, dictKey, value))
+}
+
+func (this *BaseRemoteCache) DeleteDictValue(key, dictKey string) (interface{}, error) {
+	return this.DeleteDictValueContext(context.Background(), key, dictKey)
+}
+
+func (this *BaseRemoteCache) DeleteDictValueContext(ctx context.Context, key, dictKey string) (interface{}, error) {
+	return toValue(this.exec(ctx, "ddelete", key, dictKey))
+}
+
+func (this *BaseRemoteCache) GetDictSize(key string) (int, error) {
+	return this.GetDictSizeContext(context.Background(), key)
+}
+
+func (this *BaseRemoteCache) GetDictSizeContext(ctx context.Context, key string) (int, error) {
+	return toInt(this.exec(ctx, "dsize", key))
 }
 
 func assembleCmd(values ...interface{}) string {
@@ -162,26 +353,193 @@ func assembleCmd(values ...interface{}) string {
 	return strings.Join(strValues, " ")
 }
 
-func createFirstCmd(cmd string) []byte {
-	command := []byte{}
-	command = append(command, MAGIC_CMD...)
-	command = append(command, []byte(cmd)...)
-	command = append(command, '\n')
-	return command
+//Sends a command with its arguments to the server and reads its response within <ctx>.
+func (this *BaseRemoteCache) exec(ctx context.Context, values ...interface{}) (interface{}, error) {
+	if !this.framed {
+		return this.withContext(ctx, func() (interface{}, error) {
+			return this.execCmd(assembleCmd(values...))
+		})
+	}
+
+	args := make([]string, len(values))
+	for i := range values {
+		if data, ok := values[i].([]byte); ok {
+			args[i] = string(data)
+		} else {
+			args[i] = fmt.Sprint(values[i])
+		}
+	}
+
+	if this.pool != nil {
+		return this.pool.exec(ctx, args)
+	}
+	if this.session != nil {
+		return this.execResumable(ctx, args)
+	}
+	return this.withContext(ctx, func() (interface{}, error) {
+		return this.execFrame(args)
+	})
+}
+
+//Runs an <exchange> of a command over the connection within <ctx>, see watchContext().
+//The connection is closed if the exchange breaks it, ErrConnectionLost wraps ctx.Err() if ctx interrupted it.
+func (this *BaseRemoteCache) withContext(ctx context.Context, exchange func() (interface{}, error)) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, WrapError(CONNECTION_LOST, err)
+	}
+
+	stop := watchContext(ctx, this.conn)
+	value, err := exchange()
+	cause := stop()
+	if isBroken(err) {
+		this.conn.Close()
+		if cause != nil {
+			err = WrapError(CONNECTION_LOST, cause)
+		}
+	}
+	return value, err
+}
+
+//Applies the deadline of <ctx> to a connection and interrupts its reads and writes when ctx is cancelled.
+//Returns a function that stops watching and clears the deadline, it returns ctx.Err() if ctx is done by then.
+func watchContext(ctx context.Context, conn net.Conn) func() error {
+	if ctx.Done() == nil {
+		return func() error { return nil }
+	}
+
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		conn.SetDeadline(deadline)
+	}
+	interrupted := make(chan struct{})
+	stopInterrupt := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+		close(interrupted)
+	})
+
+	return func() error {
+		var cause error
+		if !stopInterrupt() {
+			<-interrupted
+			cause = ctx.Err()
+		} else if hasDeadline && !time.Now().Before(deadline) {
+			//The connection can hit the deadline before the timer of ctx fires
+			cause = context.DeadlineExceeded
+		}
+		conn.SetDeadline(time.Time{})
+		return cause
+	}
+}
+
+//Sends a frame of a command and reads its response.
+func (this *BaseRemoteCache) execFrame(args []string) (interface{}, error) {
+	err := WriteFrame(this.conn, args)
+	if err != nil {
+		return nil, WrapError(CONNECTION_LOST, err)
+	}
+	return this.readResponse()
 }
 
+//Reads a response of a framed command, errors sent by the server are returned as they are.
+func (this *BaseRemoteCache) readResponse() (interface{}, error) {
+	value, err := ReadValue(this.reader)
+	var cacheErr *CacheError
+	if err != nil && !errors.As(err, &cacheErr) {
+		return nil, WrapError(CONNECTION_LOST, err)
+	}
+	return value, err
+}
+
+//Sends a command line to the server and reads its response.
+//Errors returned by the server are converted to CacheError, a broken connection results in ErrConnectionLost.
 func (this *BaseRemoteCache) execCmd(cmd string) (interface{}, error) {
 
-	this.conn.Write([]byte(cmd + "\n"))
+	_, err := this.conn.Write([]byte(cmd + "\n"))
+	if err != nil {
+		return nil, WrapError(CONNECTION_LOST, err)
+	}
 
 	result, _, err := this.reader.ReadLine()
 	if err != nil {
-		return nil, err
+		return nil, WrapError(CONNECTION_LOST, err)
 	}
 	response := new(JsonResponse)
 	err = json.Unmarshal(result, response)
+	if err != nil {
+		return nil, WrapError(UNEXPECTED_RESPONSE, err)
+	}
+	return response.Value, response.ToError()
+}
+
+func unexpectedValue(value interface{}, expectedType string) error {
+	return NewError(UNEXPECTED_RESPONSE, "Unexpected value [%v], %v is expected", value, expectedType)
+}
+
+//Converts a value decoded from a response back to a cached value: arrays become lists and objects become dictionaries.
+func toValue(value interface{}, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		return utils.NewSyncList(v...), nil
+	case map[string]interface{}:
+		dict := utils.NewDict()
+		for key, dictValue := range v {
+			dict.Put(key, dictValue)
+		}
+		return dict, nil
+	}
+	return value, nil
+}
+
+func toBool(value interface{}, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+
+	result, ok := value.(bool)
+	if !ok {
+		return false, unexpectedValue(value, "bool")
+	}
+	return result, nil
+}
+
+//Json numbers are decoded as float64 and numbers of the framed protocol as int64, so they are converted to int.
+func toInt(value interface{}, err error) (int, error) {
+	if err != nil {
+		return -1, err
+	}
+
+	switch result := value.(type) {
+	case int64:
+		return int(result), nil
+	case float64:
+		if result == float64(int(result)) {
+			return int(result), nil
+		}
+	}
+	return -1, unexpectedValue(value, "int")
+}
+
+func toStrings(value interface{}, err error) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	return response.Value, nil
+
+	values, ok := value.([]interface{})
+	if !ok && value != nil {
+		return nil, unexpectedValue(value, "array")
+	}
+
+	result := make([]string, len(values))
+	for i := range values {
+		str, ok := values[i].(string)
+		if !ok {
+			return nil, unexpectedValue(values[i], "string")
+		}
+		result[i] = str
+	}
+	return result, nil
 }
@@ -0,0 +1,317 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//Serves machine commands for a passed <cache> the same way the server does it.
+func serveRemoteCache(conn net.Conn, cache Cache) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	cmds := NewJsonCacheCommands(cache, conn, slog.Default())
+	for {
+		line, _, err := reader.ReadLine()
+		if err != nil {
+			return
+		}
+
+		params := strings.Split(string(line), " ")
+		err = ExecuteCommand(cmds, params[0], params[1:])
+		if errors.Is(err, ErrUnknownCommand) {
+			WriteErrorResponse(conn, err)
+		}
+	}
+}
+
+func newTestRemoteCache(cache Cache) (*BaseRemoteCache, net.Conn) {
+	client, server := net.Pipe()
+	go serveRemoteCache(server, cache)
+	return NewRemoteCache(client).(*BaseRemoteCache), server
+}
+
+func TestRemoteCacheErrors(t *testing.T) {
+	cache := NewCache()
+	defer cache.Stop()
+	cache.Put("A", "B")
+	remote, _ := newTestRemoteCache(cache)
+
+	_, err := remote.execCmd("lget A 0")
+	var cacheErr *CacheError
+	if !errors.Is(err, ErrWrongType) || !errors.As(err, &cacheErr) || cacheErr.Msg != "The value for the key [A] is not a list." {
+		t.Error("Wrong type error was not returned by remote cache", err)
+	}
+
+	_, err = remote.Put("C", "D E F")
+	if !errors.Is(err, ErrBadArguments) {
+		t.Error("Bad arguments error was not returned by remote cache", err)
+	}
+
+	_, err = remote.execCmd("unknown")
+	if !errors.Is(err, ErrUnknownCommand) {
+		t.Error("Unknown command error was not returned by remote cache", err)
+	}
+
+	value, err := remote.Get("A")
+	if err != nil || value != "B" {
+		t.Error("Remote cache should stay usable after errors", err)
+	}
+}
+
+func TestRemoteCacheConnectionLost(t *testing.T) {
+	cache := NewCache()
+	defer cache.Stop()
+	remote, server := newTestRemoteCache(cache)
+	server.Close()
+
+	_, err := remote.Get("A")
+	if !errors.Is(err, ErrConnectionLost) {
+		t.Error("Connection lost error was not returned by remote cache", err)
+	}
+}
+
+//Fake server that logs any client in without credentials and answers every framed command with its last argument.
+//"get slow" is answered after a <delay>.
+func serveSlowly(conn net.Conn, delay time.Duration) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	if _, _, err := reader.ReadLine(); err != nil {
+		return
+	}
+	WriteResponse(conn, "test", nil)
+	if framed, err := ReadHandshake(reader); !framed || err != nil {
+		return
+	}
+
+	writer := NewFramedResponseWriter(conn)
+	for {
+		args, err := ReadFrame(reader)
+		if err != nil {
+			return
+		}
+		if args[0] == "get" && args[1] == "slow" {
+			time.Sleep(delay)
+		}
+		writer.WriteResponse(args[len(args)-1], nil)
+	}
+}
+
+func dialSlowServer() (net.Conn, error) {
+	client, server := net.Pipe()
+	go serveSlowly(server, time.Second)
+	return client, nil
+}
+
+func openSlowRemoteCache(t *testing.T) RemoteCache {
+	conn, _ := dialSlowServer()
+	t.Cleanup(func() { conn.Close() })
+	_, err := LoginWithCertificate(conn, "", true)
+	if err != nil {
+		t.Fatal("Login failed", err)
+	}
+	remote, err := OpenRemoteCache(conn, "slow")
+	if err != nil {
+		t.Fatal("Wrong behavior of OpenRemoteCache function", err)
+	}
+	return remote
+}
+
+func TestRemoteCacheContext(t *testing.T) {
+	remote := openSlowRemoteCache(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, err := remote.GetContext(ctx, "slow")
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrConnectionLost) || time.Since(started) > 500*time.Millisecond {
+		t.Error("Command should be interrupted by the deadline of a context", err, time.Since(started))
+	}
+	if _, err = remote.Get("fast"); !errors.Is(err, ErrConnectionLost) {
+		t.Error("Interrupted connection should be discarded", err)
+	}
+
+	remote = openSlowRemoteCache(t)
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err = remote.GetContext(ctx, "slow"); !errors.Is(err, context.Canceled) {
+		t.Error("Command should be interrupted when a context is cancelled", err)
+	}
+
+	remote = openSlowRemoteCache(t)
+	if _, err = remote.PutContext(ctx, "A", "B"); !errors.Is(err, context.Canceled) {
+		t.Error("Command should not be sent with a cancelled context", err)
+	}
+	value, err := remote.Get("fast")
+	if err != nil || value != "fast" {
+		t.Error("Connection should stay usable when a command was not sent", value, err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if value, err = remote.GetDictValueContext(ctx, "D", "fast"); err != nil || value != "fast" {
+		t.Error("Command should be executed within a deadline", value, err)
+	}
+	<-ctx.Done()
+	if value, err = remote.Get("fast"); err != nil || value != "fast" {
+		t.Error("Deadline of a context should not stay on the connection", value, err)
+	}
+}
+
+func TestResumableRemoteCacheContext(t *testing.T) {
+	var dials atomic.Int32
+	remote, err := OpenResumableRemoteCache(func(ctx context.Context) (net.Conn, error) {
+		dials.Add(1)
+		return dialSlowServer()
+	}, "token", "slow")
+	if err != nil {
+		t.Fatal("Wrong behavior of OpenResumableRemoteCache function", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = remote.GetContext(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Command should be interrupted by the deadline of a context", err)
+	}
+	value, err := remote.Get("fast")
+	if err != nil || value != "fast" || dials.Load() != 2 {
+		t.Error("Session should be resumed over a new connection after an interrupted command", value, err, dials.Load())
+	}
+}
+
+func TestResumeContext(t *testing.T) {
+	var stalled atomic.Bool
+	remote, err := OpenResumableRemoteCache(func(ctx context.Context) (net.Conn, error) {
+		if !stalled.Load() {
+			return dialSlowServer()
+		}
+		//The server accepts the connection but never answers
+		client, server := net.Pipe()
+		go io.Copy(io.Discard, server)
+		t.Cleanup(func() { server.Close() })
+		return client, nil
+	}, "token", "slow")
+	if err != nil {
+		t.Fatal("Wrong behavior of OpenResumableRemoteCache function", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = remote.GetContext(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Command should be interrupted by the deadline of a context", err)
+	}
+
+	stalled.Store(true)
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	started := time.Now()
+	if _, err = remote.GetContext(ctx, "fast"); !errors.Is(err, context.Canceled) || time.Since(started) > 500*time.Millisecond {
+		t.Error("Resuming a session should be interrupted when a context is cancelled", err, time.Since(started))
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = remote.GetContext(ctx, "fast"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Resuming a session should be interrupted by the deadline of a context", err)
+	}
+
+	stalled.Store(false)
+	if value, err := remote.Get("fast"); err != nil || value != "fast" {
+		t.Error("Session should be resumed after an interrupted resume", value, err)
+	}
+}
+
+func TestRemoteCachePoolContext(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Cannot listen", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSlowly(conn, 300*time.Millisecond)
+		}
+	}()
+
+	options := DefaultClientOptions()
+	options.Address = listener.Addr().String()
+	options.CacheId = "slow"
+	options.PoolSize = 1
+	pool, err := DialRemoteCache(options)
+	if err != nil {
+		t.Fatal("Wrong behavior of DialRemoteCache function", err)
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = pool.GetContext(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Command should be interrupted by the deadline of a context", err)
+	}
+	value, err := pool.Get("fast")
+	if err != nil || value != "fast" {
+		t.Error("Interrupted connection should be replaced by a new one", value, err)
+	}
+
+	busy := make(chan error)
+	go func() {
+		_, err := pool.Get("slow")
+		busy <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if _, err = pool.GetContext(ctx, "fast"); !errors.Is(err, context.DeadlineExceeded) || time.Since(started) > 200*time.Millisecond {
+		t.Error("Waiting for a free connection should be interrupted by the deadline of a context", err, time.Since(started))
+	}
+	if err = <-busy; err != nil {
+		t.Error("Command of a busy connection should be finished", err)
+	}
+}
+
+func TestJsonResponseErrorCode(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		WriteErrorResponse(server, ErrAuthFailed)
+		WriteErrorResponse(server, errors.New("Disk is full"))
+		server.Close()
+	}()
+
+	reader := bufio.NewReader(client)
+	line, _, _ := reader.ReadLine()
+	response, err := JsonToResponse(line)
+	if err != nil || response.Code != AUTH_FAILED || !errors.Is(response.ToError(), ErrAuthFailed) {
+		t.Error("Wrong behavior of WriteErrorResponse function")
+	}
+
+	line, _, _ = reader.ReadLine()
+	response, err = JsonToResponse(line)
+	if err != nil || response.Code != SERVER_ERROR || response.ToError().Error() != "Disk is full" {
+		t.Error("Wrong behavior of WriteErrorResponse function")
+	}
+}
+
+func TestCacheErrorIs(t *testing.T) {
+	err := NewError(WRONG_TYPE, "The value for the key [%v] is not a list.", "A")
+	if !errors.Is(err, ErrWrongType) || errors.Is(err, ErrBadArguments) {
+		t.Error("Wrong behavior of CacheError.Is function")
+	}
+
+	if ErrorCodeOf(err) != WRONG_TYPE || ErrorCodeOf(errors.New("error")) != SERVER_ERROR {
+		t.Error("Wrong behavior of ErrorCodeOf function")
+	}
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"net"
+)
+
+//State of a RemoteCache that resumes its session when a connection is lost.
+type resumableSession struct {
+	dial    func(ctx context.Context) (net.Conn, error)
+	token   string
+	cacheId string
+	broken  bool
+}
+
+//Connects to a cache with passed <cacheId> within a session of <token>, see LoginWithSession().
+//Connections are opened by <dial>, e.g. by net.Dialer.DialContext(), it should give up when ctx is done. When a connection is lost, a new one is opened, the session is resumed with the token
+//and the same cache is selected again, so the password is not needed anymore.
+//A command that cannot be sent is repeated over the new connection. A command whose response is lost returns ErrConnectionLost,
+//because it could be executed already, the session is resumed by the next command.
+func OpenResumableRemoteCache(dial func(ctx context.Context) (net.Conn, error), token, cacheId string) (RemoteCache, error) {
+	cache := new(BaseRemoteCache)
+	cache.framed = true
+	cache.session = &resumableSession{dial: dial, token: token, cacheId: cacheId}
+
+	err := cache.resume(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+//Opens a new connection, resumes the session over it and selects the cache of the session.
+//Dialing and the handshake are interrupted when <ctx> is done, the session stays broken then.
+func (this *BaseRemoteCache) resume(ctx context.Context) error {
+	if this.conn != nil {
+		this.conn.Close()
+	}
+	this.session.broken = true
+	if err := ctx.Err(); err != nil {
+		return WrapError(CONNECTION_LOST, err)
+	}
+
+	conn, err := this.session.dial(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return WrapError(CONNECTION_LOST, err)
+	}
+	this.conn = conn
+	this.reader = bufio.NewReader(conn)
+
+	_, err = this.withContext(ctx, func() (interface{}, error) {
+		_, err := ResumeSession(conn, this.session.token, true)
+		if err != nil {
+			return nil, err
+		}
+		_, err = conn.Write(createFirstCmd())
+		if err != nil {
+			return nil, WrapError(CONNECTION_LOST, err)
+		}
+		return this.execFrame([]string{"connect-to", this.session.cacheId})
+	})
+	if err != nil {
+		return err
+	}
+
+	this.session.broken = false
+	return nil
+}
+
+//Executes a command within <ctx>, the session is resumed if the connection is lost.
+//A command interrupted by ctx is not repeated, the session is resumed by the next command. Resuming is done within ctx as well.
+func (this *BaseRemoteCache) execResumable(ctx context.Context, args []string) (interface{}, error) {
+	if this.session.broken {
+		err := this.resume(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sent := false
+	exchange := func() (interface{}, error) {
+		err := WriteFrame(this.conn, args)
+		if err != nil {
+			return nil, WrapError(CONNECTION_LOST, err)
+		}
+		sent = true
+		return this.readResponse()
+	}
+
+	value, err := this.withContext(ctx, exchange)
+	if isBroken(err) && !sent && ctx.Err() == nil {
+		err = this.resume(ctx)
+		if err != nil {
+			return nil, err
+		}
+		value, err = this.withContext(ctx, exchange)
+	}
+	if isBroken(err) {
+		this.session.broken = true
+	}
+	return value, err
+}
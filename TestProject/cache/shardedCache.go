@@ -0,0 +1,316 @@
+package cache
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	DEFAULT_SHARDS = 16
+)
+
+//Defines when a write into a Cache really happens.
+type writeMode int
+
+const (
+	writeAlways writeMode = iota
+	writeIfAbsent
+	writeIfPresent
+)
+
+//Cache implementation split into hash-partitioned segments.
+//Each segment has its own lock, so operations on different keys rarely wait for each other.
+//Limits of a Cache are shared by all its segments.
+type shardedCache struct {
+	shards  []*syncMap
+	usage   *usage
+	options CacheOptions
+	sweeper *sweeper
+}
+
+//Returns default options of a Cache
+func DefaultCacheOptions() CacheOptions {
+	return CacheOptions{SweepInterval: DEFAULT_SWEEP_INTERVAL, SweepBudget: DEFAULT_SWEEP_BUDGET, Shards: DEFAULT_SHARDS}
+}
+
+//Creates a new Cache with default options
+func NewCache() Cache {
+	return NewCacheWithOptions(DefaultCacheOptions())
+}
+
+//Creates a Cache of named caches, e.g. of a server.
+//Named caches don't expire, so the registry has no background removal of expired values, only its caches have.
+func NewRegistry() Cache {
+	options := DefaultCacheOptions()
+	options.SweepInterval = 0
+	return NewCacheWithOptions(options)
+}
+
+//Stops background removal of expired values of every named cache of a registry <caches> and of the registry itself.
+func StopCaches(caches Cache) {
+	caches.Range(func(key string, value interface{}, expiresAt time.Time) bool {
+		if c, ok := value.(Cache); ok {
+			c.Stop()
+		}
+		return true
+	})
+	caches.Stop()
+}
+
+//Creates a new Cache with passed options.
+//Background removal of expired values is started immediately and lasts till Stop() is called.
+func NewCacheWithOptions(options CacheOptions) Cache {
+	if options.Shards <= 0 {
+		options.Shards = DEFAULT_SHARDS
+	}
+
+	cache := new(shardedCache)
+	cache.options = options
+	cache.usage = new(usage)
+	cache.shards = make([]*syncMap, options.Shards)
+	for i := range cache.shards {
+		cache.shards[i] = newSyncMap(cache.usage)
+	}
+	cache.sweeper = startSweeper(cache, options.SweepInterval, options.SweepBudget)
+	return cache
+}
+
+//Returns a segment that stores a passed <key>, FNV-1a hash is used.
+func (cache *shardedCache) shard(key string) *syncMap {
+	if len(cache.shards) == 1 {
+		return cache.shards[0]
+	}
+
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return cache.shards[hash%uint32(len(cache.shards))]
+}
+
+func (cache *shardedCache) Get(key string) interface{} {
+	return cache.shard(key).Get(key)
+}
+
+func (cache *shardedCache) Put(key string, value interface{}) interface{} {
+	return valueOrError(cache.PutExpirable(key, value, -1))
+}
+
+func (cache *shardedCache) PutExpirable(key string, value interface{}, ttl int64) (interface{}, error) {
+	v := newCacheValue(key, value, ttl, time.Now())
+	if !cache.makeRoom(key, v, writeAlways, nil) {
+		return nil, ErrCacheFull
+	}
+	return cache.shard(key).PutValue(key, v), nil
+}
+
+func (cache *shardedCache) PutIfAbsent(key string, value interface{}) interface{} {
+	return valueOrError(cache.PutExpirableIfAbsent(key, value, -1))
+}
+
+func (cache *shardedCache) PutExpirableIfAbsent(key string, value interface{}, ttl int64) (interface{}, error) {
+	v := newCacheValue(key, value, ttl, time.Now())
+	if !cache.makeRoom(key, v, writeIfAbsent, nil) {
+		return nil, ErrCacheFull
+	}
+	return cache.shard(key).PutValueIfAbsent(key, v), nil
+}
+
+func (cache *shardedCache) Replace(key string, value interface{}) interface{} {
+	return valueOrError(cache.ReplaceExpirable(key, value, -1))
+}
+
+func (cache *shardedCache) ReplaceExpirable(key string, value interface{}, ttl int64) (interface{}, error) {
+	v := newCacheValue(key, value, ttl, time.Now())
+	if !cache.makeRoom(key, v, writeIfPresent, nil) {
+		return nil, ErrCacheFull
+	}
+	return cache.shard(key).ReplaceWithValue(key, v), nil
+}
+
+//Returns an error in place of a value for methods of utils.SyncMap that have no error result.
+func valueOrError(value interface{}, err error) interface{} {
+	if err != nil {
+		return err
+	}
+	return value
+}
+
+func (cache *shardedCache) ReplaceValue(key string, oldValue, newValue interface{}) bool {
+	v := newCacheValue(key, newValue, -1, time.Now())
+	if !cache.makeRoom(key, v, writeIfPresent, equalTo(oldValue)) {
+		return false
+	}
+	return cache.shard(key).ReplaceEqualValue(key, oldValue, v, true)
+}
+
+func (cache *shardedCache) ReplaceValueExpirable(key string, oldValue, newValue interface{}, ttl int64) (bool, error) {
+	v := newCacheValue(key, newValue, ttl, time.Now())
+	if !cache.makeRoom(key, v, writeIfPresent, equalTo(oldValue)) {
+		return false, ErrCacheFull
+	}
+	return cache.shard(key).ReplaceEqualValue(key, oldValue, v, false), nil
+}
+
+func (cache *shardedCache) GetWithVersion(key string) (interface{}, uint64) {
+	return cache.shard(key).GetWithVersion(key)
+}
+
+func (cache *shardedCache) ReplaceVersion(key string, version uint64, value interface{}, ttl int64) error {
+	v := newCacheValue(key, value, ttl, time.Now())
+	if !cache.makeRoom(key, v, writeIfPresent, func(existingValue *cacheValue) bool { return existingValue.version == version }) {
+		return ErrCacheFull
+	}
+	return cache.shard(key).ReplaceVersionedValue(key, version, v, ttl == KEEP_TTL)
+}
+
+func (cache *shardedCache) Remove(key string) interface{} {
+	return cache.shard(key).Remove(key)
+}
+
+func (cache *shardedCache) RemovePair(key string, value interface{}) bool {
+	return cache.shard(key).RemovePair(key, value)
+}
+
+func (cache *shardedCache) GetKeys() []string {
+	keys := []string{}
+	for _, shard := range cache.shards {
+		keys = append(keys, shard.GetKeys()...)
+	}
+	return keys
+}
+
+func (cache *shardedCache) Size() int {
+	size := 0
+	for _, shard := range cache.shards {
+		size += shard.Size()
+	}
+	return size
+}
+
+func (cache *shardedCache) UpdateTTL(key string, ttl int64) bool {
+	return cache.shard(key).UpdateTTL(key, ttl, false)
+}
+
+func (cache *shardedCache) Expire(key string, ttl int64) bool {
+	return cache.shard(key).UpdateTTL(key, ttl, true)
+}
+
+func (cache *shardedCache) ExpiresAt(key string) (time.Time, bool) {
+	return cache.shard(key).ExpiresAt(key)
+}
+
+func (cache *shardedCache) Range(f func(key string, value interface{}, expiresAt time.Time) bool) {
+	for _, shard := range cache.shards {
+		for _, e := range shard.entries() {
+			if !f(e.key, e.value, e.expiresAt) {
+				return
+			}
+		}
+	}
+}
+
+func (cache *shardedCache) Options() CacheOptions {
+	return cache.options
+}
+
+func (cache *shardedCache) Stop() {
+	cache.sweeper.stop()
+}
+
+//Splits the budget between segments, every segment is checked at least once a pass.
+func (cache *shardedCache) sweep(budget int) int {
+	shardBudget := (budget + len(cache.shards) - 1) / len(cache.shards)
+	expired := 0
+	for _, shard := range cache.shards {
+		expired += shard.sweep(shardBudget)
+	}
+	return expired
+}
+
+func (cache *shardedCache) isBounded() bool {
+	return cache.options.MaxEntries > 0 || cache.options.MaxBytes > 0
+}
+
+//Evicts values till a passed value for a passed <key> fits the limits of a Cache.
+//A conditional replace passes <matches> that checks an existing value, nothing is evicted for a write that won't happen.
+//No lock is held while evicting, so the limits can be slightly exceeded by concurrent writes.
+//Returns <false> if the value cannot be put into a Cache.
+func (cache *shardedCache) makeRoom(key string, value *cacheValue, mode writeMode, matches func(existingValue *cacheValue) bool) bool {
+	if !cache.isBounded() {
+		return true
+	}
+
+	existingValue := cache.shard(key).lookup(key)
+	if (mode == writeIfAbsent && existingValue != nil) || (mode == writeIfPresent && existingValue == nil) {
+		return true
+	}
+	if matches != nil && !matches(existingValue) {
+		return true
+	}
+
+	for evictions := 0; cache.exceedsLimits(existingValue, value); evictions++ {
+		if cache.options.Policy == NO_EVICTION || cache.options.Policy == "" || evictions >= MAX_EVICTIONS_PER_WRITE {
+			return false
+		}
+
+		if !cache.evict(key) {
+			return false
+		}
+	}
+	return true
+}
+
+//Returns a check of an existing value that is equal to <oldValue>.
+func equalTo(oldValue interface{}) func(existingValue *cacheValue) bool {
+	return func(existingValue *cacheValue) bool {
+		return existingValue.value == oldValue
+	}
+}
+
+func (cache *shardedCache) exceedsLimits(existingValue, value *cacheValue) bool {
+	entries := cache.usage.entries.Load()
+	bytes := cache.usage.bytes.Load() + value.size
+	if existingValue != nil {
+		bytes -= existingValue.size
+	} else {
+		entries++
+	}
+
+	if cache.options.MaxEntries > 0 && entries > int64(cache.options.MaxEntries) {
+		return true
+	}
+	return cache.options.MaxBytes > 0 && bytes > cache.options.MaxBytes
+}
+
+//Samples values of several segments starting from a random one and evicts the best candidate.
+//Returns <false> if there is nothing to evict.
+func (cache *shardedCache) evict(exceptKey string) bool {
+	t := time.Now()
+	start := rand.Intn(len(cache.shards))
+
+	var best *victim
+	var bestShard *syncMap
+	checked := 0
+	for i := 0; i < len(cache.shards) && checked < EVICTION_SAMPLES; i++ {
+		shard := cache.shards[(start+i)%len(cache.shards)]
+		candidate, count := shard.sample(cache.options.Policy, exceptKey, EVICTION_SAMPLES-checked, t)
+		checked += count
+		if candidate == nil {
+			continue
+		}
+		if best == nil || candidate.isBetterThan(best, cache.options.Policy) {
+			best, bestShard = candidate, shard
+		}
+		if best.expired || cache.options.Policy == RANDOM {
+			break
+		}
+	}
+
+	if best == nil {
+		return false
+	}
+	bestShard.removeValue(best.key, best.value)
+	return true
+}
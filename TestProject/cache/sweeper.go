@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_SWEEP_INTERVAL = 100 * time.Millisecond
+	DEFAULT_SWEEP_BUDGET   = 20
+)
+
+//Represents anything that can actively remove its expired values.
+type sweepable interface {
+	//Checks up to <budget> values and removes expired ones.
+	//Returns the number of removed values.
+	sweep(budget int) int
+}
+
+//Background routine that periodically removes expired values, the same way as Redis does it:
+//every pass a limited number of values with time to live is checked,
+//the pass is repeated while more than a quarter of checked values were expired
+//and a quarter of the interval is not spent yet.
+type sweeper struct {
+	interval time.Duration
+	budget   int
+	done     chan struct{}
+	stopped  chan struct{}
+	once     sync.Once
+}
+
+//Starts a sweeper for a passed <target>.
+//Returns a sweeper that does nothing in case <interval> or <budget> is not positive.
+func startSweeper(target sweepable, interval time.Duration, budget int) *sweeper {
+	s := &sweeper{interval: interval, budget: budget, done: make(chan struct{}), stopped: make(chan struct{})}
+	if interval > 0 && budget > 0 {
+		go s.run(target)
+	} else {
+		close(s.stopped)
+	}
+	return s
+}
+
+func (this *sweeper) run(target sweepable) {
+	defer close(this.stopped)
+	ticker := time.NewTicker(this.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-this.done:
+			return
+		case <-ticker.C:
+			deadline := time.Now().Add(this.interval / 4)
+			for target.sweep(this.budget) > this.budget/4 && time.Now().Before(deadline) {
+			}
+		}
+	}
+}
+
+//Stops the sweeper and waits till its routine exits, can be called several times.
+func (this *sweeper) stop() {
+	this.once.Do(func() {
+		close(this.done)
+	})
+	<-this.stopped
+}
@@ -8,193 +8,194 @@ const (
 	MAX_LINE_NUMBER_FOR_COMMAND = 20
 )
 
-func NewUserFriendlyCommands(cache Cache, logger utils.Logger) CacheCommands {
-	cmds := new(UserFriendlyCacheCommands)
-	cmds.c = cache
-	cmds.log = logger
-	return cmds
+//Creates commands of a human user that execute passed <cmds>, e.g. BaseCommands(), results are written as replies.
+func NewUserFriendlyCommands(cmds CacheCommands, replies utils.ReplyWriter) CacheCommands {
+	friendly := new(UserFriendlyCacheCommands)
+	friendly.CacheCommands = cmds
+	friendly.replies = replies
+	return friendly
 }
 
 func (this *UserFriendlyCacheCommands) GetValue(params []string) (interface{}, error) {
-	value, err := this.BaseCacheCommands.GetValue(params)
+	value, err := this.CacheCommands.GetValue(params)
 	if err != nil {
-		this.log.Logln("Cannot get value.", err)
+		this.replies.ReplyLines("Cannot get value.", err)
 	} else {
 		if value == nil {
-			this.log.Logf("No value for the key [%v]", params[0])
+			this.replies.Replyf("No value for the key [%v]", params[0])
 		} else {
-			this.log.Log(value)
+			this.replies.Reply(value)
 		}
 	}
 	return value, err
 }
 
 func (this *UserFriendlyCacheCommands) SetValue(params []string) (interface{}, error) {
-	value, err := this.BaseCacheCommands.SetValue(params)
+	value, err := this.CacheCommands.SetValue(params)
 	if err != nil {
-		this.log.Logln("Cannot set value.", err)
+		this.replies.ReplyLines("Cannot set value.", err)
 	} else {
 		if value == nil {
-			this.log.Logf("New value [%v] was set for a key [%v]", params[1], params[0])
+			this.replies.Replyf("New value [%v] was set for a key [%v]", params[1], params[0])
 		} else {
-			this.log.Logf("The value [%v] for the key [%v] was replaced with a new one [%v]", value, params[0], params[1])
+			this.replies.Replyf("The value [%v] for the key [%v] was replaced with a new one [%v]", value, params[0], params[1])
 		}
 	}
 	return value, err
 }
 
 func (this *UserFriendlyCacheCommands) UpdateValue(params []string) (bool, error) {
-	updated, err := this.BaseCacheCommands.UpdateValue(params)
+	updated, err := this.CacheCommands.UpdateValue(params)
 	if err != nil {
-		this.log.Logln("Cannot update value.", err)
+		this.replies.ReplyLines("Cannot update value.", err)
 	} else {
 		if updated {
-			this.log.Logf("The value [%v] for the key [%v] was updated with passed value [%v]", params[1], params[0], params[2])
+			this.replies.Replyf("The value [%v] for the key [%v] was updated with passed value [%v]", params[1], params[0], params[2])
 		} else {
-			this.log.Logf("Cannot update value [%v] for the key [%v], possibly the cached value was updated already", params[1], params[0])
+			this.replies.Replyf("Cannot update value [%v] for the key [%v], possibly the cached value was updated already", params[1], params[0])
 		}
 	}
 	return updated, err
 }
 
 func (this *UserFriendlyCacheCommands) RemoveValue(params []string) (interface{}, bool, error) {
-	oldValue, removed, err := this.BaseCacheCommands.RemoveValue(params)
+	oldValue, removed, err := this.CacheCommands.RemoveValue(params)
 	if err != nil {
-		this.log.Logln("Cannot remove value.", err)
+		this.replies.ReplyLines("Cannot remove value.", err)
 	} else {
 		if removed {
-			this.log.Logf("The value [%v] was deleted for the key [%v]", oldValue, params[0])
+			this.replies.Replyf("The value [%v] was deleted for the key [%v]", oldValue, params[0])
 		} else if oldValue != nil {
-			this.log.Logf("The value [%v] cannot be removed for the key [%v]. Probably the value was already updated.", oldValue, params[0])
+			this.replies.Replyf("The value [%v] cannot be removed for the key [%v]. Probably the value was already updated.", oldValue, params[0])
 		} else {
-			this.log.Logf("There is no value for the key [%v]", params[0])
+			this.replies.Replyf("There is no value for the key [%v]", params[0])
 		}
 	}
 	return oldValue, removed, err
 }
 
 func (this *UserFriendlyCacheCommands) GetKeys(params []string) ([]string, error) {
-	keys, err := this.BaseCacheCommands.GetKeys(params)
+	keys, err := this.CacheCommands.GetKeys(params)
 	if err != nil {
-		this.log.Logln("Cannot get keys.", err)
+		this.replies.ReplyLines("Cannot get keys.", err)
 	} else {
 		displayKeys := keys[:utils.Min(MAX_LINE_NUMBER_FOR_COMMAND, len(keys))]
-		this.log.Logln(utils.ConvertStrings(displayKeys)...)
-		this.log.Logf("Count: [%d/%d]", len(displayKeys), len(keys))
+		this.replies.ReplyLines(utils.ConvertStrings(displayKeys)...)
+		this.replies.Replyf("Count: [%d/%d]", len(displayKeys), len(keys))
 	}
 	return keys, err
 }
 
 func (this *UserFriendlyCacheCommands) GetListValue(params []string) (interface{}, error) {
-	value, err := this.BaseCacheCommands.GetListValue(params)
+	value, err := this.CacheCommands.GetListValue(params)
 	if err != nil {
-		this.log.Log("Cannot get list value.", err)
+		this.replies.Reply("Cannot get list value.", err)
 	} else {
-		this.log.Log(value)
+		this.replies.Reply(value)
 	}
 	return value, err
 }
 
 func (this *UserFriendlyCacheCommands) AppendListValue(params []string) error {
-	err := this.BaseCacheCommands.AppendListValue(params)
+	err := this.CacheCommands.AppendListValue(params)
 	if err != nil {
-		this.log.Logln("Append operation has been failed.", err)
+		this.replies.ReplyLines("Append operation has been failed.", err)
 	} else {
-		this.log.Logf("The value [%v] is appended.", params[1])
+		this.replies.Replyf("The value [%v] is appended.", params[1])
 	}
 	return err
 }
 
 func (this *UserFriendlyCacheCommands) DeleteListValue(params []string) (interface{}, error) {
-	value, err := this.BaseCacheCommands.DeleteListValue(params)
+	value, err := this.CacheCommands.DeleteListValue(params)
 	if err != nil {
-		this.log.Logln("Cannot delete value.", err)
+		this.replies.ReplyLines("Cannot delete value.", err)
 	} else {
-		this.log.Logf("The value [%v] was deleted.", value)
+		this.replies.Replyf("The value [%v] was deleted.", value)
 	}
 	return value, err
 }
 
 func (this *UserFriendlyCacheCommands) GetListSize(params []string) (int, error) {
-	value, err := this.BaseCacheCommands.GetListSize(params)
+	value, err := this.CacheCommands.GetListSize(params)
 	if err != nil {
-		this.log.Logln("Cannot get size of a list.", err)
+		this.replies.ReplyLines("Cannot get size of a list.", err)
 	} else {
-		this.log.Log(value)
+		this.replies.Reply(value)
 	}
 	return value, err
 }
 
 func (this *UserFriendlyCacheCommands) GetDictValue(params []string) (interface{}, error) {
-	value, err := this.BaseCacheCommands.GetDictValue(params)
+	value, err := this.CacheCommands.GetDictValue(params)
 	if err != nil {
-		this.log.Logln("Cannot get dictionary value.", err)
+		this.replies.ReplyLines("Cannot get dictionary value.", err)
 	} else {
-		this.log.Log(value)
+		this.replies.Reply(value)
 	}
 	return value, err
 }
 
 func (this *UserFriendlyCacheCommands) SetDictValue(params []string) (interface{}, error) {
-	value, err := this.BaseCacheCommands.SetDictValue(params)
+	value, err := this.CacheCommands.SetDictValue(params)
 	if err != nil {
-		this.log.Logln("Cannot set dictionary value.", err)
+		this.replies.ReplyLines("Cannot set dictionary value.", err)
 	} else if value == nil {
-		this.log.Logf("The dictionary pair was added sucessfully.")
+		this.replies.Replyf("The dictionary pair was added sucessfully.")
 	} else {
-		this.log.Logf("The value [%v] was replaced.", value)
+		this.replies.Replyf("The value [%v] was replaced.", value)
 	}
 	return value, err
 }
 
 func (this *UserFriendlyCacheCommands) DeleteDictValue(params []string) (interface{}, error) {
-	value, err := this.BaseCacheCommands.DeleteDictValue(params)
+	value, err := this.CacheCommands.DeleteDictValue(params)
 	if err != nil {
-		this.log.Logln("Cannot delete dictionary value.", err)
+		this.replies.ReplyLines("Cannot delete dictionary value.", err)
 	} else if value == nil {
-		this.log.Log("Dictionary does not contain a value for this key")
+		this.replies.Reply("Dictionary does not contain a value for this key")
 	} else {
-		this.log.Logf("The value [%v] was deleted.", value)
+		this.replies.Replyf("The value [%v] was deleted.", value)
 	}
 	return value, err
 }
 
 func (this *UserFriendlyCacheCommands) AppendDictValue(params []string) (bool, error) {
-	appended, err := this.BaseCacheCommands.AppendDictValue(params)
+	appended, err := this.CacheCommands.AppendDictValue(params)
 	if err != nil {
-		this.log.Logln("Cannot append dictionary value.", err)
+		this.replies.ReplyLines("Cannot append dictionary value.", err)
 	} else if appended {
-		this.log.Log("The value was appended sucessfully.")
+		this.replies.Reply("The value was appended sucessfully.")
 	} else {
-		this.log.Log("Cannot append dictionary value, potentially the value exists.")
+		this.replies.Reply("Cannot append dictionary value, potentially the value exists.")
 	}
 	return appended, err
 }
 
 func (this *UserFriendlyCacheCommands) GetDictSize(params []string) (int, error) {
-	size, err := this.BaseCacheCommands.GetDictSize(params)
+	size, err := this.CacheCommands.GetDictSize(params)
 	if err != nil {
-		this.log.Logln("Cannot get size of the dictionary.", err)
+		this.replies.ReplyLines("Cannot get size of the dictionary.", err)
 	} else {
-		this.log.Log(size)
+		this.replies.Reply(size)
 	}
 	return size, err
 }
 
 func (this *UserFriendlyCacheCommands) UpdateTTL(params []string) (bool, error) {
-	updated, err := this.BaseCacheCommands.UpdateTTL(params)
+	updated, err := this.CacheCommands.UpdateTTL(params)
 	if err != nil {
-		this.log.Logln("Cannot update ttl.", err)
+		this.replies.ReplyLines("Cannot update ttl.", err)
 	} else if !updated {
-		this.log.Log("Ttl was not updated, potentially there is no value in cache anymore.")
+		this.replies.Reply("Ttl was not updated, potentially there is no value in cache anymore.")
 	} else {
-		this.log.Log("Ttl was updated sucessfully.")
+		this.replies.Reply("Ttl was updated sucessfully.")
 	}
 	return updated, err
 }
 
 func (this *UserFriendlyCacheCommands) GetSize() int {
-	size := this.BaseCacheCommands.GetSize()
-	this.log.Log(size)
+	size := this.CacheCommands.GetSize()
+	this.replies.Reply(size)
 	return size
 }
@@ -0,0 +1,443 @@
+package config
+
+import (
+	"TestProject/audit"
+	"TestProject/auth"
+	"TestProject/persist"
+	"TestProject/server"
+	"TestProject/utils"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CONFIG_FILE = "server.json"
+	//Environment variable with a path of the config file, the same as -config flag.
+	CONFIG_ENV = "CACHE_CONFIG"
+	//Prefix of environment variables that override settings, e.g. CACHE_IDLE_TIMEOUT for -idle-timeout flag.
+	ENV_PREFIX = "CACHE_"
+
+	DEFAULT_ADDRESS          = ":8086"
+	DEFAULT_RESP_ADDRESS     = ":6380"
+	DEFAULT_CERT_FILE        = "cert.pem"
+	DEFAULT_KEY_FILE         = "key.pem"
+	DEFAULT_CLIENT_CA_FILE   = "clientCA.pem"
+	DEFAULT_SNAPSHOT_FILE    = "caches.snapshot"
+	DEFAULT_COMMAND_LOG_FILE = "commands.log"
+	DEFAULT_SOCKET_MODE      = "0600"
+
+	NETWORK_TCP  = "tcp"
+	NETWORK_UNIX = "unix"
+)
+
+//Duration that is written in Json as a string, e.g. "90s" or "5m".
+type Duration time.Duration
+
+func (this Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(this).String())
+}
+
+func (this *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Duration should be a string like \"90s\", not [%s]", data))
+	}
+	return this.parse(value)
+}
+
+func (this *Duration) parse(value string) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Invalid duration [%v]", value))
+	}
+	*this = Duration(duration)
+	return nil
+}
+
+//Additional listener of telnet and machine clients, see server.Listener.
+type ListenerConfig struct {
+	//NETWORK_TCP or NETWORK_UNIX, TCP by default.
+	Network string `json:",omitempty"`
+	//Address of a TCP listener, e.g. "[::1]:8086", or a path of a unix socket.
+	Address string
+	//Connections use TLS with the certificate of the server. Plaintext TCP listeners are allowed on loopback addresses only.
+	TLS bool `json:",omitempty"`
+	//Auth policy: login (default), certificate, peer or trust.
+	Auth server.AuthPolicy `json:",omitempty"`
+	//User of a trust socket.
+	User string `json:",omitempty"`
+	//Users of a peer socket by OS user ids or names, e.g. {"1000": "app"}.
+	PeerUsers map[string]string `json:",omitempty"`
+	//File permissions of a unix socket in octal, DEFAULT_SOCKET_MODE by default.
+	Mode string `json:",omitempty"`
+}
+
+//Returns file permissions of a unix socket.
+func (this *ListenerConfig) FileMode() (os.FileMode, error) {
+	mode := this.Mode
+	if mode == "" {
+		mode = DEFAULT_SOCKET_MODE
+	}
+	value, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || value > 0777 {
+		return 0, errors.New(fmt.Sprintf("Mode [%v] should be octal permissions like \"0660\"", this.Mode))
+	}
+	return os.FileMode(value), nil
+}
+
+func (this *ListenerConfig) validate() error {
+	policy, err := server.ParseAuthPolicy(string(this.Auth))
+	if err != nil {
+		return err
+	}
+	switch this.Network {
+	case "", NETWORK_TCP:
+		if _, _, err := net.SplitHostPort(this.Address); err != nil {
+			return errors.New(fmt.Sprintf("Address [%v] should be host:port or :port", this.Address))
+		}
+		if !this.TLS && !server.IsLoopback(this.Address) {
+			return errors.New(fmt.Sprintf("Plaintext address [%v] should be a loopback address", this.Address))
+		}
+		if policy == server.AUTH_PEER || policy == server.AUTH_TRUST {
+			return errors.New(fmt.Sprintf("Auth policy %v requires a unix socket", policy))
+		}
+	case NETWORK_UNIX:
+		if this.Address == "" {
+			return errors.New("Path of the socket is required")
+		}
+		if _, err := this.FileMode(); err != nil {
+			return err
+		}
+	default:
+		return errors.New(fmt.Sprintf("Unknown network [%v]", this.Network))
+	}
+
+	switch {
+	case policy == server.AUTH_CERTIFICATE && !this.TLS:
+		return errors.New("Certificate login requires TLS")
+	case policy == server.AUTH_PEER && len(this.PeerUsers) == 0:
+		return errors.New("Peer users are required")
+	case policy == server.AUTH_TRUST && this.User == "":
+		return errors.New("Trusted user is required")
+	}
+	return nil
+}
+
+//Configuration of the server.
+//Settings are taken from defaults, then from the config file, then from environment variables, then from command-line flags,
+//a later source overrides an earlier one. See Load().
+type Config struct {
+	//Addresses of listeners, e.g. ":8086" or "127.0.0.1:8086". Redis, HTTP and memcached listeners are disabled when their addresses are empty.
+	//Address of telnet and machine clients can be empty if there are other Listeners of them.
+	Address         string
+	RespAddress     string
+	HttpAddress     string `json:",omitempty"`
+	MemcacheAddress string `json:",omitempty"`
+	//More listeners of telnet and machine clients: unix sockets, plaintext loopback or other TLS addresses.
+	Listeners []ListenerConfig `json:",omitempty"`
+
+	//Certificate and key of the server.
+	CertFile string
+	KeyFile  string
+	//CAs of client certificates, clients are not asked for certificates if the file doesn't exist.
+	ClientCAFile string
+
+	UsersFile      string
+	SessionKeyFile string
+
+	//How long a telnet connection may wait for the next command.
+	IdleTimeout Duration
+	//How long commands that are being executed are waited for when the server stops.
+	ShutdownTimeout Duration
+	//Limits of new caches whose ids match patterns, the first matching pattern wins.
+	Caches []server.CacheLimits `json:",omitempty"`
+
+	SnapshotFile     string
+	SnapshotInterval Duration
+	CommandLogFile   string
+	Fsync            persist.FsyncPolicy
+
+	//Server log, it is read from "logging.json" if the config file has no such section.
+	Log utils.LogOptions
+	//Audit log, options are read from "audit.json" if the config file has no such section.
+	AuditFile string
+	Audit     audit.AuditOptions
+}
+
+//Returns the default configuration, it is the same as the server had before the config file was added.
+func DefaultConfig() *Config {
+	return &Config{
+		Address:          DEFAULT_ADDRESS,
+		RespAddress:      DEFAULT_RESP_ADDRESS,
+		CertFile:         DEFAULT_CERT_FILE,
+		KeyFile:          DEFAULT_KEY_FILE,
+		ClientCAFile:     DEFAULT_CLIENT_CA_FILE,
+		UsersFile:        auth.USERS_FILE,
+		SessionKeyFile:   auth.SESSION_KEY_FILE,
+		IdleTimeout:      Duration(server.DEFAULT_IDLE_TIMEOUT),
+		ShutdownTimeout:  Duration(server.DEFAULT_SHUTDOWN_TIMEOUT),
+		SnapshotFile:     DEFAULT_SNAPSHOT_FILE,
+		SnapshotInterval: Duration(server.DEFAULT_SNAPSHOT_INTERVAL),
+		CommandLogFile:   DEFAULT_COMMAND_LOG_FILE,
+		Fsync:            persist.FSYNC_EVERY_SECOND,
+		Log:              utils.DefaultLogOptions(),
+		AuditFile:        audit.AUDIT_FILE,
+		Audit:            audit.DefaultAuditOptions(),
+	}
+}
+
+//Setting that can be overridden by an environment variable and a command-line flag.
+type setting struct {
+	//Name of the flag, the environment variable is ENV_PREFIX followed by the name in upper case with underscores.
+	name  string
+	usage string
+	set   func(config *Config, value string) error
+}
+
+func (this *setting) env() string {
+	return ENV_PREFIX + strings.ToUpper(strings.ReplaceAll(this.name, "-", "_"))
+}
+
+func setString(field func(config *Config) *string) func(config *Config, value string) error {
+	return func(config *Config, value string) error {
+		*field(config) = value
+		return nil
+	}
+}
+
+func setDuration(field func(config *Config) *Duration) func(config *Config, value string) error {
+	return func(config *Config, value string) error {
+		return field(config).parse(value)
+	}
+}
+
+var settings = []setting{
+	{"address", "address of telnet and machine clients, e.g. :8086", setString(func(c *Config) *string { return &c.Address })},
+	{"resp-address", "address of Redis clients, e.g. :6380", setString(func(c *Config) *string { return &c.RespAddress })},
+	{"http-address", "address of the HTTPS gateway, disabled when empty", setString(func(c *Config) *string { return &c.HttpAddress })},
+	{"memcache-address", "address of memcached clients, disabled when empty", setString(func(c *Config) *string { return &c.MemcacheAddress })},
+	{"cert-file", "certificate of the server", setString(func(c *Config) *string { return &c.CertFile })},
+	{"key-file", "key of the server certificate", setString(func(c *Config) *string { return &c.KeyFile })},
+	{"client-ca-file", "CAs of client certificates", setString(func(c *Config) *string { return &c.ClientCAFile })},
+	{"users-file", "file of users", setString(func(c *Config) *string { return &c.UsersFile })},
+	{"session-key-file", "secret key of session tokens", setString(func(c *Config) *string { return &c.SessionKeyFile })},
+	{"idle-timeout", "idle timeout of telnet connections, e.g. 60s", setDuration(func(c *Config) *Duration { return &c.IdleTimeout })},
+	{"shutdown-timeout", "how long commands are waited for on shutdown, e.g. 10s", setDuration(func(c *Config) *Duration { return &c.ShutdownTimeout })},
+	{"snapshot-file", "file of snapshots of caches", setString(func(c *Config) *string { return &c.SnapshotFile })},
+	{"snapshot-interval", "interval of snapshots, e.g. 5m", setDuration(func(c *Config) *Duration { return &c.SnapshotInterval })},
+	{"command-log-file", "file of the command log", setString(func(c *Config) *string { return &c.CommandLogFile })},
+	{"fsync", "fsync policy of the command log: always, everysec or never", func(c *Config, value string) error {
+		c.Fsync = persist.FsyncPolicy(value)
+		return nil
+	}},
+	{"log-level", "level of the server log: debug, info, warn or error", setString(func(c *Config) *string { return &c.Log.Level })},
+	{"log-format", "format of the server log: text or json", setString(func(c *Config) *string { return &c.Log.Format })},
+	{"log-file", "file of the server log, stderr when empty", setString(func(c *Config) *string { return &c.Log.File })},
+	{"audit-file", "file of the audit log", setString(func(c *Config) *string { return &c.AuditFile })},
+}
+
+//Positional arguments the server had before flags were added: [port] [fsync] [respPort] [httpPort] [memcachePort].
+var positionalSettings = []string{"address", "fsync", "resp-address", "http-address", "memcache-address"}
+
+//Reads the configuration from the config file, environment variables returned by <getenv> and command-line <args>.
+//The config file is passed with -config flag or CACHE_CONFIG variable, "server.json" is read if it exists otherwise.
+//Flags can be followed by positional arguments the server had before: [port] [fsync] [respPort] [httpPort] [memcachePort].
+//Returns an error that names a wrong setting and where it came from.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	configFile := flags.String("config", "", "config file, "+CONFIG_FILE+" by default")
+	for _, s := range settings {
+		flags.String(s.name, "", s.usage+", overrides "+s.env())
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	fileName := *configFile
+	if fileName == "" {
+		fileName = getenv(CONFIG_ENV)
+	}
+	required := fileName != ""
+	if !required {
+		fileName = CONFIG_FILE
+	}
+	config, err := ReadConfig(fileName, required)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range settings {
+		if value := getenv(s.env()); value != "" {
+			if err = s.set(config, value); err != nil {
+				return nil, errors.New(fmt.Sprintf("Invalid environment variable %v: %v", s.env(), err))
+			}
+		}
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if err == nil && s.name == f.Name {
+				if setErr := s.set(config, f.Value.String()); setErr != nil {
+					err = errors.New(fmt.Sprintf("Invalid flag -%v: %v", f.Name, setErr))
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.setPositional(flags.Args())
+	if err != nil {
+		return nil, err
+	}
+	return config, config.Validate()
+}
+
+func (this *Config) setPositional(args []string) error {
+	if len(args) > len(positionalSettings) {
+		return errors.New(fmt.Sprintf("Too many arguments [%v]", strings.Join(args, " ")))
+	}
+	for i, value := range args {
+		name := positionalSettings[i]
+		if strings.HasSuffix(name, "address") {
+			if err := utils.CheckPort(value); err != nil {
+				return errors.New(fmt.Sprintf("Invalid port [%v] is provided.", value))
+			}
+			value = ":" + value
+		}
+		for _, s := range settings {
+			if s.name == name {
+				s.set(this, value)
+			}
+		}
+	}
+	return nil
+}
+
+//Reads the configuration from a Json file <fileName>, settings that are missing in the file keep default values.
+//Default configuration is returned if the file doesn't exist and it is not <required>.
+//Unknown settings in the file are reported as errors.
+func ReadConfig(fileName string, required bool) (*Config, error) {
+	config := DefaultConfig()
+
+	var err error
+	config.Log, err = utils.ReadLogOptions(utils.LOG_OPTIONS_FILE)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Cannot read [%v]: %v", utils.LOG_OPTIONS_FILE, err))
+	}
+	config.Audit, err = audit.ReadAuditOptions(audit.AUDIT_OPTIONS_FILE)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Cannot read [%v]: %v", audit.AUDIT_OPTIONS_FILE, err))
+	}
+
+	data, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) && !required {
+		return config, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(config)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Cannot read config file [%v]: %v", fileName, err))
+	}
+	return config, nil
+}
+
+//Checks all settings, the error names the first wrong setting.
+func (this *Config) Validate() error {
+	addresses := []struct {
+		name, value string
+		required    bool
+	}{{"Address", this.Address, len(this.Listeners) == 0}, {"RespAddress", this.RespAddress, false}, {"HttpAddress", this.HttpAddress, false}, {"MemcacheAddress", this.MemcacheAddress, false}}
+	for _, address := range addresses {
+		if address.value == "" && !address.required {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(address.value); err != nil {
+			return errors.New(fmt.Sprintf("Invalid setting %v: address [%v] should be host:port or :port", address.name, address.value))
+		}
+	}
+	for i := range this.Listeners {
+		if err := this.Listeners[i].validate(); err != nil {
+			return errors.New(fmt.Sprintf("Invalid setting Listeners[%v]: %v", i, err))
+		}
+	}
+
+	files := []struct{ name, value string }{{"CertFile", this.CertFile}, {"KeyFile", this.KeyFile}, {"UsersFile", this.UsersFile}, {"SessionKeyFile", this.SessionKeyFile},
+		{"SnapshotFile", this.SnapshotFile}, {"CommandLogFile", this.CommandLogFile}, {"AuditFile", this.AuditFile}}
+	for _, file := range files {
+		if file.value == "" {
+			return errors.New(fmt.Sprintf("Invalid setting %v: file is required", file.name))
+		}
+	}
+
+	if this.IdleTimeout <= 0 {
+		return errors.New("Invalid setting IdleTimeout: it should be positive")
+	}
+	if this.ShutdownTimeout <= 0 {
+		return errors.New("Invalid setting ShutdownTimeout: it should be positive")
+	}
+	if this.SnapshotInterval <= 0 {
+		return errors.New("Invalid setting SnapshotInterval: it should be positive")
+	}
+	if _, err := persist.ParseFsyncPolicy(string(this.Fsync)); err != nil {
+		return errors.New(fmt.Sprintf("Invalid setting Fsync: %v", err))
+	}
+	if err := this.Log.Validate(); err != nil {
+		return errors.New(fmt.Sprintf("Invalid setting Log: %v", err))
+	}
+	if err := this.Audit.Validate(); err != nil {
+		return errors.New(fmt.Sprintf("Invalid setting Audit: %v", err))
+	}
+	runtime := this.Runtime()
+	if err := runtime.Validate(); err != nil {
+		return errors.New(fmt.Sprintf("Invalid setting Caches: %v", err))
+	}
+	return nil
+}
+
+//Returns settings that can be changed while the server runs: the idle timeout and limits of caches.
+//The level of the server log can be changed as well.
+func (this *Config) Runtime() server.RuntimeOptions {
+	return server.RuntimeOptions{IdleTimeout: time.Duration(this.IdleTimeout), CacheLimits: this.Caches}
+}
+
+//Returns names of settings that differ in <other> configuration and can't be changed without a restart of the server.
+func (this *Config) RestartRequired(other *Config) []string {
+	fixed := func(config *Config) map[string]interface{} {
+		return map[string]interface{}{
+			"Address": config.Address, "Listeners": config.Listeners, "RespAddress": config.RespAddress, "HttpAddress": config.HttpAddress, "MemcacheAddress": config.MemcacheAddress,
+			"CertFile": config.CertFile, "KeyFile": config.KeyFile, "ClientCAFile": config.ClientCAFile,
+			"UsersFile": config.UsersFile, "SessionKeyFile": config.SessionKeyFile, "ShutdownTimeout": config.ShutdownTimeout,
+			"SnapshotFile": config.SnapshotFile, "SnapshotInterval": config.SnapshotInterval, "CommandLogFile": config.CommandLogFile, "Fsync": config.Fsync,
+			"Log.Format": config.Log.Format, "Log.File": config.Log.File, "Log.MaxSize": config.Log.MaxSize, "Log.MaxBackups": config.Log.MaxBackups,
+			"AuditFile": config.AuditFile, "Audit": config.Audit,
+		}
+	}
+
+	current, changed := fixed(this), fixed(other)
+	names := []string{}
+	for name, value := range current {
+		if !reflect.DeepEqual(value, changed[name]) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"TestProject/cache"
+	"TestProject/persist"
+	"TestProject/server"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//Returns environment variables of a test.
+func environment(variables map[string]string) func(string) string {
+	return func(name string) string {
+		return variables[name]
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	fileName := filepath.Join(t.TempDir(), CONFIG_FILE)
+	os.WriteFile(fileName, []byte(content), 0600)
+	return fileName
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	config, err := Load(nil, environment(nil))
+	if err != nil || config.Address != DEFAULT_ADDRESS || config.IdleTimeout != Duration(time.Minute) || config.Fsync != persist.FSYNC_EVERY_SECOND {
+		t.Error("Default configuration should be used without a config file", config, err)
+	}
+
+	fileName := writeConfig(t, `{"Address":":9000","RespAddress":":9001","IdleTimeout":"30s","Fsync":"always",
+		"Caches":[{"Pattern":"session-*","MaxEntries":100,"Policy":"lru"}],"Log":{"Level":"debug"}}`)
+	env := map[string]string{CONFIG_ENV: fileName, "CACHE_RESP_ADDRESS": ":9101", "CACHE_IDLE_TIMEOUT": "20s"}
+
+	config, err = Load([]string{"-idle-timeout", "10s"}, environment(env))
+	if err != nil {
+		t.Fatal("Wrong behavior of Load function", err)
+	}
+	if config.Address != ":9000" || config.Fsync != persist.FSYNC_ALWAYS || config.Log.Level != "debug" || config.Log.Format != "text" {
+		t.Error("Settings of the config file should override defaults", config)
+	}
+	if config.RespAddress != ":9101" {
+		t.Error("Environment variables should override the config file", config.RespAddress)
+	}
+	if config.IdleTimeout != Duration(10*time.Second) {
+		t.Error("Flags should override environment variables", config.IdleTimeout)
+	}
+	if len(config.Caches) != 1 || config.Caches[0].MaxEntries != 100 || config.Caches[0].Policy != cache.LRU {
+		t.Error("Limits of caches should be read", config.Caches)
+	}
+
+	config, err = Load([]string{"-config", fileName, "-fsync", "never", "8087", "everysec", "6390"}, environment(nil))
+	if err != nil || config.Address != ":8087" || config.Fsync != persist.FSYNC_EVERY_SECOND || config.RespAddress != ":6390" || config.HttpAddress != "" {
+		t.Error("Positional arguments should be accepted after flags", config, err)
+	}
+
+	config, err = Load([]string{"-resp-address", ""}, environment(nil))
+	if err != nil || config.RespAddress != "" {
+		t.Error("Redis listener should be disabled by an empty address", config, err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	expected := map[string][]string{
+		"Invalid environment variable CACHE_IDLE_TIMEOUT": {"-address", ":1"},
+		"Invalid flag -snapshot-interval":                 {"-snapshot-interval", "often"},
+		"Invalid setting Fsync":                           {"-fsync", "sometimes"},
+		"Invalid setting HttpAddress":                     {"-http-address", "8443"},
+		"Invalid setting Log":                             {"-log-level", "verbose"},
+		"Invalid port [port]":                             {"port"},
+		"Too many arguments":                              {"1", "always", "2", "3", "4", "5"},
+	}
+	for message, args := range expected {
+		env := map[string]string{}
+		if strings.Contains(message, "CACHE_IDLE_TIMEOUT") {
+			env["CACHE_IDLE_TIMEOUT"] = "forever"
+		}
+		_, err := Load(args, environment(env))
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Error("Wrong error of Load function", args, err)
+		}
+	}
+
+	_, err := Load([]string{"-config", "missing.json"}, environment(nil))
+	if err == nil {
+		t.Error("Config file passed explicitly should exist")
+	}
+
+	fileName := writeConfig(t, `{"Adress":":9000"}`)
+	_, err = Load([]string{"-config", fileName}, environment(nil))
+	if err == nil || !strings.Contains(err.Error(), "Adress") {
+		t.Error("Unknown settings should not be accepted", err)
+	}
+
+	fileName = writeConfig(t, `{"Caches":[{"Pattern":"a-*","Policy":"oldest"}]}`)
+	_, err = Load([]string{"-config", fileName}, environment(nil))
+	if err == nil || !strings.Contains(err.Error(), "Invalid setting Caches") {
+		t.Error("Unknown eviction policy should not be accepted", err)
+	}
+}
+
+func TestListeners(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	fileName := writeConfig(t, `{"Address":"","Listeners":[{"Network":"unix","Address":"cache.sock","Auth":"peer","PeerUsers":{"1000":"app"},"Mode":"0660"},
+		{"Address":"127.0.0.1:8087"},{"Address":"[::]:8088","TLS":true,"Auth":"certificate"}]}`)
+	config, err := Load([]string{"-config", fileName}, environment(nil))
+	if err != nil || len(config.Listeners) != 3 || config.Listeners[0].PeerUsers["1000"] != "app" || config.Listeners[2].Auth != server.AUTH_CERTIFICATE {
+		t.Fatal("Listeners should be read", config, err)
+	}
+	if mode, err := config.Listeners[0].FileMode(); err != nil || mode != 0660 {
+		t.Error("Wrong behavior of FileMode function", mode, err)
+	}
+	if mode, _ := config.Listeners[1].FileMode(); mode != 0600 {
+		t.Error("Socket should be private by default", mode)
+	}
+
+	expected := map[string]string{
+		"should be a loopback address":   `{"Address":":8087"}`,
+		"should be host:port":            `{"Address":"8087","TLS":true}`,
+		"requires a unix socket":         `{"Address":"127.0.0.1:8087","Auth":"trust","User":"app"}`,
+		"Certificate login requires TLS": `{"Address":"127.0.0.1:8087","Auth":"certificate"}`,
+		"Trusted user is required":       `{"Network":"unix","Address":"cache.sock","Auth":"trust"}`,
+		"Peer users are required":        `{"Network":"unix","Address":"cache.sock","Auth":"peer"}`,
+		"should be octal permissions":    `{"Network":"unix","Address":"cache.sock","Mode":"rw"}`,
+		"Unknown network":                `{"Network":"udp","Address":"127.0.0.1:8087"}`,
+		"Unknown auth policy":            `{"Address":"127.0.0.1:8087","Auth":"anonymous"}`,
+	}
+	for message, listener := range expected {
+		fileName = writeConfig(t, `{"Listeners":[`+listener+`]}`)
+		_, err = Load([]string{"-config", fileName}, environment(nil))
+		if err == nil || !strings.Contains(err.Error(), "Invalid setting Listeners[0]") || !strings.Contains(err.Error(), message) {
+			t.Error("Wrong error of Load function", listener, err)
+		}
+	}
+
+	fileName = writeConfig(t, `{"Address":""}`)
+	if _, err = Load([]string{"-config", fileName}, environment(nil)); err == nil {
+		t.Error("Address should be required without other listeners")
+	}
+}
+
+func TestLegacyOptionFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.WriteFile("logging.json", []byte(`{"Level":"warn"}`), 0600)
+	os.WriteFile("audit.json", []byte(`{"DefaultPolicy":"none"}`), 0600)
+
+	config, err := Load(nil, environment(nil))
+	if err != nil || config.Log.Level != "warn" || config.Audit.DefaultPolicy != "none" {
+		t.Error("Options of logging.json and audit.json should be used", config, err)
+	}
+
+	os.WriteFile(CONFIG_FILE, []byte(`{"Log":{"Level":"error"}}`), 0600)
+	config, err = Load(nil, environment(nil))
+	if err != nil || config.Log.Level != "error" || config.Audit.DefaultPolicy != "none" {
+		t.Error("Sections of the config file should override legacy files", config, err)
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	started := DefaultConfig()
+	reloaded := DefaultConfig()
+	reloaded.IdleTimeout = Duration(time.Second)
+	reloaded.Log.Level = "debug"
+	reloaded.Caches = []server.CacheLimits{{Pattern: "team-*", MaxEntries: 10}}
+
+	if names := started.RestartRequired(reloaded); len(names) != 0 {
+		t.Error("Runtime settings should not require a restart", names)
+	}
+
+	reloaded.Address = ":9000"
+	reloaded.Fsync = persist.FSYNC_NEVER
+	reloaded.Listeners = []ListenerConfig{{Network: NETWORK_UNIX, Address: "cache.sock"}}
+	names := started.RestartRequired(reloaded)
+	if strings.Join(names, ",") != "Address,Fsync,Listeners" {
+		t.Error("Wrong behavior of RestartRequired function", names)
+	}
+}
@@ -1,317 +1,213 @@
 // TestProject project main.go
+
 package main
 
 import (
+	"TestProject/audit"
 	"TestProject/auth"
 	"TestProject/cache"
+	"TestProject/config"
+	"TestProject/persist"
+	"TestProject/server"
 	"TestProject/utils"
-	"bufio"
 	"crypto/tls"
 	"errors"
+	"flag"
 	"fmt"
-	"io"
+	"log/slog"
 	"net"
 	"os"
-	"strings"
-	"sync/atomic"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
 const (
-	TIMEOUT = 60000000000 //1 minute
-
-	DEFAULT_PORT = "8086"
-
-	NEED_HELP = "Please use \"help\" command to find the available commands."
-
-	HELP_KEYS = "keys - operation to display cached keys. Ex. keys [startIndex] [endIndex]"
-	HELP_TTL  = "ttl - operation to update time to live attribute of any cached value. Ex. ttl key ttlInSeconds"
-
-	HELP_GET    = "get - operation to get cached value if it exists. Ex. get key"
-	HELP_SET    = "set - operation to set a new cached string value. Ex. set key value [ttl]"
-	HELP_UPDATE = "update - operation to exchange an existing cached string value. Ex. update key oldValue newValue [ttlInSeconds]"
-	HELP_DELETE = "delete - operation to remove an existing cached value. Ex. delete key [value]"
-	HELP_SIZE   = "size - operation to find out the number of cached values. Ex. size"
-	HELP_EXIT   = "exit - operation to close the connection with the server. Ex. exit"
-
-	HELP_LSIZE   = "lsize - operation to check the size of a list. Ex. lsize key"
-	HELP_LGET    = "lget - operation to get a value from cached list. Ex. lget key index"
-	HELP_LAPPEND = "lappend - operation to add a new value into the cached list. Ex. lappend key value [ttlInSeconds]"
-	HELP_LDELETE = "ldelete - operation to remove a value from a list by index. Ex. ldelete key index"
-
-	HELP_DSIZE   = "dsize - operation to check the size of a dictionary. Ex. lsize key"
-	HELP_DGET    = "dget - operation to get a value from cached dictionary by key. Ex. dget key dictKey"
-	HELP_DSET    = "dset - operation to set a key-value pair into a cached dictionary. Ex. dset key dictKey dictValue"
-	HELP_DAPPEND = "dappend - operation to add a value to the dictionary. Ex. dappend key dictKey value [ttlInSeconds]"
-	HELP_DDELETE = "ddelete - opeartion to remove a value from cached dictionary. Ex. ddelete key dictKey"
+	//How often the users file is checked for changes.
+	USERS_RELOAD_INTERVAL = 5 * time.Second
 )
 
-var existingCaches cache.Cache = cache.NewCache()
-var port = DEFAULT_PORT
-
-var stopped atomic.Value
-
-var users map[string]string
-
+//Reads the configuration of the server and serves clients till the server is stopped, see config.Load() and server.Server.
 func main() {
 
-	var err error
-
-	users, err = auth.ReadUsers()
-
-	if err != nil {
-		fmt.Printf("Error [%v] happened", err)
+	conf, err := config.Load(os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
 		return
+	} else if err != nil {
+		fmt.Printf("Error [%v] happened while reading configuration\n", err)
+		os.Exit(2)
 	}
 
-	port = getPort()
-	listener := startListenOn(port)
-
-	for {
-		conn, err := listener.Accept()
-
-		if stopped.Load() != nil {
-			return
-		}
-
-		if err != nil {
-			fmt.Printf("Error [%v] happened", err)
-			continue
-		}
-
-		go handleConnection(conn)
+	logLevel := new(slog.LevelVar)
+	logger, logFile, err := utils.NewLogger(conf.Log, logLevel)
+	if err != nil {
+		fmt.Printf("Error [%v] happened while opening log\n", err)
+		return
 	}
-}
-
-func handleConnection(conn net.Conn) {
+	defer logFile.Close()
+	slog.SetDefault(logger)
 
-	defer conn.Close()
+	options := server.DefaultServerOptions()
+	options.RuntimeOptions = conf.Runtime()
+	options.ShutdownTimeout = time.Duration(conf.ShutdownTimeout)
+	options.SnapshotInterval = time.Duration(conf.SnapshotInterval)
+	options.Log = logger
 
-	var log utils.Logger
-	log = utils.NewTelnetLogger(conn)
+	options.Users, err = auth.OpenUserStore(conf.UsersFile)
 
-	reader := bufio.NewReader(conn)
-
-	credentials, _, err := reader.ReadLine()
 	if err != nil {
-		fmt.Printf("Error [%v] happened", err)
+		logger.Error("Cannot read users", utils.LOG_ERROR, err)
 		return
 	}
-	user, err := auth.JsonToUser(credentials)
+	options.Users.Watch(USERS_RELOAD_INTERVAL, logger)
+
+	sessionKey, err := auth.LoadSessionKey(conf.SessionKeyFile)
 	if err != nil {
-		log.Logf("Error [%v] happened", err)
+		logger.Error("Cannot load session key", utils.LOG_ERROR, err)
 		return
 	}
+	options.Sessions = auth.NewSessionSigner(sessionKey, auth.SESSION_TTL)
 
-	pass := users[user.Name]
-	if pass == "" || pass != user.Pass {
-		if user.IsMachine {
-			cache.WriteErrorResponse(conn, errors.New("User/password pair is incorrect"))
-		} else {
-			log.Log("User/password pair is incorrect")
-		}
+	options.Auditor, err = audit.OpenAuditor(conf.AuditFile, conf.Audit, logger)
+	if err != nil {
+		logger.Error("Cannot open audit log", utils.LOG_ERROR, err)
 		return
-	} else {
-		if user.IsMachine {
-			cache.WriteResponse(conn, "Ok", nil)
-		}
 	}
 
-	if user.IsMachine {
-		handleMachineConnection(conn, reader, utils.NewConsoleLogger())
-	} else {
-		handleHumanConnection(conn, reader, log)
+	options.Snapshots = persist.NewSnapshotter(conf.SnapshotFile, options.Caches)
+	options.CommandLog, err = restoreCaches(options.Caches, options.Snapshots, conf, logger)
+	if err != nil {
+		logger.Error("Cannot restore caches", utils.LOG_ERROR, err)
+		return
 	}
 
-}
-
-func printHelp(log utils.Logger) {
-	log.Logln(HELP_GET, HELP_SET, HELP_UPDATE, HELP_DELETE, HELP_EXIT, HELP_LGET, HELP_LAPPEND, HELP_LDELETE, HELP_LSIZE, HELP_DGET, HELP_DSET, HELP_DAPPEND, HELP_DDELETE, HELP_KEYS, HELP_TTL)
-}
-
-func getCache(id string) cache.Cache {
-	existingCache := existingCaches.Get(id)
-	if existingCache == nil {
-		newCache := cache.NewCache()
-		existingCache = existingCaches.PutIfAbsent(id, newCache)
-		if existingCache == nil {
-			existingCache = newCache
-		}
+	options.TLSConfig = loadTLSConfig(conf)
+	options.Listener = startListenOn(conf.Address)
+	options.RespListener = startListenOn(conf.RespAddress)
+	options.HttpListener = startListenOn(conf.HttpAddress)
+	options.MemcacheListener = startListenOn(conf.MemcacheAddress)
+	options.Listeners, err = startListeners(conf.Listeners, options.TLSConfig)
+	if err != nil {
+		logger.Error("Cannot listen", utils.LOG_ERROR, err)
+		return
 	}
-	return existingCache.(cache.Cache)
-}
-
-func handleMachineConnection(conn net.Conn, reader *bufio.Reader, log utils.Logger) {
 
-	c, err := readCache(reader)
+	cacheServer, err := server.NewServer(options)
 	if err != nil {
-		log.Logf("Error [%v] happened", err)
-		cache.WriteErrorResponse(conn, err)
-		return
-	} else if c == nil {
+		logger.Error("Cannot create server", utils.LOG_ERROR, err)
 		return
 	}
+	reloadOnHangup(cacheServer, options.Users, conf, logLevel, logger)
+	stopOnSignals(cacheServer, logger)
 
-	cmds := cache.NewJsonCacheCommands(c, conn, log)
+	err = cacheServer.Serve()
+	if err != nil {
+		logger.Error("Server failed", utils.LOG_ERROR, err)
+	}
+}
 
-	for {
+//Reloads the users file and the configuration when the server gets SIGHUP, connections of users are not dropped.
+//The idle timeout, limits of caches and the log level are applied at once, other changed settings are reported
+//and applied after a restart, see config.Config.RestartRequired().
+func reloadOnHangup(cacheServer *server.Server, users *auth.UserStore, started *config.Config, logLevel *slog.LevelVar, logger *slog.Logger) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			err := users.Reload()
+			if err != nil {
+				logger.Error("Cannot reload users", utils.LOG_ERROR, err)
+			} else {
+				logger.Info("Users were reloaded")
+			}
 
-		cmd, _, err := reader.ReadLine()
-		if err != nil {
-			if err == io.EOF {
-				return
+			conf, err := config.Load(os.Args[1:], os.Getenv)
+			if err != nil {
+				logger.Error("Cannot reload configuration", utils.LOG_ERROR, err)
+				continue
+			}
+			err = cacheServer.Reconfigure(conf.Runtime())
+			if err != nil {
+				logger.Error("Cannot reload configuration", utils.LOG_ERROR, err)
+				continue
 			}
-			log.Logf("Error [%v] happened", err)
-			log.Log("Connection will be closed")
-			return
+			level, _ := utils.ParseLogLevel(conf.Log.Level)
+			logLevel.Set(level)
+			for _, name := range started.RestartRequired(conf) {
+				logger.Warn("Setting is changed, it will be applied after restart", "setting", name)
+			}
+			logger.Info("Configuration was reloaded")
 		}
-
-		command := strings.Trim(string(cmd), " ")
-		splitCommand := strings.Split(command, " ")
-		command = splitCommand[0]
-		params := splitCommand[1:]
-
-		handleCommand(cmds, command, params)
-	}
+	}()
 }
 
-func handleHumanConnection(conn net.Conn, reader *bufio.Reader, log utils.Logger) {
-
-	log.Log("You've been connected to In-memory cache. Connection idle timeout is ", int64(float64(TIMEOUT)/float64(time.Second)), "s.")
-	log.Log("Please enter first command: \"stop-server\" or \"connect-to\" <cacheId>")
+//Stops the server on SIGINT and SIGTERM the same way "stop-server" command does.
+func stopOnSignals(cacheServer *server.Server, logger *slog.Logger) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		logger.Info("Signal is received", "signal", sig.String())
+		cacheServer.Stop()
+	}()
+}
 
-	conn.SetReadDeadline(time.Now().Add(TIMEOUT))
+//Opens the command log and restores caches from it.
+//When the log is empty, caches are restored from the latest snapshot and the log is rewritten from them.
+func restoreCaches(caches cache.Cache, snapshots *persist.Snapshotter, conf *config.Config, logger *slog.Logger) (*persist.CommandLog, error) {
+	options := persist.DefaultCommandLogOptions()
+	options.Fsync = conf.Fsync
 
-	c, err := readCache(reader)
+	commandLog, err := persist.OpenCommandLog(conf.CommandLogFile, caches, options, logger)
 	if err != nil {
-		log.Logf("Error [%v] happened", err)
-		return
-	} else if c == nil {
-		return
+		return nil, err
+	}
+	getCache := func(id string, options cache.CacheOptions) cache.Cache {
+		return server.GetCache(caches, id, options)
 	}
 
-	cmds := cache.NewUserFriendlyCommands(c, log)
-
-	log.Log("Connected")
-
-	for {
-
-		conn.SetReadDeadline(time.Now().Add(TIMEOUT))
-
-		cmd, _, err := reader.ReadLine()
-		if err != nil {
-			if err == io.EOF {
-				return
-			}
-			log.Logf("Error [%v] happened", err)
-			log.Log("Connection will be closed")
-			return
-		}
-
-		command := strings.Trim(string(cmd), " ")
-
-		splitCommand := strings.Split(command, " ")
-		command = splitCommand[0]
-		params := splitCommand[1:]
-
-		switch command {
-		case "help":
-			printHelp(log)
-			break
-		case "exit":
-			log.Log("Connection closed")
-			return
-		default:
-			err = handleCommand(cmds, command, params)
-		}
-
-		if err != nil {
-			log.Log(NEED_HELP)
-		}
+	if !commandLog.IsEmpty() {
+		replayed, err := commandLog.Replay(getCache)
+		logger.Info("Commands replayed from command log", "count", replayed)
+		return commandLog, err
 	}
-}
 
-func handleCommand(cmds cache.CacheCommands, command string, params []string) error {
-	var err error
-	switch command {
-	case "get":
-		_, err = cmds.GetValue(params)
-		break
-	case "set":
-		_, err = cmds.SetValue(params)
-		break
-	case "update":
-		_, err = cmds.UpdateValue(params)
-		break
-	case "delete":
-		_, _, err = cmds.RemoveValue(params)
-		break
-	case "keys":
-		_, err = cmds.GetKeys(params)
-		break
-	case "size":
-		cmds.GetSize()
-	case "lget":
-		_, err = cmds.GetListValue(params)
-		break
-	case "lappend":
-		err = cmds.AppendListValue(params)
-		break
-	case "ldelete":
-		_, err = cmds.DeleteListValue(params)
-		break
-	case "lsize":
-		_, err = cmds.GetListSize(params)
-		break
-	case "dget":
-		_, err = cmds.GetDictValue(params)
-		break
-	case "dset":
-		_, err = cmds.SetDictValue(params)
-		break
-	case "dappend":
-		_, err = cmds.AppendDictValue(params)
-		break
-	case "ddelete":
-		_, err = cmds.DeleteDictValue(params)
-		break
-	case "dsize":
-		_, err = cmds.GetDictSize(params)
-		break
-	case "ttl":
-		_, err = cmds.UpdateTTL(params)
-		break
-	default:
-		err = errors.New("Unknown command")
+	loaded, err := snapshots.Load(getCache)
+	if err != nil {
+		return commandLog, err
 	}
+	logger.Info("Values loaded from snapshot", "count", loaded)
 
-	return err
+	return commandLog, commandLog.Compact()
 }
 
-func stopServer() {
-	stopped.Store(true)
-}
+//Returns TLS config of all listeners with the certificate and the key of the server.
+func loadTLSConfig(conf *config.Config) *tls.Config {
+
+	cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+	if err != nil {
+		panic(errors.New(fmt.Sprintf("Error [%v] happened", err)))
+	}
 
-func getPort() string {
-	if len(os.Args) > 1 {
-		err := utils.CheckPort(os.Args[1])
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if _, err := os.Stat(conf.ClientCAFile); err == nil {
+		tlsConfig.ClientCAs, err = utils.LoadCertPool(conf.ClientCAFile)
 		if err != nil {
-			panic(errors.New(fmt.Sprint("Invalid port [", os.Args[1], "] is provided.")))
+			panic(errors.New(fmt.Sprintf("Error [%v] happened", err)))
 		}
-		return os.Args[1]
+		//Clients without certificates still log in with passwords
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
 	}
-	return DEFAULT_PORT
+	return tlsConfig
 }
 
-func startListenOn(port string) net.Listener {
-
-	cert, err := tls.LoadX509KeyPair("cert.pem", "key.pem")
-	if err != nil {
-		panic(errors.New(fmt.Sprintf("Error [%v] happened", err)))
+//Listens on a TCP <address>, or returns <nil> if the address is empty. TLS is added by the server.
+func startListenOn(address string) net.Listener {
+	if address == "" {
+		return nil
 	}
 
-	config := tls.Config{Certificates: []tls.Certificate{cert}}
-	listener, err := tls.Listen("tcp", ":"+port, &config)
+	listener, err := net.Listen("tcp", address)
 	if err != nil {
 		panic(fmt.Sprintf("Error [%v] happened", err))
 	}
@@ -319,26 +215,31 @@ func startListenOn(port string) net.Listener {
 	return listener
 }
 
-func readCache(reader *bufio.Reader) (cache.Cache, error) {
-	firstCmd, _, err := reader.ReadLine()
-	if err != nil {
-		return nil, err
-	}
-
-	cmd := string(firstCmd)
-	if cmd == "stop-server" {
-		stopServer()
-		return nil, nil
-	}
-
-	if !strings.HasPrefix(cmd, "connect-to") {
-		return nil, errors.New("Invalid command")
-	}
+//Starts additional listeners of telnet and machine clients, TLS listeners use <tlsConfig> of the server.
+//Listeners that were started are closed if one of them fails.
+func startListeners(confs []config.ListenerConfig, tlsConfig *tls.Config) ([]server.Listener, error) {
+	var listeners []server.Listener
+	for _, conf := range confs {
+		var listener net.Listener
+		var err error
+		if conf.Network == config.NETWORK_UNIX {
+			mode, _ := conf.FileMode()
+			listener, err = server.ListenUnix(conf.Address, mode)
+		} else {
+			listener, err = net.Listen(config.NETWORK_TCP, conf.Address)
+		}
+		if err != nil {
+			for _, started := range listeners {
+				started.Close()
+			}
+			return nil, err
+		}
 
-	params := strings.Split(cmd, " ")
-	if len(params) != 2 {
-		return nil, errors.New("Invalid parameters")
+		started := server.Listener{Listener: listener, Auth: conf.Auth, User: conf.User, PeerUsers: conf.PeerUsers}
+		if conf.TLS {
+			started.TLSConfig = tlsConfig
+		}
+		listeners = append(listeners, started)
 	}
-
-	return getCache(params[1]), nil
+	return listeners, nil
 }
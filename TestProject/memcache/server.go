@@ -0,0 +1,784 @@
+package memcache
+
+import (
+	"TestProject/audit"
+	"TestProject/auth"
+	"TestProject/cache"
+	"TestProject/utils"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	//Named cache that stores values of memcached clients.
+	DEFAULT_CACHE = "memcache"
+
+	SERVER_VERSION = "1.0.0"
+
+	//Max length of a key, the same limit as memcached has.
+	MAX_KEY_SIZE = 250
+
+	//Max size of a stored value, the default item size limit of memcached.
+	MAX_VALUE_SIZE = 1024 * 1024
+
+	MAX_LINE_SIZE = 2048
+
+	//Expiration times bigger than this number of seconds are absolute Unix times.
+	MAX_RELATIVE_EXPTIME = 60 * 60 * 24 * 30
+
+	//Time to live of a value stored with an expiration time in the past, the value expires right after it is stored.
+	EXPIRED_TTL = 1
+
+	//Max delay of "flush_all" in seconds that fits into time.Duration.
+	MAX_FLUSH_DELAY = math.MaxInt64 / int64(time.Second)
+)
+
+//Returned by a write that didn't change a Cache, so there is nothing to log.
+var errNotStored = errors.New("Not stored")
+
+//Commands of the cache whose permissions are required by memcached commands.
+var PERMISSION_COMMANDS = map[string]string{
+	"get": "get", "gets": "get",
+	"set": "set", "add": "set", "replace": "set", "cas": "set", "incr": "set", "decr": "set",
+	"delete": "delete", "flush_all": "delete",
+	"touch": "ttl",
+}
+
+//Counters reported by "stats" command.
+type stats struct {
+	currConnections  atomic.Int64
+	totalConnections atomic.Int64
+	cmdGet           atomic.Int64
+	cmdSet           atomic.Int64
+	cmdTouch         atomic.Int64
+	cmdFlush         atomic.Int64
+	getHits          atomic.Int64
+	getMisses        atomic.Int64
+	deleteHits       atomic.Int64
+	deleteMisses     atomic.Int64
+	incrHits         atomic.Int64
+	incrMisses       atomic.Int64
+	decrHits         atomic.Int64
+	decrMisses       atomic.Int64
+	casHits          atomic.Int64
+	casMisses        atomic.Int64
+	casBadval        atomic.Int64
+	touchHits        atomic.Int64
+	touchMisses      atomic.Int64
+}
+
+//Serves clients that speak the ASCII protocol of memcached, so memcached client libraries can be used.
+//All clients share one named cache. String values are stored as they are, values with non-zero flags are stored as cache.FlaggedValue.
+//Lists and dictionaries are not visible to memcached clients.
+//
+//Clients authenticate the same way as with memcached started with an authentication file:
+//the first command is "set" with any key and "<user> <password>" as the data.
+//A user has to be allowed to access the cache, every command is checked against permissions of the user.
+type Server struct {
+	cacheId      string
+	getCache     func(id string, options cache.CacheOptions) cache.Cache
+	authenticate func(name, pass, remote string) *auth.User
+	logWrite     func(cacheId string, c cache.Cache, key string, write func() error) error
+	auditor      *audit.Auditor
+	log          *slog.Logger
+	started      time.Time
+	stats        stats
+
+	//Timers of delayed "flush_all" commands, one pending flush per cache, they are stopped by Close().
+	lock    sync.Mutex
+	flushes map[cache.Cache]*time.Timer
+	closed  bool
+}
+
+//Creates a Server for a named cache <cacheId> obtained by <getCache>, users are checked by <authenticate> that returns <nil> for a wrong password
+//and gets a remote address of a client. Every write of a key is done by <logWrite>, e.g. to be written into the command log.
+//Mutating commands are written into the audit log by <auditor>, errors of connections and denied commands are written into <log>.
+func NewServer(cacheId string,
+	getCache func(id string, options cache.CacheOptions) cache.Cache,
+	authenticate func(name, pass, remote string) *auth.User,
+	logWrite func(cacheId string, c cache.Cache, key string, write func() error) error,
+	auditor *audit.Auditor,
+	log *slog.Logger) *Server {
+
+	server := new(Server)
+	server.cacheId = cacheId
+	server.getCache = getCache
+	server.authenticate = authenticate
+	server.logWrite = logWrite
+	server.auditor = auditor
+	server.log = log
+	server.started = time.Now()
+	server.flushes = make(map[cache.Cache]*time.Timer)
+	return server
+}
+
+//Stops delayed flushes that are not done yet, later "flush_all" commands with a delay are ignored.
+//Connections are not closed, they are closed with their listener.
+func (this *Server) Close() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.closed = true
+	for _, timer := range this.flushes {
+		timer.Stop()
+	}
+	this.flushes = nil
+}
+
+//Accepts connections till <listener> is closed.
+func (this *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go this.ServeConn(conn)
+	}
+}
+
+//State of one client connection.
+type session struct {
+	server  *Server
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	remote  string
+	user    *auth.User
+	log     *slog.Logger
+	c       cache.Cache
+	noreply bool
+}
+
+//Serves commands of one client till it disconnects or sends "quit".
+func (this *Server) ServeConn(conn net.Conn) {
+	defer conn.Close()
+
+	this.stats.currConnections.Add(1)
+	this.stats.totalConnections.Add(1)
+	defer this.stats.currConnections.Add(-1)
+
+	s := &session{server: this, reader: bufio.NewReader(conn), writer: bufio.NewWriter(conn), remote: conn.RemoteAddr().String()}
+	s.log = this.log.With(utils.LOG_REMOTE, s.remote, utils.LOG_CACHE, this.cacheId)
+	s.c = this.getCache(this.cacheId, cache.DefaultCacheOptions())
+
+	for {
+		line, err := readLine(s.reader)
+		if err != nil {
+			if err == errLineTooLong {
+				s.writer.WriteString("CLIENT_ERROR line is too long\r\n")
+				s.writer.Flush()
+			} else if err != io.EOF {
+				s.log.Warn("Cannot read command", utils.LOG_ERROR, err)
+			}
+			return
+		}
+
+		args := strings.Fields(line)
+		quit := false
+		if len(args) > 0 {
+			quit, err = s.execute(args[0], args[1:])
+		}
+
+		//Replies of pipelined commands are sent together
+		if s.reader.Buffered() == 0 || quit || err != nil {
+			if flushErr := s.writer.Flush(); flushErr != nil {
+				return
+			}
+		}
+		if quit || err != nil {
+			return
+		}
+	}
+}
+
+var errLineTooLong = errors.New("Line is too long")
+
+func readLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		part, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, part...)
+		if len(line) > MAX_LINE_SIZE {
+			return "", errLineTooLong
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+//Executes a command and writes its reply.
+//Returns <true> if the connection has to be closed, an error is returned if the connection cannot be used anymore.
+func (this *session) execute(command string, args []string) (bool, error) {
+	this.noreply = len(args) > 0 && args[len(args)-1] == "noreply"
+	if this.noreply {
+		args = args[:len(args)-1]
+	}
+
+	switch command {
+	case "quit":
+		return true, nil
+	case "version":
+		this.reply("VERSION " + SERVER_VERSION)
+		return false, nil
+	}
+
+	if this.user == nil {
+		if command != "set" {
+			this.reply("CLIENT_ERROR unauthenticated")
+			return false, nil
+		}
+		return false, this.auth(args)
+	}
+
+	//Storage commands are checked after their data is read, so the next command is not taken from the data
+	isStorage := command == "set" || command == "add" || command == "replace" || command == "cas"
+	if !isStorage && !this.permitted(command) {
+		return false, nil
+	}
+
+	switch command {
+	case "get":
+		this.get(args, false)
+	case "gets":
+		this.get(args, true)
+	case "set", "add", "replace", "cas":
+		return false, this.store(command, args)
+	case "delete":
+		this.delete(args)
+	case "incr", "decr":
+		this.incr(command, args)
+	case "touch":
+		this.touch(args)
+	case "flush_all":
+		this.flushAll(args)
+	case "stats":
+		this.writeStats(args)
+	case "verbosity":
+		this.reply("OK")
+	default:
+		this.reply("ERROR")
+	}
+	return false, nil
+}
+
+//Writes a reply line unless a client asked for no reply.
+func (this *session) reply(line string) {
+	if !this.noreply {
+		this.writer.WriteString(line + "\r\n")
+	}
+}
+
+//Authenticates a client with "set <key> <flags> <exptime> <bytes>" command where data is "<user> <password>".
+func (this *session) auth(args []string) error {
+	if len(args) != 4 {
+		this.reply("CLIENT_ERROR bad command line format")
+		return nil
+	}
+
+	data, ok, err := this.readData(args[3])
+	if !ok || err != nil {
+		return err
+	}
+
+	var user *auth.User
+	credentials := strings.SplitN(string(data), " ", 2)
+	if len(credentials) == 2 {
+		user = this.server.authenticate(credentials[0], credentials[1], this.remote)
+	}
+	if user == nil {
+		this.reply("CLIENT_ERROR authentication failure")
+		return nil
+	}
+
+	if err := cache.CheckCacheAccess(user, this.server.cacheId); err != nil {
+		this.log.Warn("Cache access is denied", utils.LOG_USER, user.Name, utils.LOG_ERROR, err)
+		this.reply("CLIENT_ERROR authentication failure")
+		return nil
+	}
+
+	this.user = user
+	this.log = this.log.With(utils.LOG_USER, user.Name)
+	this.reply("STORED")
+	return nil
+}
+
+//Checks that the user can execute a <command>, a denial is replied and written into the log.
+//Denials of mutating commands are written into the audit log too. Commands that don't touch the cache are always permitted.
+func (this *session) permitted(command string) bool {
+	cacheCommand, ok := PERMISSION_COMMANDS[command]
+	if !ok {
+		return true
+	}
+
+	if err := cache.CheckPermission(this.user, cacheCommand); err != nil {
+		this.log.Warn("Command is denied", utils.LOG_ERROR, err)
+		if cacheCommand != "get" {
+			this.server.auditor.Command(this.user.Name, this.server.cacheId, command, nil, err)
+		}
+		this.reply("CLIENT_ERROR permission denied")
+		return false
+	}
+	return true
+}
+
+//Reads a data block of a storage command, <size> is the number of bytes in the block.
+//Returns <false> if the block was rejected, an error is returned if the connection cannot be used anymore.
+func (this *session) readData(size string) ([]byte, bool, error) {
+	length, err := strconv.Atoi(size)
+	if err != nil || length < 0 {
+		this.reply("CLIENT_ERROR bad command line format")
+		return nil, false, nil
+	}
+
+	if length > MAX_VALUE_SIZE {
+		_, err = this.reader.Discard(length + 2)
+		this.reply("SERVER_ERROR object too large for cache")
+		return nil, false, err
+	}
+
+	data := make([]byte, length+2)
+	_, err = io.ReadFull(this.reader, data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if data[length] != '\r' || data[length+1] != '\n' {
+		this.reply("CLIENT_ERROR bad data chunk")
+		return nil, false, errors.New("Bad data chunk")
+	}
+	return data[:length], true, nil
+}
+
+//get|gets <key>*
+func (this *session) get(keys []string, withVersion bool) {
+	for _, key := range keys {
+		this.server.stats.cmdGet.Add(1)
+		value, version := this.c.GetWithVersion(key)
+		data, flags, ok := fromCacheValue(value)
+		if !ok {
+			this.server.stats.getMisses.Add(1)
+			continue
+		}
+		this.server.stats.getHits.Add(1)
+
+		if withVersion {
+			this.writer.WriteString(fmt.Sprintf("VALUE %v %d %d %d\r\n", key, flags, len(data), version))
+		} else {
+			this.writer.WriteString(fmt.Sprintf("VALUE %v %d %d\r\n", key, flags, len(data)))
+		}
+		this.writer.WriteString(data)
+		this.writer.WriteString("\r\n")
+	}
+	this.writer.WriteString("END\r\n")
+}
+
+//set|add|replace <key> <flags> <exptime> <bytes> [noreply]
+//cas <key> <flags> <exptime> <bytes> <cas unique> [noreply]
+func (this *session) store(command string, args []string) error {
+	argsCount := 4
+	if command == "cas" {
+		argsCount = 5
+	}
+	if len(args) != argsCount {
+		this.reply("ERROR")
+		return nil
+	}
+
+	key := args[0]
+	flags, flagsErr := strconv.ParseUint(args[1], 10, 32)
+	exptime, exptimeErr := strconv.ParseInt(args[2], 10, 64)
+	var version uint64
+	var versionErr error
+	if command == "cas" {
+		version, versionErr = strconv.ParseUint(args[4], 10, 64)
+	}
+
+	data, ok, err := this.readData(args[3])
+	if !ok || err != nil {
+		return err
+	}
+
+	if !isValidKey(key) || flagsErr != nil || exptimeErr != nil || versionErr != nil {
+		this.reply("CLIENT_ERROR bad command line format")
+		return nil
+	}
+
+	if !this.permitted(command) {
+		return nil
+	}
+
+	this.server.stats.cmdSet.Add(1)
+	value := toCacheValue(string(data), uint32(flags))
+	ttl := toTTL(exptime, time.Now())
+
+	var result string
+	writeErr := this.write(command, []string{key, string(data)}, func() error {
+		result = "STORED"
+		switch command {
+		case "set":
+			_, err := this.c.PutExpirable(key, value, ttl)
+			return err
+		case "add":
+			if existing, err := this.c.PutExpirableIfAbsent(key, value, ttl); err != nil {
+				return err
+			} else if existing != nil {
+				result = "NOT_STORED"
+				return errNotStored
+			}
+		case "replace":
+			if existing, err := this.c.ReplaceExpirable(key, value, ttl); err != nil {
+				return err
+			} else if existing == nil {
+				result = "NOT_STORED"
+				return errNotStored
+			}
+		case "cas":
+			return this.cas(key, version, value, ttl, &result)
+		}
+		return nil
+	})
+
+	switch {
+	case writeErr == nil || writeErr == errNotStored:
+	case errors.Is(writeErr, cache.ErrCacheFull):
+		result = "SERVER_ERROR out of memory storing object"
+	default:
+		result = serverError(writeErr)
+	}
+	this.reply(result)
+	return nil
+}
+
+//Replaces a value in case it was not changed since a client read it with "gets".
+func (this *session) cas(key string, version uint64, value interface{}, ttl int64, result *string) error {
+	err := this.c.ReplaceVersion(key, version, value, ttl)
+	switch err {
+	case nil:
+		this.server.stats.casHits.Add(1)
+		return nil
+	case cache.ErrNotFound:
+		this.server.stats.casMisses.Add(1)
+		*result = "NOT_FOUND"
+	case cache.ErrVersionMismatch:
+		this.server.stats.casBadval.Add(1)
+		*result = "EXISTS"
+	default:
+		return err
+	}
+	return errNotStored
+}
+
+//delete <key> [noreply]
+func (this *session) delete(args []string) {
+	if len(args) != 1 && !(len(args) == 2 && args[1] == "0") {
+		this.reply("CLIENT_ERROR bad command line format.  Usage: delete <key> [noreply]")
+		return
+	}
+
+	key := args[0]
+	err := this.write("delete", []string{key}, func() error {
+		if this.c.Remove(key) == nil {
+			return errNotStored
+		}
+		return nil
+	})
+
+	if err == nil {
+		this.server.stats.deleteHits.Add(1)
+		this.reply("DELETED")
+	} else {
+		this.server.stats.deleteMisses.Add(1)
+		this.reply("NOT_FOUND")
+	}
+}
+
+//incr|decr <key> <value> [noreply]
+//A value is a decimal 64-bit unsigned integer, "incr" wraps around on overflow, "decr" stops at zero.
+func (this *session) incr(command string, args []string) {
+	if len(args) != 2 {
+		this.reply("ERROR")
+		return
+	}
+
+	key := args[0]
+	delta, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		this.reply("CLIENT_ERROR invalid numeric delta argument")
+		return
+	}
+
+	hits, misses := &this.server.stats.incrHits, &this.server.stats.incrMisses
+	if command == "decr" {
+		hits, misses = &this.server.stats.decrHits, &this.server.stats.decrMisses
+	}
+
+	var result string
+	err = this.write(command, args, func() error {
+		for {
+			value, version := this.c.GetWithVersion(key)
+			data, flags, ok := fromCacheValue(value)
+			if !ok {
+				return cache.ErrNotFound
+			}
+
+			number, err := strconv.ParseUint(data, 10, 64)
+			if err != nil {
+				return cache.ErrWrongType
+			}
+
+			if command == "incr" {
+				number += delta
+			} else if number < delta {
+				number = 0
+			} else {
+				number -= delta
+			}
+
+			result = strconv.FormatUint(number, 10)
+			err = this.c.ReplaceVersion(key, version, toCacheValue(result, flags), cache.KEEP_TTL)
+			if err != cache.ErrVersionMismatch {
+				return err
+			}
+		}
+	})
+
+	switch err {
+	case nil:
+		hits.Add(1)
+		this.reply(result)
+	case cache.ErrNotFound:
+		misses.Add(1)
+		this.reply("NOT_FOUND")
+	case cache.ErrWrongType:
+		this.reply("CLIENT_ERROR cannot increment or decrement non-numeric value")
+	default:
+		if errors.Is(err, cache.ErrCacheFull) {
+			this.reply("SERVER_ERROR out of memory")
+		} else {
+			this.reply(serverError(err))
+		}
+	}
+}
+
+//Returns SERVER_ERROR reply of an <err>, line breaks of its message are replaced so the reply stays one line.
+func serverError(err error) string {
+	return "SERVER_ERROR " + strings.NewReplacer("\r", " ", "\n", " ").Replace(err.Error())
+}
+
+//touch <key> <exptime> [noreply]
+func (this *session) touch(args []string) {
+	if len(args) != 2 {
+		this.reply("ERROR")
+		return
+	}
+
+	key := args[0]
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		this.reply("CLIENT_ERROR invalid exptime argument")
+		return
+	}
+
+	this.server.stats.cmdTouch.Add(1)
+	err = this.write("touch", args, func() error {
+		if !this.c.Expire(key, toTTL(exptime, time.Now())) {
+			return errNotStored
+		}
+		return nil
+	})
+
+	if err == nil {
+		this.server.stats.touchHits.Add(1)
+		this.reply("TOUCHED")
+	} else {
+		this.server.stats.touchMisses.Add(1)
+		this.reply("NOT_FOUND")
+	}
+}
+
+//flush_all [delay] [noreply]
+//All values of the cache are removed, after <delay> seconds if it is passed.
+func (this *session) flushAll(args []string) {
+	if len(args) > 1 {
+		this.reply("ERROR")
+		return
+	}
+
+	var delay int64
+	if len(args) == 1 {
+		var err error
+		delay, err = strconv.ParseInt(args[0], 10, 64)
+		if err != nil || delay < 0 || delay > MAX_FLUSH_DELAY {
+			this.reply("CLIENT_ERROR bad command line format")
+			return
+		}
+	}
+
+	this.server.stats.cmdFlush.Add(1)
+	this.server.auditor.Command(this.user.Name, this.server.cacheId, "flush_all", args, nil)
+	if delay == 0 {
+		this.server.flush(this.c)
+	} else {
+		this.server.flushLater(this.c, time.Duration(delay)*time.Second)
+	}
+	this.reply("OK")
+}
+
+//Writes a key <params>[0] by <write> into the command log, a <command> of the user is written into the audit log.
+//A command that changed nothing, e.g. "add" of an existing key, is a successful command.
+func (this *session) write(command string, params []string, write func() error) error {
+	err := this.server.logWrite(this.server.cacheId, this.c, params[0], write)
+	auditErr := err
+	if err == errNotStored {
+		auditErr = nil
+	}
+	this.server.auditor.Command(this.user.Name, this.server.cacheId, command, params, auditErr)
+	return err
+}
+
+//Flushes a cache <c> after a <delay> unless the server is closed by then.
+//A pending flush of the same cache is replaced, so only the last delay is in effect.
+func (this *Server) flushLater(c cache.Cache, delay time.Duration) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.closed {
+		return
+	}
+
+	if pending := this.flushes[c]; pending != nil {
+		pending.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		this.lock.Lock()
+		pending := this.flushes[c] == timer
+		if pending {
+			delete(this.flushes, c)
+		}
+		this.lock.Unlock()
+		if pending {
+			this.flush(c)
+		}
+	})
+	this.flushes[c] = timer
+}
+
+func (this *Server) flush(c cache.Cache) {
+	for _, key := range c.GetKeys() {
+		this.logWrite(this.cacheId, c, key, func() error {
+			c.Remove(key)
+			return nil
+		})
+	}
+}
+
+//stats
+func (this *session) writeStats(args []string) {
+	if len(args) > 0 {
+		this.reply("ERROR")
+		return
+	}
+
+	s := &this.server.stats
+	t := time.Now()
+	values := []struct {
+		name  string
+		value interface{}
+	}{
+		{"pid", os.Getpid()},
+		{"uptime", int64(t.Sub(this.server.started) / time.Second)},
+		{"time", t.Unix()},
+		{"version", SERVER_VERSION},
+		{"curr_connections", s.currConnections.Load()},
+		{"total_connections", s.totalConnections.Load()},
+		{"cmd_get", s.cmdGet.Load()},
+		{"cmd_set", s.cmdSet.Load()},
+		{"cmd_flush", s.cmdFlush.Load()},
+		{"cmd_touch", s.cmdTouch.Load()},
+		{"get_hits", s.getHits.Load()},
+		{"get_misses", s.getMisses.Load()},
+		{"delete_misses", s.deleteMisses.Load()},
+		{"delete_hits", s.deleteHits.Load()},
+		{"incr_misses", s.incrMisses.Load()},
+		{"incr_hits", s.incrHits.Load()},
+		{"decr_misses", s.decrMisses.Load()},
+		{"decr_hits", s.decrHits.Load()},
+		{"cas_misses", s.casMisses.Load()},
+		{"cas_hits", s.casHits.Load()},
+		{"cas_badval", s.casBadval.Load()},
+		{"touch_hits", s.touchHits.Load()},
+		{"touch_misses", s.touchMisses.Load()},
+		{"curr_items", this.c.Size()},
+	}
+
+	for _, v := range values {
+		this.writer.WriteString(fmt.Sprintf("STAT %v %v\r\n", v.name, v.value))
+	}
+	this.writer.WriteString("END\r\n")
+}
+
+//Checks that a key is not too long and has no control characters.
+func isValidKey(key string) bool {
+	if len(key) == 0 || len(key) > MAX_KEY_SIZE {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+//Converts memcached expiration time to time to live of a Cache.
+//Zero means no expiration, negative values and absolute times in the past make a value expired right away.
+func toTTL(exptime int64, t time.Time) int64 {
+	switch {
+	case exptime == 0:
+		return cache.DEFAULT_TTL
+	case exptime < 0:
+		return EXPIRED_TTL
+	case exptime <= MAX_RELATIVE_EXPTIME:
+		return exptime * int64(time.Second)
+	}
+
+	ttl := time.Unix(exptime, 0).Sub(t)
+	if ttl <= 0 {
+		return EXPIRED_TTL
+	}
+	return int64(ttl)
+}
+
+//Creates a value to be put into a Cache, a plain string is used for values without flags.
+func toCacheValue(data string, flags uint32) interface{} {
+	if flags == 0 {
+		return data
+	}
+	return cache.FlaggedValue{Value: data, Flags: flags}
+}
+
+//Returns data and flags of a stored value.
+//Returns <false> if there is no value or the value is not a string, e.g. it is a list.
+func fromCacheValue(value interface{}) (string, uint32, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, 0, true
+	case cache.FlaggedValue:
+		return v.Value, v.Flags, true
+	}
+	return "", 0, false
+}
@@ -0,0 +1,332 @@
+package memcache
+
+import (
+	"TestProject/audit"
+	"TestProject/auth"
+	"TestProject/cache"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+//Starts a Server with an admin "admin"/"secret", a read-only user "reader"/"secret" and a user "other"/"secret" of another cache
+//for a passed registry of named caches and connects to it.
+func connectTestServer(t *testing.T, caches cache.Cache) (net.Conn, *bufio.Reader) {
+	return connectServer(t, newTestServer(caches))
+}
+
+//Connects to a <testServer> through a pipe that is closed when a test ends.
+func connectServer(t *testing.T, testServer *Server) (net.Conn, *bufio.Reader) {
+	client, server := net.Pipe()
+	go testServer.ServeConn(server)
+	t.Cleanup(func() { client.Close() })
+	return client, bufio.NewReader(client)
+}
+
+//Creates a Server of connectTestServer().
+func newTestServer(caches cache.Cache) *Server {
+	getCache := func(id string, options cache.CacheOptions) cache.Cache {
+		existingCache := caches.Get(id)
+		if existingCache == nil {
+			existingCache = cache.NewCacheWithOptions(options)
+			caches.Put(id, existingCache)
+		}
+		return existingCache.(cache.Cache)
+	}
+	authenticate := func(name, pass, remote string) *auth.User {
+		if pass != "secret" {
+			return nil
+		}
+		switch name {
+		case "admin":
+			return &auth.User{Name: name, Admin: true}
+		case "reader":
+			return &auth.User{Name: name, Caches: []string{DEFAULT_CACHE}, ReadOnly: true}
+		case "other":
+			return &auth.User{Name: name, Caches: []string{"other"}}
+		}
+		return nil
+	}
+	logWrite := func(cacheId string, c cache.Cache, key string, write func() error) error {
+		return write()
+	}
+
+	return NewServer(DEFAULT_CACHE, getCache, authenticate, logWrite, nil, slog.Default())
+}
+
+//Creates a registry of named caches, its caches are stopped when a test ends.
+func newRegistry(t *testing.T) cache.Cache {
+	caches := cache.NewRegistry()
+	t.Cleanup(func() { cache.StopCaches(caches) })
+	return caches
+}
+
+//Sends a raw <request> and checks that exactly <expected> reply is received.
+func exchange(t *testing.T, conn net.Conn, reader *bufio.Reader, request, expected string) {
+	t.Helper()
+	go conn.Write([]byte(request))
+
+	reply := make([]byte, len(expected))
+	_, err := io.ReadFull(reader, reply)
+	if err != nil || string(reply) != expected {
+		t.Errorf("Wrong reply for %q: %q expected, %q received, error [%v]", request, expected, reply, err)
+	}
+}
+
+func connectAuthenticated(t *testing.T, caches cache.Cache) (net.Conn, *bufio.Reader) {
+	conn, reader := connectTestServer(t, caches)
+	exchange(t, conn, reader, "set auth 0 0 12\r\nadmin secret\r\n", "STORED\r\n")
+	return conn, reader
+}
+
+func TestAuthentication(t *testing.T) {
+	conn, reader := connectTestServer(t, newRegistry(t))
+
+	exchange(t, conn, reader, "get A\r\n", "CLIENT_ERROR unauthenticated\r\n")
+	exchange(t, conn, reader, "version\r\n", "VERSION "+SERVER_VERSION+"\r\n")
+	exchange(t, conn, reader, "set auth 0 0 11\r\nadmin wrong\r\n", "CLIENT_ERROR authentication failure\r\n")
+	exchange(t, conn, reader, "set auth 0 0 12\r\nadmin secret\r\n", "STORED\r\n")
+	exchange(t, conn, reader, "get A\r\n", "END\r\n")
+}
+
+func TestPermissions(t *testing.T) {
+	caches := newRegistry(t)
+	conn, reader := connectTestServer(t, caches)
+	exchange(t, conn, reader, "set auth 0 0 12\r\nother secret\r\n", "CLIENT_ERROR authentication failure\r\n")
+	exchange(t, conn, reader, "set auth 0 0 13\r\nreader secret\r\n", "STORED\r\n")
+
+	caches.Get(DEFAULT_CACHE).(cache.Cache).Put("A", "B")
+	exchange(t, conn, reader, "get A\r\n", "VALUE A 0 1\r\nB\r\nEND\r\n")
+	exchange(t, conn, reader, "set A 0 0 1\r\nC\r\nget A\r\n", "CLIENT_ERROR permission denied\r\nVALUE A 0 1\r\nB\r\nEND\r\n")
+	exchange(t, conn, reader, "delete A\r\n", "CLIENT_ERROR permission denied\r\n")
+	exchange(t, conn, reader, "incr A 1\r\n", "CLIENT_ERROR permission denied\r\n")
+	exchange(t, conn, reader, "touch A 10\r\n", "CLIENT_ERROR permission denied\r\n")
+	exchange(t, conn, reader, "flush_all\r\n", "CLIENT_ERROR permission denied\r\n")
+	exchange(t, conn, reader, "get A\r\n", "VALUE A 0 1\r\nB\r\nEND\r\n")
+}
+
+func TestAudit(t *testing.T) {
+	var buffer bytes.Buffer
+	server := newTestServer(newRegistry(t))
+	server.auditor = audit.NewAuditor(&buffer, audit.DefaultAuditOptions(), slog.Default())
+	conn, reader := connectServer(t, server)
+	exchange(t, conn, reader, "set auth 0 0 13\r\nreader secret\r\n", "STORED\r\n")
+	exchange(t, conn, reader, "delete A\r\n", "CLIENT_ERROR permission denied\r\n")
+	conn, reader = connectServer(t, server)
+	exchange(t, conn, reader, "set auth 0 0 12\r\nadmin secret\r\n", "STORED\r\n")
+	exchange(t, conn, reader, "set A 0 0 1\r\nB\r\nget A\r\n", "STORED\r\nVALUE A 0 1\r\nB\r\nEND\r\n")
+	exchange(t, conn, reader, "add A 0 0 1\r\nC\r\n", "NOT_STORED\r\n")
+
+	var records []audit.Record
+	decoder := json.NewDecoder(&buffer)
+	for decoder.More() {
+		var record audit.Record
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal("Cannot read audit log", err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 {
+		t.Fatal("Wrong number of audit records", records)
+	}
+	if records[0].User != "reader" || records[0].Command != "delete" || records[0].Success || records[0].Code != cache.PERMISSION_DENIED {
+		t.Error("Denied mutating command should be audited", records[0])
+	}
+	if records[1].User != "admin" || records[1].Command != "set" || records[1].Cache != DEFAULT_CACHE || records[1].Key != "A" || records[1].Params != nil || !records[1].Success {
+		t.Error("Mutating command should be audited without values", records[1])
+	}
+	if records[2].Command != "add" || !records[2].Success {
+		t.Error("Command that didn't change a cache should be audited", records[2])
+	}
+}
+
+func TestStorageCommands(t *testing.T) {
+	caches := newRegistry(t)
+	conn, reader := connectAuthenticated(t, caches)
+
+	exchange(t, conn, reader, "set A 0 0 5\r\nhello\r\n", "STORED\r\n")
+	exchange(t, conn, reader, "get A\r\n", "VALUE A 0 5\r\nhello\r\nEND\r\n")
+	exchange(t, conn, reader, "set B 42 0 9\r\nbin\r\nary!\r\n", "STORED\r\n")
+	exchange(t, conn, reader, "get A B C\r\n", "VALUE A 0 5\r\nhello\r\nVALUE B 42 9\r\nbin\r\nary!\r\nEND\r\n")
+
+	exchange(t, conn, reader, "add A 0 0 1\r\nX\r\n", "NOT_STORED\r\n")
+	exchange(t, conn, reader, "add C 0 0 1\r\nX\r\n", "STORED\r\n")
+	exchange(t, conn, reader, "replace D 0 0 1\r\nX\r\n", "NOT_STORED\r\n")
+	exchange(t, conn, reader, "replace C 0 100 1\r\nY\r\n", "STORED\r\n")
+	exchange(t, conn, reader, "get C\r\n", "VALUE C 0 1\r\nY\r\nEND\r\n")
+
+	c := caches.Get(DEFAULT_CACHE).(cache.Cache)
+	if c.Get("B") != (cache.FlaggedValue{Value: "bin\r\nary!", Flags: 42}) {
+		t.Error("Value with flags was not stored as FlaggedValue")
+	}
+	if expiresAt, _ := c.ExpiresAt("C"); expiresAt.IsZero() || expiresAt.After(time.Now().Add(100*time.Second)) {
+		t.Error("Expiration time was not passed to the cache")
+	}
+
+	exchange(t, conn, reader, "set E 0 -1 1\r\nX\r\n", "STORED\r\n")
+	exchange(t, conn, reader, "get E\r\n", "END\r\n")
+	exchange(t, conn, reader, "set F 0 0 1 noreply\r\nX\r\nget F\r\n", "VALUE F 0 1\r\nX\r\nEND\r\n")
+
+	exchange(t, conn, reader, "set G 0 0 abc\r\n", "CLIENT_ERROR bad command line format\r\n")
+	exchange(t, conn, reader, "set G 0\r\n", "ERROR\r\n")
+	exchange(t, conn, reader, "set "+strings.Repeat("K", MAX_KEY_SIZE+1)+" 0 0 1\r\nX\r\n", "CLIENT_ERROR bad command line format\r\n")
+	exchange(t, conn, reader, "set G 0 0 "+strconv.Itoa(MAX_VALUE_SIZE+1)+"\r\n"+strings.Repeat("X", MAX_VALUE_SIZE+1)+"\r\n", "SERVER_ERROR object too large for cache\r\n")
+	exchange(t, conn, reader, "unknown\r\n", "ERROR\r\n")
+}
+
+func TestCasCommand(t *testing.T) {
+	caches := newRegistry(t)
+	conn, reader := connectAuthenticated(t, caches)
+
+	exchange(t, conn, reader, "set A 3 0 1\r\nB\r\n", "STORED\r\n")
+	_, version := caches.Get(DEFAULT_CACHE).(cache.Cache).GetWithVersion("A")
+	unique := strconv.FormatUint(version, 10)
+
+	exchange(t, conn, reader, "gets A\r\n", "VALUE A 3 1 "+unique+"\r\nB\r\nEND\r\n")
+	exchange(t, conn, reader, "cas A 0 0 1 "+unique+"\r\nC\r\n", "STORED\r\n")
+	exchange(t, conn, reader, "cas A 0 0 1 "+unique+"\r\nD\r\n", "EXISTS\r\n")
+	exchange(t, conn, reader, "cas Z 0 0 1 "+unique+"\r\nD\r\n", "NOT_FOUND\r\n")
+	exchange(t, conn, reader, "get A\r\n", "VALUE A 0 1\r\nC\r\nEND\r\n")
+}
+
+func TestDeleteAndTouchCommands(t *testing.T) {
+	caches := newRegistry(t)
+	conn, reader := connectAuthenticated(t, caches)
+
+	exchange(t, conn, reader, "set A 0 0 1\r\nB\r\n", "STORED\r\n")
+	exchange(t, conn, reader, "touch A 100\r\n", "TOUCHED\r\n")
+	exchange(t, conn, reader, "touch Z 100\r\n", "NOT_FOUND\r\n")
+	if expiresAt, _ := caches.Get(DEFAULT_CACHE).(cache.Cache).ExpiresAt("A"); expiresAt.IsZero() {
+		t.Error("Wrong behavior of touch command")
+	}
+
+	exchange(t, conn, reader, "delete A\r\n", "DELETED\r\n")
+	exchange(t, conn, reader, "delete A\r\n", "NOT_FOUND\r\n")
+
+	exchange(t, conn, reader, "set A 0 0 1\r\nB\r\n", "STORED\r\n")
+	exchange(t, conn, reader, "set C 0 0 1\r\nD\r\n", "STORED\r\n")
+	exchange(t, conn, reader, "flush_all 99999999999\r\n", "CLIENT_ERROR bad command line format\r\n")
+	exchange(t, conn, reader, "get A\r\n", "VALUE A 0 1\r\nB\r\nEND\r\n")
+	exchange(t, conn, reader, "flush_all\r\n", "OK\r\n")
+	exchange(t, conn, reader, "get A C\r\n", "END\r\n")
+}
+
+func TestDelayedFlush(t *testing.T) {
+	caches := newRegistry(t)
+	server := newTestServer(caches)
+	c := server.getCache(DEFAULT_CACHE, cache.DefaultCacheOptions())
+	c.Put("A", "B")
+
+	server.flushLater(c, 10*time.Millisecond)
+	for i := 0; i < 100 && c.Get("A") != nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if c.Get("A") != nil {
+		t.Error("Cache should be flushed after a delay")
+	}
+
+	c.Put("A", "B")
+	server.flushLater(c, 10*time.Millisecond)
+	server.flushLater(c, time.Hour)
+	time.Sleep(50 * time.Millisecond)
+	if c.Get("A") != "B" || len(server.flushes) != 1 {
+		t.Error("Delayed flush should be replaced by the next delayed flush of the cache")
+	}
+
+	server.flushLater(c, 10*time.Millisecond)
+	server.Close()
+	server.flushLater(c, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if c.Get("A") != "B" {
+		t.Error("Delayed flush should be stopped when the server is closed")
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	server := newTestServer(newRegistry(t))
+	server.logWrite = func(cacheId string, c cache.Cache, key string, write func() error) error {
+		if key == "full" {
+			return cache.ErrCacheFull
+		}
+		if err := write(); err != nil {
+			return err
+		}
+		return cache.NewError(cache.SERVER_ERROR, "Cannot write command log")
+	}
+	conn, reader := connectServer(t, server)
+	exchange(t, conn, reader, "set auth 0 0 12\r\nadmin secret\r\n", "STORED\r\n")
+
+	exchange(t, conn, reader, "set full 0 0 1\r\n1\r\n", "SERVER_ERROR out of memory storing object\r\n")
+	exchange(t, conn, reader, "incr full 1\r\n", "SERVER_ERROR out of memory\r\n")
+	exchange(t, conn, reader, "set A 0 0 1\r\n1\r\n", "SERVER_ERROR Cannot write command log\r\n")
+	exchange(t, conn, reader, "incr A 1\r\n", "SERVER_ERROR Cannot write command log\r\n")
+	exchange(t, conn, reader, "add A 0 0 1\r\n1\r\n", "NOT_STORED\r\n")
+}
+
+func TestIncrDecrCommands(t *testing.T) {
+	conn, reader := connectAuthenticated(t, newRegistry(t))
+
+	exchange(t, conn, reader, "incr A 1\r\n", "NOT_FOUND\r\n")
+	exchange(t, conn, reader, "set A 5 0 2\r\n10\r\n", "STORED\r\n")
+	exchange(t, conn, reader, "incr A 5\r\n", "15\r\n")
+	exchange(t, conn, reader, "decr A 20\r\n", "0\r\n")
+	exchange(t, conn, reader, "get A\r\n", "VALUE A 5 1\r\n0\r\nEND\r\n")
+
+	exchange(t, conn, reader, "set A 0 0 20\r\n18446744073709551615\r\n", "STORED\r\n")
+	exchange(t, conn, reader, "incr A 2\r\n", "1\r\n")
+
+	exchange(t, conn, reader, "incr A x\r\n", "CLIENT_ERROR invalid numeric delta argument\r\n")
+	exchange(t, conn, reader, "set B 0 0 1\r\nX\r\n", "STORED\r\n")
+	exchange(t, conn, reader, "incr B 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+}
+
+func TestStatsCommand(t *testing.T) {
+	conn, reader := connectAuthenticated(t, newRegistry(t))
+
+	exchange(t, conn, reader, "set A 0 0 1\r\nB\r\n", "STORED\r\n")
+	exchange(t, conn, reader, "get A Z\r\n", "VALUE A 0 1\r\nB\r\nEND\r\n")
+
+	go conn.Write([]byte("stats\r\n"))
+	stats := map[string]string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal("Unexpected error during reading stats", err)
+		}
+		if line == "END\r\n" {
+			break
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "STAT" {
+			t.Fatal("Wrong format of stats", line)
+		}
+		stats[fields[1]] = fields[2]
+	}
+
+	if stats["cmd_get"] != "2" || stats["get_hits"] != "1" || stats["get_misses"] != "1" || stats["curr_items"] != "1" || stats["version"] != SERVER_VERSION {
+		t.Error("Wrong behavior of stats command", stats)
+	}
+}
+
+func TestToTTL(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	if toTTL(0, now) != cache.DEFAULT_TTL || toTTL(-1, now) != EXPIRED_TTL {
+		t.Error("Wrong behavior of toTTL function")
+	}
+
+	if toTTL(10, now) != int64(10*time.Second) {
+		t.Error("Relative expiration time was converted incorrectly")
+	}
+
+	if toTTL(1700000100, now) != int64(100*time.Second) || toTTL(1699999999, now) != EXPIRED_TTL {
+		t.Error("Absolute expiration time was converted incorrectly")
+	}
+}
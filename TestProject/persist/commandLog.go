@@ -0,0 +1,645 @@
+package persist
+
+import (
+	"TestProject/cache"
+	"TestProject/utils"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+//Defines how often the command log is flushed to a disk.
+type FsyncPolicy string
+
+const (
+	COMMAND_LOG_MAGIC   = "TPLOG"
+	COMMAND_LOG_VERSION = 1
+
+	//Every command is synced to a disk before the next one is appended.
+	FSYNC_ALWAYS FsyncPolicy = "always"
+	//Commands are synced to a disk once a second.
+	FSYNC_EVERY_SECOND FsyncPolicy = "everysec"
+	//Commands are passed to an operating system which decides when to sync them.
+	FSYNC_NEVER FsyncPolicy = "never"
+
+	DEFAULT_COMPACTION_INTERVAL = time.Minute
+	DEFAULT_COMPACTION_MIN_SIZE = 16 * 1024 * 1024
+
+	//The number of locks that keep the order of commands for the same key.
+	KEY_LOCKS = 64
+)
+
+//Options to tune a command log
+type CommandLogOptions struct {
+	Fsync FsyncPolicy
+
+	//How often the size of the log is checked for compaction. Non-positive value disables the compaction.
+	CompactionInterval time.Duration
+
+	//The log is compacted when it is bigger than this size and it doubled since the last compaction.
+	CompactionMinSize int64
+}
+
+//Returns default options of a command log
+func DefaultCommandLogOptions() CommandLogOptions {
+	return CommandLogOptions{Fsync: FSYNC_EVERY_SECOND, CompactionInterval: DEFAULT_COMPACTION_INTERVAL, CompactionMinSize: DEFAULT_COMPACTION_MIN_SIZE}
+}
+
+//Converts a string to a fsync policy.
+//Returns an error if the string is not a known policy.
+func ParseFsyncPolicy(policy string) (FsyncPolicy, error) {
+	switch p := FsyncPolicy(policy); p {
+	case FSYNC_ALWAYS, FSYNC_EVERY_SECOND, FSYNC_NEVER:
+		return p, nil
+	}
+	return FSYNC_EVERY_SECOND, errors.New(fmt.Sprintf("Unknown fsync policy [%v]", policy))
+}
+
+//One line of a command log.
+//A record contains either options of a named cache, or an executed command, or a key-value pair written by compaction.
+type logRecord struct {
+	Cache   string
+	Options *cache.CacheOptions `json:",omitempty"`
+	Command string              `json:",omitempty"`
+	Params  []string            `json:",omitempty"`
+	Entry   *Entry              `json:",omitempty"`
+
+	//Absolute expiration time in Unix nanoseconds of the command key after the command was executed,
+	//zero for keys without time to live.
+	ExpiresAt int64 `json:",omitempty"`
+}
+
+//Append-only log of mutating commands of all named caches.
+//
+//A log file starts with a header line "TPLOG <version>", followed by JSON records, one per line.
+//Time to live is stored as an absolute expiration time, so replay doesn't extend it.
+//The log is compacted in background by rewriting it from the current content of caches.
+type CommandLog struct {
+	//Shared by executed commands, exclusive while compaction copies caches and switches files.
+	gate     sync.RWMutex
+	keyLocks [KEY_LOCKS]sync.Mutex
+
+	//Protects fields below
+	sync.Mutex
+	path       string
+	file       *os.File
+	writer     *bufio.Writer
+	size       int64
+	baseSize   int64
+	dirty      bool
+	known      map[string]bool
+	rewriting  bool
+	rewriteBuf bytes.Buffer
+
+	options CommandLogOptions
+	caches  cache.Cache
+	log     *slog.Logger
+	done    chan struct{}
+	once    sync.Once
+}
+
+//Opens a command log for named caches stored in <caches>, the file is created if it doesn't exist.
+//Errors of background activities are written into <log>.
+func OpenCommandLog(path string, caches cache.Cache, options CommandLogOptions, log *slog.Logger) (*CommandLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	commandLog := new(CommandLog)
+	commandLog.path = path
+	commandLog.file = file
+	commandLog.writer = bufio.NewWriter(file)
+	commandLog.size = info.Size()
+	commandLog.baseSize = info.Size()
+	commandLog.known = make(map[string]bool)
+	commandLog.options = options
+	commandLog.caches = caches
+	commandLog.log = log
+	commandLog.done = make(chan struct{})
+
+	if commandLog.size == 0 {
+		err = commandLog.writeHeader(commandLog.writer)
+		if err == nil {
+			err = commandLog.flush(true)
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	go commandLog.run()
+	return commandLog, nil
+}
+
+//Returns <true> if the log contains no records, e.g. it was just created.
+func (this *CommandLog) IsEmpty() bool {
+	this.Lock()
+	defer this.Unlock()
+	return this.size <= int64(len(this.header()))
+}
+
+//Wraps passed commands of a named cache, so all successful mutating commands are appended to the log.
+func (this *CommandLog) Wrap(cmds cache.CacheCommands, cacheId string, c cache.Cache) cache.CacheCommands {
+	return &LoggedCommands{CacheCommands: cmds, commandLog: this, cacheId: cacheId, c: c}
+}
+
+//Executes a mutating command by calling <exec> and appends it to the log if it succeeded.
+//Commands for the same key are appended in the same order they are executed.
+func (this *CommandLog) Exec(cacheId string, c cache.Cache, command string, params []string, exec func() error) error {
+	this.gate.RLock()
+	defer this.gate.RUnlock()
+
+	if len(params) == 0 {
+		return exec()
+	}
+
+	keyLock := &this.keyLocks[keyLockIndex(cacheId, params[0])]
+	keyLock.Lock()
+	defer keyLock.Unlock()
+
+	err := exec()
+	if err != nil {
+		return err
+	}
+
+	record := &logRecord{Cache: cacheId, Command: command, Params: params}
+	if expiresAt, ok := c.ExpiresAt(params[0]); ok && !expiresAt.IsZero() {
+		record.ExpiresAt = expiresAt.UnixNano()
+	}
+
+	appendErr := this.append(c, record)
+	if appendErr != nil {
+		this.log.Error("Cannot append to command log", utils.LOG_CACHE, cacheId, utils.LOG_ERROR, appendErr)
+	}
+	return nil
+}
+
+//Executes a write of a <key> done directly on a Cache by calling <write>, e.g. a write of the memcached listener,
+//and appends the resulting value of the key to the log if the write succeeded.
+//A removed or expired key is logged as "delete" command.
+func (this *CommandLog) ExecWrite(cacheId string, c cache.Cache, key string, write func() error) error {
+	this.gate.RLock()
+	defer this.gate.RUnlock()
+
+	keyLock := &this.keyLocks[keyLockIndex(cacheId, key)]
+	keyLock.Lock()
+	defer keyLock.Unlock()
+
+	err := write()
+	if err != nil {
+		return err
+	}
+
+	record := &logRecord{Cache: cacheId, Command: "delete", Params: []string{key}}
+	if value := c.Get(key); value != nil {
+		expiresAt, _ := c.ExpiresAt(key)
+		entry, err := NewEntry(key, value, expiresAt)
+		if err != nil {
+			this.log.Error("Cannot append to command log", utils.LOG_CACHE, cacheId, utils.LOG_ERROR, err)
+			return nil
+		}
+		record = &logRecord{Cache: cacheId, Entry: entry}
+	}
+
+	appendErr := this.append(c, record)
+	if appendErr != nil {
+		this.log.Error("Cannot append to command log", utils.LOG_CACHE, cacheId, utils.LOG_ERROR, appendErr)
+	}
+	return nil
+}
+
+func keyLockIndex(cacheId, key string) uint32 {
+	hash := uint32(2166136261)
+	for _, s := range []string{cacheId, "\x00", key} {
+		for i := 0; i < len(s); i++ {
+			hash ^= uint32(s[i])
+			hash *= 16777619
+		}
+	}
+	return hash % KEY_LOCKS
+}
+
+func (this *CommandLog) append(c cache.Cache, record *logRecord) error {
+	this.Lock()
+	defer this.Unlock()
+
+	if !this.known[record.Cache] {
+		options := c.Options()
+		err := this.write(&logRecord{Cache: record.Cache, Options: &options})
+		if err != nil {
+			return err
+		}
+		this.known[record.Cache] = true
+	}
+
+	err := this.write(record)
+	if err != nil {
+		return err
+	}
+	return this.flush(this.options.Fsync == FSYNC_ALWAYS)
+}
+
+func (this *CommandLog) write(record *logRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	_, err = this.writer.Write(data)
+	if err != nil {
+		return err
+	}
+	this.size += int64(len(data))
+	this.dirty = true
+
+	if this.rewriting {
+		this.rewriteBuf.Write(data)
+	}
+	return nil
+}
+
+//Passes buffered records to an operating system and syncs the file if <sync> is <true>.
+func (this *CommandLog) flush(sync bool) error {
+	err := this.writer.Flush()
+	if err != nil || !sync {
+		return err
+	}
+	this.dirty = false
+	return this.file.Sync()
+}
+
+func (this *CommandLog) header() string {
+	return fmt.Sprintf("%s %d\n", COMMAND_LOG_MAGIC, COMMAND_LOG_VERSION)
+}
+
+func (this *CommandLog) writeHeader(w io.Writer) error {
+	n, err := io.WriteString(w, this.header())
+	this.size += int64(n)
+	return err
+}
+
+//Replays all records of the log, so caches get the same content they had when the log was written.
+//Named caches are obtained by <getCache> which creates them with logged options if necessary.
+//Returns the number of replayed records.
+func (this *CommandLog) Replay(getCache func(id string, options cache.CacheOptions) cache.Cache) (int, error) {
+	this.gate.Lock()
+	defer this.gate.Unlock()
+
+	file, err := os.Open(this.path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Cannot read command log header: %v", err))
+	}
+	err = checkHeader(header, COMMAND_LOG_MAGIC, COMMAND_LOG_VERSION)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	decoder := json.NewDecoder(reader)
+	for {
+		record := new(logRecord)
+		err = decoder.Decode(record)
+		if err == io.EOF {
+			return replayed, nil
+		} else if err == io.ErrUnexpectedEOF {
+			//The last record was not written completely, e.g. the server crashed
+			return replayed, this.truncate(int64(len(header)) + decoder.InputOffset())
+		} else if err != nil {
+			return replayed, err
+		}
+
+		err = this.replayRecord(record, getCache, time.Now())
+		if err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+}
+
+//Cuts off an incomplete record at the end of the log.
+func (this *CommandLog) truncate(size int64) error {
+	this.Lock()
+	defer this.Unlock()
+
+	err := this.file.Truncate(size)
+	if err != nil {
+		return err
+	}
+	this.size = size
+	this.baseSize = size
+	return nil
+}
+
+//Replays one record, a command that fails now is written into the log, e.g. when the log is partly corrupted.
+func (this *CommandLog) replayRecord(record *logRecord, getCache func(id string, options cache.CacheOptions) cache.Cache, t time.Time) error {
+	if record.Options != nil {
+		getCache(record.Cache, *record.Options)
+		return nil
+	}
+
+	c := getCache(record.Cache, cache.DefaultCacheOptions())
+	if record.Entry != nil {
+		_, err := record.Entry.PutInto(c, t)
+		if err == cache.ErrCacheFull {
+			return nil
+		}
+		return err
+	}
+
+	if !cache.MUTATING_COMMANDS[record.Command] || len(record.Params) == 0 {
+		return errors.New(fmt.Sprintf("Unexpected command [%v] in command log", record.Command))
+	}
+
+	key := record.Params[0]
+	err := cache.ExecuteCommand(cache.BaseCommands(c), record.Command, record.Params)
+	if err != nil {
+		this.log.Warn("Cannot replay command of command log", utils.LOG_CACHE, record.Cache, "command", record.Command, "key", key, utils.LOG_ERROR, err)
+	}
+
+	if record.ExpiresAt == 0 {
+		c.UpdateTTL(key, cache.DEFAULT_TTL)
+	} else if ttl := record.ExpiresAt - t.UnixNano(); ttl > 0 {
+		c.Expire(key, ttl)
+	} else {
+		c.Remove(key)
+	}
+	return nil
+}
+
+//Rewrites the log from the current content of caches.
+//Commands are blocked only while caches are copied and while the files are switched.
+func (this *CommandLog) Compact() error {
+	this.gate.Lock()
+	records, err := this.dumpCaches()
+	if err == nil {
+		this.Lock()
+		this.rewriting = true
+		this.rewriteBuf.Reset()
+		this.Unlock()
+	}
+	this.gate.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmpPath := this.path + ".tmp"
+	file, err := this.writeCompacted(tmpPath, records)
+
+	this.gate.Lock()
+	defer this.gate.Unlock()
+	this.Lock()
+	defer this.Unlock()
+
+	this.rewriting = false
+	if err == nil {
+		_, err = file.Write(this.rewriteBuf.Bytes())
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, this.path)
+	}
+	this.rewriteBuf.Reset()
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		os.Remove(tmpPath)
+		return err
+	}
+
+	this.flush(false)
+	this.file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	this.file = file
+	this.writer = bufio.NewWriter(file)
+	this.size = info.Size()
+	this.baseSize = info.Size()
+	this.dirty = false
+	this.known = make(map[string]bool)
+	return nil
+}
+
+//Copies the content of all named caches into log records.
+func (this *CommandLog) dumpCaches() ([]*logRecord, error) {
+	records := []*logRecord{}
+	var err error
+	this.caches.Range(func(id string, value interface{}, _ time.Time) bool {
+		c, ok := value.(cache.Cache)
+		if !ok {
+			return true
+		}
+
+		options := c.Options()
+		records = append(records, &logRecord{Cache: id, Options: &options})
+		c.Range(func(key string, value interface{}, expiresAt time.Time) bool {
+			var entry *Entry
+			entry, err = NewEntry(key, value, expiresAt)
+			if err == nil {
+				records = append(records, &logRecord{Cache: id, Entry: entry})
+			}
+			return err == nil
+		})
+		return err == nil
+	})
+	return records, err
+}
+
+func (this *CommandLog) writeCompacted(path string, records []*logRecord) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := bufio.NewWriter(file)
+	_, err = io.WriteString(writer, this.header())
+	encoder := json.NewEncoder(writer)
+	for i := 0; i < len(records) && err == nil; i++ {
+		err = encoder.Encode(records[i])
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	return file, err
+}
+
+//Syncs the log every second and compacts it when it is necessary, till Close() is called.
+func (this *CommandLog) run() {
+	syncTicker := time.NewTicker(time.Second)
+	defer syncTicker.Stop()
+
+	var compaction <-chan time.Time
+	if this.options.CompactionInterval > 0 {
+		compactionTicker := time.NewTicker(this.options.CompactionInterval)
+		defer compactionTicker.Stop()
+		compaction = compactionTicker.C
+	}
+
+	for {
+		select {
+		case <-this.done:
+			return
+		case <-syncTicker.C:
+			if this.options.Fsync == FSYNC_EVERY_SECOND {
+				this.sync()
+			}
+		case <-compaction:
+			if this.needsCompaction() {
+				if err := this.Compact(); err != nil {
+					this.log.Error("Cannot compact command log", utils.LOG_ERROR, err)
+				}
+			}
+		}
+	}
+}
+
+func (this *CommandLog) sync() {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.dirty {
+		if err := this.flush(true); err != nil {
+			this.log.Error("Cannot sync command log", utils.LOG_ERROR, err)
+		}
+	}
+}
+
+func (this *CommandLog) needsCompaction() bool {
+	this.Lock()
+	defer this.Unlock()
+	return this.size > this.options.CompactionMinSize && this.size >= 2*this.baseSize
+}
+
+//Stops background activities, syncs and closes the log file.
+func (this *CommandLog) Close() error {
+	this.once.Do(func() {
+		close(this.done)
+	})
+
+	this.gate.Lock()
+	defer this.gate.Unlock()
+	this.Lock()
+	defer this.Unlock()
+
+	err := this.flush(true)
+	closeErr := this.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+//Decorates commands of a named cache, successful mutating commands are appended to a command log.
+type LoggedCommands struct {
+	cache.CacheCommands
+	commandLog *CommandLog
+	cacheId    string
+	c          cache.Cache
+}
+
+func (this *LoggedCommands) SetValue(params []string) (interface{}, error) {
+	var value interface{}
+	err := this.commandLog.Exec(this.cacheId, this.c, "set", params, func() (err error) {
+		value, err = this.CacheCommands.SetValue(params)
+		return
+	})
+	return value, err
+}
+
+func (this *LoggedCommands) UpdateValue(params []string) (bool, error) {
+	var updated bool
+	err := this.commandLog.Exec(this.cacheId, this.c, "update", params, func() (err error) {
+		updated, err = this.CacheCommands.UpdateValue(params)
+		return
+	})
+	return updated, err
+}
+
+func (this *LoggedCommands) RemoveValue(params []string) (interface{}, bool, error) {
+	var value interface{}
+	var removed bool
+	err := this.commandLog.Exec(this.cacheId, this.c, "delete", params, func() (err error) {
+		value, removed, err = this.CacheCommands.RemoveValue(params)
+		return
+	})
+	return value, removed, err
+}
+
+func (this *LoggedCommands) AppendListValue(params []string) error {
+	return this.commandLog.Exec(this.cacheId, this.c, "lappend", params, func() error {
+		return this.CacheCommands.AppendListValue(params)
+	})
+}
+
+func (this *LoggedCommands) DeleteListValue(params []string) (interface{}, error) {
+	var value interface{}
+	err := this.commandLog.Exec(this.cacheId, this.c, "ldelete", params, func() (err error) {
+		value, err = this.CacheCommands.DeleteListValue(params)
+		return
+	})
+	return value, err
+}
+
+func (this *LoggedCommands) SetDictValue(params []string) (interface{}, error) {
+	var value interface{}
+	err := this.commandLog.Exec(this.cacheId, this.c, "dset", params, func() (err error) {
+		value, err = this.CacheCommands.SetDictValue(params)
+		return
+	})
+	return value, err
+}
+
+func (this *LoggedCommands) AppendDictValue(params []string) (bool, error) {
+	var appended bool
+	err := this.commandLog.Exec(this.cacheId, this.c, "dappend", params, func() (err error) {
+		appended, err = this.CacheCommands.AppendDictValue(params)
+		return
+	})
+	return appended, err
+}
+
+func (this *LoggedCommands) DeleteDictValue(params []string) (interface{}, error) {
+	var value interface{}
+	err := this.commandLog.Exec(this.cacheId, this.c, "ddelete", params, func() (err error) {
+		value, err = this.CacheCommands.DeleteDictValue(params)
+		return
+	})
+	return value, err
+}
+
+func (this *LoggedCommands) UpdateTTL(params []string) (bool, error) {
+	var updated bool
+	err := this.commandLog.Exec(this.cacheId, this.c, "ttl", params, func() (err error) {
+		updated, err = this.CacheCommands.UpdateTTL(params)
+		return
+	})
+	return updated, err
+}
@@ -0,0 +1,242 @@
+package persist
+
+import (
+	"TestProject/cache"
+	"TestProject/utils"
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestLog(t *testing.T, path string, caches cache.Cache) *CommandLog {
+	options := DefaultCommandLogOptions()
+	options.Fsync = FSYNC_ALWAYS
+	options.CompactionInterval = 0
+
+	commandLog, err := OpenCommandLog(path, caches, options, slog.Default())
+	if err != nil {
+		t.Fatal("Unexpected error during opening command log", err)
+	}
+	return commandLog
+}
+
+func loggedCommands(commandLog *CommandLog, caches cache.Cache, id string) cache.CacheCommands {
+	c := cacheGetter(caches)(id, cache.DefaultCacheOptions())
+	return commandLog.Wrap(cache.BaseCommands(c), id, c)
+}
+
+func replayLog(t *testing.T, path string) cache.Cache {
+	caches := newRegistry(t)
+	commandLog := openTestLog(t, path, caches)
+	defer commandLog.Close()
+
+	_, err := commandLog.Replay(cacheGetter(caches))
+	if err != nil {
+		t.Fatal("Unexpected error during replaying command log", err)
+	}
+	return caches
+}
+
+func TestReplayCommandLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.log")
+	caches := newRegistry(t)
+	commandLog := openTestLog(t, path, caches)
+
+	cmds := loggedCommands(commandLog, caches, "TestCache")
+	cmds.SetValue([]string{"A", "B"})
+	cmds.SetValue([]string{"C", "D", "3600"})
+	cmds.UpdateValue([]string{"A", "B", "Z"})
+	cmds.AppendListValue([]string{"L", "1"})
+	cmds.AppendListValue([]string{"L", "2"})
+	cmds.AppendListValue([]string{"L", "3"})
+	cmds.DeleteListValue([]string{"L", "0"})
+	cmds.SetDictValue([]string{"D", "K", "V"})
+	cmds.AppendDictValue([]string{"D", "K2", "V2"})
+	cmds.DeleteDictValue([]string{"D", "K"})
+	cmds.SetValue([]string{"E", "F"})
+	cmds.RemoveValue([]string{"E"})
+	cmds.SetValue([]string{"G", "H"})
+	cmds.UpdateTTL([]string{"G", "1800"})
+	commandLog.Close()
+
+	expected, _ := caches.Get("TestCache").(cache.Cache).ExpiresAt("C")
+
+	replayed := replayLog(t, path).Get("TestCache").(cache.Cache)
+	if replayed.Size() != 5 || replayed.Get("A") != "Z" || replayed.Get("E") != nil {
+		t.Error("String values were not replayed correctly")
+	}
+
+	if list, ok := replayed.Get("L").(utils.List); !ok || list.String() != "List [2 3]" {
+		t.Error("List values were not replayed correctly")
+	}
+
+	if dict, ok := replayed.Get("D").(utils.Dict); !ok || dict.Size() != 1 || dict.Get("K2") != "V2" {
+		t.Error("Dictionary values were not replayed correctly")
+	}
+
+	expiresAt, _ := replayed.ExpiresAt("C")
+	if expiresAt.Sub(expected) > 10*time.Millisecond || expiresAt.Before(expected) {
+		t.Error("Replay should keep the absolute expiration time")
+	}
+
+	expiresAt, _ = replayed.ExpiresAt("G")
+	if expiresAt.IsZero() {
+		t.Error("Time to live was not replayed")
+	}
+}
+
+func TestReplayLogsFailedCommands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.log")
+	caches := newRegistry(t)
+	commandLog := openTestLog(t, path, caches)
+	loggedCommands(commandLog, caches, "TestCache").SetValue([]string{"A", "B"})
+	commandLog.Close()
+
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	file.WriteString(`{"Cache":"TestCache","Command":"lappend","Params":["A","C"]}` + "\n")
+	file.Close()
+
+	var output bytes.Buffer
+	caches = newRegistry(t)
+	commandLog, err := OpenCommandLog(path, caches, DefaultCommandLogOptions(), slog.New(slog.NewTextHandler(&output, nil)))
+	if err != nil {
+		t.Fatal("Unexpected error during opening command log", err)
+	}
+	defer commandLog.Close()
+
+	replayed, err := commandLog.Replay(cacheGetter(caches))
+	if err != nil || replayed != 3 || caches.Get("TestCache").(cache.Cache).Get("A") != "B" {
+		t.Error("Failed command should not stop replay", replayed, err)
+	}
+	if !strings.Contains(output.String(), "Cannot replay command of command log") || !strings.Contains(output.String(), "command=lappend") {
+		t.Error("Failed command should be written into the log", output.String())
+	}
+}
+
+func TestReplayDropsExpiredValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.log")
+	caches := newRegistry(t)
+	commandLog := openTestLog(t, path, caches)
+
+	cmds := loggedCommands(commandLog, caches, "TestCache")
+	cmds.SetValue([]string{"A", "B"})
+	cmds.AppendListValue([]string{"L", "1", "1"})
+	cmds.UpdateTTL([]string{"A", "1"})
+	commandLog.Close()
+
+	time.Sleep(1100 * time.Millisecond)
+
+	replayed := replayLog(t, path).Get("TestCache").(cache.Cache)
+	if replayed.Get("A") != nil || replayed.Get("L") != nil {
+		t.Error("Values that expired before replay should be dropped")
+	}
+}
+
+func TestCompactCommandLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.log")
+	caches := newRegistry(t)
+	commandLog := openTestLog(t, path, caches)
+
+	cmds := loggedCommands(commandLog, caches, "TestCache")
+	for i := 0; i < 100; i++ {
+		cmds.SetValue([]string{"A", "B"})
+		cmds.AppendListValue([]string{"L", "1"})
+	}
+	before, _ := os.Stat(path)
+
+	err := commandLog.Compact()
+	if err != nil {
+		t.Fatal("Unexpected error during compaction", err)
+	}
+
+	cmds.AppendListValue([]string{"L", "2"})
+	commandLog.Close()
+
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Error("Compaction should make the log smaller")
+	}
+
+	replayed := replayLog(t, path).Get("TestCache").(cache.Cache)
+	list, ok := replayed.Get("L").(utils.List)
+	if !ok || list.Size() != 101 || replayed.Get("A") != "B" {
+		t.Error("Compacted log was not replayed correctly")
+	}
+}
+
+func TestReplayIncompleteRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.log")
+	caches := newRegistry(t)
+	commandLog := openTestLog(t, path, caches)
+	loggedCommands(commandLog, caches, "TestCache").SetValue([]string{"A", "B"})
+	commandLog.Close()
+
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	file.WriteString(`{"Cache":"TestCache","Comm`)
+	file.Close()
+
+	caches = newRegistry(t)
+	commandLog = openTestLog(t, path, caches)
+	_, err := commandLog.Replay(cacheGetter(caches))
+	if err != nil {
+		t.Fatal("Incomplete last record should be ignored", err)
+	}
+	loggedCommands(commandLog, caches, "TestCache").SetValue([]string{"C", "D"})
+	commandLog.Close()
+
+	replayed := replayLog(t, path).Get("TestCache").(cache.Cache)
+	if replayed.Get("A") != "B" || replayed.Get("C") != "D" {
+		t.Error("Log should stay usable after an incomplete record")
+	}
+}
+
+func TestReplayDirectWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.log")
+	caches := newRegistry(t)
+	commandLog := openTestLog(t, path, caches)
+
+	c := cacheGetter(caches)("TestCache", cache.DefaultCacheOptions())
+	commandLog.ExecWrite("TestCache", c, "A", func() error {
+		c.PutExpirable("A", cache.FlaggedValue{Value: "B", Flags: 5}, int64(time.Hour))
+		return nil
+	})
+	commandLog.ExecWrite("TestCache", c, "C", func() error {
+		c.Put("C", "D")
+		return nil
+	})
+	commandLog.ExecWrite("TestCache", c, "C", func() error {
+		c.Remove("C")
+		return nil
+	})
+	commandLog.ExecWrite("TestCache", c, "E", func() error {
+		c.Put("E", "F")
+		return cache.ErrVersionMismatch
+	})
+	commandLog.Close()
+
+	replayed := replayLog(t, path).Get("TestCache").(cache.Cache)
+	if replayed.Get("A") != (cache.FlaggedValue{Value: "B", Flags: 5}) || replayed.Get("C") != nil || replayed.Get("E") != nil {
+		t.Error("Direct writes were not replayed correctly")
+	}
+
+	expiresAt, _ := replayed.ExpiresAt("A")
+	if expiresAt.IsZero() {
+		t.Error("Time to live of a direct write was not replayed")
+	}
+}
+
+func TestParseFsyncPolicy(t *testing.T) {
+	policy, err := ParseFsyncPolicy("always")
+	if err != nil || policy != FSYNC_ALWAYS {
+		t.Error("Wrong behavior of ParseFsyncPolicy function")
+	}
+
+	_, err = ParseFsyncPolicy("sometimes")
+	if err == nil {
+		t.Error("Wrong behavior of ParseFsyncPolicy function")
+	}
+}
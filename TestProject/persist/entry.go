@@ -0,0 +1,122 @@
+package persist
+
+import (
+	"TestProject/cache"
+	"TestProject/utils"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	STRING_VALUE = "string"
+	LIST_VALUE   = "list"
+	DICT_VALUE   = "dict"
+)
+
+//Serializable form of a cached key-value pair.
+//Only string, cache.FlaggedValue, utils.List and utils.Dict values are supported, values of lists and dictionaries are stored as strings.
+type Entry struct {
+	Key   string
+	Type  string
+	Value string            `json:",omitempty"`
+	List  []string          `json:",omitempty"`
+	Dict  map[string]string `json:",omitempty"`
+
+	//Flags of a cache.FlaggedValue, string values without flags are plain strings.
+	Flags uint32 `json:",omitempty"`
+
+	//Absolute expiration time in Unix nanoseconds, zero for values without time to live.
+	ExpiresAt int64 `json:",omitempty"`
+}
+
+//Creates a serializable form of a key-value pair.
+//Returns an error if a type of the value is not supported.
+func NewEntry(key string, value interface{}, expiresAt time.Time) (*Entry, error) {
+	entry := &Entry{Key: key}
+	if !expiresAt.IsZero() {
+		entry.ExpiresAt = expiresAt.UnixNano()
+	}
+
+	switch v := value.(type) {
+	case string:
+		entry.Type = STRING_VALUE
+		entry.Value = v
+	case cache.FlaggedValue:
+		entry.Type = STRING_VALUE
+		entry.Value = v.Value
+		entry.Flags = v.Flags
+	case utils.List:
+		entry.Type = LIST_VALUE
+		values := v.Values()
+		entry.List = make([]string, len(values))
+		for i := range values {
+			entry.List[i] = fmt.Sprint(values[i])
+		}
+	case utils.Dict:
+		entry.Type = DICT_VALUE
+		entry.Dict = make(map[string]string)
+		for dictKey, dictValue := range v.Pairs() {
+			entry.Dict[dictKey] = fmt.Sprint(dictValue)
+		}
+	default:
+		return nil, errors.New(fmt.Sprintf("Value of unsupported type [%T] for the key [%v]", value, key))
+	}
+
+	return entry, nil
+}
+
+//Creates a value that can be put into a Cache.
+func (this *Entry) CacheValue() (interface{}, error) {
+	switch this.Type {
+	case STRING_VALUE:
+		if this.Flags != 0 {
+			return cache.FlaggedValue{Value: this.Value, Flags: this.Flags}, nil
+		}
+		return this.Value, nil
+	case LIST_VALUE:
+		values := make([]interface{}, len(this.List))
+		for i := range this.List {
+			values[i] = this.List[i]
+		}
+		return utils.NewSyncList(values...), nil
+	case DICT_VALUE:
+		dict := utils.NewDict()
+		for key, value := range this.Dict {
+			dict.Put(key, value)
+		}
+		return dict, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unknown type [%v] of the value for the key [%v]", this.Type, this.Key))
+}
+
+//Returns time to live that is left at a passed time, DEFAULT_TTL for values without time to live.
+//Returns <false> if the value is already expired.
+func (this *Entry) TTL(t time.Time) (int64, bool) {
+	if this.ExpiresAt == 0 {
+		return cache.DEFAULT_TTL, true
+	}
+
+	ttl := this.ExpiresAt - t.UnixNano()
+	return ttl, ttl > 0
+}
+
+//Puts the key-value pair into a passed Cache with the time to live that is left.
+//Returns <false> if the value is expired and was not put.
+func (this *Entry) PutInto(c cache.Cache, t time.Time) (bool, error) {
+	ttl, alive := this.TTL(t)
+	if !alive {
+		return false, nil
+	}
+
+	value, err := this.CacheValue()
+	if err != nil {
+		return false, err
+	}
+
+	_, err = c.PutExpirable(this.Key, value, ttl)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
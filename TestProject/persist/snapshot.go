@@ -0,0 +1,216 @@
+package persist
+
+import (
+	"TestProject/cache"
+	"TestProject/utils"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SNAPSHOT_MAGIC   = "TPSNAP"
+	SNAPSHOT_VERSION = 1
+)
+
+//One line of a snapshot file.
+//The first record of every named cache contains its options, all others contain its key-value pairs.
+type snapshotRecord struct {
+	Cache   string
+	Options *cache.CacheOptions `json:",omitempty"`
+	Entry   *Entry              `json:",omitempty"`
+}
+
+//Saves point-in-time snapshots of all named caches into a file and loads them back.
+//
+//A snapshot file starts with a header line "TPSNAP <version>", followed by JSON records, one per line.
+//Every snapshot is written into a temporary file first, which replaces the previous snapshot when it is complete.
+type Snapshotter struct {
+	sync.Mutex
+	path   string
+	caches cache.Cache
+	done   chan struct{}
+	once   sync.Once
+}
+
+//Creates a Snapshotter for named caches stored in <caches>.
+func NewSnapshotter(path string, caches cache.Cache) *Snapshotter {
+	snapshotter := new(Snapshotter)
+	snapshotter.path = path
+	snapshotter.caches = caches
+	snapshotter.done = make(chan struct{})
+	return snapshotter
+}
+
+//Writes a snapshot of all named caches.
+//Every cache segment is copied under its lock, writes into other segments are not blocked meanwhile.
+func (this *Snapshotter) Save() error {
+	this.Lock()
+	defer this.Unlock()
+
+	tmpPath := this.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	err = this.write(file)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, this.path)
+}
+
+func (this *Snapshotter) write(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	_, err := fmt.Fprintf(writer, "%s %d\n", SNAPSHOT_MAGIC, SNAPSHOT_VERSION)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(writer)
+	this.caches.Range(func(id string, value interface{}, _ time.Time) bool {
+		c, ok := value.(cache.Cache)
+		if !ok {
+			return true
+		}
+
+		options := c.Options()
+		err = encoder.Encode(&snapshotRecord{Cache: id, Options: &options})
+		if err != nil {
+			return false
+		}
+
+		c.Range(func(key string, value interface{}, expiresAt time.Time) bool {
+			var entry *Entry
+			entry, err = NewEntry(key, value, expiresAt)
+			if err == nil {
+				err = encoder.Encode(&snapshotRecord{Cache: id, Entry: entry})
+			}
+			return err == nil
+		})
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return writer.Flush()
+}
+
+//Loads the latest snapshot, values that expired since the snapshot was saved are dropped.
+//Named caches are obtained by <getCache> which creates them with stored options if necessary.
+//Returns the number of loaded values, a missing snapshot file is not an error.
+func (this *Snapshotter) Load(getCache func(id string, options cache.CacheOptions) cache.Cache) (int, error) {
+	this.Lock()
+	defer this.Unlock()
+
+	file, err := os.Open(this.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Cannot read snapshot header: %v", err))
+	}
+	err = checkHeader(header, SNAPSHOT_MAGIC, SNAPSHOT_VERSION)
+	if err != nil {
+		return 0, err
+	}
+
+	t := time.Now()
+	loaded := 0
+	caches := make(map[string]cache.Cache)
+	decoder := json.NewDecoder(reader)
+	for {
+		record := new(snapshotRecord)
+		err = decoder.Decode(record)
+		if err == io.EOF {
+			return loaded, nil
+		} else if err != nil {
+			return loaded, err
+		}
+
+		if record.Options != nil {
+			caches[record.Cache] = getCache(record.Cache, *record.Options)
+		}
+		if record.Entry == nil {
+			continue
+		}
+
+		c := caches[record.Cache]
+		if c == nil {
+			c = getCache(record.Cache, cache.DefaultCacheOptions())
+			caches[record.Cache] = c
+		}
+		put, err := record.Entry.PutInto(c, t)
+		if err != nil && err != cache.ErrCacheFull {
+			return loaded, err
+		}
+		if put {
+			loaded++
+		}
+	}
+}
+
+//Saves snapshots every <interval> till Stop() is called, errors are written into <log>.
+func (this *Snapshotter) Start(interval time.Duration, log *slog.Logger) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-this.done:
+				return
+			case <-ticker.C:
+				if err := this.Save(); err != nil {
+					log.Error("Cannot save snapshot", utils.LOG_ERROR, err)
+				}
+			}
+		}
+	}()
+}
+
+//Stops periodic snapshots, can be called several times.
+func (this *Snapshotter) Stop() {
+	this.once.Do(func() {
+		close(this.done)
+	})
+}
+
+//Checks that a header line has expected format: "<magic> <version>".
+func checkHeader(header, magic string, version int) error {
+	fields := strings.Fields(header)
+	if len(fields) != 2 || fields[0] != magic {
+		return errors.New(fmt.Sprintf("Unknown file format, [%v] header expected", magic))
+	}
+
+	fileVersion, err := strconv.Atoi(fields[1])
+	if err != nil || fileVersion != version {
+		return errors.New(fmt.Sprintf("Unsupported version [%v] of [%v] file", fields[1], magic))
+	}
+	return nil
+}
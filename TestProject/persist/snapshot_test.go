@@ -0,0 +1,108 @@
+package persist
+
+import (
+	"TestProject/cache"
+	"TestProject/utils"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//Returns a function that creates named caches inside a passed registry, the same way the server does it.
+func cacheGetter(caches cache.Cache) func(id string, options cache.CacheOptions) cache.Cache {
+	return func(id string, options cache.CacheOptions) cache.Cache {
+		existingCache := caches.Get(id)
+		if existingCache == nil {
+			existingCache = cache.NewCacheWithOptions(options)
+			caches.Put(id, existingCache)
+		}
+		return existingCache.(cache.Cache)
+	}
+}
+
+func TestSaveAndLoadSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "caches.snapshot")
+
+	caches := newRegistry(t)
+	getCache := cacheGetter(caches)
+
+	options := cache.DefaultCacheOptions()
+	options.MaxEntries = 10
+	options.Policy = cache.LRU
+	first := getCache("first", options)
+	first.Put("A", "B")
+	first.Put("L", utils.NewSyncList("1", "2", "3"))
+	first.PutExpirable("T", "expirable", int64(time.Hour))
+	first.PutExpirable("E", "expired", int64(50*time.Millisecond))
+
+	dict := utils.NewDict()
+	dict.Put("K", "V")
+	getCache("second", cache.DefaultCacheOptions()).Put("D", dict)
+
+	err := NewSnapshotter(path, caches).Save()
+	if err != nil {
+		t.Fatal("Unexpected error during saving snapshot", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	loadedCaches := newRegistry(t)
+	loaded, err := NewSnapshotter(path, loadedCaches).Load(cacheGetter(loadedCaches))
+	if err != nil {
+		t.Fatal("Unexpected error during loading snapshot", err)
+	}
+
+	if loaded != 4 {
+		t.Error("Expired values should not be loaded")
+	}
+
+	loadedFirst := loadedCaches.Get("first").(cache.Cache)
+	if loadedFirst.Options().MaxEntries != 10 || loadedFirst.Options().Policy != cache.LRU {
+		t.Error("Options of a cache were not restored")
+	}
+
+	if loadedFirst.Get("A") != "B" || loadedFirst.Get("E") != nil {
+		t.Error("String values were not restored correctly")
+	}
+
+	list, ok := loadedFirst.Get("L").(utils.List)
+	if !ok || list.String() != "List [1 2 3]" {
+		t.Error("List values were not restored correctly")
+	}
+
+	if !loadedFirst.UpdateTTL("T", int64(time.Hour)) {
+		t.Error("Expirable values were not restored")
+	}
+
+	loadedDict, ok := loadedCaches.Get("second").(cache.Cache).Get("D").(utils.Dict)
+	if !ok || loadedDict.Get("K") != "V" {
+		t.Error("Dictionary values were not restored correctly")
+	}
+}
+
+func TestLoadMissingSnapshot(t *testing.T) {
+	caches := newRegistry(t)
+	loaded, err := NewSnapshotter(filepath.Join(t.TempDir(), "missing"), caches).Load(cacheGetter(caches))
+	if err != nil || loaded != 0 {
+		t.Error("Missing snapshot should not be an error")
+	}
+}
+
+func TestLoadUnsupportedSnapshotVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "caches.snapshot")
+	os.WriteFile(path, []byte("TPSNAP 99\n"), 0600)
+
+	caches := newRegistry(t)
+	_, err := NewSnapshotter(path, caches).Load(cacheGetter(caches))
+	if err == nil {
+		t.Error("Snapshot of unknown version should not be loaded")
+	}
+}
+
+//Creates a registry of named caches, its caches are stopped when a test ends.
+func newRegistry(t *testing.T) cache.Cache {
+	caches := cache.NewRegistry()
+	t.Cleanup(func() { cache.StopCaches(caches) })
+	return caches
+}
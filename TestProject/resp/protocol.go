@@ -0,0 +1,199 @@
+package resp
+
+import (
+	"TestProject/utils"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	//Max number of arguments of one command.
+	MAX_ARGS = 1024 * 1024
+
+	//Max size of one bulk string, the same as Redis uses.
+	MAX_BULK_SIZE = 512 << 20
+
+	//Max length of an inline command or of a length line.
+	MAX_LINE_SIZE = 64 << 10
+
+	//Limits of a client that is not authenticated yet, the same as Redis uses.
+	MAX_UNAUTHENTICATED_ARGS      = 10
+	MAX_UNAUTHENTICATED_BULK_SIZE = 16 << 10
+
+	//Bulk strings are read by chunks of this size, so a declared size is not allocated before the data is sent.
+	BULK_CHUNK_SIZE = 64 << 10
+)
+
+//Returned when a client sends data that is not valid RESP, the connection has to be closed after it.
+var ErrProtocol = errors.New("Protocol error")
+
+func protocolError(format string, params ...interface{}) error {
+	return fmt.Errorf("%w: %v", ErrProtocol, fmt.Sprintf(format, params...))
+}
+
+//Reads one command sent by a client.
+//Commands are sent as arrays of bulk strings, e.g. "*2\r\n$3\r\nGET\r\n$1\r\nA\r\n",
+//or as inline commands, e.g. "GET A\r\n", which are split the same way as telnet commands.
+//Returns an empty command for an empty inline command.
+//A client that is not <authenticated> can send only a few short arguments.
+func ReadCommand(reader *bufio.Reader, authenticated bool) ([]string, error) {
+	maxArgs, maxBulkSize := MAX_ARGS, MAX_BULK_SIZE
+	if !authenticated {
+		maxArgs, maxBulkSize = MAX_UNAUTHENTICATED_ARGS, MAX_UNAUTHENTICATED_BULK_SIZE
+	}
+
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		args, err := utils.SplitCommand(line)
+		if err != nil {
+			return nil, protocolError("%v", err)
+		}
+		return args, nil
+	}
+
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count > maxArgs {
+		return nil, protocolError("invalid multibulk length")
+	}
+
+	args := make([]string, 0, utils.Min(count, 1024))
+	for i := 0; i < count; i++ {
+		line, err = readLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, protocolError("expected '$', got '%v'", line[:utils.Min(1, len(line))])
+		}
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkSize {
+			return nil, protocolError("invalid bulk length")
+		}
+
+		arg, err := readBulk(reader, size)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+//Reads a bulk string of <size> bytes followed by "\r\n".
+//A buffer grows by chunks while data is received, so a client cannot make the server allocate a size it doesn't send.
+func readBulk(reader *bufio.Reader, size int) (string, error) {
+	var data bytes.Buffer
+	data.Grow(utils.Min(size+2, BULK_CHUNK_SIZE))
+	for data.Len() < size+2 {
+		_, err := io.CopyN(&data, reader, int64(utils.Min(size+2-data.Len(), BULK_CHUNK_SIZE)))
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	bulk := data.Bytes()
+	if bulk[size] != '\r' || bulk[size+1] != '\n' {
+		return "", protocolError("bulk string is not terminated")
+	}
+	return string(bulk[:size]), nil
+}
+
+func readLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		part, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, part...)
+		if len(line) > MAX_LINE_SIZE {
+			return "", protocolError("too big inline request")
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+//Writes replies in RESP2 or RESP3 format depending on the protocol version chosen by a client.
+//Replies are buffered, Flush() has to be called to send them.
+type Writer struct {
+	*bufio.Writer
+	proto int
+}
+
+//Creates a Writer of RESP2 replies, the version can be changed with SetProto().
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{Writer: bufio.NewWriter(w), proto: 2}
+}
+
+func (this *Writer) SetProto(proto int) {
+	this.proto = proto
+}
+
+func (this *Writer) Proto() int {
+	return this.proto
+}
+
+//Writes a simple string reply, e.g. "+OK".
+func (this *Writer) WriteSimple(s string) {
+	this.WriteString("+" + s + "\r\n")
+}
+
+//Writes an error reply, <msg> has to start with an error code, e.g. "ERR wrong number of arguments".
+func (this *Writer) WriteError(msg string) {
+	this.WriteString("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(msg) + "\r\n")
+}
+
+func (this *Writer) WriteInt(n int64) {
+	this.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (this *Writer) WriteBulk(s string) {
+	this.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+//Writes a null reply, "$-1" in RESP2 and "_" in RESP3.
+func (this *Writer) WriteNull() {
+	if this.proto >= 3 {
+		this.WriteString("_\r\n")
+	} else {
+		this.WriteString("$-1\r\n")
+	}
+}
+
+//Writes a header of an array of <n> elements, the elements have to be written after it.
+func (this *Writer) WriteArray(n int) {
+	this.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+//Writes a header of a map of <n> key-value pairs, the keys and values have to be written after it.
+//RESP2 has no maps, so a map is written as an array of keys and values.
+func (this *Writer) WriteMap(n int) {
+	if this.proto >= 3 {
+		this.WriteString("%" + strconv.Itoa(n) + "\r\n")
+	} else {
+		this.WriteArray(2 * n)
+	}
+}
+
+//Writes an array of bulk strings.
+func (this *Writer) WriteStrings(values []string) {
+	this.WriteArray(len(values))
+	for _, value := range values {
+		this.WriteBulk(value)
+	}
+}
@@ -0,0 +1,700 @@
+package resp
+
+import (
+	"TestProject/audit"
+	"TestProject/auth"
+	"TestProject/cache"
+	"TestProject/utils"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	//Named cache a connection uses till SELECT command is executed.
+	DEFAULT_DB = "0"
+
+	SERVER_NAME    = "TestProject"
+	SERVER_VERSION = "1.0.0"
+)
+
+//Serves clients that speak RESP, the protocol of Redis, so redis-cli and Redis client libraries can be used.
+//Named caches are used as databases, "SELECT TestCache" switches a connection to the cache "TestCache".
+type Server struct {
+	getCache     func(id string, options cache.CacheOptions) cache.Cache
+	authenticate func(name, pass, remote string) *auth.User
+	wrap         func(cmds cache.CacheCommands, cacheId string, c cache.Cache) cache.CacheCommands
+	auditor      *audit.Auditor
+	log          *slog.Logger
+}
+
+//Creates a Server.
+//Named caches are obtained by <getCache>, users are checked by <authenticate> that returns <nil> for a wrong password
+//and gets a remote address of a client, commands of every cache are decorated by <wrap>, e.g. to be written into the command log.
+//Mutating commands are written into the audit log by <auditor>, errors of connections and denied commands are written into <log>.
+func NewServer(getCache func(id string, options cache.CacheOptions) cache.Cache,
+	authenticate func(name, pass, remote string) *auth.User,
+	wrap func(cmds cache.CacheCommands, cacheId string, c cache.Cache) cache.CacheCommands,
+	auditor *audit.Auditor,
+	log *slog.Logger) *Server {
+
+	server := new(Server)
+	server.getCache = getCache
+	server.authenticate = authenticate
+	server.wrap = wrap
+	server.auditor = auditor
+	server.log = log
+	return server
+}
+
+//Accepts connections till <listener> is closed.
+func (this *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go this.ServeConn(conn)
+	}
+}
+
+//State of one client connection.
+type session struct {
+	server *Server
+	writer *Writer
+	remote string
+	user   *auth.User
+	//Log of the connection, the user is added to fields of <baseLog> at login.
+	log     *slog.Logger
+	baseLog *slog.Logger
+	db      string
+	c       cache.Cache
+	cmds    cache.CacheCommands
+}
+
+//Serves commands of one client till it disconnects or sends QUIT.
+func (this *Server) ServeConn(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	s := &session{server: this, writer: NewWriter(conn), remote: conn.RemoteAddr().String()}
+	s.baseLog = this.log.With(utils.LOG_REMOTE, s.remote)
+	s.log = s.baseLog
+	s.db = DEFAULT_DB
+
+	for {
+		args, err := ReadCommand(reader, s.user != nil)
+		if err != nil {
+			if errors.Is(err, ErrProtocol) {
+				s.writer.WriteError("ERR " + err.Error())
+				s.writer.Flush()
+			} else if err != io.EOF {
+				s.log.Warn("Cannot read command", utils.LOG_ERROR, err)
+			}
+			return
+		}
+
+		quit := len(args) > 0 && s.execute(strings.ToUpper(args[0]), args[1:])
+
+		//Replies of pipelined commands are sent together
+		if reader.Buffered() == 0 || quit {
+			if err = s.writer.Flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+//Selects a cache <db>, it is opened by the first command that needs it, see openDb().
+func (this *session) selectDb(db string) {
+	this.db = db
+	this.c = nil
+	this.cmds = nil
+}
+
+//Opens the selected cache with commands that check permissions of the logged in user, mutating commands are audited.
+//Caches are opened for authenticated users only, so clients that never log in don't create them.
+func (this *session) openDb() {
+	if this.cmds != nil {
+		return
+	}
+	this.c = this.server.getCache(this.db, cache.DefaultCacheOptions())
+	base := &redisCommands{CacheCommands: cache.BaseCommands(this.c), c: this.c}
+	this.cmds = cache.NewRestrictedCommands(this.server.wrap(base, this.db, this.c), this.user, this.log.With(utils.LOG_CACHE, this.db))
+	this.cmds = this.server.auditor.Wrap(this.cmds, this.user.Name, this.db)
+}
+
+//Base commands of a selected cache, time to live of EXPIRE is counted from now like Redis does,
+//while "ttl" command of telnet and machine clients counts it from the time a value was stored.
+type redisCommands struct {
+	cache.CacheCommands
+	c cache.Cache
+}
+
+func (this *redisCommands) UpdateTTL(params []string) (bool, error) {
+	if len(params) != 2 {
+		return this.CacheCommands.UpdateTTL(params)
+	}
+	seconds, err := strconv.Atoi(params[1])
+	if err != nil {
+		return this.CacheCommands.UpdateTTL(params)
+	}
+	return this.c.Expire(params[0], int64(seconds)*int64(time.Second)), nil
+}
+
+//Executes a command and writes its reply.
+//Returns <true> if the connection has to be closed.
+func (this *session) execute(command string, args []string) bool {
+	w := this.writer
+
+	switch command {
+	case "QUIT":
+		w.WriteSimple("OK")
+		return true
+	case "PING":
+		this.ping(args)
+		return false
+	case "HELLO":
+		this.hello(args)
+		return false
+	case "AUTH":
+		this.auth(args)
+		return false
+	}
+
+	if this.user == nil {
+		w.WriteError("NOAUTH Authentication required.")
+		return false
+	}
+
+	if err := cache.CheckCacheAccess(this.user, this.db); err != nil && command != "SELECT" {
+		this.log.Warn("Cache access is denied", utils.LOG_CACHE, this.db, utils.LOG_ERROR, err)
+		this.writeError(err)
+		return false
+	}
+	if command != "SELECT" {
+		this.openDb()
+	}
+
+	switch command {
+	case "ECHO":
+		if this.checkArgs(command, args, 1, 1) {
+			w.WriteBulk(args[0])
+		}
+	case "COMMAND":
+		w.WriteArray(0)
+	case "SELECT":
+		if !this.checkArgs(command, args, 1, 1) {
+			break
+		}
+		if err := cache.CheckCacheAccess(this.user, args[0]); err != nil {
+			this.log.Warn("Cache access is denied", utils.LOG_CACHE, args[0], utils.LOG_ERROR, err)
+			this.writeError(err)
+		} else {
+			this.selectDb(args[0])
+			w.WriteSimple("OK")
+		}
+	case "DBSIZE":
+		if this.checkArgs(command, args, 0, 0) {
+			w.WriteInt(int64(this.cmds.GetSize()))
+		}
+	case "KEYS":
+		if this.checkArgs(command, args, 1, 1) {
+			this.keys(args[0])
+		}
+	case "GET":
+		if this.checkArgs(command, args, 1, 1) {
+			this.get(args[0])
+		}
+	case "SET":
+		if this.checkArgs(command, args, 2, 4) {
+			this.set(args)
+		}
+	case "DEL":
+		if this.checkArgs(command, args, 1, -1) {
+			this.del(args)
+		}
+	case "EXPIRE":
+		if this.checkArgs(command, args, 2, 2) {
+			this.expire(args[0], args[1])
+		}
+	case "LINDEX":
+		if this.checkArgs(command, args, 2, 2) {
+			this.lindex(args[0], args[1])
+		}
+	case "RPUSH":
+		if this.checkArgs(command, args, 2, -1) {
+			this.rpush(args[0], args[1:])
+		}
+	case "LREM":
+		if this.checkArgs(command, args, 3, 3) {
+			this.lrem(args[0], args[1], args[2])
+		}
+	case "LLEN":
+		if this.checkArgs(command, args, 1, 1) {
+			size, err := this.cmds.GetListSize(args)
+			this.writeInt(size, err)
+		}
+	case "HGET":
+		if this.checkArgs(command, args, 2, 2) {
+			value, err := this.cmds.GetDictValue(args)
+			this.writeValue(value, err)
+		}
+	case "HSET":
+		if this.checkArgs(command, args, 3, -1) && len(args)%2 == 1 {
+			this.hset(args[0], args[1:])
+		} else if len(args) >= 3 {
+			w.WriteError("ERR wrong number of arguments for 'hset' command")
+		}
+	case "HSETNX":
+		if this.checkArgs(command, args, 3, 3) {
+			appended, err := this.cmds.AppendDictValue(args)
+			this.writeBool(appended, err)
+		}
+	case "HDEL":
+		if this.checkArgs(command, args, 2, -1) {
+			this.hdel(args[0], args[1:])
+		}
+	case "HLEN":
+		if this.checkArgs(command, args, 1, 1) {
+			size, err := this.cmds.GetDictSize(args)
+			this.writeInt(size, err)
+		}
+	default:
+		w.WriteError(fmt.Sprintf("ERR unknown command '%v'", strings.ToLower(command)))
+	}
+	return false
+}
+
+//Checks that the number of arguments is in [min, max] range, negative <max> means no limit.
+//Writes an error reply if it's not.
+func (this *session) checkArgs(command string, args []string, min, max int) bool {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		this.writer.WriteError(fmt.Sprintf("ERR wrong number of arguments for '%v' command", strings.ToLower(command)))
+		return false
+	}
+	return true
+}
+
+func (this *session) ping(args []string) {
+	if len(args) > 1 {
+		this.checkArgs("PING", args, 0, 1)
+	} else if len(args) == 1 {
+		this.writer.WriteBulk(args[0])
+	} else {
+		this.writer.WriteSimple("PONG")
+	}
+}
+
+//HELLO [protover [AUTH username password] [SETNAME clientname]]
+func (this *session) hello(args []string) {
+	w := this.writer
+	proto := w.Proto()
+	if len(args) > 0 {
+		var err error
+		proto, err = strconv.Atoi(args[0])
+		if err != nil {
+			w.WriteError("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if proto != 2 && proto != 3 {
+			w.WriteError("NOPROTO unsupported protocol version")
+			return
+		}
+	}
+
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "AUTH":
+			if i+2 >= len(args) {
+				w.WriteError("ERR Syntax error in HELLO option 'auth'")
+				return
+			}
+			user := this.server.authenticate(args[i+1], args[i+2], this.remote)
+			if user == nil {
+				w.WriteError("WRONGPASS invalid username-password pair or user is disabled.")
+				return
+			}
+			this.login(user)
+			i += 2
+		case "SETNAME":
+			i++
+		default:
+			w.WriteError(fmt.Sprintf("ERR Syntax error in HELLO option '%v'", args[i]))
+			return
+		}
+	}
+
+	if this.user == nil {
+		w.WriteError("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+		return
+	}
+
+	w.SetProto(proto)
+	w.WriteMap(6)
+	w.WriteBulk("server")
+	w.WriteBulk(SERVER_NAME)
+	w.WriteBulk("version")
+	w.WriteBulk(SERVER_VERSION)
+	w.WriteBulk("proto")
+	w.WriteInt(int64(proto))
+	w.WriteBulk("mode")
+	w.WriteBulk("standalone")
+	w.WriteBulk("role")
+	w.WriteBulk("master")
+	w.WriteBulk("modules")
+	w.WriteArray(0)
+}
+
+//AUTH [username] password, a user without name is "default".
+func (this *session) auth(args []string) {
+	if !this.checkArgs("AUTH", args, 1, 2) {
+		return
+	}
+
+	name, pass := "default", args[0]
+	if len(args) == 2 {
+		name, pass = args[0], args[1]
+	}
+
+	user := this.server.authenticate(name, pass, this.remote)
+	if user == nil {
+		this.writer.WriteError("WRONGPASS invalid username-password pair or user is disabled.")
+		return
+	}
+	this.login(user)
+	this.writer.WriteSimple("OK")
+}
+
+//Remembers an authenticated user, so its permissions are checked by commands of the selected cache.
+func (this *session) login(user *auth.User) {
+	this.user = user
+	this.log = this.baseLog.With(utils.LOG_USER, user.Name)
+	//Commands of a cache opened for a previous user are dropped
+	this.selectDb(this.db)
+}
+
+func (this *session) keys(pattern string) {
+	keys, err := this.cmds.GetKeys(nil)
+	if err != nil {
+		this.writeError(err)
+		return
+	}
+
+	matched := []string{}
+	for _, key := range keys {
+		if matchPattern(pattern, key) {
+			matched = append(matched, key)
+		}
+	}
+	this.writer.WriteStrings(matched)
+}
+
+func (this *session) get(key string) {
+	value, err := this.cmds.GetValue([]string{key})
+	switch value.(type) {
+	case utils.List, utils.Dict:
+		this.writeError(cache.ErrWrongType)
+	default:
+		this.writeValue(value, err)
+	}
+}
+
+//SET key value [EX seconds]
+func (this *session) set(args []string) {
+	params := args[:2]
+	if len(args) > 2 {
+		if len(args) != 4 || strings.ToUpper(args[2]) != "EX" {
+			this.writer.WriteError("ERR syntax error")
+			return
+		}
+		seconds, err := strconv.Atoi(args[3])
+		if err != nil || seconds <= 0 {
+			this.writer.WriteError("ERR invalid expire time in 'set' command")
+			return
+		}
+		params = append(params, args[3])
+	}
+
+	_, err := this.cmds.SetValue(params)
+	if err != nil {
+		this.writeError(err)
+		return
+	}
+	this.writer.WriteSimple("OK")
+}
+
+func (this *session) del(keys []string) {
+	deleted := 0
+	for _, key := range keys {
+		_, removed, err := this.cmds.RemoveValue([]string{key})
+		if err != nil {
+			this.writeError(err)
+			return
+		}
+		if removed {
+			deleted++
+		}
+	}
+	this.writer.WriteInt(int64(deleted))
+}
+
+//A key with non-positive <seconds> is removed like Redis does, time to live of the cache would keep it forever.
+func (this *session) expire(key, seconds string) {
+	ttl, err := strconv.Atoi(seconds)
+	if err != nil {
+		this.writer.WriteError("ERR value is not an integer or out of range")
+		return
+	}
+
+	if ttl <= 0 {
+		_, removed, err := this.cmds.RemoveValue([]string{key})
+		this.writeBool(removed, err)
+		return
+	}
+	updated, err := this.cmds.UpdateTTL([]string{key, seconds})
+	this.writeBool(updated, err)
+}
+
+//Negative index is counted from the end of a list, a null reply is written for an index out of bounds.
+func (this *session) lindex(key, index string) {
+	i, err := strconv.Atoi(index)
+	if err != nil {
+		this.writer.WriteError("ERR value is not an integer or out of range")
+		return
+	}
+
+	size, err := this.cmds.GetListSize([]string{key})
+	if err != nil {
+		this.writeError(err)
+		return
+	}
+	if i < 0 {
+		i += size
+	}
+	if i < 0 || i >= size {
+		this.writer.WriteNull()
+		return
+	}
+
+	value, err := this.cmds.GetListValue([]string{key, strconv.Itoa(i)})
+	this.writeValue(value, err)
+}
+
+func (this *session) rpush(key string, values []string) {
+	for _, value := range values {
+		err := this.cmds.AppendListValue([]string{key, value})
+		if err != nil {
+			this.writeError(err)
+			return
+		}
+	}
+
+	size, err := this.cmds.GetListSize([]string{key})
+	this.writeInt(size, err)
+}
+
+//Removes <count> values equal to <value> from a list: from the head for positive <count>,
+//from the tail for negative one and all of them for zero.
+//Values are removed by their indexes, so concurrent changes of the same list can affect the result.
+func (this *session) lrem(key, count, value string) {
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		this.writer.WriteError("ERR value is not an integer or out of range")
+		return
+	}
+
+	_, err = this.cmds.GetListSize([]string{key})
+	if err != nil {
+		this.writeError(err)
+		return
+	}
+	stored, _ := this.cmds.GetValue([]string{key})
+	list, ok := stored.(utils.List)
+	if !ok {
+		this.writer.WriteInt(0)
+		return
+	}
+
+	indexes := []int{}
+	values := list.Values()
+	for i := range values {
+		if n < 0 {
+			i = len(values) - 1 - i
+		}
+		if fmt.Sprint(values[i]) == value {
+			indexes = append(indexes, i)
+			if len(indexes) == n || len(indexes) == -n {
+				break
+			}
+		}
+	}
+
+	//Indexes are removed from the tail, so the rest of them stay valid
+	if n >= 0 {
+		for i, j := 0, len(indexes)-1; i < j; i, j = i+1, j-1 {
+			indexes[i], indexes[j] = indexes[j], indexes[i]
+		}
+	}
+
+	removed := 0
+	for _, i := range indexes {
+		_, err = this.cmds.DeleteListValue([]string{key, strconv.Itoa(i)})
+		if err != nil {
+			break
+		}
+		removed++
+	}
+	this.writer.WriteInt(int64(removed))
+}
+
+//HSET key field value [field value ...], the number of added fields is written.
+func (this *session) hset(key string, pairs []string) {
+	added := 0
+	for i := 0; i < len(pairs); i += 2 {
+		value, err := this.cmds.SetDictValue([]string{key, pairs[i], pairs[i+1]})
+		if err != nil {
+			this.writeError(err)
+			return
+		}
+		if value == nil {
+			added++
+		}
+	}
+	this.writer.WriteInt(int64(added))
+}
+
+func (this *session) hdel(key string, fields []string) {
+	deleted := 0
+	for _, field := range fields {
+		value, err := this.cmds.DeleteDictValue([]string{key, field})
+		if err != nil {
+			this.writeError(err)
+			return
+		}
+		if value != nil {
+			deleted++
+		}
+	}
+	this.writer.WriteInt(int64(deleted))
+}
+
+func (this *session) writeValue(value interface{}, err error) {
+	if err != nil {
+		this.writeError(err)
+	} else if value == nil {
+		this.writer.WriteNull()
+	} else {
+		this.writer.WriteBulk(fmt.Sprint(value))
+	}
+}
+
+func (this *session) writeInt(n int, err error) {
+	if err != nil {
+		this.writeError(err)
+	} else {
+		this.writer.WriteInt(int64(n))
+	}
+}
+
+func (this *session) writeBool(b bool, err error) {
+	if b {
+		this.writeInt(1, err)
+	} else {
+		this.writeInt(0, err)
+	}
+}
+
+//Converts errors of CacheCommands to Redis errors.
+func (this *session) writeError(err error) {
+	switch {
+	case errors.Is(err, cache.ErrWrongType):
+		this.writer.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	case errors.Is(err, cache.ErrCacheFull):
+		this.writer.WriteError("OOM command not allowed when used memory > 'maxmemory'.")
+	case errors.Is(err, cache.ErrPermissionDenied):
+		this.writer.WriteError("NOPERM " + err.Error())
+	default:
+		this.writer.WriteError("ERR " + err.Error())
+	}
+}
+
+//Checks if <key> matches a glob-style <pattern> of KEYS command.
+//Supported patterns: "*" for any sequence, "?" for any character, "[abc]", "[^a]" and "[a-z]" for character classes,
+//"\" escapes a special character.
+func matchPattern(pattern, key string) bool {
+	p, k := []rune(pattern), []rune(key)
+	for len(p) > 0 {
+		switch p[0] {
+		case '*':
+			for len(p) > 0 && p[0] == '*' {
+				p = p[1:]
+			}
+			if len(p) == 0 {
+				return true
+			}
+			for i := 0; i <= len(k); i++ {
+				if matchPattern(string(p), string(k[i:])) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(k) == 0 {
+				return false
+			}
+		case '[':
+			if len(k) == 0 {
+				return false
+			}
+			end := 1
+			for end < len(p) && p[end] != ']' {
+				end++
+			}
+			if end == len(p) || !matchClass(p[1:end], k[0]) {
+				return false
+			}
+			p = p[end:]
+		case '\\':
+			if len(p) > 1 {
+				p = p[1:]
+			}
+			fallthrough
+		default:
+			if len(k) == 0 || p[0] != k[0] {
+				return false
+			}
+		}
+		p, k = p[1:], k[1:]
+	}
+	return len(k) == 0
+}
+
+func matchClass(class []rune, r rune) bool {
+	negate := len(class) > 0 && class[0] == '^'
+	if negate {
+		class = class[1:]
+	}
+
+	matched := false
+	for i := 0; i < len(class); i++ {
+		if i+2 < len(class) && class[i+1] == '-' {
+			if class[i] <= r && r <= class[i+2] {
+				matched = true
+			}
+			i += 2
+		} else if class[i] == r {
+			matched = true
+		}
+	}
+	return matched != negate
+}
@@ -0,0 +1,335 @@
+package resp
+
+import (
+	"TestProject/audit"
+	"TestProject/auth"
+	"TestProject/cache"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//Starts a Server with an admin "admin"/"secret" and a read-only user "reader"/"secret" of caches "team-*"
+//for a passed registry of named caches and connects to it.
+func connectTestServer(t *testing.T, caches cache.Cache) (net.Conn, *bufio.Reader) {
+	return connectServer(t, newTestServer(caches))
+}
+
+//Creates a Server of connectTestServer().
+func newTestServer(caches cache.Cache) *Server {
+	getCache := func(id string, options cache.CacheOptions) cache.Cache {
+		existingCache := caches.Get(id)
+		if existingCache == nil {
+			existingCache = cache.NewCacheWithOptions(options)
+			caches.Put(id, existingCache)
+		}
+		return existingCache.(cache.Cache)
+	}
+	authenticate := func(name, pass, remote string) *auth.User {
+		if pass != "secret" {
+			return nil
+		}
+		switch name {
+		case "admin":
+			return &auth.User{Name: name, Admin: true}
+		case "reader":
+			return &auth.User{Name: name, Caches: []string{"team-*"}, ReadOnly: true}
+		}
+		return nil
+	}
+	wrap := func(cmds cache.CacheCommands, cacheId string, c cache.Cache) cache.CacheCommands {
+		return cmds
+	}
+
+	return NewServer(getCache, authenticate, wrap, nil, slog.Default())
+}
+
+//Connects to a <testServer> through a pipe that is closed when a test ends.
+func connectServer(t *testing.T, testServer *Server) (net.Conn, *bufio.Reader) {
+	client, server := net.Pipe()
+	go testServer.ServeConn(server)
+	t.Cleanup(func() { client.Close() })
+	return client, bufio.NewReader(client)
+}
+
+//Creates a registry of named caches, its caches are stopped when a test ends.
+func newRegistry(t *testing.T) cache.Cache {
+	caches := cache.NewRegistry()
+	t.Cleanup(func() { cache.StopCaches(caches) })
+	return caches
+}
+
+//Sends a raw <request> and checks that exactly <expected> reply is received.
+func exchange(t *testing.T, conn net.Conn, reader *bufio.Reader, request, expected string) {
+	t.Helper()
+	go conn.Write([]byte(request))
+
+	reply := make([]byte, len(expected))
+	_, err := io.ReadFull(reader, reply)
+	if err != nil || string(reply) != expected {
+		t.Errorf("Wrong reply for %q: %q expected, %q received, error [%v]", request, expected, reply, err)
+	}
+}
+
+func connectAuthenticated(t *testing.T, caches cache.Cache) (net.Conn, *bufio.Reader) {
+	conn, reader := connectTestServer(t, caches)
+	exchange(t, conn, reader, "*3\r\n$4\r\nAUTH\r\n$5\r\nadmin\r\n$6\r\nsecret\r\n", "+OK\r\n")
+	return conn, reader
+}
+
+func TestAuthentication(t *testing.T) {
+	caches := newRegistry(t)
+	conn, reader := connectTestServer(t, caches)
+
+	exchange(t, conn, reader, "*2\r\n$3\r\nGET\r\n$1\r\nA\r\n", "-NOAUTH Authentication required.\r\n")
+	exchange(t, conn, reader, "*3\r\n$4\r\nAUTH\r\n$5\r\nadmin\r\n$5\r\nwrong\r\n", "-WRONGPASS invalid username-password pair or user is disabled.\r\n")
+	exchange(t, conn, reader, "*1\r\n$4\r\nPING\r\n", "+PONG\r\n")
+	if caches.Get(DEFAULT_DB) != nil {
+		t.Error("Cache should not be opened for a client that is not authenticated")
+	}
+	exchange(t, conn, reader, "*3\r\n$4\r\nAUTH\r\n$5\r\nadmin\r\n$6\r\nsecret\r\n", "+OK\r\n")
+	exchange(t, conn, reader, "*2\r\n$3\r\nGET\r\n$1\r\nA\r\n", "$-1\r\n")
+	if caches.Get(DEFAULT_DB) == nil {
+		t.Error("Selected cache should be opened by the first command of an authenticated client")
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	caches := newRegistry(t)
+	caches.Put("team-a", cache.NewCache())
+	caches.Get("team-a").(cache.Cache).Put("A", "B")
+	conn, reader := connectTestServer(t, caches)
+
+	exchange(t, conn, reader, "*3\r\n$4\r\nAUTH\r\n$6\r\nreader\r\n$6\r\nsecret\r\n", "+OK\r\n")
+	exchange(t, conn, reader, "*2\r\n$3\r\nGET\r\n$1\r\nA\r\n", "-NOPERM User [reader] is not allowed to access the cache [0]\r\n")
+	if caches.Get(DEFAULT_DB) != nil {
+		t.Error("Cache should not be opened for a user who cannot access it")
+	}
+	exchange(t, conn, reader, "*2\r\n$6\r\nSELECT\r\n$7\r\nprivate\r\n", "-NOPERM User [reader] is not allowed to access the cache [private]\r\n")
+	exchange(t, conn, reader, "*2\r\n$6\r\nSELECT\r\n$6\r\nteam-a\r\n", "+OK\r\n")
+	exchange(t, conn, reader, "*2\r\n$3\r\nGET\r\n$1\r\nA\r\n", "$1\r\nB\r\n")
+	exchange(t, conn, reader, "*3\r\n$3\r\nSET\r\n$1\r\nA\r\n$1\r\nC\r\n", "-NOPERM User [reader] is not allowed to execute [set]\r\n")
+	exchange(t, conn, reader, "*2\r\n$4\r\nLLEN\r\n$1\r\nL\r\n", "-NOPERM User [reader] is not allowed to execute [lsize]\r\n")
+
+	if caches.Get("team-a").(cache.Cache).Get("A") != "B" {
+		t.Error("Read-only user should not change a cache")
+	}
+}
+
+func TestAudit(t *testing.T) {
+	var buffer bytes.Buffer
+	server := newTestServer(newRegistry(t))
+	server.auditor = audit.NewAuditor(&buffer, audit.DefaultAuditOptions(), slog.Default())
+	conn, reader := connectServer(t, server)
+	exchange(t, conn, reader, "*3\r\n$4\r\nAUTH\r\n$6\r\nreader\r\n$6\r\nsecret\r\n", "+OK\r\n")
+	exchange(t, conn, reader, "*2\r\n$6\r\nSELECT\r\n$6\r\nteam-a\r\n", "+OK\r\n")
+	exchange(t, conn, reader, "*3\r\n$3\r\nSET\r\n$1\r\nA\r\n$1\r\nB\r\n", "-NOPERM User [reader] is not allowed to execute [set]\r\n")
+	conn, reader = connectServer(t, server)
+	exchange(t, conn, reader, "*3\r\n$4\r\nAUTH\r\n$5\r\nadmin\r\n$6\r\nsecret\r\n", "+OK\r\n")
+	exchange(t, conn, reader, "*3\r\n$3\r\nSET\r\n$1\r\nA\r\n$1\r\nB\r\n", "+OK\r\n")
+	exchange(t, conn, reader, "*2\r\n$3\r\nGET\r\n$1\r\nA\r\n", "$1\r\nB\r\n")
+	exchange(t, conn, reader, "*2\r\n$3\r\nDEL\r\n$1\r\nA\r\n", ":1\r\n")
+
+	var records []audit.Record
+	decoder := json.NewDecoder(&buffer)
+	for decoder.More() {
+		var record audit.Record
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal("Cannot read audit log", err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 {
+		t.Fatal("Wrong number of audit records", records)
+	}
+	if records[0].User != "reader" || records[0].Cache != "team-a" || records[0].Command != "set" || records[0].Success || records[0].Code != cache.PERMISSION_DENIED {
+		t.Error("Denied mutating command should be audited", records[0])
+	}
+	if records[1].User != "admin" || records[1].Cache != DEFAULT_DB || records[1].Command != "set" || records[1].Key != "A" || records[1].Params != nil || !records[1].Success {
+		t.Error("Mutating command should be audited without values", records[1])
+	}
+	if records[2].Command != "delete" || !records[2].Success {
+		t.Error("Removed value should be audited", records[2])
+	}
+}
+
+func TestStringCommands(t *testing.T) {
+	caches := newRegistry(t)
+	conn, reader := connectAuthenticated(t, caches)
+
+	exchange(t, conn, reader, "*3\r\n$3\r\nSET\r\n$1\r\nA\r\n$11\r\nhello world\r\n", "+OK\r\n")
+	exchange(t, conn, reader, "*2\r\n$3\r\nGET\r\n$1\r\nA\r\n", "$11\r\nhello world\r\n")
+	exchange(t, conn, reader, "*5\r\n$3\r\nSET\r\n$1\r\nB\r\n$1\r\nC\r\n$2\r\nEX\r\n$3\r\n100\r\n", "+OK\r\n")
+	exchange(t, conn, reader, "*5\r\n$3\r\nSET\r\n$1\r\nB\r\n$1\r\nC\r\n$2\r\nPX\r\n$3\r\n100\r\n", "-ERR syntax error\r\n")
+	exchange(t, conn, reader, "*1\r\n$6\r\nDBSIZE\r\n", ":2\r\n")
+	exchange(t, conn, reader, "*2\r\n$4\r\nKEYS\r\n$1\r\nB\r\n", "*1\r\n$1\r\nB\r\n")
+	exchange(t, conn, reader, "*3\r\n$6\r\nEXPIRE\r\n$1\r\nA\r\n$3\r\n100\r\n", ":1\r\n")
+	exchange(t, conn, reader, "*3\r\n$6\r\nEXPIRE\r\n$1\r\nZ\r\n$3\r\n100\r\n", ":0\r\n")
+	exchange(t, conn, reader, "*3\r\n$6\r\nEXPIRE\r\n$1\r\nA\r\n$1\r\nx\r\n", "-ERR value is not an integer or out of range\r\n")
+	exchange(t, conn, reader, "*4\r\n$3\r\nDEL\r\n$1\r\nA\r\n$1\r\nB\r\n$1\r\nZ\r\n", ":2\r\n")
+	exchange(t, conn, reader, "*2\r\n$3\r\nGET\r\n$1\r\nA\r\n", "$-1\r\n")
+	exchange(t, conn, reader, "*3\r\n$3\r\nSET\r\n$1\r\nA\r\n$1\r\nB\r\n", "+OK\r\n")
+	exchange(t, conn, reader, "*3\r\n$6\r\nEXPIRE\r\n$1\r\nA\r\n$2\r\n-1\r\n", ":1\r\n")
+	exchange(t, conn, reader, "*2\r\n$3\r\nGET\r\n$1\r\nA\r\n", "$-1\r\n")
+	exchange(t, conn, reader, "*3\r\n$6\r\nEXPIRE\r\n$1\r\nA\r\n$1\r\n0\r\n", ":0\r\n")
+	exchange(t, conn, reader, "*1\r\n$3\r\nGET\r\n", "-ERR wrong number of arguments for 'get' command\r\n")
+	exchange(t, conn, reader, "*1\r\n$7\r\nUNKNOWN\r\n", "-ERR unknown command 'unknown'\r\n")
+
+	if caches.Get(DEFAULT_DB).(cache.Cache).Size() != 0 {
+		t.Error("Values should be stored in the default database")
+	}
+}
+
+func TestListCommands(t *testing.T) {
+	conn, reader := connectAuthenticated(t, newRegistry(t))
+
+	exchange(t, conn, reader, "*5\r\n$5\r\nRPUSH\r\n$1\r\nL\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\na\r\n", ":3\r\n")
+	exchange(t, conn, reader, "*4\r\n$5\r\nRPUSH\r\n$1\r\nL\r\n$1\r\nc\r\n$1\r\na\r\n", ":5\r\n")
+	exchange(t, conn, reader, "*2\r\n$4\r\nLLEN\r\n$1\r\nL\r\n", ":5\r\n")
+	exchange(t, conn, reader, "*3\r\n$6\r\nLINDEX\r\n$1\r\nL\r\n$1\r\n1\r\n", "$1\r\nb\r\n")
+	exchange(t, conn, reader, "*3\r\n$6\r\nLINDEX\r\n$1\r\nL\r\n$2\r\n-2\r\n", "$1\r\nc\r\n")
+	exchange(t, conn, reader, "*3\r\n$6\r\nLINDEX\r\n$1\r\nL\r\n$2\r\n10\r\n", "$-1\r\n")
+	exchange(t, conn, reader, "*4\r\n$4\r\nLREM\r\n$1\r\nL\r\n$2\r\n-1\r\n$1\r\na\r\n", ":1\r\n")
+	exchange(t, conn, reader, "*3\r\n$6\r\nLINDEX\r\n$1\r\nL\r\n$2\r\n-1\r\n", "$1\r\nc\r\n")
+	exchange(t, conn, reader, "*4\r\n$4\r\nLREM\r\n$1\r\nL\r\n$1\r\n0\r\n$1\r\na\r\n", ":2\r\n")
+	exchange(t, conn, reader, "*3\r\n$6\r\nLINDEX\r\n$1\r\nL\r\n$1\r\n0\r\n", "$1\r\nb\r\n")
+	exchange(t, conn, reader, "*2\r\n$4\r\nLLEN\r\n$1\r\nZ\r\n", ":0\r\n")
+	exchange(t, conn, reader, "*2\r\n$3\r\nGET\r\n$1\r\nL\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+}
+
+func TestHashCommands(t *testing.T) {
+	conn, reader := connectAuthenticated(t, newRegistry(t))
+
+	exchange(t, conn, reader, "*6\r\n$4\r\nHSET\r\n$1\r\nH\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n", ":2\r\n")
+	exchange(t, conn, reader, "*4\r\n$4\r\nHSET\r\n$1\r\nH\r\n$1\r\na\r\n$1\r\n3\r\n", ":0\r\n")
+	exchange(t, conn, reader, "*5\r\n$4\r\nHSET\r\n$1\r\nH\r\n$1\r\na\r\n$1\r\n3\r\n$1\r\nb\r\n", "-ERR wrong number of arguments for 'hset' command\r\n")
+	exchange(t, conn, reader, "*3\r\n$4\r\nHGET\r\n$1\r\nH\r\n$1\r\na\r\n", "$1\r\n3\r\n")
+	exchange(t, conn, reader, "*4\r\n$6\r\nHSETNX\r\n$1\r\nH\r\n$1\r\na\r\n$1\r\n4\r\n", ":0\r\n")
+	exchange(t, conn, reader, "*4\r\n$6\r\nHSETNX\r\n$1\r\nH\r\n$1\r\nc\r\n$1\r\n4\r\n", ":1\r\n")
+	exchange(t, conn, reader, "*2\r\n$4\r\nHLEN\r\n$1\r\nH\r\n", ":3\r\n")
+	exchange(t, conn, reader, "*4\r\n$4\r\nHDEL\r\n$1\r\nH\r\n$1\r\na\r\n$1\r\nz\r\n", ":1\r\n")
+	exchange(t, conn, reader, "*3\r\n$4\r\nHGET\r\n$1\r\nH\r\n$1\r\na\r\n", "$-1\r\n")
+	exchange(t, conn, reader, "*3\r\n$5\r\nRPUSH\r\n$1\r\nH\r\n$1\r\na\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+}
+
+func TestSelectNamedCache(t *testing.T) {
+	caches := newRegistry(t)
+	conn, reader := connectAuthenticated(t, caches)
+
+	exchange(t, conn, reader, "*2\r\n$6\r\nSELECT\r\n$9\r\nTestCache\r\n", "+OK\r\n")
+	exchange(t, conn, reader, "*3\r\n$3\r\nSET\r\n$1\r\nA\r\n$1\r\nB\r\n", "+OK\r\n")
+	exchange(t, conn, reader, "*2\r\n$6\r\nSELECT\r\n$1\r\n0\r\n", "+OK\r\n")
+	exchange(t, conn, reader, "*2\r\n$3\r\nGET\r\n$1\r\nA\r\n", "$-1\r\n")
+
+	if caches.Get("TestCache").(cache.Cache).Get("A") != "B" {
+		t.Error("SELECT should switch a connection to a named cache")
+	}
+}
+
+func TestHelloResp3(t *testing.T) {
+	conn, reader := connectTestServer(t, newRegistry(t))
+
+	exchange(t, conn, reader, "*2\r\n$5\r\nHELLO\r\n$1\r\n4\r\n", "-NOPROTO unsupported protocol version\r\n")
+	hello := "%6\r\n$6\r\nserver\r\n$11\r\nTestProject\r\n$7\r\nversion\r\n$5\r\n1.0.0\r\n$5\r\nproto\r\n:3\r\n" +
+		"$4\r\nmode\r\n$10\r\nstandalone\r\n$4\r\nrole\r\n$6\r\nmaster\r\n$7\r\nmodules\r\n*0\r\n"
+	exchange(t, conn, reader, "*5\r\n$5\r\nHELLO\r\n$1\r\n3\r\n$4\r\nAUTH\r\n$5\r\nadmin\r\n$6\r\nsecret\r\n", hello)
+	exchange(t, conn, reader, "*2\r\n$3\r\nGET\r\n$1\r\nA\r\n", "_\r\n")
+}
+
+func TestInlineAndPipelinedCommands(t *testing.T) {
+	conn, reader := connectAuthenticated(t, newRegistry(t))
+
+	exchange(t, conn, reader, "PING\r\n", "+PONG\r\n")
+	exchange(t, conn, reader, "SET greeting \"hello world\"\r\nGET greeting\r\n*1\r\n$4\r\nPING\r\n", "+OK\r\n$11\r\nhello world\r\n+PONG\r\n")
+	exchange(t, conn, reader, "*1\r\n$1\r\nX\r\n*1\r\n$4\r\nQUIT\r\n", "-ERR unknown command 'x'\r\n+OK\r\n")
+
+	_, err := reader.ReadByte()
+	if err != io.EOF {
+		t.Error("Connection should be closed after QUIT")
+	}
+}
+
+func TestProtocolError(t *testing.T) {
+	conn, reader := connectAuthenticated(t, newRegistry(t))
+
+	exchange(t, conn, reader, "*1\r\n+PING\r\n", "-ERR Protocol error: expected '$', got '+'\r\n")
+
+	_, err := reader.ReadByte()
+	if err != io.EOF {
+		t.Error("Connection should be closed after a protocol error")
+	}
+}
+
+func TestReadCommand(t *testing.T) {
+	args, err := ReadCommand(bufio.NewReader(strings.NewReader("*2\r\n$3\r\nGET\r\n$4\r\na\r\nb\r\n")), true)
+	if err != nil || len(args) != 2 || args[1] != "a\r\nb" {
+		t.Error("Wrong behavior of ReadCommand function")
+	}
+
+	_, err = ReadCommand(bufio.NewReader(strings.NewReader("*1\r\n$3\r\nGETX\r\n")), true)
+	if err == nil {
+		t.Error("Wrong behavior of ReadCommand function")
+	}
+
+	bulk := strings.Repeat("a", 3*BULK_CHUNK_SIZE+1)
+	args, err = ReadCommand(bufio.NewReader(strings.NewReader("*1\r\n$"+strconv.Itoa(len(bulk))+"\r\n"+bulk+"\r\n")), true)
+	if err != nil || len(args) != 1 || args[0] != bulk {
+		t.Error("Bulk string should be read by chunks", err)
+	}
+
+	_, err = ReadCommand(bufio.NewReader(strings.NewReader("*1\r\n$536870912\r\nabc")), true)
+	if err != io.ErrUnexpectedEOF {
+		t.Error("Bulk string that is shorter than its declared size should fail", err)
+	}
+
+	_, err = ReadCommand(bufio.NewReader(strings.NewReader("*11\r\n")), false)
+	if !errors.Is(err, ErrProtocol) {
+		t.Error("Client that is not authenticated should not send many arguments", err)
+	}
+	_, err = ReadCommand(bufio.NewReader(strings.NewReader("*1\r\n$16385\r\n")), false)
+	if !errors.Is(err, ErrProtocol) {
+		t.Error("Client that is not authenticated should not send big bulk strings", err)
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	matches := map[string][]string{
+		"*":         {"", "a", "a/b"},
+		"h?llo":     {"hello", "hallo"},
+		"h*llo":     {"hllo", "heeeello"},
+		"h[ae]llo":  {"hello", "hallo"},
+		"h[^e]llo":  {"hallo"},
+		"h[a-b]llo": {"hallo", "hbllo"},
+		"h\\*llo":   {"h*llo"},
+	}
+	mismatches := map[string][]string{
+		"h?llo":     {"hllo"},
+		"h[ae]llo":  {"hillo"},
+		"h[^e]llo":  {"hello"},
+		"h[a-b]llo": {"hcllo"},
+		"h\\*llo":   {"hello"},
+		"a*":        {"ba"},
+	}
+
+	for pattern, keys := range matches {
+		for _, key := range keys {
+			if !matchPattern(pattern, key) {
+				t.Errorf("Pattern [%v] should match [%v]", pattern, key)
+			}
+		}
+	}
+	for pattern, keys := range mismatches {
+		for _, key := range keys {
+			if matchPattern(pattern, key) {
+				t.Errorf("Pattern [%v] should not match [%v]", pattern, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,405 @@
+package rest
+
+import (
+	"TestProject/audit"
+	"TestProject/auth"
+	"TestProject/cache"
+	"TestProject/utils"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const (
+	//Header that can pass time to live of a value in seconds, "ttl" query parameter can be used instead.
+	TTL_HEADER = "X-Cache-TTL"
+
+	//Max size of a request body.
+	MAX_BODY_SIZE = 64 << 20
+
+	//Path that issues bearer tokens, the only path that accepts Basic auth.
+	TOKENS_PATH = "/tokens"
+)
+
+//Key of an authenticated user in a request context.
+type userKey struct{}
+
+//Handler of one route, returns a value for the response body.
+type routeFunc func(cmds cache.CacheCommands, r *http.Request) (interface{}, error)
+
+//HTTP/JSON gateway to named caches.
+//
+//Routes:
+//	GET    /caches/{cacheId}/keys                   - all keys of a cache
+//	GET    /caches/{cacheId}/size                   - number of values in a cache
+//	GET    /caches/{cacheId}/keys/{key}             - a value
+//	PUT    /caches/{cacheId}/keys/{key}             - sets a string value, returns a replaced one
+//	DELETE /caches/{cacheId}/keys/{key}             - removes a value
+//	PUT    /caches/{cacheId}/ttl/{key}              - updates time to live of a value
+//	GET    /caches/{cacheId}/lists/{key}            - a whole list
+//	POST   /caches/{cacheId}/lists/{key}            - appends a value to a list, returns the size of the list
+//	GET    /caches/{cacheId}/lists/{key}/{index}    - a value of a list
+//	DELETE /caches/{cacheId}/lists/{key}/{index}    - removes a value from a list
+//	GET    /caches/{cacheId}/dicts/{key}            - a whole dictionary
+//	GET    /caches/{cacheId}/dicts/{key}/{field}    - a value of a dictionary
+//	PUT    /caches/{cacheId}/dicts/{key}/{field}    - sets a value of a dictionary, returns a replaced one
+//	DELETE /caches/{cacheId}/dicts/{key}/{field}    - removes a value from a dictionary
+//	POST   /tokens                                  - issues a bearer token for a user authenticated with Basic auth
+//
+//Bearer tokens are session tokens of auth.SessionSigner, a user of a token is found again for every request,
+//so changes of the user and revoked sessions apply to tokens at once.
+//Basic auth is accepted by POST /tokens only, so a password is not checked again for every request.
+//
+//Values are sent in a body of JsonResponse shape: {"Value": "..."}, responses are JsonResponse too.
+//Time to live in seconds is passed in X-Cache-TTL header or "ttl" query parameter.
+//Requests are authenticated with a bearer token or with a verified client certificate, permissions of a user are checked for every request.
+type Gateway struct {
+	router       *router
+	getCache     func(id string, options cache.CacheOptions) cache.Cache
+	authenticate func(name, pass, remote string) *auth.User
+	findByCert   func(cert *x509.Certificate) *auth.User
+	wrap         func(cmds cache.CacheCommands, cacheId string, c cache.Cache) cache.CacheCommands
+	//Bearer tokens are not accepted or issued without a signer.
+	sessions      *auth.SessionSigner
+	findBySession func(session *auth.Session) *auth.User
+	auditor       *audit.Auditor
+	log           *slog.Logger
+}
+
+//Creates a Gateway.
+//Named caches are obtained by <getCache>, users are checked by <authenticate> that returns <nil> for a wrong password
+//and gets a remote address of a client, users of verified client certificates are found by <findByCert>, bearer tokens are issued by <sessions>
+//and their users are found by <findBySession> that returns <nil> for a removed user or a revoked session,
+//commands of every cache are decorated by <wrap>, e.g. to be written into the command log.
+//Logins with tokens and certificates and mutating commands are written into the audit log by <auditor>, denied requests are written into <log>.
+func NewGateway(getCache func(id string, options cache.CacheOptions) cache.Cache,
+	authenticate func(name, pass, remote string) *auth.User,
+	findByCert func(cert *x509.Certificate) *auth.User,
+	sessions *auth.SessionSigner,
+	findBySession func(session *auth.Session) *auth.User,
+	wrap func(cmds cache.CacheCommands, cacheId string, c cache.Cache) cache.CacheCommands,
+	auditor *audit.Auditor,
+	log *slog.Logger) *Gateway {
+
+	gateway := new(Gateway)
+	gateway.getCache = getCache
+	gateway.authenticate = authenticate
+	gateway.findByCert = findByCert
+	gateway.wrap = wrap
+	gateway.sessions = sessions
+	gateway.findBySession = findBySession
+	gateway.auditor = auditor
+	gateway.log = log
+
+	routes := new(router)
+	routes.handle("GET", "/caches/{cacheId}/keys", gateway.route(getKeys))
+	routes.handle("GET", "/caches/{cacheId}/size", gateway.route(getSize))
+	routes.handle("GET", "/caches/{cacheId}/keys/{key}", gateway.route(getValue))
+	routes.handle("PUT", "/caches/{cacheId}/keys/{key}", gateway.route(setValue))
+	routes.handle("DELETE", "/caches/{cacheId}/keys/{key}", gateway.route(removeValue))
+	routes.handle("PUT", "/caches/{cacheId}/ttl/{key}", gateway.route(updateTTL))
+	routes.handle("GET", "/caches/{cacheId}/lists/{key}", gateway.route(getList))
+	routes.handle("POST", "/caches/{cacheId}/lists/{key}", gateway.route(appendListValue))
+	routes.handle("GET", "/caches/{cacheId}/lists/{key}/{index}", gateway.route(getListValue))
+	routes.handle("DELETE", "/caches/{cacheId}/lists/{key}/{index}", gateway.route(deleteListValue))
+	routes.handle("GET", "/caches/{cacheId}/dicts/{key}", gateway.route(getDict))
+	routes.handle("GET", "/caches/{cacheId}/dicts/{key}/{field}", gateway.route(getDictValue))
+	routes.handle("PUT", "/caches/{cacheId}/dicts/{key}/{field}", gateway.route(setDictValue))
+	routes.handle("DELETE", "/caches/{cacheId}/dicts/{key}/{field}", gateway.route(deleteDictValue))
+	routes.handle("POST", TOKENS_PATH, gateway.issueToken)
+	gateway.router = routes
+
+	return gateway
+}
+
+func (this *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := r.BasicAuth(); ok && (r.Method != http.MethodPost || r.URL.Path != TOKENS_PATH) {
+		writeResponse(w, nil, cache.NewError(cache.AUTH_FAILED, "Basic auth is accepted by POST %v only, send a bearer token", TOKENS_PATH))
+		return
+	}
+
+	user := this.user(r)
+	if user == nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="cache"`)
+		writeResponse(w, nil, cache.ErrAuthFailed)
+		return
+	}
+	this.router.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+}
+
+//Returns a user who sent a request, or <nil> if the request is not authenticated.
+//Every request with credentials is a login attempt that is written into the audit log.
+func (this *Gateway) user(r *http.Request) *auth.User {
+	if name, pass, ok := r.BasicAuth(); ok {
+		return this.authenticate(name, pass, r.RemoteAddr)
+	}
+
+	attempt := audit.Record{Remote: r.RemoteAddr}
+	var user *auth.User
+	if value, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		attempt.Method = audit.METHOD_SESSION
+		user = this.sessionUser(value, &attempt)
+	} else if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		attempt.Method = audit.METHOD_CERTIFICATE
+		user = this.findByCert(r.TLS.PeerCertificates[0])
+	} else {
+		return nil
+	}
+
+	var err error
+	if user == nil {
+		err = cache.ErrAuthFailed
+	} else {
+		attempt.User = user.Name
+	}
+	this.auditor.Login(attempt, err)
+	return user
+}
+
+//Returns a user of a bearer token, or <nil> if the token is invalid, expired or revoked.
+//A name of a valid token is set into the <attempt> even if its user is not found.
+func (this *Gateway) sessionUser(token string, attempt *audit.Record) *auth.User {
+	if this.sessions == nil {
+		return nil
+	}
+	session, err := this.sessions.Parse(token)
+	if err != nil {
+		return nil
+	}
+	attempt.User = session.User
+	return this.findBySession(session)
+}
+
+func (this *Gateway) issueToken(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := r.BasicAuth(); !ok {
+		writeResponse(w, nil, cache.NewError(cache.AUTH_FAILED, "Basic auth is required to issue a token"))
+		return
+	}
+
+	if this.sessions == nil {
+		writeResponse(w, nil, cache.NewError(cache.AUTH_FAILED, "Sessions are not enabled"))
+		return
+	}
+
+	value, err := this.sessions.Issue(r.Context().Value(userKey{}).(*auth.User).Name, false)
+	writeResponse(w, value, err)
+}
+
+//Converts a route function to http.HandlerFunc that executes it for a cache from the request path.
+//Commands are checked against permissions of the user who sent the request.
+func (this *Gateway) route(f routeFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value(userKey{}).(*auth.User)
+		id := r.PathValue("cacheId")
+		log := this.log.With(utils.LOG_REMOTE, r.RemoteAddr, utils.LOG_CACHE, id)
+		if err := cache.CheckCacheAccess(user, id); err != nil {
+			log.Warn("Cache access is denied", utils.LOG_USER, user.Name, utils.LOG_ERROR, err)
+			writeResponse(w, nil, err)
+			return
+		}
+
+		c := this.getCache(id, cache.DefaultCacheOptions())
+		cmds := this.auditor.Wrap(cache.NewRestrictedCommands(this.wrap(cache.BaseCommands(c), id, c), user, log), user.Name, id)
+		value, err := f(cmds, r)
+		writeResponse(w, value, err)
+	}
+}
+
+//Writes a JsonResponse with a status code that matches the error code.
+func writeResponse(w http.ResponseWriter, value interface{}, err error) {
+	status := http.StatusOK
+	if err != nil {
+		status = statusOf(cache.ErrorCodeOf(err))
+	}
+	writeStatus(w, status, value, err)
+}
+
+//Writes a JsonResponse with a passed <status> code.
+func writeStatus(w http.ResponseWriter, status int, value interface{}, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(cache.NewJsonResponse(value, err))
+}
+
+func statusOf(code cache.ErrorCode) int {
+	switch code {
+	case cache.BAD_ARGUMENTS:
+		return http.StatusBadRequest
+	case cache.AUTH_FAILED:
+		return http.StatusUnauthorized
+	case cache.PERMISSION_DENIED:
+		return http.StatusForbidden
+	case cache.NOT_FOUND, cache.UNKNOWN_COMMAND:
+		return http.StatusNotFound
+	case cache.WRONG_TYPE:
+		return http.StatusConflict
+	case cache.CACHE_FULL:
+		return http.StatusInsufficientStorage
+	}
+	return http.StatusInternalServerError
+}
+
+//Reads a string value from a request body of JsonResponse shape.
+func readValue(r *http.Request) (string, error) {
+	request := new(cache.JsonResponse)
+	err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, MAX_BODY_SIZE)).Decode(request)
+	if err != nil {
+		return "", cache.WrapError(cache.BAD_ARGUMENTS, err)
+	}
+
+	value, ok := request.Value.(string)
+	if !ok {
+		return "", cache.NewError(cache.BAD_ARGUMENTS, "String \"Value\" is expected")
+	}
+	return value, nil
+}
+
+//Appends time to live from the request to <params> if it is passed.
+func withTTL(r *http.Request, params ...string) []string {
+	ttl := r.Header.Get(TTL_HEADER)
+	if ttl == "" {
+		ttl = r.URL.Query().Get("ttl")
+	}
+	if ttl != "" {
+		params = append(params, ttl)
+	}
+	return params
+}
+
+func notFound(key string) error {
+	return cache.NewError(cache.NOT_FOUND, "No value for the key [%v]", key)
+}
+
+func getKeys(cmds cache.CacheCommands, r *http.Request) (interface{}, error) {
+	return cmds.GetKeys(nil)
+}
+
+func getSize(cmds cache.CacheCommands, r *http.Request) (interface{}, error) {
+	return cmds.GetSize(), nil
+}
+
+func getValue(cmds cache.CacheCommands, r *http.Request) (interface{}, error) {
+	key := r.PathValue("key")
+	value, err := cmds.GetValue([]string{key})
+	if err == nil && value == nil {
+		return nil, notFound(key)
+	}
+	return value, err
+}
+
+func setValue(cmds cache.CacheCommands, r *http.Request) (interface{}, error) {
+	value, err := readValue(r)
+	if err != nil {
+		return nil, err
+	}
+	return cmds.SetValue(withTTL(r, r.PathValue("key"), value))
+}
+
+func removeValue(cmds cache.CacheCommands, r *http.Request) (interface{}, error) {
+	key := r.PathValue("key")
+	value, removed, err := cmds.RemoveValue([]string{key})
+	if err == nil && !removed {
+		return nil, notFound(key)
+	}
+	return value, err
+}
+
+func updateTTL(cmds cache.CacheCommands, r *http.Request) (interface{}, error) {
+	key := r.PathValue("key")
+	params := withTTL(r, key)
+	if len(params) != 2 {
+		return nil, cache.NewError(cache.BAD_ARGUMENTS, "Time to live is not passed")
+	}
+
+	updated, err := cmds.UpdateTTL(params)
+	if err == nil && !updated {
+		return nil, notFound(key)
+	}
+	return updated, err
+}
+
+func getList(cmds cache.CacheCommands, r *http.Request) (interface{}, error) {
+	key := r.PathValue("key")
+	value, err := cmds.GetValue([]string{key})
+	if err != nil {
+		return nil, err
+	} else if value == nil {
+		return nil, notFound(key)
+	}
+
+	if _, ok := value.(utils.List); !ok {
+		return nil, cache.NewError(cache.WRONG_TYPE, "The value for the key [%v] is not a list.", key)
+	}
+	return value, nil
+}
+
+func appendListValue(cmds cache.CacheCommands, r *http.Request) (interface{}, error) {
+	value, err := readValue(r)
+	if err != nil {
+		return nil, err
+	}
+
+	key := r.PathValue("key")
+	err = cmds.AppendListValue(withTTL(r, key, value))
+	if err != nil {
+		return nil, err
+	}
+	return cmds.GetListSize([]string{key})
+}
+
+func getListValue(cmds cache.CacheCommands, r *http.Request) (interface{}, error) {
+	key := r.PathValue("key")
+	value, err := cmds.GetListValue([]string{key, r.PathValue("index")})
+	if err == nil && value == nil {
+		return nil, notFound(key)
+	}
+	return value, err
+}
+
+func deleteListValue(cmds cache.CacheCommands, r *http.Request) (interface{}, error) {
+	return cmds.DeleteListValue([]string{r.PathValue("key"), r.PathValue("index")})
+}
+
+func getDict(cmds cache.CacheCommands, r *http.Request) (interface{}, error) {
+	key := r.PathValue("key")
+	value, err := cmds.GetValue([]string{key})
+	if err != nil {
+		return nil, err
+	} else if value == nil {
+		return nil, notFound(key)
+	}
+
+	if _, ok := value.(utils.Dict); !ok {
+		return nil, cache.NewError(cache.WRONG_TYPE, "The value for the key [%v] is not a dictionary.", key)
+	}
+	return value, nil
+}
+
+func getDictValue(cmds cache.CacheCommands, r *http.Request) (interface{}, error) {
+	key, field := r.PathValue("key"), r.PathValue("field")
+	value, err := cmds.GetDictValue([]string{key, field})
+	if err == nil && value == nil {
+		return nil, cache.NewError(cache.NOT_FOUND, "No value for the key [%v] in the dictionary [%v]", field, key)
+	}
+	return value, err
+}
+
+func setDictValue(cmds cache.CacheCommands, r *http.Request) (interface{}, error) {
+	value, err := readValue(r)
+	if err != nil {
+		return nil, err
+	}
+	return cmds.SetDictValue([]string{r.PathValue("key"), r.PathValue("field"), value})
+}
+
+func deleteDictValue(cmds cache.CacheCommands, r *http.Request) (interface{}, error) {
+	key, field := r.PathValue("key"), r.PathValue("field")
+	value, err := cmds.DeleteDictValue([]string{key, field})
+	if err == nil && value == nil {
+		return nil, cache.NewError(cache.NOT_FOUND, "No value for the key [%v] in the dictionary [%v]", field, key)
+	}
+	return value, err
+}
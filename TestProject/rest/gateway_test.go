@@ -0,0 +1,432 @@
+package rest
+
+import (
+	"TestProject/audit"
+	"TestProject/auth"
+	"TestProject/cache"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+//Creates a Gateway with an admin "admin"/"secret", a user "reader"/"secret" who can only read strings of caches "team-*"
+//and a user "billing" of a client certificate with the common name "billing" for a passed registry of named caches.
+func newTestGateway(caches cache.Cache) *Gateway {
+	gateway, _ := newTestGatewayWithUsers(caches)
+	return gateway
+}
+
+//Creates a Gateway of newTestGateway() together with the store of its users.
+func newTestGatewayWithUsers(caches cache.Cache) (*Gateway, *auth.UserStore) {
+	getCache := func(id string, options cache.CacheOptions) cache.Cache {
+		existingCache := caches.Get(id)
+		if existingCache == nil {
+			existingCache = cache.NewCacheWithOptions(options)
+			caches.Put(id, existingCache)
+		}
+		return existingCache.(cache.Cache)
+	}
+	users := auth.NewUserStore(map[string]*auth.User{
+		"admin":  {Name: "admin", Admin: true},
+		"reader": {Name: "reader", Caches: []string{"team-*"}, ReadOnly: true},
+	})
+	authenticate := func(name, pass, remote string) *auth.User {
+		if pass != "secret" {
+			return nil
+		}
+		return users.Get(name)
+	}
+	findByCert := func(cert *x509.Certificate) *auth.User {
+		if cert.Subject.CommonName == "billing" {
+			return &auth.User{Name: "billing", Caches: []string{"team-*"}}
+		}
+		return nil
+	}
+	wrap := func(cmds cache.CacheCommands, cacheId string, c cache.Cache) cache.CacheCommands {
+		return cmds
+	}
+	sessions := auth.NewSessionSigner([]byte(strings.Repeat("k", auth.SESSION_KEY_SIZE)), time.Hour)
+	return NewGateway(getCache, authenticate, findByCert, sessions, users.FindBySession, wrap, nil, slog.Default()), users
+}
+
+//Creates a registry of named caches, its caches are stopped when a test ends.
+func newRegistry(t *testing.T) cache.Cache {
+	caches := cache.NewRegistry()
+	t.Cleanup(func() { cache.StopCaches(caches) })
+	return caches
+}
+
+//Sends a request of an admin authenticated with a bearer token and returns the status and the decoded response.
+func send(t *testing.T, gateway *Gateway, method, url, body string) (int, *cache.JsonResponse) {
+	t.Helper()
+	request := httptest.NewRequest(method, url, strings.NewReader(body))
+	authorize(gateway, request, "admin")
+	return serve(t, gateway, request)
+}
+
+//Sets a bearer token of a <user> into a <request>.
+func authorize(gateway *Gateway, request *http.Request, user string) {
+	token, _ := gateway.sessions.Issue(user, false)
+	request.Header.Set("Authorization", "Bearer "+token)
+}
+
+func serve(t *testing.T, gateway http.Handler, request *http.Request) (int, *cache.JsonResponse) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	gateway.ServeHTTP(recorder, request)
+
+	response := new(cache.JsonResponse)
+	err := json.Unmarshal(recorder.Body.Bytes(), response)
+	if err != nil {
+		t.Fatal("Response is not a JsonResponse", recorder.Body.String())
+	}
+	return recorder.Code, response
+}
+
+func TestGatewayValues(t *testing.T) {
+	caches := newRegistry(t)
+	gateway := newTestGateway(caches)
+
+	status, response := send(t, gateway, "PUT", "/caches/TestCache/keys/A", `{"Value": "hello world"}`)
+	if status != http.StatusOK || response.Value != nil || response.Err != "" {
+		t.Error("Wrong behavior of PUT key route", status, response)
+	}
+
+	status, response = send(t, gateway, "GET", "/caches/TestCache/keys/A", "")
+	if status != http.StatusOK || response.Value != "hello world" {
+		t.Error("Wrong behavior of GET key route", status, response)
+	}
+
+	status, response = send(t, gateway, "GET", "/caches/TestCache/keys/Z", "")
+	if status != http.StatusNotFound || response.Code != cache.NOT_FOUND {
+		t.Error("Missing value should be 404", status, response)
+	}
+
+	status, response = send(t, gateway, "PUT", "/caches/TestCache/keys/B?ttl=100", `{"Value": "C"}`)
+	if status != http.StatusOK {
+		t.Error("Wrong behavior of PUT key route with ttl", status, response)
+	}
+	expiresAt, _ := caches.Get("TestCache").(cache.Cache).ExpiresAt("B")
+	if expiresAt.IsZero() || expiresAt.After(time.Now().Add(100*time.Second)) {
+		t.Error("Time to live was not passed from query parameter")
+	}
+
+	status, response = send(t, gateway, "PUT", "/caches/TestCache/keys/B", `{"Value": 1}`)
+	if status != http.StatusBadRequest || response.Code != cache.BAD_ARGUMENTS {
+		t.Error("Non-string value should be 400", status, response)
+	}
+
+	request := httptest.NewRequest("PUT", "/caches/TestCache/ttl/A", nil)
+	authorize(gateway, request, "admin")
+	request.Header.Set(TTL_HEADER, "100")
+	status, response = serve(t, gateway, request)
+	if status != http.StatusOK || response.Value != true {
+		t.Error("Wrong behavior of PUT ttl route", status, response)
+	}
+
+	status, response = send(t, gateway, "PUT", "/caches/TestCache/ttl/A", "")
+	if status != http.StatusBadRequest {
+		t.Error("Missing ttl should be 400", status, response)
+	}
+
+	status, response = send(t, gateway, "GET", "/caches/TestCache/size", "")
+	if status != http.StatusOK || response.Value != float64(2) {
+		t.Error("Wrong behavior of GET size route", status, response)
+	}
+
+	status, response = send(t, gateway, "GET", "/caches/TestCache/keys", "")
+	if keys, ok := response.Value.([]interface{}); status != http.StatusOK || !ok || len(keys) != 2 {
+		t.Error("Wrong behavior of GET keys route", status, response)
+	}
+
+	status, response = send(t, gateway, "DELETE", "/caches/TestCache/keys/A", "")
+	if status != http.StatusOK || response.Value != "hello world" {
+		t.Error("Wrong behavior of DELETE key route", status, response)
+	}
+
+	status, _ = send(t, gateway, "DELETE", "/caches/TestCache/keys/A", "")
+	if status != http.StatusNotFound {
+		t.Error("Removal of a missing value should be 404", status)
+	}
+}
+
+func TestGatewayListsAndDicts(t *testing.T) {
+	gateway := newTestGateway(newRegistry(t))
+
+	send(t, gateway, "POST", "/caches/TestCache/lists/L", `{"Value": "1"}`)
+	status, response := send(t, gateway, "POST", "/caches/TestCache/lists/L", `{"Value": "2"}`)
+	if status != http.StatusOK || response.Value != float64(2) {
+		t.Error("Wrong behavior of POST list route", status, response)
+	}
+
+	status, response = send(t, gateway, "GET", "/caches/TestCache/lists/L/1", "")
+	if status != http.StatusOK || response.Value != "2" {
+		t.Error("Wrong behavior of GET list value route", status, response)
+	}
+
+	status, response = send(t, gateway, "DELETE", "/caches/TestCache/lists/L/0", "")
+	if status != http.StatusOK || response.Value != "1" {
+		t.Error("Wrong behavior of DELETE list value route", status, response)
+	}
+
+	status, response = send(t, gateway, "GET", "/caches/TestCache/lists/L", "")
+	if list, ok := response.Value.([]interface{}); status != http.StatusOK || !ok || len(list) != 1 {
+		t.Error("Wrong behavior of GET list route", status, response)
+	}
+
+	status, response = send(t, gateway, "PUT", "/caches/TestCache/dicts/D/K", `{"Value": "V"}`)
+	if status != http.StatusOK || response.Value != nil {
+		t.Error("Wrong behavior of PUT dict value route", status, response)
+	}
+
+	status, response = send(t, gateway, "GET", "/caches/TestCache/dicts/D/K", "")
+	if status != http.StatusOK || response.Value != "V" {
+		t.Error("Wrong behavior of GET dict value route", status, response)
+	}
+
+	status, response = send(t, gateway, "GET", "/caches/TestCache/dicts/D", "")
+	if dict, ok := response.Value.(map[string]interface{}); status != http.StatusOK || !ok || dict["K"] != "V" {
+		t.Error("Wrong behavior of GET dict route", status, response)
+	}
+
+	status, response = send(t, gateway, "GET", "/caches/TestCache/dicts/L/K", "")
+	if status != http.StatusConflict || response.Code != cache.WRONG_TYPE {
+		t.Error("Wrong type should be 409", status, response)
+	}
+
+	status, response = send(t, gateway, "DELETE", "/caches/TestCache/dicts/D/K", "")
+	if status != http.StatusOK || response.Value != "V" {
+		t.Error("Wrong behavior of DELETE dict value route", status, response)
+	}
+
+	status, _ = send(t, gateway, "GET", "/caches/TestCache/dicts/D/K", "")
+	if status != http.StatusNotFound {
+		t.Error("Missing dictionary value should be 404", status)
+	}
+}
+
+func TestGatewayRoutes(t *testing.T) {
+	caches := newRegistry(t)
+	gateway := newTestGateway(caches)
+
+	status, response := send(t, gateway, "PUT", "/caches/TestCache/keys/a%2Fb%20c", `{"Value": "B"}`)
+	if status != http.StatusOK || caches.Get("TestCache").(cache.Cache).Get("a/b c") != "B" {
+		t.Error("Path values should be unescaped", status, response)
+	}
+
+	status, response = send(t, gateway, "GET", "/caches/TestCache/unknown", "")
+	if status != http.StatusNotFound || response.Code != cache.NOT_FOUND {
+		t.Error("Unknown route should be 404", status, response)
+	}
+
+	status, _ = send(t, gateway, "GET", "/caches//keys", "")
+	if status != http.StatusNotFound {
+		t.Error("Empty path value should not match a route", status)
+	}
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("POST", "/caches/TestCache/keys/A", nil)
+	authorize(gateway, request, "admin")
+	gateway.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusMethodNotAllowed || recorder.Header().Get("Allow") != "GET, PUT, DELETE" {
+		t.Error("Route with another method should be 405", recorder.Code, recorder.Header())
+	}
+}
+
+func TestGatewayAuthentication(t *testing.T) {
+	gateway := newTestGateway(newRegistry(t))
+
+	status, response := serve(t, gateway, httptest.NewRequest("GET", "/caches/TestCache/size", nil))
+	if status != http.StatusUnauthorized || response.Code != cache.AUTH_FAILED {
+		t.Error("Request without credentials should be 401", status, response)
+	}
+
+	request := httptest.NewRequest("POST", "/tokens", nil)
+	request.SetBasicAuth("admin", "wrong")
+	status, _ = serve(t, gateway, request)
+	if status != http.StatusUnauthorized {
+		t.Error("Request with wrong password should be 401", status)
+	}
+
+	request = httptest.NewRequest("GET", "/caches/TestCache/size", nil)
+	request.SetBasicAuth("admin", "secret")
+	status, response = serve(t, gateway, request)
+	if status != http.StatusUnauthorized || !strings.Contains(response.Err, "bearer token") {
+		t.Error("Basic auth should be accepted by POST /tokens only", status, response)
+	}
+
+	request = httptest.NewRequest("POST", "/tokens", nil)
+	request.SetBasicAuth("admin", "secret")
+	status, response = serve(t, gateway, request)
+	token, ok := response.Value.(string)
+	if status != http.StatusOK || !ok || token == "" {
+		t.Fatal("Token was not issued", status, response)
+	}
+
+	request = httptest.NewRequest("GET", "/caches/TestCache/size", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	status, _ = serve(t, gateway, request)
+	if status != http.StatusOK {
+		t.Error("Request with bearer token should be accepted", status)
+	}
+
+	request = httptest.NewRequest("GET", "/caches/TestCache/size", nil)
+	request.Header.Set("Authorization", "Bearer unknown")
+	status, _ = serve(t, gateway, request)
+	if status != http.StatusUnauthorized {
+		t.Error("Request with unknown token should be 401", status)
+	}
+}
+
+func TestGatewayPermissions(t *testing.T) {
+	caches := newRegistry(t)
+	gateway := newTestGateway(caches)
+	send(t, gateway, "PUT", "/caches/team-a/keys/A", `{"Value": "B"}`)
+	send(t, gateway, "POST", "/caches/team-a/lists/L", `{"Value": "a"}`)
+
+	request := func(method, url, body string) (int, *cache.JsonResponse) {
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		authorize(gateway, r, "reader")
+		return serve(t, gateway, r)
+	}
+
+	status, response := request("GET", "/caches/team-a/keys/A", "")
+	if status != http.StatusOK || response.Value != "B" {
+		t.Error("Allowed request should be accepted", status, response)
+	}
+
+	status, response = request("GET", "/caches/private/keys/A", "")
+	if status != http.StatusForbidden || response.Code != cache.PERMISSION_DENIED {
+		t.Error("Request to a cache that is not allowed should be 403", status, response)
+	}
+
+	status, _ = request("PUT", "/caches/team-a/keys/A", `{"Value": "C"}`)
+	if status != http.StatusForbidden {
+		t.Error("Read-only user should not change a cache", status)
+	}
+
+	status, _ = request("GET", "/caches/team-a/lists/L", "")
+	if status != http.StatusForbidden {
+		t.Error("User without the list category should not read lists", status)
+	}
+
+	if caches.Get("team-a").(cache.Cache).Get("A") != "B" {
+		t.Error("Denied request changed a cache")
+	}
+}
+
+func TestGatewayClientCertificate(t *testing.T) {
+	gateway := newTestGateway(newRegistry(t))
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}
+
+	request := httptest.NewRequest("GET", "/caches/team-a/size", nil)
+	request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	status, _ := serve(t, gateway, request)
+	if status != http.StatusOK {
+		t.Error("Request with a verified client certificate should be accepted", status)
+	}
+
+	request = httptest.NewRequest("GET", "/caches/team-a/size", nil)
+	request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	status, _ = serve(t, gateway, request)
+	if status != http.StatusUnauthorized {
+		t.Error("Request with a client certificate that is not verified should be 401", status)
+	}
+}
+
+func TestTokenRevocation(t *testing.T) {
+	gateway, users := newTestGatewayWithUsers(newRegistry(t))
+	issue := func(name string) string {
+		request := httptest.NewRequest("POST", "/tokens", nil)
+		request.SetBasicAuth(name, "secret")
+		_, response := serve(t, gateway, request)
+		token, _ := response.Value.(string)
+		return token
+	}
+	request := func(token, method, url, body string) int {
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		status, _ := serve(t, gateway, r)
+		return status
+	}
+
+	token := issue("reader")
+	if status := request(token, "PUT", "/caches/team-a/keys/A", `{"Value": "B"}`); status != http.StatusForbidden {
+		t.Error("Bearer token should keep permissions of its user", status)
+	}
+	err := users.Grant("reader", auth.User{Caches: []string{"team-*"}})
+	if err != nil {
+		t.Fatal("Wrong behavior of Grant function", err)
+	}
+	if status := request(token, "PUT", "/caches/team-a/keys/A", `{"Value": "B"}`); status != http.StatusOK {
+		t.Error("Bearer token should get current permissions of its user", status)
+	}
+
+	users.RevokeSessions("reader")
+	if status := request(token, "GET", "/caches/team-a/size", ""); status != http.StatusUnauthorized {
+		t.Error("Revoked bearer token should be 401", status)
+	}
+
+	token = issue("reader")
+	if status := request(token, "GET", "/caches/team-a/size", ""); status != http.StatusOK {
+		t.Error("Bearer token issued after revocation should be accepted", status)
+	}
+	users.Delete("reader")
+	if status := request(token, "GET", "/caches/team-a/size", ""); status != http.StatusUnauthorized {
+		t.Error("Bearer token of a removed user should be 401", status)
+	}
+}
+
+func TestGatewayAudit(t *testing.T) {
+	var buffer bytes.Buffer
+	gateway := newTestGateway(newRegistry(t))
+	gateway.auditor = audit.NewAuditor(&buffer, audit.DefaultAuditOptions(), slog.Default())
+
+	token, _ := gateway.sessions.Issue("reader", false)
+	request := httptest.NewRequest("PUT", "/caches/team-a/keys/A", strings.NewReader(`{"Value": "B"}`))
+	request.Header.Set("Authorization", "Bearer "+token)
+	serve(t, gateway, request)
+	request = httptest.NewRequest("GET", "/caches/team-a/size", nil)
+	request.Header.Set("Authorization", "Bearer wrong")
+	serve(t, gateway, request)
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}
+	request = httptest.NewRequest("PUT", "/caches/team-a/keys/A", strings.NewReader(`{"Value": "B"}`))
+	request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	serve(t, gateway, request)
+
+	var records []audit.Record
+	decoder := json.NewDecoder(&buffer)
+	for decoder.More() {
+		var record audit.Record
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal("Cannot read audit log", err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 5 {
+		t.Fatal("Wrong number of audit records", records)
+	}
+	if records[0].Event != audit.EVENT_LOGIN || records[0].User != "reader" || records[0].Method != audit.METHOD_SESSION || records[0].Remote == "" || !records[0].Success {
+		t.Error("Login with a bearer token should be audited", records[0])
+	}
+	if records[1].Command != "set" || records[1].Cache != "team-a" || records[1].Success || records[1].Code != cache.PERMISSION_DENIED {
+		t.Error("Denied mutating command should be audited", records[1])
+	}
+	if records[2].Event != audit.EVENT_LOGIN || records[2].Method != audit.METHOD_SESSION || records[2].Success {
+		t.Error("Login with an invalid bearer token should be audited", records[2])
+	}
+	if records[3].Event != audit.EVENT_LOGIN || records[3].User != "billing" || records[3].Method != audit.METHOD_CERTIFICATE || !records[3].Success {
+		t.Error("Login with a client certificate should be audited", records[3])
+	}
+	if records[4].User != "billing" || records[4].Command != "set" || records[4].Key != "A" || !records[4].Success {
+		t.Error("Mutating command should be audited", records[4])
+	}
+}
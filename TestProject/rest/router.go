@@ -0,0 +1,82 @@
+package rest
+
+import (
+	"TestProject/cache"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//Route of a method and a path pattern, segments of the pattern in braces are path values, e.g. "/caches/{cacheId}/keys".
+type route struct {
+	method   string
+	segments []string
+	handler  http.HandlerFunc
+}
+
+//Dispatches requests by a method and a path, path values are set into a request, see http.Request.PathValue().
+//Method and wildcard patterns of http.ServeMux are not used, because they are disabled by GODEBUG httpmuxgo121
+//when a project that embeds the gateway is built without a module.
+type router struct {
+	routes []route
+}
+
+//Adds a route of a <method> and a path <pattern>.
+func (this *router) handle(method, pattern string, handler http.HandlerFunc) {
+	this.routes = append(this.routes, route{method: method, segments: strings.Split(strings.TrimPrefix(pattern, "/"), "/"), handler: handler})
+}
+
+//Serves a request by the first route that matches its method and path.
+//Unknown paths are 404, a known path with another method is 405 with the allowed methods in Allow header.
+func (this *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+	var allowed []string
+	for _, route := range this.routes {
+		values, ok := route.match(segments)
+		if !ok {
+			continue
+		}
+		if route.method != r.Method && !(route.method == http.MethodGet && r.Method == http.MethodHead) {
+			allowed = append(allowed, route.method)
+			continue
+		}
+
+		for name, value := range values {
+			r.SetPathValue(name, value)
+		}
+		route.handler(w, r)
+		return
+	}
+
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeStatus(w, http.StatusMethodNotAllowed, nil, cache.NewError(cache.BAD_ARGUMENTS, "Method %v is not allowed for [%v]", r.Method, r.URL.Path))
+		return
+	}
+	writeResponse(w, nil, cache.NewError(cache.NOT_FOUND, "No route for [%v]", r.URL.Path))
+}
+
+//Returns unescaped path values if escaped path <segments> match the route, every path value has to be non-empty.
+func (this *route) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(this.segments) {
+		return nil, false
+	}
+
+	values := make(map[string]string)
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, false
+		}
+		pattern := this.segments[i]
+		if name, ok := strings.CutPrefix(pattern, "{"); ok {
+			if unescaped == "" {
+				return nil, false
+			}
+			values[strings.TrimSuffix(name, "}")] = unescaped
+		} else if unescaped != pattern {
+			return nil, false
+		}
+	}
+	return values, true
+}
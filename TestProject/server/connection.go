@@ -0,0 +1,352 @@
+package server
+
+import (
+	"TestProject/audit"
+	"TestProject/auth"
+	"TestProject/cache"
+	"TestProject/utils"
+	"bufio"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	NEED_HELP = "Please use \"help\" command to find the available commands."
+
+	HELP_KEYS = "keys - operation to display cached keys. Ex. keys [startIndex] [endIndex]"
+	HELP_TTL  = "ttl - operation to update time to live attribute of any cached value. Ex. ttl key ttlInSeconds"
+	HELP_SAVE = "save - operation to save a snapshot of all caches to disk. Ex. save"
+
+	HELP_USER_ADD    = "user-add - operation to add a new user without permissions. Ex. user-add name password"
+	HELP_USER_DEL    = "user-del - operation to remove a user. Ex. user-del name"
+	HELP_USER_PASSWD = "user-passwd - operation to change a password of a user. Ex. user-passwd name password"
+	HELP_USER_LIST   = "user-list - operation to display users with their permissions. Ex. user-list"
+	HELP_USER_GRANT  = "user-grant - operation to replace permissions of a user. Ex. user-grant name [cache=pattern]... [category=list|dict|admin]... [cert=name]... [readonly] [admin]"
+
+	HELP_SESSION_REVOKE = "session-revoke - operation to revoke all session tokens of a user. Ex. session-revoke name"
+
+	HELP_LOCKOUT_LIST  = "lockout-list - operation to display users and addresses with failed logins. Ex. lockout-list"
+	HELP_LOCKOUT_CLEAR = "lockout-clear - operation to forget failed logins of a user, an address or everybody. Ex. lockout-clear user:name|ip:address|all"
+
+	HELP_GET    = "get - operation to get cached value if it exists. Ex. get key"
+	HELP_SET    = "set - operation to set a new cached string value. Ex. set key value [ttl]"
+	HELP_UPDATE = "update - operation to exchange an existing cached string value. Ex. update key oldValue newValue [ttlInSeconds]"
+	HELP_DELETE = "delete - operation to remove an existing cached value. Ex. delete key [value]"
+	HELP_SIZE   = "size - operation to find out the number of cached values. Ex. size"
+	HELP_EXIT   = "exit - operation to close the connection with the server. Ex. exit"
+
+	HELP_LSIZE   = "lsize - operation to check the size of a list. Ex. lsize key"
+	HELP_LGET    = "lget - operation to get a value from cached list. Ex. lget key index"
+	HELP_LAPPEND = "lappend - operation to add a new value into the cached list. Ex. lappend key value [ttlInSeconds]"
+	HELP_LDELETE = "ldelete - operation to remove a value from a list by index. Ex. ldelete key index"
+
+	HELP_DSIZE   = "dsize - operation to check the size of a dictionary. Ex. lsize key"
+	HELP_DGET    = "dget - operation to get a value from cached dictionary by key. Ex. dget key dictKey"
+	HELP_DSET    = "dset - operation to set a key-value pair into a cached dictionary. Ex. dset key dictKey dictValue"
+	HELP_DAPPEND = "dappend - operation to add a value to the dictionary. Ex. dappend key dictKey value [ttlInSeconds]"
+	HELP_DDELETE = "ddelete - opeartion to remove a value from cached dictionary. Ex. ddelete key dictKey"
+)
+
+func (this *Server) handleConnection(conn net.Conn, listener *Listener) {
+
+	defer conn.Close()
+
+	log := this.options.Log.With(utils.LOG_LISTENER, listener.Addr().String(), utils.LOG_CONNECTION, this.connectionIds.Add(1), utils.LOG_REMOTE, conn.RemoteAddr().String())
+
+	reader := bufio.NewReader(conn)
+
+	attempt := audit.Record{Remote: conn.RemoteAddr().String()}
+	user, err := this.login(conn, reader, &attempt, listener)
+	this.options.Auditor.Login(attempt, err)
+	if err != nil {
+		log.Warn("Login failed", utils.LOG_USER, attempt.User, utils.LOG_ERROR, err)
+		return
+	}
+	log = log.With(utils.LOG_USER, user.Name)
+	log.Debug("User logged in", "machine", user.IsMachine)
+
+	if user.IsMachine {
+		this.handleMachineConnection(conn, reader, user, log)
+	} else {
+		this.handleHumanConnection(conn, reader, user, utils.NewTelnetWriter(conn), log)
+	}
+
+}
+
+func printHelp(replies utils.ReplyWriter) {
+	replies.ReplyLines(HELP_GET, HELP_SET, HELP_UPDATE, HELP_DELETE, HELP_EXIT, HELP_LGET, HELP_LAPPEND, HELP_LDELETE, HELP_LSIZE, HELP_DGET, HELP_DSET, HELP_DAPPEND, HELP_DDELETE, HELP_KEYS, HELP_TTL, HELP_SAVE,
+		HELP_USER_ADD, HELP_USER_DEL, HELP_USER_PASSWD, HELP_USER_LIST, HELP_USER_GRANT, HELP_SESSION_REVOKE, HELP_LOCKOUT_LIST, HELP_LOCKOUT_CLEAR)
+}
+
+//Serves commands of a machine client, errors of the connection are written into the server <log>.
+func (this *Server) handleMachineConnection(conn net.Conn, reader *bufio.Reader, user *auth.User, log *slog.Logger) {
+
+	framed, err := cache.ReadHandshake(reader)
+	if err != nil {
+		if this.drain.Closing() {
+			return
+		}
+		log.Warn("Cannot read handshake", utils.LOG_ERROR, err)
+		if framed {
+			cache.NewFramedResponseWriter(conn).WriteResponse(nil, err)
+		}
+		return
+	}
+
+	var writer cache.ResponseWriter
+	var readCommand func() ([]string, error)
+	if framed {
+		writer = cache.NewFramedResponseWriter(conn)
+		readCommand = func() ([]string, error) {
+			return cache.ReadFrame(reader)
+		}
+	} else {
+		writer = cache.NewJsonResponseWriter(conn)
+		readCommand = func() ([]string, error) {
+			cmd, _, err := reader.ReadLine()
+			if err != nil {
+				return nil, err
+			}
+			return strings.Split(strings.Trim(string(cmd), " "), " "), nil
+		}
+	}
+
+	params, err := readCommand()
+	if err != nil {
+		if this.drain.Closing() {
+			return
+		}
+		log.Warn("Cannot read command", utils.LOG_ERROR, err)
+		return
+	}
+	id, c, err := this.openCache(user, params)
+	if err != nil {
+		log.Warn("Cannot open cache", utils.LOG_ERROR, err)
+		writer.WriteResponse(nil, err)
+		return
+	} else if c == nil {
+		return
+	}
+	log = log.With(utils.LOG_CACHE, id)
+	if framed {
+		writer.WriteResponse("Ok", nil)
+	}
+
+	cmds := this.wrap(cache.NewMachineCacheCommands(cache.NewRestrictedCommands(cache.BaseCommands(c), user, log), writer, log), id, c)
+
+	for {
+
+		params, err := readCommand()
+		if err != nil {
+			if err == io.EOF || this.drain.Closing() {
+				return
+			}
+			log.Warn("Cannot read command, connection will be closed", utils.LOG_ERROR, err)
+			if errors.Is(err, cache.ErrBadArguments) {
+				writer.WriteResponse(nil, err)
+			}
+			return
+		}
+
+		command := params[0]
+		params = params[1:]
+
+		switch command {
+		case "save":
+			err = this.save(user)
+			writer.WriteResponse(err == nil, err)
+		case "user-add", "user-del", "user-passwd", "user-list", "user-grant", "session-revoke", "lockout-list", "lockout-clear":
+			writer.WriteResponse(this.manageUsers(user, command, params))
+		default:
+			err = this.handleCommand(user, id, cmds, command, params)
+			if errors.Is(err, cache.ErrUnknownCommand) {
+				writer.WriteResponse(nil, err)
+			}
+		}
+	}
+}
+
+//Serves commands of a human user, replies are written with <replies> and errors of the connection into the server <log>.
+func (this *Server) handleHumanConnection(conn net.Conn, reader *bufio.Reader, user *auth.User, replies utils.ReplyWriter, log *slog.Logger) {
+
+	idleTimeout := this.runtime().IdleTimeout
+	replies.Reply("You've been connected to In-memory cache. Connection idle timeout is ", int64(float64(idleTimeout)/float64(time.Second)), "s.")
+	replies.Reply("Please enter first command: \"stop-server\" or \"connect-to\" <cacheId> [maxEntries] [maxBytes] [evictionPolicy]")
+
+	this.drain.Notify(conn, func() {
+		replies.Reply("Server is shutting down, connection will be closed")
+	})
+
+	conn.SetReadDeadline(time.Now().Add(idleTimeout))
+
+	id, c, err := this.readCache(user, reader)
+	if err != nil {
+		if this.drain.Closing() {
+			return
+		}
+		replies.Replyf("Error [%v] happened", err)
+		return
+	} else if c == nil {
+		return
+	}
+	log = log.With(utils.LOG_CACHE, id)
+
+	cmds := this.wrap(cache.NewUserFriendlyCommands(cache.NewRestrictedCommands(cache.BaseCommands(c), user, log), replies), id, c)
+
+	replies.Reply("Connected")
+
+	for {
+
+		conn.SetReadDeadline(time.Now().Add(this.runtime().IdleTimeout))
+
+		cmd, _, err := reader.ReadLine()
+		if err != nil {
+			if err == io.EOF || this.drain.Closing() {
+				return
+			}
+			log.Warn("Cannot read command, connection will be closed", utils.LOG_ERROR, err)
+			replies.Replyf("Error [%v] happened", err)
+			replies.Reply("Connection will be closed")
+			return
+		}
+
+		splitCommand, err := utils.SplitCommand(string(cmd))
+		if err != nil {
+			replies.Replyf("Error [%v] happened", err)
+			continue
+		} else if len(splitCommand) == 0 {
+			continue
+		}
+		command := splitCommand[0]
+		params := splitCommand[1:]
+
+		switch command {
+		case "help":
+			printHelp(replies)
+			break
+		case "exit":
+			replies.Reply("Connection closed")
+			return
+		case "save":
+			if saveErr := this.save(user); saveErr != nil {
+				replies.ReplyLines("Cannot save snapshot.", saveErr)
+			} else {
+				replies.Reply("Snapshot saved")
+			}
+		case "user-add", "user-del", "user-passwd", "user-list", "user-grant", "session-revoke", "lockout-list", "lockout-clear":
+			var value interface{}
+			value, err = this.manageUsers(user, command, params)
+			if lines, ok := value.([]string); ok {
+				for _, line := range lines {
+					replies.Reply(line)
+				}
+			} else if err == nil {
+				replies.Reply("Done")
+			} else if !errors.Is(err, cache.ErrBadArguments) {
+				replies.Replyf("Error [%v] happened", err)
+				err = nil
+			}
+		default:
+			err = this.handleCommand(user, id, cmds, command, params)
+		}
+
+		//Denied commands are replied by the commands of the cache
+		if err != nil && !errors.Is(err, cache.ErrPermissionDenied) {
+			replies.Reply(NEED_HELP)
+		}
+	}
+}
+
+//Executes a command with <cmds> that check permissions of a <user>, see cache.NewRestrictedCommands().
+//Mutating commands of a cache <cacheId> are written into the audit log together with denials of them.
+func (this *Server) handleCommand(user *auth.User, cacheId string, cmds cache.CacheCommands, command string, params []string) error {
+	err := cache.ExecuteCommand(cmds, command, params)
+	if cache.MUTATING_COMMANDS[command] {
+		this.options.Auditor.Command(user.Name, cacheId, command, params, err)
+	}
+	return err
+}
+
+//Reads the first command of a connection.
+//Returns the id of a cache to connect to together with the cache, or <nil> cache if the server was stopped.
+func (this *Server) readCache(user *auth.User, reader *bufio.Reader) (string, cache.Cache, error) {
+	firstCmd, _, err := reader.ReadLine()
+	if err != nil {
+		return "", nil, err
+	}
+
+	params, err := utils.SplitCommand(string(firstCmd))
+	if err != nil {
+		return "", nil, cache.WrapError(cache.BAD_ARGUMENTS, err)
+	}
+	return this.openCache(user, params)
+}
+
+//Executes the first command of a connection passed as <params>: "stop-server" or "connect-to" <cacheId> [options].
+//Returns the id of a cache to connect to together with the cache, or <nil> cache if the server was stopped.
+//Returns ErrPermissionDenied if a <user> is not allowed to execute the command.
+func (this *Server) openCache(user *auth.User, params []string) (string, cache.Cache, error) {
+	if len(params) == 1 && params[0] == "stop-server" {
+		err := this.checkPermission(user, "stop-server")
+		if err != nil {
+			return "", nil, err
+		}
+		this.Stop()
+		return "", nil, nil
+	}
+
+	if len(params) == 0 || params[0] != "connect-to" {
+		return "", nil, cache.NewError(cache.UNKNOWN_COMMAND, "Invalid command")
+	}
+
+	if len(params) < 2 || len(params) > 5 {
+		return "", nil, cache.NewError(cache.BAD_ARGUMENTS, "Invalid parameters")
+	}
+
+	err := cache.CheckCacheAccess(user, params[1])
+	if err != nil {
+		this.options.Log.Warn("Cache access is denied", utils.LOG_USER, user.Name, utils.LOG_ERROR, err)
+		return "", nil, err
+	}
+
+	options, err := parseCacheOptions(this.cacheOptions(params[1]), params[2:])
+	if err != nil {
+		return "", nil, err
+	}
+
+	return params[1], this.GetCache(params[1], options), nil
+}
+
+//Parses optional limits of a cache passed with "connect-to" command: [maxEntries] [maxBytes] [evictionPolicy].
+//Limits that are not passed are taken from <options> configured for the cache. Zero limit means no limit.
+func parseCacheOptions(options cache.CacheOptions, params []string) (cache.CacheOptions, error) {
+
+	var err error
+	if len(params) > 0 {
+		options.MaxEntries, err = strconv.Atoi(params[0])
+		if err != nil {
+			return options, cache.NewError(cache.BAD_ARGUMENTS, "Invalid integer [%v]", params[0])
+		}
+	}
+
+	if len(params) > 1 {
+		options.MaxBytes, err = strconv.ParseInt(params[1], 10, 64)
+		if err != nil {
+			return options, cache.NewError(cache.BAD_ARGUMENTS, "Invalid integer [%v]", params[1])
+		}
+	}
+
+	if len(params) > 2 {
+		options.Policy, err = cache.ParseEvictionPolicy(params[2])
+		if err != nil {
+			return options, err
+		}
+	}
+
+	return options, nil
+}
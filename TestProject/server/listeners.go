@@ -0,0 +1,139 @@
+package server
+
+import (
+	"TestProject/utils"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+//How clients of a listener log in.
+type AuthPolicy string
+
+const (
+	//Clients log in with passwords, client certificates or session tokens.
+	AUTH_LOGIN AuthPolicy = "login"
+	//Clients log in with client certificates only, the listener needs TLS with ClientCAs.
+	AUTH_CERTIFICATE AuthPolicy = "certificate"
+	//Clients of a unix socket are logged in as users their OS accounts are mapped to, see Listener.PeerUsers.
+	AUTH_PEER AuthPolicy = "peer"
+	//Clients of a unix socket are logged in as Listener.User without credentials, access is restricted by file permissions of the socket.
+	AUTH_TRUST AuthPolicy = "trust"
+)
+
+//Checks that a policy is known, empty policy is AUTH_LOGIN.
+func ParseAuthPolicy(name string) (AuthPolicy, error) {
+	switch policy := AuthPolicy(name); policy {
+	case "":
+		return AUTH_LOGIN, nil
+	case AUTH_LOGIN, AUTH_CERTIFICATE, AUTH_PEER, AUTH_TRUST:
+		return policy, nil
+	}
+	return "", errors.New(fmt.Sprintf("Unknown auth policy [%v]", name))
+}
+
+//Listener of telnet and machine clients with its own TLS config and auth policy.
+type Listener struct {
+	net.Listener
+	//Connections are wrapped with TLS if the config is set. Plaintext TCP listeners are allowed on loopback addresses only.
+	TLSConfig *tls.Config
+	//Empty policy is AUTH_LOGIN.
+	Auth AuthPolicy
+	//User clients of AUTH_TRUST listener are logged in as.
+	User string
+	//Users clients of AUTH_PEER listener are logged in as, keys are OS user ids or OS user names.
+	PeerUsers map[string]string
+}
+
+func (this *Listener) validate() error {
+	if this.Listener == nil {
+		return errors.New("Listener is required")
+	}
+	address := this.Addr()
+	policy, err := ParseAuthPolicy(string(this.Auth))
+	if err != nil {
+		return err
+	}
+
+	_, isUnix := address.(*net.UnixAddr)
+	if this.TLSConfig == nil && !isUnix && !IsLoopback(address.String()) {
+		return errors.New(fmt.Sprintf("Plaintext listener [%v] should be bound to a loopback address", address))
+	}
+	switch {
+	case policy == AUTH_CERTIFICATE && (this.TLSConfig == nil || this.TLSConfig.ClientCAs == nil):
+		return errors.New(fmt.Sprintf("Certificate login on [%v] requires TLS with client CAs", address))
+	case (policy == AUTH_PEER || policy == AUTH_TRUST) && !isUnix:
+		return errors.New(fmt.Sprintf("Auth policy %v on [%v] requires a unix socket", policy, address))
+	case policy == AUTH_PEER && len(this.PeerUsers) == 0:
+		return errors.New(fmt.Sprintf("Peer users of [%v] are required", address))
+	case policy == AUTH_TRUST && this.User == "":
+		return errors.New(fmt.Sprintf("Trusted user of [%v] is required", address))
+	}
+	return nil
+}
+
+//Returns a listener that wraps connections with TLS if it has the config.
+func (this *Listener) withTLS() net.Listener {
+	if this.TLSConfig == nil {
+		return this.Listener
+	}
+	return tls.NewListener(this.Listener, this.TLSConfig)
+}
+
+//Returns the name of a user a peer of a unix socket <conn> is mapped to, or an error if its OS user is not mapped.
+func (this *Listener) peerUser(conn net.Conn) (string, error) {
+	unixConn, ok := utils.UnwrapDrained(conn).(*net.UnixConn)
+	if !ok {
+		return "", errors.New("Peer credentials require a unix socket")
+	}
+	uid, err := peerUid(unixConn)
+	if err != nil {
+		return "", err
+	}
+
+	id := strconv.FormatUint(uint64(uid), 10)
+	if name, ok := this.PeerUsers[id]; ok {
+		return name, nil
+	}
+	if account, err := user.LookupId(id); err == nil {
+		if name, ok := this.PeerUsers[account.Username]; ok {
+			return name, nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("OS user %v is not mapped to a user", id))
+}
+
+//Returns true if a host of an <address> is a loopback IP address or "localhost".
+func IsLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+//Listens on a unix socket <path> with file permissions <mode>. A socket file left by a stopped server is removed first,
+//the file is removed again when the listener is closed.
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chmod(path, mode)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
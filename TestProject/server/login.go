@@ -0,0 +1,256 @@
+package server
+
+import (
+	"TestProject/audit"
+	"TestProject/auth"
+	"TestProject/cache"
+	"TestProject/utils"
+	"bufio"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+//Logs a user of a new connection in with a challenge-response exchange, see auth.ScramServer.
+//Every message of the server is a JsonResponse, a failure is sent to the client as well.
+//Who tries to log in and how is filled into an audit <attempt> as soon as it is known.
+//Logins that are not allowed by the auth policy of a <listener> are rejected.
+func (this *Server) login(conn net.Conn, reader *bufio.Reader, attempt *audit.Record, listener *Listener) (*auth.User, error) {
+	credentials, _, err := reader.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	user, err := auth.JsonToUser(credentials)
+	if err != nil {
+		return nil, err
+	}
+	attempt.User = user.Name
+	attempt.IsMachine = user.IsMachine
+
+	switch listener.Auth {
+	case AUTH_PEER, AUTH_TRUST:
+		return this.trustedLogin(conn, user, attempt, listener)
+	case AUTH_CERTIFICATE:
+		if user.Token != "" || user.Scram != "" {
+			attempt.Method = audit.METHOD_CERTIFICATE
+			err = cache.NewError(cache.AUTH_FAILED, "Certificate login is required")
+			cache.WriteErrorResponse(conn, err)
+			return nil, err
+		}
+	}
+
+	source := sourceAddress(conn)
+	if user.Token != "" {
+		attempt.Method = audit.METHOD_SESSION
+		loggedUser, err := this.resumeSession(conn, user, source)
+		if loggedUser != nil {
+			attempt.User = loggedUser.Name
+		}
+		return loggedUser, err
+	}
+
+	if user.Scram == "" {
+		attempt.Method = audit.METHOD_CERTIFICATE
+		certUser := this.certificateUser(conn)
+		if certUser == nil || (user.Name != "" && user.Name != certUser.Name) {
+			err = cache.NewError(cache.AUTH_FAILED, "Challenge-response login is required")
+			cache.WriteErrorResponse(conn, err)
+			return nil, err
+		}
+		cache.WriteResponse(conn, certUser.Name, nil)
+		certUser.IsMachine = user.IsMachine
+		return certUser, nil
+	}
+
+	attempt.Method = audit.METHOD_PASSWORD
+	scram, err := auth.NewScramServer(user.Scram, this.lookupVerifier)
+	if err != nil {
+		err = cache.WrapError(cache.AUTH_FAILED, err)
+		cache.WriteErrorResponse(conn, err)
+		return nil, err
+	}
+	attempt.User = scram.User()
+	err = this.checkLockout(scram.User(), source)
+	if err != nil {
+		cache.WriteErrorResponse(conn, err)
+		return nil, err
+	}
+	cache.WriteResponse(conn, scram.ServerFirst(), nil)
+
+	clientFinal, _, err := reader.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+
+	serverFinal, err := scram.Finish(string(clientFinal))
+	if err != nil {
+		this.options.Limiter.Fail(scram.User(), source)
+		cache.WriteErrorResponse(conn, cache.ErrAuthFailed)
+		return nil, cache.WrapError(cache.AUTH_FAILED, err)
+	}
+	this.options.Limiter.Succeed(scram.User())
+	cache.WriteResponse(conn, serverFinal, nil)
+
+	//A copy of the stored user keeps its permissions and the mode chosen by the client
+	loggedUser := this.options.Users.Get(scram.User())
+	if loggedUser == nil {
+		cache.WriteErrorResponse(conn, cache.ErrAuthFailed)
+		return nil, cache.ErrAuthFailed
+	}
+	loggedUser.IsMachine = user.IsMachine
+
+	if user.Session {
+		if this.options.Sessions == nil {
+			err = cache.NewError(cache.AUTH_FAILED, "Sessions are not enabled")
+			cache.WriteErrorResponse(conn, err)
+			return nil, err
+		}
+		token, err := this.options.Sessions.Issue(loggedUser.Name, loggedUser.IsMachine)
+		cache.WriteResponse(conn, token, err)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return loggedUser, nil
+}
+
+//Logs a client of a unix socket in as a user the <listener> maps it to, the name of the user is sent back.
+//The client sends no credentials, a name it sends has to be the name of that user.
+func (this *Server) trustedLogin(conn net.Conn, user *auth.User, attempt *audit.Record, listener *Listener) (*auth.User, error) {
+	name := listener.User
+	attempt.Method = audit.METHOD_TRUST
+	var err error
+	if listener.Auth == AUTH_PEER {
+		attempt.Method = audit.METHOD_PEER
+		name, err = listener.peerUser(conn)
+	}
+
+	var loggedUser *auth.User
+	switch {
+	case err != nil:
+		err = cache.WrapError(cache.AUTH_FAILED, err)
+	case user.Token != "" || user.Scram != "":
+		err = cache.NewError(cache.AUTH_FAILED, "Credentials are not accepted by %v listener", listener.Auth)
+	default:
+		attempt.User = name
+		loggedUser = this.options.Users.Get(name)
+		if loggedUser == nil || (user.Name != "" && user.Name != loggedUser.Name) {
+			err = cache.NewError(cache.AUTH_FAILED, "User [%v] of the socket is unknown or differs from the sent name", name)
+		}
+	}
+	if err != nil {
+		cache.WriteErrorResponse(conn, err)
+		return nil, err
+	}
+
+	cache.WriteResponse(conn, loggedUser.Name, nil)
+	loggedUser.IsMachine = user.IsMachine
+	return loggedUser, nil
+}
+
+//Logs a user in with a token of a session issued by an earlier login, the name of the user is sent back.
+//Permissions are taken from the current state of the user, a revoked session or a removed user is not accepted.
+//Invalid tokens are counted as failed logins of a <source> address.
+func (this *Server) resumeSession(conn net.Conn, user *auth.User, source string) (*auth.User, error) {
+	err := this.checkLockout("", source)
+	if err != nil {
+		cache.WriteErrorResponse(conn, err)
+		return nil, err
+	}
+
+	var loggedUser *auth.User
+	if this.options.Sessions != nil {
+		session, err := this.options.Sessions.Parse(user.Token)
+		if err == nil {
+			loggedUser = this.options.Users.FindBySession(session)
+		}
+	}
+	if loggedUser == nil {
+		this.options.Limiter.Fail("", source)
+		err = cache.NewError(cache.AUTH_FAILED, "Session is invalid, expired or revoked")
+		cache.WriteErrorResponse(conn, err)
+		return nil, err
+	}
+
+	cache.WriteResponse(conn, loggedUser.Name, nil)
+	loggedUser.IsMachine = user.IsMachine
+	return loggedUser, nil
+}
+
+//Returns an error if logins of a <user> or from a <source> address are delayed or locked out after failures.
+func (this *Server) checkLockout(user, source string) error {
+	lockout := this.options.Limiter.Check(user, source)
+	if lockout == nil {
+		return nil
+	}
+	return cache.NewError(cache.AUTH_FAILED, "Too many failed logins, try again after %v", lockout.Until.Format(time.RFC3339))
+}
+
+//Returns the host of a remote address of a connection, or the whole address if it has no port.
+func sourceAddress(conn net.Conn) string {
+	return sourceOf(conn.RemoteAddr().String())
+}
+
+//Returns the host of a remote <address>, or the whole address if it has no port.
+func sourceOf(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
+
+//Returns a user a verified client certificate of a connection belongs to, or <nil> if there is no such certificate.
+func (this *Server) certificateUser(conn net.Conn) *auth.User {
+	tlsConn, ok := utils.UnwrapDrained(conn).(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	return this.checkCertificate(tlsConn.ConnectionState())
+}
+
+//Returns a user a verified client certificate belongs to, or <nil> if a client didn't send a certificate signed by ClientCAs of the TLS config.
+func (this *Server) checkCertificate(state tls.ConnectionState) *auth.User {
+	if len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	return this.options.Users.FindByCertificate(state.PeerCertificates[0])
+}
+
+//Checks a password of a user that is sent as plain text, e.g. by Redis clients, from a <remote> address.
+//Returns the user with its permissions, or <nil> if the password is incorrect or logins of the user or of the source address are locked out.
+//Every attempt is written into the audit log.
+func (this *Server) checkUser(name, pass, remote string) *auth.User {
+	user, err := this.verifyUser(name, pass, sourceOf(remote))
+	this.options.Auditor.Login(audit.Record{User: name, Remote: remote, Method: audit.METHOD_PASSWORD}, err)
+	return user
+}
+
+func (this *Server) verifyUser(name, pass, source string) (*auth.User, error) {
+	err := this.checkLockout(name, source)
+	if err != nil {
+		return nil, err
+	}
+
+	user := this.options.Users.Get(name)
+	var verifier *auth.Verifier
+	if user != nil {
+		verifier, err = user.Verifier()
+	}
+	if user == nil || err != nil || !verifier.Check(pass) {
+		this.options.Limiter.Fail(name, source)
+		return nil, cache.ErrAuthFailed
+	}
+	this.options.Limiter.Succeed(name)
+	return user, nil
+}
+
+//Returns a password verifier of a user, or <nil> if the user is unknown.
+func (this *Server) lookupVerifier(name string) *auth.Verifier {
+	user := this.options.Users.Get(name)
+	if user == nil {
+		return nil
+	}
+	verifier, _ := user.Verifier()
+	return verifier
+}
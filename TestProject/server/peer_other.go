@@ -0,0 +1,13 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"net"
+)
+
+//Peer credentials are read on Linux only, AUTH_PEER listeners reject every client elsewhere.
+func peerUid(conn *net.UnixConn) (uint32, error) {
+	return 0, errors.New("Peer credentials are not supported on this system")
+}
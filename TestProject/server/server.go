@@ -0,0 +1,407 @@
+package server
+
+import (
+	"TestProject/audit"
+	"TestProject/auth"
+	"TestProject/cache"
+	"TestProject/memcache"
+	"TestProject/persist"
+	"TestProject/resp"
+	"TestProject/rest"
+	"TestProject/utils"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	//How long commands that are being executed are waited for when the server stops.
+	DEFAULT_SHUTDOWN_TIMEOUT  = 10 * time.Second
+	DEFAULT_SNAPSHOT_INTERVAL = 5 * time.Minute
+	//How long a telnet connection may wait for the next command.
+	DEFAULT_IDLE_TIMEOUT = time.Minute
+)
+
+//Limits of caches whose ids match a pattern, e.g. "session-*", they are used when a cache is created.
+//Zero limit means no limit, empty policy keeps the default one.
+type CacheLimits struct {
+	Pattern    string
+	MaxEntries int                  `json:",omitempty"`
+	MaxBytes   int64                `json:",omitempty"`
+	Policy     cache.EvictionPolicy `json:",omitempty"`
+}
+
+//Options of a Server that can be changed while it runs, see Server.Reconfigure().
+type RuntimeOptions struct {
+	IdleTimeout time.Duration
+	//Limits of new caches, the first matching pattern wins. Limits passed with "connect-to" command take precedence.
+	CacheLimits []CacheLimits
+}
+
+//Checks the idle timeout, cache patterns and eviction policies.
+func (this *RuntimeOptions) Validate() error {
+	if this.IdleTimeout <= 0 {
+		return errors.New("Idle timeout should be positive")
+	}
+	for _, limits := range this.CacheLimits {
+		if _, err := path.Match(limits.Pattern, ""); err != nil {
+			return errors.New(fmt.Sprintf("Wrong cache pattern [%v]", limits.Pattern))
+		}
+		if limits.Policy != "" {
+			if _, err := cache.ParseEvictionPolicy(string(limits.Policy)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//Options of a Server. Users are required, other options have defaults, see DefaultServerOptions().
+type ServerOptions struct {
+	RuntimeOptions
+
+	//Listener of telnet and machine clients. Listeners of Redis, HTTP and memcached clients are optional.
+	Listener         net.Listener
+	RespListener     net.Listener
+	HttpListener     net.Listener
+	MemcacheListener net.Listener
+	//Listeners are wrapped with TLS if the config is set, client certificates are checked if it has ClientCAs.
+	TLSConfig *tls.Config
+	//More listeners of telnet and machine clients, e.g. unix sockets or other addresses, with their own TLS configs and auth policies.
+	//Listener is optional if there are such listeners.
+	Listeners []Listener
+
+	Users *auth.UserStore
+	//Registry of named caches, its values are caches, see cache.NewRegistry().
+	Caches cache.Cache
+	//Signer of session tokens, sessions can't be issued or resumed without it.
+	Sessions *auth.SessionSigner
+	Limiter  *auth.LoginLimiter
+	Auditor  *audit.Auditor
+	//Command log the mutating commands are appended to, commands are not logged if it is nil.
+	CommandLog *persist.CommandLog
+	//Snapshotter of caches, "save" command fails without it.
+	Snapshots        *persist.Snapshotter
+	SnapshotInterval time.Duration
+	ShutdownTimeout  time.Duration
+	//Diagnostics of the server, replies to users are not written here.
+	Log *slog.Logger
+}
+
+//Returns default options without listeners and users: an empty cache registry, default login limits, no persistence and no audit.
+func DefaultServerOptions() ServerOptions {
+	return ServerOptions{
+		RuntimeOptions:   RuntimeOptions{IdleTimeout: DEFAULT_IDLE_TIMEOUT},
+		Caches:           cache.NewRegistry(),
+		Limiter:          auth.NewLoginLimiter(auth.DefaultLimiterOptions()),
+		SnapshotInterval: DEFAULT_SNAPSHOT_INTERVAL,
+		ShutdownTimeout:  DEFAULT_SHUTDOWN_TIMEOUT,
+		Log:              slog.Default(),
+	}
+}
+
+func (this *ServerOptions) validate() error {
+	switch {
+	case this.Listener == nil && len(this.Listeners) == 0:
+		return errors.New("Listener is required")
+	case this.Users == nil:
+		return errors.New("Users are required")
+	case this.Caches == nil:
+		return errors.New("Cache registry is required")
+	case this.Limiter == nil:
+		return errors.New("Login limiter is required")
+	case this.Log == nil:
+		return errors.New("Log is required")
+	case this.ShutdownTimeout <= 0:
+		return errors.New("Shutdown timeout should be positive")
+	}
+	for _, listener := range this.listeners() {
+		if err := listener.validate(); err != nil {
+			return err
+		}
+	}
+	return this.RuntimeOptions.Validate()
+}
+
+//Returns all listeners of telnet and machine clients, Listener uses TLSConfig and AUTH_LOGIN policy.
+func (this *ServerOptions) listeners() []*Listener {
+	var listeners []*Listener
+	if this.Listener != nil {
+		listeners = append(listeners, &Listener{Listener: this.Listener, TLSConfig: this.TLSConfig, Auth: AUTH_LOGIN})
+	}
+	for i := range this.Listeners {
+		listeners = append(listeners, &this.Listeners[i])
+	}
+	return listeners
+}
+
+//In-memory cache server: telnet users, machine clients and optional Redis, HTTP and memcached clients of the same caches.
+//A server is started by Serve() and stopped by Shutdown(), by "stop-server" command of an admin or by Stop().
+type Server struct {
+	options ServerOptions
+	//Options that are changed by Reconfigure(), they are read by connections without locks.
+	runtimeOptions atomic.Pointer[RuntimeOptions]
+
+	//Listeners of telnet and machine clients.
+	listeners      []*Listener
+	respServer     *resp.Server
+	httpServer     *http.Server
+	memcacheServer *memcache.Server
+
+	//Tracks connections of telnet, machine, Redis and memcached clients, so they are drained when the server stops.
+	drain *utils.Drainer
+	//Ids of connections, an id is added to records of the server log about a connection.
+	connectionIds atomic.Int64
+
+	stopOnce    sync.Once
+	stopped     chan struct{}
+	shutdownErr error
+}
+
+//Creates a Server, nothing is accepted till Serve() is called.
+func NewServer(options ServerOptions) (*Server, error) {
+	err := options.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	server := new(Server)
+	server.options = options
+	server.listeners = options.listeners()
+	server.runtimeOptions.Store(&options.RuntimeOptions)
+	server.drain = utils.NewDrainer()
+	server.stopped = make(chan struct{})
+
+	log := options.Log
+	if options.RespListener != nil {
+		server.respServer = resp.NewServer(server.getLimitedCache, server.checkUser, server.wrap, options.Auditor, log.With(utils.LOG_LISTENER, "resp"))
+	}
+	if options.HttpListener != nil {
+		gateway := rest.NewGateway(server.getLimitedCache, server.checkUser, options.Users.FindByCertificate, options.Sessions, options.Users.FindBySession, server.wrap, options.Auditor, log.With(utils.LOG_LISTENER, "http"))
+		server.httpServer = &http.Server{Handler: gateway}
+	}
+	if options.MemcacheListener != nil {
+		server.memcacheServer = memcache.NewServer(memcache.DEFAULT_CACHE, server.getLimitedCache, server.checkUser, server.logWrite, options.Auditor, log.With(utils.LOG_LISTENER, "memcache"))
+	}
+	return server, nil
+}
+
+//Accepts connections of all listeners and starts periodic snapshots.
+//Returns <nil> once the server is shut down and persistence is flushed, or an error if a listener fails.
+func (this *Server) Serve() error {
+	if this.options.Snapshots != nil && this.options.SnapshotInterval > 0 {
+		this.options.Snapshots.Start(this.options.SnapshotInterval, this.options.Log)
+	}
+
+	if this.respServer != nil {
+		go this.respServer.Serve(this.drain.Listen(this.withTLS(this.options.RespListener)))
+	}
+	if this.httpServer != nil {
+		//Connections of the gateway are drained by http.Server, it needs *tls.Conn to find certificates of clients
+		go this.httpServer.Serve(this.withTLS(this.options.HttpListener))
+	}
+	if this.memcacheServer != nil {
+		go this.memcacheServer.Serve(this.drain.Listen(this.withTLS(this.options.MemcacheListener)))
+	}
+
+	failures := make(chan error, len(this.listeners))
+	for _, listener := range this.listeners {
+		go func(listener *Listener) {
+			failures <- this.accept(listener)
+		}(listener)
+	}
+	for range this.listeners {
+		if err := <-failures; err != nil {
+			return err
+		}
+	}
+
+	<-this.stopped
+	return nil
+}
+
+//Accepts connections of telnet and machine clients till the server is shut down.
+//Returns <nil> on shutdown, or an error if the listener is closed by somebody else.
+func (this *Server) accept(listener *Listener) error {
+	drained := this.drain.Listen(listener.withTLS())
+	for {
+		conn, err := drained.Accept()
+		if err != nil {
+			if this.drain.Closing() {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			this.options.Log.Warn("Cannot accept connection", utils.LOG_LISTENER, listener.Addr().String(), utils.LOG_ERROR, err)
+			continue
+		}
+
+		go this.handleConnection(conn, listener)
+	}
+}
+
+func (this *Server) withTLS(listener net.Listener) net.Listener {
+	if this.options.TLSConfig == nil {
+		return listener
+	}
+	return tls.NewListener(listener, this.options.TLSConfig)
+}
+
+//Replaces options that can be changed while the server runs, e.g. when the configuration is reloaded.
+//Connections use a new idle timeout from their next command, new limits are used for caches created after the call.
+func (this *Server) Reconfigure(options RuntimeOptions) error {
+	err := options.Validate()
+	if err != nil {
+		return err
+	}
+	this.runtimeOptions.Store(&options)
+	return nil
+}
+
+func (this *Server) runtime() *RuntimeOptions {
+	return this.runtimeOptions.Load()
+}
+
+//Returns options of a new cache <cacheId>: default options with limits of the first matching pattern.
+func (this *Server) cacheOptions(cacheId string) cache.CacheOptions {
+	options := cache.DefaultCacheOptions()
+	for _, limits := range this.runtime().CacheLimits {
+		if matched, _ := path.Match(limits.Pattern, cacheId); matched {
+			options.MaxEntries = limits.MaxEntries
+			options.MaxBytes = limits.MaxBytes
+			if limits.Policy != "" {
+				options.Policy = limits.Policy
+			}
+			break
+		}
+	}
+	return options
+}
+
+//Returns a named cache for Redis, HTTP and memcached clients, they can't pass limits, so configured limits are used.
+func (this *Server) getLimitedCache(id string, _ cache.CacheOptions) cache.Cache {
+	return this.GetCache(id, this.cacheOptions(id))
+}
+
+//Starts shutting the server down without waiting for it, so the connection that asked for it can be closed.
+func (this *Server) Stop() {
+	go this.Shutdown(this.options.ShutdownTimeout)
+}
+
+//Stops accepting connections, tells telnet users that connections will be closed and waits up to <timeout>
+//till commands that are being executed finish, then saves the final snapshot and closes the command log and the audit log.
+//Named caches are stopped at last, they stay usable but expired values are not removed in the background anymore.
+//The server is shut down once, later calls wait till the first one is done and return the same result.
+//Returns an error if connections were not drained in time or persistence was not flushed.
+func (this *Server) Shutdown(timeout time.Duration) error {
+	this.stopOnce.Do(func() {
+		defer close(this.stopped)
+		log := this.options.Log
+		log.Info("Server is shutting down", "timeout", timeout.String())
+
+		drained := make(chan bool, 1)
+		go func() {
+			drained <- this.drain.Shutdown(timeout)
+		}()
+		var errs []error
+		if this.httpServer != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			err := this.httpServer.Shutdown(ctx)
+			cancel()
+			if err != nil {
+				log.Warn("Cannot drain http connections, they are closed", utils.LOG_ERROR, err)
+				this.httpServer.Close()
+				errs = append(errs, err)
+			}
+		}
+		if !<-drained {
+			log.Warn("Connections were not drained in time, they are closed")
+			errs = append(errs, errors.New("Connections were not drained in time"))
+		}
+		if this.memcacheServer != nil {
+			this.memcacheServer.Close()
+		}
+
+		errs = append(errs, this.flush()...)
+		cache.StopCaches(this.options.Caches)
+		this.shutdownErr = errors.Join(errs...)
+		log.Info("Server is stopped")
+	})
+	<-this.stopped
+	return this.shutdownErr
+}
+
+//Saves the final snapshot and closes the command log and the audit log before the server exits.
+func (this *Server) flush() []error {
+	log := this.options.Log
+	var errs []error
+	if snapshots := this.options.Snapshots; snapshots != nil {
+		snapshots.Stop()
+		err := snapshots.Save()
+		if err != nil {
+			log.Error("Cannot save snapshot", utils.LOG_ERROR, err)
+			errs = append(errs, err)
+		}
+	}
+
+	if this.options.CommandLog != nil {
+		err := this.options.CommandLog.Close()
+		if err != nil {
+			log.Error("Cannot close command log", utils.LOG_ERROR, err)
+			errs = append(errs, err)
+		}
+	}
+
+	err := this.options.Auditor.Close()
+	if err != nil {
+		log.Error("Cannot close audit log", utils.LOG_ERROR, err)
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+//Returns a named cache of the server, see GetCache().
+func (this *Server) GetCache(id string, options cache.CacheOptions) cache.Cache {
+	return GetCache(this.options.Caches, id, options)
+}
+
+//Returns a named cache of a registry <caches>, the cache is created with passed <options> if it doesn't exist yet.
+//Options of an existing cache are not changed.
+func GetCache(caches cache.Cache, id string, options cache.CacheOptions) cache.Cache {
+	existingCache := caches.Get(id)
+	if existingCache == nil {
+		newCache := cache.NewCacheWithOptions(options)
+		existingCache = caches.PutIfAbsent(id, newCache)
+		if existingCache == nil {
+			existingCache = newCache
+		} else {
+			newCache.Stop()
+		}
+	}
+	return existingCache.(cache.Cache)
+}
+
+//Decorates commands of a named cache, so they are written into the command log if there is one.
+func (this *Server) wrap(cmds cache.CacheCommands, cacheId string, c cache.Cache) cache.CacheCommands {
+	if this.options.CommandLog == nil {
+		return cmds
+	}
+	return this.options.CommandLog.Wrap(cmds, cacheId, c)
+}
+
+//Executes a direct write of a key, so it is written into the command log if there is one.
+func (this *Server) logWrite(cacheId string, c cache.Cache, key string, write func() error) error {
+	if this.options.CommandLog == nil {
+		return write()
+	}
+	return this.options.CommandLog.ExecWrite(cacheId, c, key, write)
+}
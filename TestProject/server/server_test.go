@@ -0,0 +1,1142 @@
+package server
+
+import (
+	"TestProject/audit"
+	"TestProject/auth"
+	"TestProject/cache"
+	"TestProject/persist"
+	"TestProject/utils"
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//In-process server, tests connect its handlers to clients with pipes.
+var testServer *Server
+
+//Users of the in-process server.
+var users *auth.UserStore
+
+//Audit log of the in-process server.
+var auditFile string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "cache")
+	if err != nil {
+		panic(err)
+	}
+
+	verifier, err := auth.NewVerifier("test", auth.MIN_ITERATIONS)
+	if err != nil {
+		panic(err)
+	}
+	users = auth.NewUserStore(map[string]*auth.User{
+		"test":   {Name: "test", Pass: verifier.String(), Admin: true},
+		"reader": {Name: "reader", Pass: verifier.String(), Caches: []string{"team-*"}, ReadOnly: true, Categories: []string{auth.CATEGORY_LIST}},
+	})
+	options := DefaultServerOptions()
+	options.Listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	options.Users = users
+	options.Sessions = auth.NewSessionSigner([]byte("0123456789abcdef0123456789abcdef"), time.Hour)
+	//Tests fail logins on purpose, so failures don't delay other logins, see TestLoginLockout
+	options.Limiter = auth.NewLoginLimiter(auth.LimiterOptions{MaxFailures: 1000})
+	auditFile = filepath.Join(dir, audit.AUDIT_FILE)
+	options.Auditor, err = audit.OpenAuditor(auditFile, audit.DefaultAuditOptions(), slog.Default())
+	if err != nil {
+		panic(err)
+	}
+	options.CommandLog, err = persist.OpenCommandLog(filepath.Join(dir, "commands.log"), options.Caches, persist.DefaultCommandLogOptions(), slog.Default())
+	if err != nil {
+		panic(err)
+	}
+	testServer, err = NewServer(options)
+	if err != nil {
+		panic(err)
+	}
+	go testServer.Serve()
+
+	code := m.Run()
+
+	testServer.Shutdown(time.Second)
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+//Connects a client to the in-process server and logs it in as an admin.
+func connectClient(t *testing.T, isMachine bool) net.Conn {
+	return connectClientAs(t, "test", isMachine)
+}
+
+//Connects a client to the in-process server and logs a user <name> in, all test users have the password "test".
+func connectClientAs(t *testing.T, name string, isMachine bool) net.Conn {
+	client, server := net.Pipe()
+	go testServer.handleConnection(server, testServer.listeners[0])
+	t.Cleanup(func() { client.Close() })
+
+	err := cache.Login(client, name, "test", isMachine)
+	if err != nil {
+		t.Fatal("Login failed", err)
+	}
+	return client
+}
+
+//Connects a machine client to the in-process server and returns a RemoteCache for a passed <cacheId>.
+func connectRemoteCache(t *testing.T, cacheId string) cache.RemoteCache {
+	client := connectClient(t, true)
+
+	remote, err := cache.OpenRemoteCache(client, cacheId)
+	if err != nil {
+		t.Fatal("Cannot connect to cache", err)
+	}
+	return remote
+}
+
+//Connects a machine client that uses the line-based protocol.
+func connectLegacyRemoteCache(t *testing.T, cacheId string) cache.RemoteCache {
+	client := connectClient(t, true)
+
+	client.Write([]byte("connect-to " + cacheId + "\n"))
+	return cache.NewRemoteCache(client)
+}
+
+func TestLoginFailures(t *testing.T) {
+	client, server := net.Pipe()
+	go testServer.handleConnection(server, testServer.listeners[0])
+	defer client.Close()
+
+	err := cache.Login(client, "test", "wrong", true)
+	if !errors.Is(err, cache.ErrAuthFailed) {
+		t.Error("Wrong password should not be accepted", err)
+	}
+
+	client, server = net.Pipe()
+	go testServer.handleConnection(server, testServer.listeners[0])
+	defer client.Close()
+
+	err = cache.Login(client, "unknown", "test", true)
+	if !errors.Is(err, cache.ErrAuthFailed) {
+		t.Error("Unknown user should not be accepted", err)
+	}
+
+	client, server = net.Pipe()
+	go testServer.handleConnection(server, testServer.listeners[0])
+	defer client.Close()
+
+	data, _ := auth.UserToJson(&auth.User{Name: "test", Pass: auth.EncryptPass("test"), IsMachine: true})
+	go client.Write(append(data, '\n'))
+	line, _, _ := bufio.NewReader(client).ReadLine()
+	response, err := cache.JsonToResponse(line)
+	if err != nil || !errors.Is(response.ToError(), cache.ErrAuthFailed) {
+		t.Error("Password hash should not be accepted instead of challenge-response login", err)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	now := time.Now()
+	limiterOptions := auth.DefaultLimiterOptions()
+	limiterOptions.MaxFailures = 2
+	limiterOptions.Now = func() time.Time { return now }
+	options := testServer.options
+	options.Limiter = auth.NewLoginLimiter(limiterOptions)
+	defer func(previous *Server) { testServer = previous }(testServer)
+	testServer, _ = NewServer(options)
+
+	err := cache.Login(connectPipe(t), "reader", "wrong", true)
+	if !errors.Is(err, cache.ErrAuthFailed) {
+		t.Error("Wrong password should not be accepted", err)
+	}
+	err = cache.Login(connectPipe(t), "reader", "test", true)
+	if !errors.Is(err, cache.ErrAuthFailed) || !strings.Contains(err.Error(), "Too many failed logins") {
+		t.Error("Login should be delayed after a failure", err)
+	}
+
+	now = now.Add(auth.DEFAULT_BASE_DELAY)
+	err = cache.Login(connectPipe(t), "reader", "wrong", true)
+	if !errors.Is(err, cache.ErrAuthFailed) {
+		t.Error("Wrong password should not be accepted", err)
+	}
+	now = now.Add(auth.DEFAULT_MAX_DELAY)
+	err = cache.Login(connectPipe(t), "reader", "test", true)
+	if !errors.Is(err, cache.ErrAuthFailed) || testServer.checkUser("reader", "test", "") != nil {
+		t.Error("User should be locked out after MaxFailures failures", err)
+	}
+
+	value, err := testServer.manageUsers(users.Get("test"), "lockout-list", nil)
+	list, _ := value.([]string)
+	if err != nil || len(list) != 2 || !strings.HasPrefix(list[0], "ip:pipe failures=2 locked") || !strings.HasPrefix(list[1], "user:reader failures=2 locked") {
+		t.Error("Wrong behavior of lockout-list command", list, err)
+	}
+
+	_, err = testServer.manageUsers(users.Get("reader"), "lockout-clear", []string{"all"})
+	if !errors.Is(err, cache.ErrPermissionDenied) {
+		t.Error("Lockouts should be cleared by an admin only", err)
+	}
+	_, err = testServer.manageUsers(users.Get("test"), "lockout-clear", []string{"user:reader"})
+	if err != nil {
+		t.Error("Wrong behavior of lockout-clear command", err)
+	}
+	_, err = testServer.manageUsers(users.Get("test"), "lockout-clear", []string{"user:reader"})
+	if !errors.Is(err, cache.ErrNotFound) {
+		t.Error("Cleared lockout should not be cleared again", err)
+	}
+	if testServer.checkUser("reader", "test", "") == nil {
+		t.Error("User should log in after the lockout is cleared")
+	}
+
+	err = cache.Login(connectPipe(t), "test", "test", true)
+	if !errors.Is(err, cache.ErrAuthFailed) {
+		t.Error("Address should stay locked out after the user lockout is cleared", err)
+	}
+	testServer.manageUsers(users.Get("test"), "lockout-clear", []string{"ip:pipe"})
+	err = cache.Login(connectPipe(t), "test", "test", true)
+	if err != nil {
+		t.Error("Address should log in after the lockout is cleared", err)
+	}
+
+	testServer.checkUser("nobody", "wrong", "10.0.0.9:1000")
+	if testServer.checkUser("test", "test", "10.0.0.9:1001") != nil {
+		t.Error("Plain text logins should be delayed per source address")
+	}
+	if testServer.checkUser("test", "test", "10.0.0.10:1000") == nil {
+		t.Error("Plain text login from another address should be accepted")
+	}
+}
+
+//Returns records of the audit log of a <user>.
+func auditRecords(t *testing.T, user string) []audit.Record {
+	data, err := os.ReadFile(auditFile)
+	if err != nil {
+		t.Fatal("Cannot read audit log", err)
+	}
+
+	records := []audit.Record{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record audit.Record
+		if json.Unmarshal([]byte(line), &record) == nil && record.User == user {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func TestAudit(t *testing.T) {
+	users.Add("auditor", "test")
+	users.Grant("auditor", auth.User{Caches: []string{"audit-*"}, Categories: []string{auth.CATEGORY_LIST}})
+	defer users.Delete("auditor")
+	written := len(auditRecords(t, "auditor"))
+
+	cache.Login(connectPipe(t), "auditor", "wrong", true)
+	remote, err := cache.OpenRemoteCache(connectClientAs(t, "auditor", true), "audit-test")
+	if err != nil {
+		t.Fatal("Cannot connect to cache", err)
+	}
+	remote.Put("key", "secret")
+	remote.SetDictValue("dict", "field", "value")
+	remote.Get("key")
+
+	records := auditRecords(t, "auditor")[written:]
+	if len(records) != 4 {
+		t.Fatal("Wrong number of audit records", records)
+	}
+	//A failed login is written after the client gets the error, so it can be written after the next login
+	if records[0].Success {
+		records[0], records[1] = records[1], records[0]
+	}
+	if records[0].Event != audit.EVENT_LOGIN || records[0].Success || records[0].Code != cache.AUTH_FAILED || records[0].Method != audit.METHOD_PASSWORD || records[0].Remote != "pipe" {
+		t.Error("Failed login should be audited", records[0])
+	}
+	if records[1].Event != audit.EVENT_LOGIN || !records[1].Success || !records[1].IsMachine {
+		t.Error("Successful login should be audited", records[1])
+	}
+	if records[2].Command != "set" || records[2].Cache != "audit-test" || records[2].Key != "key" || records[2].Params != nil || !records[2].Success {
+		t.Error("Mutating command should be audited without values", records[2])
+	}
+	if records[3].Command != "dset" || records[3].Success || records[3].Code != cache.PERMISSION_DENIED {
+		t.Error("Denied mutating command should be audited", records[3])
+	}
+
+	testServer.manageUsers(users.Get("test"), "user-passwd", []string{"auditor", "secret"})
+	records = auditRecords(t, "test")
+	last := records[len(records)-1]
+	if last.Command != "user-passwd" || last.Key != "auditor" || last.Params != nil {
+		t.Error("User management should be audited without passwords", last)
+	}
+
+	testServer.checkUser("auditor", "wrong", "10.0.0.1:1234")
+	testServer.checkUser("auditor", "secret", "10.0.0.1:1234")
+	records = auditRecords(t, "auditor")
+	records = records[len(records)-2:]
+	if records[0].Event != audit.EVENT_LOGIN || records[0].Success || records[0].Method != audit.METHOD_PASSWORD || records[0].Remote != "10.0.0.1:1234" {
+		t.Error("Failed plain text login should be audited", records[0])
+	}
+	if records[1].Event != audit.EVENT_LOGIN || !records[1].Success {
+		t.Error("Successful plain text login should be audited", records[1])
+	}
+}
+
+func TestRemotePermissions(t *testing.T) {
+	_, err := cache.OpenRemoteCache(connectClientAs(t, "reader", true), "private")
+	if !errors.Is(err, cache.ErrPermissionDenied) {
+		t.Error("Cache that is not allowed should not be opened", err)
+	}
+
+	_, _, err = testServer.openCache(users.Get("reader"), []string{"stop-server"})
+	if !errors.Is(err, cache.ErrPermissionDenied) || testServer.drain.Closing() {
+		t.Error("Server should not be stopped by a user who is not an admin", err)
+	}
+
+	testServer.GetCache("team-permissions", cache.DefaultCacheOptions()).Put("A", "B")
+	remote, err := cache.OpenRemoteCache(connectClientAs(t, "reader", true), "team-permissions")
+	if err != nil {
+		t.Fatal("Allowed cache should be opened", err)
+	}
+
+	value, err := remote.Get("A")
+	if err != nil || value != "B" {
+		t.Error("Read-only user should read values", err)
+	}
+
+	_, err = remote.Put("A", "C")
+	if !errors.Is(err, cache.ErrPermissionDenied) {
+		t.Error("Read-only user should not change values", err)
+	}
+
+	_, err = remote.GetDictSize("D")
+	if !errors.Is(err, cache.ErrPermissionDenied) {
+		t.Error("User without the dict category should not execute dictionary commands", err)
+	}
+
+	cache.BaseCommands(testServer.GetCache("team-permissions", cache.DefaultCacheOptions())).SetDictValue([]string{"D", "field", "value"})
+	_, err = remote.Get("D")
+	if !errors.Is(err, cache.ErrPermissionDenied) {
+		t.Error("User without the dict category should not get a whole dictionary", err)
+	}
+
+	_, err = remote.GetListSize("L")
+	if err != nil {
+		t.Error("User with the list category should execute list commands", err)
+	}
+}
+
+func TestHumanPermissions(t *testing.T) {
+	users.Add("viewer", "test")
+	users.Grant("viewer", auth.User{Caches: []string{"team-*"}})
+	defer users.Delete("viewer")
+	c := testServer.GetCache("team-human", cache.DefaultCacheOptions())
+	cache.BaseCommands(c).AppendListValue([]string{"L", "secret"})
+
+	client := connectClientAs(t, "viewer", false)
+	reader := bufio.NewReader(client)
+	go func() {
+		client.Write([]byte("connect-to team-human\n"))
+		client.Write([]byte("get L\n"))
+		client.Write([]byte("exit\n"))
+	}()
+
+	denied := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		if strings.Contains(line, "secret") {
+			t.Error("List should not be returned to a user without the list category", line)
+		}
+		if strings.Contains(line, "is not allowed to execute [lget]") {
+			denied = true
+		}
+	}
+	if !denied {
+		t.Error("Get of a list should be denied to a user without the list category")
+	}
+}
+
+func TestUserManagement(t *testing.T) {
+	admin := connectClientAs(t, "test", true)
+	_, err := cache.OpenRemoteCache(admin, "TestUserManagement")
+	if err != nil {
+		t.Fatal("Cannot connect to cache", err)
+	}
+	reader := bufio.NewReader(admin)
+	exec := func(args ...string) (interface{}, error) {
+		cache.WriteFrame(admin, args)
+		return cache.ReadValue(reader)
+	}
+
+	value, err := exec("user-add", "bob", "secret")
+	if err != nil || value != true {
+		t.Error("Wrong behavior of user-add command", err)
+	}
+	_, err = exec("user-add", "bob", "other")
+	if !errors.Is(err, cache.ErrBadArguments) {
+		t.Error("Existing user should not be added", err)
+	}
+
+	_, err = exec("user-grant", "bob", "cache=team-*", "category=dict", "readonly")
+	if err != nil {
+		t.Error("Wrong behavior of user-grant command", err)
+	}
+	bob := users.Get("bob")
+	if bob == nil || !bob.ReadOnly || !bob.CanAccessCache("team-a") || !bob.CanExecute(auth.CATEGORY_DICT, false) {
+		t.Error("Permissions were not granted", bob)
+	}
+	_, err = exec("user-grant", "bob", "unknown")
+	if !errors.Is(err, cache.ErrBadArguments) {
+		t.Error("Unknown permission should not be granted", err)
+	}
+
+	_, err = exec("user-passwd", "bob", "test")
+	if err != nil || testServer.checkUser("bob", "test", "") == nil || testServer.checkUser("bob", "secret", "") != nil {
+		t.Error("Wrong behavior of user-passwd command", err)
+	}
+
+	bobClient := connectClientAs(t, "bob", true)
+	_, err = cache.OpenRemoteCache(bobClient, "team-a")
+	if err != nil {
+		t.Error("Added user should log in", err)
+	}
+	cache.WriteFrame(bobClient, []string{"user-del", "test"})
+	_, err = cache.ReadValue(bufio.NewReader(bobClient))
+	if !errors.Is(err, cache.ErrPermissionDenied) {
+		t.Error("User who is not an admin should not manage users", err)
+	}
+
+	value, err = exec("user-list")
+	list, _ := value.([]interface{})
+	if err != nil || len(list) != 3 || !strings.Contains(list[0].(string), `"Name":"bob"`) || strings.Contains(list[0].(string), "scram") {
+		t.Error("Wrong behavior of user-list command", value, err)
+	}
+
+	_, err = exec("user-del", "bob")
+	if err != nil || users.Get("bob") != nil {
+		t.Error("Wrong behavior of user-del command", err)
+	}
+	_, err = exec("user-del", "bob")
+	if !errors.Is(err, cache.ErrNotFound) {
+		t.Error("Unknown user should not be removed", err)
+	}
+}
+
+//Creates a certificate with a common name <name> signed by <parent>, or a self-signed CA if <parent> is nil.
+func createCertificate(t *testing.T, name string, parent *tls.Certificate) tls.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: parent == nil,
+	}
+
+	signer, signerKey := template, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	data, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal("Cannot create certificate", err)
+	}
+	leaf, _ := x509.ParseCertificate(data)
+	return tls.Certificate{Certificate: [][]byte{data}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestCertificateLogin(t *testing.T) {
+	ca := createCertificate(t, "ca", nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Cannot listen", err)
+	}
+	certListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Cannot listen", err)
+	}
+	options := DefaultServerOptions()
+	options.Listener = listener
+	options.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{createCertificate(t, "localhost", &ca)},
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	}
+	options.Listeners = []Listener{{Listener: certListener, TLSConfig: options.TLSConfig, Auth: AUTH_CERTIFICATE}}
+	options.Users = users
+	options.Caches = testServer.options.Caches
+	tlsServer, _ := NewServer(options)
+	go tlsServer.Serve()
+	defer tlsServer.Shutdown(time.Second)
+
+	users.Add("service", "secret")
+	users.Grant("service", auth.User{Caches: []string{"team-*"}, Certificates: []string{"billing"}})
+	defer users.Delete("service")
+
+	dialTo := func(address string, cert tls.Certificate) net.Conn {
+		conn, err := tls.Dial("tcp", address, &tls.Config{Certificates: []tls.Certificate{cert}, InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal("Cannot connect", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	dial := func(cert tls.Certificate) net.Conn {
+		return dialTo(listener.Addr().String(), cert)
+	}
+
+	conn := dial(createCertificate(t, "billing", &ca))
+	name, err := cache.LoginWithCertificate(conn, "", true)
+	if err != nil || name != "service" {
+		t.Fatal("User of a client certificate should log in", name, err)
+	}
+	_, err = cache.OpenRemoteCache(conn, "team-billing")
+	if err != nil {
+		t.Error("Permissions of the certificate user should be applied", err)
+	}
+
+	_, err = cache.LoginWithCertificate(dial(createCertificate(t, "billing", &ca)), "test", true)
+	if !errors.Is(err, cache.ErrAuthFailed) {
+		t.Error("Certificate should not log another user in", err)
+	}
+
+	_, err = cache.LoginWithCertificate(dial(createCertificate(t, "unknown", &ca)), "", true)
+	if !errors.Is(err, cache.ErrAuthFailed) {
+		t.Error("Certificate without a user should not be accepted", err)
+	}
+
+	otherCa := createCertificate(t, "other", nil)
+	_, err = cache.LoginWithCertificate(dial(createCertificate(t, "billing", &otherCa)), "", true)
+	if err == nil {
+		t.Error("Certificate of unknown CA should not be accepted", err)
+	}
+
+	name, err = cache.LoginWithCertificate(dialTo(certListener.Addr().String(), createCertificate(t, "billing", &ca)), "", true)
+	if err != nil || name != "service" {
+		t.Error("Certificate listener should log users of certificates in", name, err)
+	}
+	err = cache.Login(dialTo(certListener.Addr().String(), createCertificate(t, "billing", &ca)), "service", "secret", true)
+	if !errors.Is(err, cache.ErrAuthFailed) {
+		t.Error("Certificate listener should not accept passwords", err)
+	}
+}
+
+func TestSessionResume(t *testing.T) {
+	var last net.Conn
+	dial := func(ctx context.Context) (net.Conn, error) {
+		client, server := net.Pipe()
+		go testServer.handleConnection(server, testServer.listeners[0])
+		t.Cleanup(func() { client.Close() })
+		last = client
+		return client, nil
+	}
+
+	conn, _ := dial(context.Background())
+	token, err := cache.LoginWithSession(conn, "test", "test", true)
+	if err != nil || token == "" {
+		t.Fatal("Session token was not issued", err)
+	}
+	conn.Close()
+
+	remote, err := cache.OpenResumableRemoteCache(dial, token, "TestSessionResume")
+	if err != nil {
+		t.Fatal("Session was not resumed", err)
+	}
+	remote.Put("A", "B")
+
+	last.Close()
+	value, err := remote.Get("A")
+	if err != nil || value != "B" {
+		t.Error("Session should be resumed with the same cache after a connection is lost", err)
+	}
+
+	_, err = cache.ResumeSession(connectPipe(t), token+"x", true)
+	if !errors.Is(err, cache.ErrAuthFailed) {
+		t.Error("Forged token should not be accepted", err)
+	}
+
+	_, err = testServer.manageUsers(users.Get("reader"), "session-revoke", []string{"test"})
+	if !errors.Is(err, cache.ErrPermissionDenied) {
+		t.Error("Sessions should be revoked by an admin only", err)
+	}
+	_, err = testServer.manageUsers(users.Get("test"), "session-revoke", []string{"test"})
+	if err != nil {
+		t.Fatal("Wrong behavior of session-revoke command", err)
+	}
+
+	last.Close()
+	_, err = remote.Get("A")
+	if !errors.Is(err, cache.ErrAuthFailed) {
+		t.Error("Revoked session should not be resumed", err)
+	}
+}
+
+func TestRemoteCachePool(t *testing.T) {
+	startServer := func(address string) *Server {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			t.Fatal("Cannot listen", err)
+		}
+		options := DefaultServerOptions()
+		options.Listener = listener
+		options.Users = users
+		options.Caches = testServer.options.Caches
+		options.Limiter = testServer.options.Limiter
+		server, err := NewServer(options)
+		if err != nil {
+			t.Fatal("Wrong behavior of NewServer function", err)
+		}
+		go server.Serve()
+		return server
+	}
+	server := startServer("127.0.0.1:0")
+
+	options := cache.DefaultClientOptions()
+	options.Address = server.options.Listener.Addr().String()
+	options.User = "test"
+	options.Password = "test"
+	options.CacheId = "TestRemoteCachePool"
+	options.PoolSize = 4
+	options.HealthCheckAge = 0
+	options.MinBackoff = 20 * time.Millisecond
+	options.MaxBackoff = 100 * time.Millisecond
+	options.MaxRetries = 2
+
+	wrong := options
+	wrong.Password = "wrong"
+	if _, err := cache.DialRemoteCache(wrong); !errors.Is(err, cache.ErrAuthFailed) {
+		t.Error("Wrong password should be reported by DialRemoteCache", err)
+	}
+
+	remote, err := cache.DialRemoteCache(options)
+	if err != nil {
+		t.Fatal("Wrong behavior of DialRemoteCache function", err)
+	}
+	defer remote.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			remote.Put(key, key+"-value")
+			value, err := remote.Get(key)
+			if err != nil || value != key+"-value" {
+				t.Error("Commands of concurrent goroutines should not be mixed", key, value, err)
+			}
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+	if size, err := remote.Size(); err != nil || size != 20 {
+		t.Error("Wrong behavior of pooled remote cache", size, err)
+	}
+
+	server.Shutdown(time.Second)
+	started := time.Now()
+	if _, err = remote.Get("1"); !errors.Is(err, cache.ErrConnectionLost) {
+		t.Error("Command should fail when the server is down", err)
+	}
+	if time.Since(started) < 60*time.Millisecond {
+		t.Error("Connection attempts should be repeated with backoff", time.Since(started))
+	}
+
+	server = startServer(options.Address)
+	defer server.Shutdown(time.Second)
+	value, err := remote.Get("1")
+	if err != nil || value != "1-value" {
+		t.Error("Pool should reconnect and log in again when the server is back", value, err)
+	}
+
+	remote.Close()
+	if _, err = remote.Get("1"); !errors.Is(err, cache.ErrConnectionLost) {
+		t.Error("Closed pool should not execute commands", err)
+	}
+}
+
+//Connects a client to the in-process server without logging it in.
+func connectPipe(t *testing.T) net.Conn {
+	client, server := net.Pipe()
+	go testServer.handleConnection(server, testServer.listeners[0])
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestRemoteValues(t *testing.T) {
+	remote := connectRemoteCache(t, "TestRemoteValues")
+
+	value, err := remote.Put("A", "B")
+	if err != nil || value != nil {
+		t.Error("Wrong behavior of Put function", err)
+	}
+
+	value, err = remote.PutExpirable("A", "C", 100)
+	if err != nil || value != "B" {
+		t.Error("Wrong behavior of PutExpirable function", err)
+	}
+
+	value, err = remote.Get("A")
+	if err != nil || value != "C" {
+		t.Error("Wrong behavior of Get function", err)
+	}
+
+	replaced, err := remote.ReplaceValue("A", "C", "D")
+	if err != nil || !replaced {
+		t.Error("Wrong behavior of ReplaceValue function", err)
+	}
+
+	replaced, err = remote.ReplaceValueExpirable("A", "C", "E", 100)
+	if err != nil || replaced {
+		t.Error("Wrong behavior of ReplaceValueExpirable function", err)
+	}
+
+	updated, err := remote.UpdateTTL("A", 100)
+	if err != nil || !updated {
+		t.Error("Wrong behavior of UpdateTTL function", err)
+	}
+
+	remote.Put("F", "G")
+	size, err := remote.Size()
+	if err != nil || size != 2 {
+		t.Error("Wrong behavior of Size function", err)
+	}
+
+	keys, err := remote.GetKeys()
+	if err != nil || len(keys) != 2 {
+		t.Error("Wrong behavior of GetKeys function", err)
+	}
+
+	removed, err := remote.RemovePair("A", "Z")
+	if err != nil || removed {
+		t.Error("Wrong behavior of RemovePair function", err)
+	}
+
+	removed, err = remote.RemovePair("A", "D")
+	if err != nil || !removed {
+		t.Error("Wrong behavior of RemovePair function", err)
+	}
+
+	value, err = remote.Remove("F")
+	if err != nil || value != "G" {
+		t.Error("Wrong behavior of Remove function", err)
+	}
+}
+
+func TestRemoteLists(t *testing.T) {
+	remote := connectRemoteCache(t, "TestRemoteLists")
+
+	if remote.AppendListValue("L", "1") != nil || remote.AppendListValueExpirable("L", "2", 100) != nil || remote.AppendListValue("L", "3") != nil {
+		t.Error("Wrong behavior of AppendListValue function")
+	}
+
+	value, err := remote.GetListValue("L", 1)
+	if err != nil || value != "2" {
+		t.Error("Wrong behavior of GetListValue function", err)
+	}
+
+	value, err = remote.DeleteListValue("L", 0)
+	if err != nil || value != "1" {
+		t.Error("Wrong behavior of DeleteListValue function", err)
+	}
+
+	size, err := remote.GetListSize("L")
+	if err != nil || size != 2 {
+		t.Error("Wrong behavior of GetListSize function", err)
+	}
+
+	value, err = remote.Get("L")
+	list, ok := value.(utils.List)
+	if err != nil || !ok || list.String() != "List [2 3]" {
+		t.Error("List was not converted from Json", err)
+	}
+
+	_, err = remote.GetListValue("L", 5)
+	if !errors.Is(err, cache.ErrBadArguments) {
+		t.Error("Wrong behavior of GetListValue function", err)
+	}
+
+	remote.Put("S", "string")
+	_, err = remote.GetListSize("S")
+	if !errors.Is(err, cache.ErrWrongType) {
+		t.Error("Wrong behavior of GetListSize function", err)
+	}
+}
+
+func TestRemoteDictionaries(t *testing.T) {
+	remote := connectRemoteCache(t, "TestRemoteDictionaries")
+
+	value, err := remote.SetDictValue("D", "K", "V")
+	if err != nil || value != nil {
+		t.Error("Wrong behavior of SetDictValue function", err)
+	}
+
+	value, err = remote.SetDictValue("D", "K", "V2")
+	if err != nil || value != "V" {
+		t.Error("Wrong behavior of SetDictValue function", err)
+	}
+
+	appended, err := remote.AppendDictValue("D", "K", "V3")
+	if err != nil || appended {
+		t.Error("Wrong behavior of AppendDictValue function", err)
+	}
+
+	appended, err = remote.AppendDictValue("D", "K2", "V3")
+	if err != nil || !appended {
+		t.Error("Wrong behavior of AppendDictValue function", err)
+	}
+
+	value, err = remote.GetDictValue("D", "K2")
+	if err != nil || value != "V3" {
+		t.Error("Wrong behavior of GetDictValue function", err)
+	}
+
+	value, err = remote.DeleteDictValue("D", "K")
+	if err != nil || value != "V2" {
+		t.Error("Wrong behavior of DeleteDictValue function", err)
+	}
+
+	size, err := remote.GetDictSize("D")
+	if err != nil || size != 1 {
+		t.Error("Wrong behavior of GetDictSize function", err)
+	}
+
+	value, err = remote.Get("D")
+	dict, ok := value.(utils.Dict)
+	if err != nil || !ok || dict.Get("K2") != "V3" {
+		t.Error("Dictionary was not converted from Json", err)
+	}
+
+	remote.AppendListValue("L", "1")
+	_, err = remote.GetDictValue("L", "K")
+	if !errors.Is(err, cache.ErrWrongType) {
+		t.Error("Wrong behavior of GetDictValue function", err)
+	}
+}
+
+func TestLegacyRemoteValues(t *testing.T) {
+	remote := connectLegacyRemoteCache(t, "TestLegacyRemoteValues")
+
+	remote.Put("A", "B")
+	remote.AppendListValue("L", "1")
+	value, err := remote.Get("A")
+	if err != nil || value != "B" {
+		t.Error("Wrong behavior of Get function", err)
+	}
+
+	size, err := remote.Size()
+	if err != nil || size != 2 {
+		t.Error("Wrong behavior of Size function", err)
+	}
+
+	_, err = remote.GetListSize("A")
+	if !errors.Is(err, cache.ErrWrongType) {
+		t.Error("Wrong behavior of GetListSize function", err)
+	}
+}
+
+func TestRemoteBinaryValues(t *testing.T) {
+	remote := connectRemoteCache(t, "TestRemoteBinaryValues")
+
+	values := []string{"hello world", "line\nbreak", "", "\x00\xff\xfe binary"}
+	for _, value := range values {
+		remote.Put("key with spaces", value)
+		stored, err := remote.Get("key with spaces")
+		if err != nil || stored != value {
+			t.Errorf("Value [%q] was not stored as is: [%q] %v", value, stored, err)
+		}
+	}
+
+	remote.Put("bytes", []byte{0, 1, 2})
+	stored, _ := remote.Get("bytes")
+	if stored != "\x00\x01\x02" {
+		t.Error("Byte slice was not stored as is")
+	}
+
+	remote.SetDictValue("D", "dict key", "dict value")
+	value, err := remote.GetDictValue("D", "dict key")
+	if err != nil || value != "dict value" {
+		t.Error("Dictionary values with spaces were not stored as is", err)
+	}
+}
+
+func TestHumanQuotedCommands(t *testing.T) {
+	client := connectClient(t, false)
+	go io.Copy(io.Discard, client)
+
+	client.Write([]byte("connect-to TestHumanQuotedCommands\n"))
+	client.Write([]byte("set greeting \"hello world\"\n"))
+	client.Write([]byte("exit\n"))
+
+	for i := 0; i < 100 && testServer.options.Caches.Get("TestHumanQuotedCommands") == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c := testServer.options.Caches.Get("TestHumanQuotedCommands").(cache.Cache)
+	for i := 0; i < 100 && c.Get("greeting") == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if c.Get("greeting") != "hello world" {
+		t.Error("Quoted value was not set")
+	}
+}
+
+//Reads lines of a telnet connection till a line <expected>, returns <false> if the connection is closed before it.
+func readUntil(reader *bufio.Reader, expected string) bool {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		if strings.TrimSpace(line) == expected {
+			return true
+		}
+	}
+}
+
+func TestServeAndShutdown(t *testing.T) {
+	dir := t.TempDir()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Cannot listen", err)
+	}
+	options := DefaultServerOptions()
+	options.Listener = listener
+	options.Users = users
+	options.Snapshots = persist.NewSnapshotter(filepath.Join(dir, "caches.snapshot"), options.Caches)
+	options.CommandLog, err = persist.OpenCommandLog(filepath.Join(dir, "commands.log"), options.Caches, persist.DefaultCommandLogOptions(), slog.Default())
+	if err != nil {
+		t.Fatal("Cannot open command log", err)
+	}
+
+	_, err = NewServer(ServerOptions{Listener: listener})
+	if err == nil {
+		t.Error("Server without users should not be created")
+	}
+	server, err := NewServer(options)
+	if err != nil {
+		t.Fatal("Wrong behavior of NewServer function", err)
+	}
+	served := make(chan error)
+	go func() {
+		served <- server.Serve()
+	}()
+
+	dial := func() (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal("Cannot connect", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		if err = cache.Login(conn, "test", "test", false); err != nil {
+			t.Fatal("Login failed", err)
+		}
+		return conn, bufio.NewReader(conn)
+	}
+
+	user, userReader := dial()
+	user.Write([]byte("connect-to TestServeAndShutdown\nset A B\n"))
+	if !readUntil(userReader, "Connected") {
+		t.Fatal("User was not connected to cache")
+	}
+
+	admin, _ := dial()
+	admin.Write([]byte("stop-server\n"))
+
+	if !readUntil(userReader, "Server is shutting down, connection will be closed") {
+		t.Error("Connected user should be told about shutdown")
+	}
+	if _, err = userReader.ReadString('\n'); err == nil {
+		t.Error("Connection of the user should be closed")
+	}
+
+	select {
+	case err = <-served:
+		if err != nil {
+			t.Error("Wrong behavior of Serve function", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve should return after shutdown")
+	}
+	if server.Shutdown(time.Second) != nil {
+		t.Error("Repeated shutdown should return the result of the first one")
+	}
+
+	restored := cache.NewRegistry()
+	defer cache.StopCaches(restored)
+	loaded, err := persist.NewSnapshotter(filepath.Join(dir, "caches.snapshot"), restored).Load(func(id string, options cache.CacheOptions) cache.Cache {
+		return GetCache(restored, id, options)
+	})
+	if err != nil || loaded != 1 {
+		t.Error("Final snapshot should be saved on shutdown", loaded, err)
+	}
+	if _, err = net.Dial("tcp", listener.Addr().String()); err == nil {
+		t.Error("Connections should not be accepted after shutdown")
+	}
+}
+
+func TestListeners(t *testing.T) {
+	dir := t.TempDir()
+	listen := func(network, address string) net.Listener {
+		listener, err := net.Listen(network, address)
+		if err != nil {
+			t.Fatal("Cannot listen", err)
+		}
+		t.Cleanup(func() { listener.Close() })
+		return listener
+	}
+	trusted, err := ListenUnix(filepath.Join(dir, "trusted.sock"), 0600)
+	if err != nil {
+		t.Fatal("Wrong behavior of ListenUnix function", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "trusted.sock")); err != nil || info.Mode().Perm() != 0600 {
+		t.Error("Permissions of the socket should be set", info, err)
+	}
+	uid := strconv.Itoa(os.Getuid())
+
+	options := DefaultServerOptions()
+	options.Users = users
+	options.Caches = testServer.options.Caches
+	options.Listeners = []Listener{
+		{Listener: listen("tcp", "127.0.0.1:0")},
+		{Listener: trusted, Auth: AUTH_TRUST, User: "reader"},
+		{Listener: listen("unix", filepath.Join(dir, "peer.sock")), Auth: AUTH_PEER, PeerUsers: map[string]string{uid: "test"}},
+		{Listener: listen("unix", filepath.Join(dir, "other.sock")), Auth: AUTH_PEER, PeerUsers: map[string]string{"-1": "test"}},
+	}
+	if ipv6, err := net.Listen("tcp", "[::1]:0"); err == nil {
+		options.Listeners = append(options.Listeners, Listener{Listener: ipv6})
+	}
+	server, err := NewServer(options)
+	if err != nil {
+		t.Fatal("Wrong behavior of NewServer function", err)
+	}
+	go server.Serve()
+	defer server.Shutdown(time.Second)
+
+	dial := func(listener Listener) net.Conn {
+		address := listener.Addr()
+		conn, err := net.Dial(address.Network(), address.String())
+		if err != nil {
+			t.Fatal("Cannot connect", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	for _, listener := range append(options.Listeners[:1:1], options.Listeners[4:]...) {
+		if err = cache.Login(dial(listener), "test", "test", true); err != nil {
+			t.Error("Plaintext loopback listener should accept passwords", listener.Addr(), err)
+		}
+	}
+
+	conn := dial(options.Listeners[1])
+	name, err := cache.LoginWithCertificate(conn, "", true)
+	if err != nil || name != "reader" {
+		t.Fatal("Clients of trusted socket should be logged in as its user", name, err)
+	}
+	if _, err = cache.OpenRemoteCache(conn, "other"); !errors.Is(err, cache.ErrPermissionDenied) {
+		t.Error("Permissions of the trusted user should be applied", err)
+	}
+	if _, err = cache.LoginWithCertificate(dial(options.Listeners[1]), "test", true); !errors.Is(err, cache.ErrAuthFailed) {
+		t.Error("Trusted socket should not log another user in", err)
+	}
+	if err = cache.Login(dial(options.Listeners[1]), "test", "test", true); !errors.Is(err, cache.ErrAuthFailed) {
+		t.Error("Trusted socket should not accept passwords", err)
+	}
+
+	name, err = cache.LoginWithCertificate(dial(options.Listeners[2]), "", true)
+	if err != nil || name != "test" {
+		t.Error("Clients of peer socket should be logged in as users of their OS users", name, err)
+	}
+	if _, err = cache.LoginWithCertificate(dial(options.Listeners[3]), "", true); !errors.Is(err, cache.ErrAuthFailed) {
+		t.Error("OS users that are not mapped should not be logged in", err)
+	}
+}
+
+func TestListenerPolicies(t *testing.T) {
+	listen := func(network, address string) net.Listener {
+		listener, err := net.Listen(network, address)
+		if err != nil {
+			t.Fatal("Cannot listen", err)
+		}
+		t.Cleanup(func() { listener.Close() })
+		return listener
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{createCertificate(t, "localhost", nil)}}
+	socket := filepath.Join(t.TempDir(), "cache.sock")
+
+	expected := map[string]Listener{
+		"should be bound to a loopback address": {Listener: listen("tcp", ":0")},
+		"requires TLS with client CAs":          {Listener: listen("tcp", "127.0.0.1:0"), TLSConfig: tlsConfig, Auth: AUTH_CERTIFICATE},
+		"requires a unix socket":                {Listener: listen("tcp", "127.0.0.1:0"), Auth: AUTH_TRUST, User: "test"},
+		"Trusted user":                          {Listener: listen("unix", socket), Auth: AUTH_TRUST},
+		"Unknown auth policy":                   {Listener: listen("tcp", "127.0.0.1:0"), Auth: "anonymous"},
+	}
+	for message, listener := range expected {
+		options := DefaultServerOptions()
+		options.Users = users
+		options.Listeners = []Listener{listener}
+		_, err := NewServer(options)
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Error("Wrong behavior of NewServer function", message, err)
+		}
+	}
+
+	options := DefaultServerOptions()
+	options.Users = users
+	options.Listeners = []Listener{{Listener: listen("tcp", ":0"), TLSConfig: tlsConfig}}
+	if _, err := NewServer(options); err != nil {
+		t.Error("TLS listener should be bound to any address", err)
+	}
+	if !IsLoopback("localhost:8086") || !IsLoopback("[::1]:8086") || IsLoopback(":8086") || IsLoopback("10.0.0.1:8086") {
+		t.Error("Wrong behavior of IsLoopback function")
+	}
+}
+
+func TestCacheLimits(t *testing.T) {
+	defer testServer.Reconfigure(testServer.options.RuntimeOptions)
+	err := testServer.Reconfigure(RuntimeOptions{IdleTimeout: time.Minute, CacheLimits: []CacheLimits{{Pattern: "limited-*", MaxEntries: 2, Policy: cache.LRU}}})
+	if err != nil {
+		t.Fatal("Wrong behavior of Reconfigure function", err)
+	}
+	if testServer.Reconfigure(RuntimeOptions{}) == nil || testServer.Reconfigure(RuntimeOptions{IdleTimeout: time.Minute, CacheLimits: []CacheLimits{{Pattern: "[", MaxEntries: 1}}}) == nil {
+		t.Error("Wrong options should not be applied")
+	}
+
+	_, err = cache.OpenRemoteCache(connectClient(t, true), "limited-machine")
+	options := testServer.options.Caches.Get("limited-machine").(cache.Cache).Options()
+	if err != nil || options.MaxEntries != 2 || options.Policy != cache.LRU {
+		t.Error("Configured limits should be used for a new cache", options, err)
+	}
+
+	_, c, err := testServer.openCache(users.Get("test"), []string{"connect-to", "limited-explicit", "5"})
+	if err != nil || c.Options().MaxEntries != 5 || c.Options().Policy != cache.LRU {
+		t.Error("Limits passed with connect-to should override configured ones", c.Options(), err)
+	}
+
+	if testServer.getLimitedCache("limited-redis", cache.DefaultCacheOptions()).Options().MaxEntries != 2 {
+		t.Error("Configured limits should be used for caches of other listeners")
+	}
+	if testServer.getLimitedCache("unlimited", cache.DefaultCacheOptions()).Options().MaxEntries != 0 {
+		t.Error("Caches that don't match patterns should have default options")
+	}
+}
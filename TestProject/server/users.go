@@ -0,0 +1,89 @@
+package server
+
+import (
+	"TestProject/auth"
+	"TestProject/cache"
+	"TestProject/utils"
+	"errors"
+)
+
+//Checks that a user is allowed to execute a command, denials are written into the server log.
+func (this *Server) checkPermission(user *auth.User, command string) error {
+	err := cache.CheckPermission(user, command)
+	if err != nil {
+		this.options.Log.Warn("Command is denied", utils.LOG_USER, user.Name, utils.LOG_ERROR, err)
+	}
+	return err
+}
+
+//Saves a snapshot of all caches in case a user is allowed to do it.
+func (this *Server) save(user *auth.User) error {
+	err := this.checkPermission(user, "save")
+	if err != nil {
+		return err
+	}
+	if this.options.Snapshots == nil {
+		return cache.NewError(cache.SERVER_ERROR, "Snapshots are not enabled")
+	}
+	return this.options.Snapshots.Save()
+}
+
+//Executes a command that manages users, their sessions or lockouts in case a user is allowed to do it, changes of users are written into the users file.
+//"user-list" returns users with their permissions as Json, "lockout-list" returns failed logins, other commands return <true>.
+//Commands that change something are written into the audit log.
+func (this *Server) manageUsers(user *auth.User, command string, params []string) (value interface{}, err error) {
+	if command != "user-list" && command != "lockout-list" {
+		defer func() {
+			this.options.Auditor.Command(user.Name, "", command, params, err)
+		}()
+	}
+
+	err = this.checkPermission(user, command)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case command == "user-add" && len(params) == 2:
+		err = this.options.Users.Add(params[0], params[1])
+	case command == "user-del" && len(params) == 1:
+		err = this.options.Users.Delete(params[0])
+	case command == "user-passwd" && len(params) == 2:
+		err = this.options.Users.SetPassword(params[0], params[1])
+	case command == "session-revoke" && len(params) == 1:
+		err = this.options.Users.RevokeSessions(params[0])
+	case command == "user-grant" && len(params) >= 1:
+		var permissions auth.User
+		permissions, err = auth.ParsePermissions(params[1:])
+		if err == nil {
+			err = this.options.Users.Grant(params[0], permissions)
+		}
+	case command == "user-list" && len(params) == 0:
+		list := []string{}
+		for _, u := range this.options.Users.List() {
+			data, _ := auth.UserToJson(&u)
+			list = append(list, string(data))
+		}
+		return list, nil
+	case command == "lockout-clear" && len(params) == 1:
+		if !this.options.Limiter.Clear(params[0]) {
+			return nil, cache.NewError(cache.NOT_FOUND, "No failed logins of [%v]", params[0])
+		}
+	case command == "lockout-list" && len(params) == 0:
+		list := []string{}
+		for _, lockout := range this.options.Limiter.List() {
+			list = append(list, lockout.String())
+		}
+		return list, nil
+	default:
+		return nil, cache.ErrBadArguments
+	}
+
+	if errors.Is(err, auth.ErrUnknownUser) {
+		return nil, cache.WrapError(cache.NOT_FOUND, err)
+	} else if err != nil {
+		return nil, cache.WrapError(cache.BAD_ARGUMENTS, err)
+	}
+	this.options.Log.Info("Users were changed", utils.LOG_USER, user.Name, "command", command, "target", params[0])
+	return true, nil
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
@@ -11,6 +12,9 @@ type Dict interface {
 	SyncMap
 	//Represents a dictionary as a one string value where necessary.
 	String() string
+
+	//Returns a copy of all key-value pairs of a dictionary.
+	Pairs() map[string]interface{}
 }
 
 //Synchronized implementation of dictionary interface
@@ -46,6 +50,18 @@ func (dict *baseDict) copyKeyValues() []string {
 	return list
 }
 
+//Returns a copy of the dictionary key-value pairs.
+func (dict *baseDict) Pairs() map[string]interface{} {
+	dict.Lock()
+	defer dict.Unlock()
+
+	pairs := make(map[string]interface{}, len(dict.m))
+	for key, value := range dict.m {
+		pairs[key] = value
+	}
+	return pairs
+}
+
 //Returns a word(value) for a passed key.
 func (dict *baseDict) Get(key string) interface{} {
 	dict.Lock()
@@ -152,6 +168,11 @@ func (dict *baseDict) RemovePair(key string, value interface{}) bool {
 	return true
 }
 
+//Presents the dictionary as a Json object of its key-value pairs.
+func (dict *baseDict) MarshalJSON() ([]byte, error) {
+	return json.Marshal(dict.Pairs())
+}
+
 //Returns size of dictionary, count of key-value pair in it.
 func (dict *baseDict) Size() int {
 	dict.Lock()
@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+//Tracks connections accepted by listeners, so they can be drained when the server shuts down.
+//Shutdown() stops accepting, wakes up connections that wait for a command and lets connections that execute a command finish it.
+type Drainer struct {
+	lock      sync.Mutex
+	listeners []net.Listener
+	conns     map[*drainedConn]struct{}
+	closing   bool
+	active    sync.WaitGroup
+}
+
+func NewDrainer() *Drainer {
+	drainer := new(Drainer)
+	drainer.conns = make(map[*drainedConn]struct{})
+	return drainer
+}
+
+//Returns a listener whose connections are tracked by the drainer, the listener is closed by Shutdown().
+func (this *Drainer) Listen(listener net.Listener) net.Listener {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.closing {
+		listener.Close()
+	}
+	this.listeners = append(this.listeners, listener)
+	return &drainedListener{Listener: listener, drainer: this}
+}
+
+//Returns <true> once Shutdown() is called.
+func (this *Drainer) Closing() bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.closing
+}
+
+//Registers a <notice> that is called when the server starts shutting down, e.g. to tell a user that the connection will be closed.
+//Connections that are not tracked by the drainer are ignored.
+func (this *Drainer) Notify(conn net.Conn, notice func()) {
+	drained, ok := conn.(*drainedConn)
+	if !ok || drained.drainer != this {
+		return
+	}
+
+	this.lock.Lock()
+	closing := this.closing
+	drained.notice = notice
+	this.lock.Unlock()
+
+	if closing {
+		notice()
+	}
+}
+
+//Stops accepting connections and waits up to <timeout> till all tracked connections are closed by their handlers.
+//Reads of connections fail right away, so a handler that waits for a command exits, and a handler that executes a command
+//exits when it tries to read the next one. Connections that are still open after <timeout> are closed.
+//Returns <true> if all connections were closed by their handlers in time.
+func (this *Drainer) Shutdown(timeout time.Duration) bool {
+	this.lock.Lock()
+	this.closing = true
+	for _, listener := range this.listeners {
+		listener.Close()
+	}
+	conns := make([]*drainedConn, 0, len(this.conns))
+	for conn := range this.conns {
+		conns = append(conns, conn)
+	}
+	this.lock.Unlock()
+
+	//A client that doesn't read its notice delays only its own connection
+	deadline := time.Now().Add(timeout)
+	for _, conn := range conns {
+		go func(conn *drainedConn) {
+			if notice := conn.getNotice(); notice != nil {
+				conn.Conn.SetWriteDeadline(deadline)
+				notice()
+			}
+			conn.Conn.SetReadDeadline(time.Now())
+		}(conn)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		this.active.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return true
+	case <-time.After(timeout):
+	}
+
+	this.lock.Lock()
+	for conn := range this.conns {
+		conn.Conn.Close()
+	}
+	this.lock.Unlock()
+	return false
+}
+
+func (this *Drainer) track(conn net.Conn) (net.Conn, bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.closing {
+		return nil, false
+	}
+	drained := &drainedConn{Conn: conn, drainer: this}
+	this.conns[drained] = struct{}{}
+	this.active.Add(1)
+	return drained, true
+}
+
+type drainedListener struct {
+	net.Listener
+	drainer *Drainer
+}
+
+//Connections accepted while the drainer shuts down are closed at once.
+func (this *drainedListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := this.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		drained, ok := this.drainer.track(conn)
+		if ok {
+			return drained, nil
+		}
+		conn.Close()
+	}
+}
+
+//Connection tracked by a Drainer, its read deadline cannot be moved after the drainer started shutting down.
+type drainedConn struct {
+	net.Conn
+	drainer *Drainer
+	notice  func()
+	once    sync.Once
+}
+
+func (this *drainedConn) getNotice() func() {
+	this.drainer.lock.Lock()
+	defer this.drainer.lock.Unlock()
+	return this.notice
+}
+
+func (this *drainedConn) SetReadDeadline(deadline time.Time) error {
+	this.drainer.lock.Lock()
+	defer this.drainer.lock.Unlock()
+
+	if this.drainer.closing {
+		deadline = time.Now()
+	}
+	return this.Conn.SetReadDeadline(deadline)
+}
+
+func (this *drainedConn) SetDeadline(deadline time.Time) error {
+	this.drainer.lock.Lock()
+	defer this.drainer.lock.Unlock()
+
+	if this.drainer.closing {
+		this.Conn.SetWriteDeadline(deadline)
+		return this.Conn.SetReadDeadline(time.Now())
+	}
+	return this.Conn.SetDeadline(deadline)
+}
+
+func (this *drainedConn) Close() error {
+	this.once.Do(func() {
+		this.drainer.lock.Lock()
+		delete(this.drainer.conns, this)
+		this.drainer.lock.Unlock()
+		this.drainer.active.Done()
+	})
+	return this.Conn.Close()
+}
+
+//Returns the connection a tracked connection <conn> wraps, e.g. *tls.Conn, other connections are returned as they are.
+func UnwrapDrained(conn net.Conn) net.Conn {
+	if drained, ok := conn.(*drainedConn); ok {
+		return drained.Conn
+	}
+	return conn
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+//Starts a loopback listener tracked by a <drainer>, every accepted connection is served by <handle>.
+func listenDrained(t *testing.T, drainer *Drainer, handle func(net.Conn)) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Cannot listen", err)
+	}
+	drained := drainer.Listen(listener)
+	t.Cleanup(func() { drained.Close() })
+
+	go func() {
+		for {
+			conn, err := drained.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func dial(t *testing.T, address string) net.Conn {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal("Cannot connect", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestDrainerShutdown(t *testing.T) {
+	drainer := NewDrainer()
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	address := listenDrained(t, drainer, func(conn net.Conn) {
+		defer conn.Close()
+		drainer.Notify(conn, func() {
+			conn.Write([]byte("closing\n"))
+		})
+
+		reader := bufio.NewReader(conn)
+		for {
+			conn.SetReadDeadline(time.Now().Add(time.Minute))
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if line == "slow\n" {
+				close(started)
+				<-release
+			}
+			conn.Write([]byte("done " + line))
+		}
+	})
+
+	idle := dial(t, address)
+	busy := dial(t, address)
+	idle.Write([]byte("ping\n"))
+	idleReader := bufio.NewReader(idle)
+	if line, _ := idleReader.ReadString('\n'); line != "done ping\n" {
+		t.Fatal("Wrong behavior of tracked connection", line)
+	}
+	busy.Write([]byte("slow\n"))
+	<-started
+
+	result := make(chan bool)
+	go func() {
+		result <- drainer.Shutdown(5 * time.Second)
+	}()
+
+	if line, _ := idleReader.ReadString('\n'); line != "closing\n" {
+		t.Error("Notice should be sent on shutdown", line)
+	}
+	if _, err := idleReader.ReadString('\n'); err == nil {
+		t.Error("Idle connection should be closed on shutdown")
+	}
+	if !drainer.Closing() {
+		t.Error("Wrong behavior of Closing function")
+	}
+
+	select {
+	case <-result:
+		t.Fatal("Shutdown should wait for a command that is being executed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	busyReader := bufio.NewReader(busy)
+	lines := map[string]bool{}
+	for {
+		line, err := busyReader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		lines[line] = true
+	}
+	if !lines["done slow\n"] || !lines["closing\n"] {
+		t.Error("Command that is being executed should be finished", lines)
+	}
+	if !<-result {
+		t.Error("All connections should be drained in time")
+	}
+
+	conn, err := net.Dial("tcp", address)
+	if err == nil {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	if err == nil {
+		t.Error("Connections should not be accepted after shutdown")
+	}
+}
+
+func TestDrainerTimeout(t *testing.T) {
+	drainer := NewDrainer()
+	release := make(chan struct{})
+	defer close(release)
+
+	address := listenDrained(t, drainer, func(conn net.Conn) {
+		defer conn.Close()
+		conn.Read(make([]byte, 1))
+		<-release
+	})
+
+	stuck := dial(t, address)
+	stuck.Write([]byte("x"))
+	time.Sleep(50 * time.Millisecond)
+
+	if drainer.Shutdown(100 * time.Millisecond) {
+		t.Error("Stuck connection should not be drained")
+	}
+	stuck.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := stuck.Read(make([]byte, 1))
+	if netErr, ok := err.(net.Error); err == nil || ok && netErr.Timeout() {
+		t.Error("Stuck connection should be closed after the timeout", err)
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"sync"
@@ -24,6 +25,9 @@ type List interface {
 
 	//Allows a list to be presented as a string where necessary.
 	String() string
+
+	//Returns a copy of all values of a list.
+	Values() []interface{}
 }
 
 //Synchronized implementation of a List interface
@@ -115,6 +119,16 @@ func (list *SyncList) String() string {
 	return fmt.Sprint("List ", slice)
 }
 
+//Returns a copy of the list values.
+func (list *SyncList) Values() []interface{} {
+	return list.copySlice()
+}
+
+//Presents the list as a Json array of its values.
+func (list *SyncList) MarshalJSON() ([]byte, error) {
+	return json.Marshal(list.copySlice())
+}
+
 func (list *SyncList) copySlice() []interface{} {
 	list.Lock()
 	defer list.Unlock()
@@ -1,78 +1,115 @@
 package utils
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"net"
+	"io"
+	"log/slog"
+	"os"
 )
 
-//Represents a logger interface.
-//From time to time the logging shoud happen into a different places: console, file, socket connection etc.
-//For this purpose the interface was introduced.
-type Logger interface {
-	//Formatted log, the same as fmt.Printf().
-	Logf(str string, params ...interface{})
+const (
+	LOG_OPTIONS_FILE = "logging.json"
 
-	//Log in one line, the same as fmt.Println().
-	Log(any ...interface{})
+	LOG_FORMAT_TEXT = "text"
+	LOG_FORMAT_JSON = "json"
 
-	//Log each value into a separate line.
-	Logln(any ...interface{})
-}
-
-type ConsoleLogger struct{}
-
-func NewConsoleLogger() Logger {
-	return new(ConsoleLogger)
-}
+	//Keys of fields that are added to records of the server log.
+	LOG_LISTENER   = "listener"
+	LOG_CONNECTION = "conn"
+	LOG_REMOTE     = "remote"
+	LOG_USER       = "user"
+	LOG_CACHE      = "cache"
+	LOG_ERROR      = "error"
+)
 
-func (logger ConsoleLogger) Logf(str string, params ...interface{}) {
-	fmt.Printf(str, params)
-	fmt.Println()
+//Options of the server log.
+type LogOptions struct {
+	//"debug", "info", "warn" or "error".
+	Level string
+	//"text" or "json".
+	Format string
+	//File of the log that is rotated the same way as the audit log, the log is written into stderr if the file is empty.
+	File       string
+	MaxSize    int64
+	MaxBackups int
 }
 
-func (logger ConsoleLogger) Log(any ...interface{}) {
-	fmt.Println(any)
+//Returns default options of the server log: info level in text format written into stderr.
+func DefaultLogOptions() LogOptions {
+	return LogOptions{Level: "info", Format: LOG_FORMAT_TEXT, MaxSize: DEFAULT_ROTATE_SIZE, MaxBackups: DEFAULT_ROTATE_BACKUPS}
 }
 
-func (logger ConsoleLogger) Logln(any ...interface{}) {
-	for i := 0; i < len(any); i++ {
-		fmt.Println(any[i])
+//Reads options of the server log from a Json file, options that are missing in the file keep default values.
+//Default options are returned if the file doesn't exist.
+func ReadLogOptions(fileName string) (LogOptions, error) {
+	options := DefaultLogOptions()
+	data, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return options, nil
+	} else if err != nil {
+		return options, err
 	}
-}
 
-type TelnetLogger struct {
-	conn net.Conn
+	err = json.Unmarshal(data, &options)
+	if err != nil {
+		return options, err
+	}
+	return options, nil
 }
 
-func NewTelnetLogger(conn net.Conn) *TelnetLogger {
-	logger := new(TelnetLogger)
-	logger.conn = conn
-	return logger
+//Checks the level and the format of options.
+func (this *LogOptions) Validate() error {
+	_, err := ParseLogLevel(this.Level)
+	if err != nil {
+		return err
+	}
+	if this.Format != LOG_FORMAT_TEXT && this.Format != LOG_FORMAT_JSON {
+		return errors.New(fmt.Sprintf("Unknown log format [%v]", this.Format))
+	}
+	return nil
 }
 
-func (logger TelnetLogger) Logf(str string, params ...interface{}) {
-	logger.conn.Write([]byte(fmt.Sprintf(str, params...)))
-	logger.conn.Write([]byte("\r\n"))
+//Parses a level of the server log: "debug", "info", "warn" or "error".
+func ParseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(name))
+	if err != nil {
+		return level, errors.New(fmt.Sprintf("Unknown log level [%v]", name))
+	}
+	return level, nil
 }
 
-func (logger TelnetLogger) Log(any ...interface{}) {
-	for i := 0; i < len(any); i++ {
-		logger.conn.Write([]byte(fmt.Sprint(any[i])))
+//Creates the server log with levels and key-value fields, e.g.
+//	log.With(utils.LOG_USER, name).Warn("Cannot save snapshot", utils.LOG_ERROR, err)
+//The level of options is set into <levelVar> when it is passed, so the level can be changed later, e.g. when the configuration is reloaded.
+//Returns the log and a closer of its file, the closer does nothing when the log is written into stderr.
+func NewLogger(options LogOptions, levelVar *slog.LevelVar) (*slog.Logger, io.Closer, error) {
+	err := options.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+	level, _ := ParseLogLevel(options.Level)
+	var leveler slog.Leveler = level
+	if levelVar != nil {
+		levelVar.Set(level)
+		leveler = levelVar
 	}
-	logger.conn.Write([]byte("\r\n"))
-}
 
-func (logger TelnetLogger) Logln(any ...interface{}) {
-	for i := 0; i < len(any); i++ {
-		logger.conn.Write([]byte(fmt.Sprint(any[i])))
-		logger.conn.Write([]byte("\r\n"))
+	var writer io.Writer = os.Stderr
+	var closer io.Closer = io.NopCloser(nil)
+	if options.File != "" {
+		file, err := OpenRotatingFile(options.File, options.MaxSize, options.MaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		writer, closer = file, file
 	}
-}
 
-func ConvertStrings(strings []string) []interface{} {
-	results := make([]interface{}, len(strings))
-	for i, k := range strings {
-		results[i] = k
+	handlerOptions := &slog.HandlerOptions{Level: leveler}
+	if options.Format == LOG_FORMAT_JSON {
+		return slog.New(slog.NewJSONHandler(writer, handlerOptions)), closer, nil
 	}
-	return results
+	return slog.New(slog.NewTextHandler(writer, handlerOptions)), closer, nil
 }
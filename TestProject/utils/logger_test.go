@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	options := DefaultLogOptions()
+	options.Level = "warn"
+	options.Format = LOG_FORMAT_JSON
+	options.File = filepath.Join(t.TempDir(), "server.log")
+
+	level := new(slog.LevelVar)
+	log, closer, err := NewLogger(options, level)
+	if err != nil {
+		t.Fatal("Cannot create logger", err)
+	}
+	log.Info("Skipped")
+	log.With(LOG_USER, "admin").Warn("Written", LOG_CACHE, "team-a")
+	level.Set(slog.LevelError)
+	log.Warn("Skipped after the level is changed")
+	closer.Close()
+
+	data, _ := os.ReadFile(options.File)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var record map[string]interface{}
+	if len(lines) != 1 || json.Unmarshal([]byte(lines[0]), &record) != nil {
+		t.Fatal("Records below the level should not be written", lines)
+	}
+	if record["msg"] != "Written" || record["level"] != "WARN" || record[LOG_USER] != "admin" || record[LOG_CACHE] != "team-a" {
+		t.Error("Wrong behavior of NewLogger function", record)
+	}
+
+	_, _, err = NewLogger(LogOptions{Level: "verbose", Format: LOG_FORMAT_TEXT}, nil)
+	if err == nil {
+		t.Error("Unknown level should not be accepted")
+	}
+	_, _, err = NewLogger(LogOptions{Level: "info", Format: "xml"}, nil)
+	if err == nil {
+		t.Error("Unknown format should not be accepted")
+	}
+}
+
+func TestReadLogOptions(t *testing.T) {
+	dir := t.TempDir()
+
+	options, err := ReadLogOptions(filepath.Join(dir, "missing.json"))
+	if err != nil || options != DefaultLogOptions() {
+		t.Error("Default options should be returned for a missing file", err)
+	}
+
+	fileName := filepath.Join(dir, LOG_OPTIONS_FILE)
+	os.WriteFile(fileName, []byte(`{"Level":"debug","File":"server.log"}`), 0600)
+	options, err = ReadLogOptions(fileName)
+	if err != nil || options.Level != "debug" || options.File != "server.log" || options.Format != LOG_FORMAT_TEXT {
+		t.Error("Wrong behavior of ReadLogOptions function", options, err)
+	}
+}
+
+func TestTelnetWriter(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	replies := NewTelnetWriter(buffer)
+
+	replies.Replyf("Count: [%d/%d]", 1, 2)
+	replies.Reply("Timeout is ", 60, "s.")
+	replies.ReplyLines("a", "b")
+
+	if buffer.String() != "Count: [1/2]\r\nTimeout is 60s.\r\na\r\nb\r\n" {
+		t.Error("Wrong behavior of TelnetWriter", buffer.String())
+	}
+}
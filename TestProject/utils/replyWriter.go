@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+)
+
+//Writes replies to a human user, e.g. into a telnet connection.
+//Diagnostics of the server are not written here, they go into the server log, see NewLogger().
+type ReplyWriter interface {
+	//Formatted reply in one line, the same as fmt.Printf().
+	Replyf(format string, params ...interface{})
+
+	//Reply in one line, values are written one after another.
+	Reply(values ...interface{})
+
+	//Each value is written into a separate line.
+	ReplyLines(values ...interface{})
+}
+
+//Writes replies into a telnet connection, every line ends with "\r\n".
+type TelnetWriter struct {
+	writer io.Writer
+}
+
+func NewTelnetWriter(writer io.Writer) *TelnetWriter {
+	telnet := new(TelnetWriter)
+	telnet.writer = writer
+	return telnet
+}
+
+func (this *TelnetWriter) Replyf(format string, params ...interface{}) {
+	this.writer.Write([]byte(fmt.Sprintf(format, params...) + "\r\n"))
+}
+
+func (this *TelnetWriter) Reply(values ...interface{}) {
+	line := ""
+	for _, value := range values {
+		line += fmt.Sprint(value)
+	}
+	this.writer.Write([]byte(line + "\r\n"))
+}
+
+func (this *TelnetWriter) ReplyLines(values ...interface{}) {
+	for _, value := range values {
+		this.writer.Write([]byte(fmt.Sprint(value) + "\r\n"))
+	}
+}
+
+func ConvertStrings(strings []string) []interface{} {
+	results := make([]interface{}, len(strings))
+	for i, k := range strings {
+		results[i] = k
+	}
+	return results
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+const (
+	DEFAULT_ROTATE_SIZE    = 64 * 1024 * 1024
+	DEFAULT_ROTATE_BACKUPS = 5
+)
+
+//File that is rotated when it grows bigger than a limit: "name" is renamed to "name.1", "name.1" to "name.2" and so on,
+//the oldest backup is removed. Writes are safe for concurrent use, every write goes into one file.
+type RotatingFile struct {
+	lock       sync.Mutex
+	fileName   string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+//Opens a file <fileName> for appending, the file is rotated when it is bigger than <maxSize> bytes and <maxBackups> old files are kept.
+//Non-positive <maxSize> turns rotation off.
+func OpenRotatingFile(fileName string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	rotating := new(RotatingFile)
+	rotating.fileName = fileName
+	rotating.maxSize = maxSize
+	rotating.maxBackups = maxBackups
+	err := rotating.open()
+	if err != nil {
+		return nil, err
+	}
+	return rotating, nil
+}
+
+func (this *RotatingFile) open() error {
+	file, err := os.OpenFile(this.fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	this.file = file
+	this.size = info.Size()
+	return nil
+}
+
+//Appends <data> to the file, the file is rotated before the write if the data doesn't fit into it.
+//When rotation fails the data is still written into the current file and the error of rotation is returned.
+func (this *RotatingFile) Write(data []byte) (int, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.file == nil {
+		return 0, os.ErrClosed
+	}
+	var rotateErr error
+	if this.maxSize > 0 && this.size > 0 && this.size+int64(len(data)) > this.maxSize {
+		rotateErr = this.rotate()
+		if this.file == nil {
+			return 0, rotateErr
+		}
+	}
+
+	n, err := this.file.Write(data)
+	this.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+//Renames the current file into the first backup and opens a new one.
+//If the file cannot be renamed it is opened again, so writes go on into the old file.
+func (this *RotatingFile) rotate() error {
+	err := this.file.Close()
+	this.file = nil
+
+	if err == nil && this.maxBackups > 0 {
+		os.Remove(this.backupName(this.maxBackups))
+		for i := this.maxBackups - 1; i > 0; i-- {
+			os.Rename(this.backupName(i), this.backupName(i+1))
+		}
+		err = os.Rename(this.fileName, this.backupName(1))
+	} else if err == nil {
+		err = os.Remove(this.fileName)
+	}
+
+	openErr := this.open()
+	if err == nil {
+		err = openErr
+	}
+	return err
+}
+
+func (this *RotatingFile) backupName(index int) string {
+	return fmt.Sprintf("%v.%d", this.fileName, index)
+}
+
+func (this *RotatingFile) Close() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.file == nil {
+		return nil
+	}
+	err := this.file.Close()
+	this.file = nil
+	return err
+}
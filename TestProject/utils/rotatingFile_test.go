@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.log")
+	file, err := OpenRotatingFile(fileName, 10, 2)
+	if err != nil {
+		t.Fatal("Cannot open file", err)
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err = file.Write([]byte(line))
+		if err != nil {
+			t.Fatal("Wrong behavior of Write function", err)
+		}
+	}
+	file.Close()
+
+	expected := map[string]string{fileName: "fourth\n", fileName + ".1": "third\n", fileName + ".2": "second\n"}
+	for name, content := range expected {
+		data, _ := os.ReadFile(name)
+		if string(data) != content {
+			t.Error("Wrong content of rotated file", name, string(data))
+		}
+	}
+	if _, err = os.Stat(fileName + ".3"); !os.IsNotExist(err) {
+		t.Error("Oldest backup should be removed")
+	}
+
+	file, _ = OpenRotatingFile(fileName, 10, 2)
+	file.Write([]byte("x\n"))
+	file.Close()
+	data, _ := os.ReadFile(fileName)
+	if string(data) != "fourth\nx\n" {
+		t.Error("Reopened file should be appended", string(data))
+	}
+
+	_, err = file.Write([]byte("y\n"))
+	if err != os.ErrClosed {
+		t.Error("Closed file should not be written", err)
+	}
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+//Defines how a client checks the server and which certificate it presents.
+type ClientTLSOptions struct {
+	//File with PEM certificates of CAs the server certificate has to be signed by, system CAs are used if it is empty.
+	CAFile string
+	//SHA-256 fingerprint of the server certificate in hex, colons are allowed, e.g. "ab:cd:...".
+	Pin string
+	//Client certificate and its key for mutual TLS, the certificate is not sent if they are empty.
+	CertFile string
+	KeyFile  string
+	//Turns off checking of the server, it has to be asked for explicitly.
+	Insecure bool
+}
+
+//Registers flags of client TLS options: -ca, -pin, -cert, -key and -insecure.
+func RegisterTLSFlags(flags *flag.FlagSet) *ClientTLSOptions {
+	options := new(ClientTLSOptions)
+	flags.StringVar(&options.CAFile, "ca", "", "file with PEM certificates of CAs that sign the server certificate")
+	flags.StringVar(&options.Pin, "pin", "", "SHA-256 fingerprint of the server certificate in hex")
+	flags.StringVar(&options.CertFile, "cert", "", "client certificate for mutual TLS")
+	flags.StringVar(&options.KeyFile, "key", "", "key of the client certificate")
+	flags.BoolVar(&options.Insecure, "insecure", false, "don't check the server certificate")
+	return options
+}
+
+//Creates a configuration of a client connection.
+//The server certificate is checked against a CA bundle and a pinned fingerprint if they are passed,
+//a pinned certificate is accepted without a CA because a self-signed certificate is pinned usually.
+func NewClientTLSConfig(options *ClientTLSOptions) (*tls.Config, error) {
+	config := new(tls.Config)
+
+	if options.CertFile != "" || options.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if options.Insecure {
+		config.InsecureSkipVerify = true
+		return config, nil
+	}
+
+	if options.CAFile != "" {
+		pool, err := LoadCertPool(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if options.Pin != "" {
+		pin, err := hex.DecodeString(strings.ReplaceAll(options.Pin, ":", ""))
+		if err != nil || len(pin) != sha256.Size {
+			return nil, errors.New(fmt.Sprintf("Invalid certificate fingerprint [%v]", options.Pin))
+		}
+
+		checkChain := options.CAFile != ""
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("Server certificate is missing")
+			}
+			if Fingerprint(state.PeerCertificates[0]) != hex.EncodeToString(pin) {
+				return errors.New("Server certificate doesn't match the pinned fingerprint")
+			}
+			if checkChain {
+				return verifyServer(state, config.RootCAs)
+			}
+			return nil
+		}
+	}
+	return config, nil
+}
+
+//Returns SHA-256 fingerprint of a certificate in hex.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+//Reads PEM certificates of a file into a pool.
+func LoadCertPool(fileName string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New(fmt.Sprintf("No certificates found in [%v]", fileName))
+	}
+	return pool, nil
+}
+
+//Checks a server certificate against CAs the same way as it is done without InsecureSkipVerify.
+func verifyServer(state tls.ConnectionState, roots *x509.CertPool) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       state.ServerName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//Creates a certificate with a common name <name> signed by <parent>, or a self-signed CA if <parent> is nil.
+func createCertificate(t *testing.T, name string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Cannot generate key", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := template, interface{}(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+
+	data, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal("Cannot create certificate", err)
+	}
+	leaf, _ := x509.ParseCertificate(data)
+	return tls.Certificate{Certificate: [][]byte{data}, PrivateKey: key, Leaf: leaf}
+}
+
+//Makes a TLS handshake of a client with <config> against a server that presents <cert>.
+func handshake(config *tls.Config, cert tls.Certificate) error {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	config.ServerName = "localhost"
+	conn, err := tls.Dial("tcp", listener.Addr().String(), config)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func TestClientTLSConfig(t *testing.T) {
+	ca := createCertificate(t, "ca", nil)
+	cert := createCertificate(t, "localhost", &ca)
+	otherCa := createCertificate(t, "other", nil)
+	other := createCertificate(t, "localhost", &otherCa)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Leaf.Raw}), 0600)
+
+	config, err := NewClientTLSConfig(&ClientTLSOptions{CAFile: caFile})
+	if err != nil || handshake(config, cert) != nil || handshake(config.Clone(), other) == nil {
+		t.Error("Server certificate should be checked against CA file", err)
+	}
+
+	config, err = NewClientTLSConfig(&ClientTLSOptions{Pin: Fingerprint(other.Leaf)})
+	if err != nil || handshake(config, other) != nil || handshake(config.Clone(), cert) == nil {
+		t.Error("Server certificate should be checked against pinned fingerprint", err)
+	}
+
+	config, err = NewClientTLSConfig(&ClientTLSOptions{CAFile: caFile, Pin: Fingerprint(other.Leaf)})
+	if err != nil || handshake(config, other) == nil {
+		t.Error("Pinned certificate should be checked against CA file too", err)
+	}
+
+	config, _ = NewClientTLSConfig(&ClientTLSOptions{})
+	if handshake(config, cert) == nil {
+		t.Error("Certificate of unknown CA should not be accepted by default")
+	}
+
+	config, _ = NewClientTLSConfig(&ClientTLSOptions{Insecure: true})
+	if handshake(config, other) != nil {
+		t.Error("Any certificate should be accepted in insecure mode")
+	}
+
+	_, err = NewClientTLSConfig(&ClientTLSOptions{Pin: "abc"})
+	if err == nil {
+		t.Error("Invalid fingerprint should not be accepted")
+	}
+}
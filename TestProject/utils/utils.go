@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"errors"
 	"strconv"
+	"strings"
 )
 
 type Reader interface {
@@ -23,3 +25,57 @@ func CheckPort(port string) error {
 	_, err := strconv.Atoi(port)
 	return err
 }
+
+//Splits a command line into words the way a shell does it.
+//Words are separated by whitespaces, a word with whitespaces can be quoted with double or single quotes,
+//e.g. set greeting "hello world". A backslash escapes the next character outside of single quotes.
+//Returns an error if a quote is not closed.
+func SplitCommand(line string) ([]string, error) {
+	words := []string{}
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\' && i+1 < len(runes):
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("Quote is not closed")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
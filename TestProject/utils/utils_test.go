@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -57,3 +58,16 @@ func benchmarkCheckPort(port string, b *testing.B) {
 		CheckPort(port)
 	}
 }
+
+func TestSplitCommandFunction(t *testing.T) {
+	words, err := SplitCommand(`set  greeting "hello world" 'it''s' a\ b "say \"hi\"" ""`)
+	expected := []string{"set", "greeting", "hello world", "its", "a b", `say "hi"`, ""}
+	if err != nil || !reflect.DeepEqual(words, expected) {
+		t.Error("Wrong behavior of SplitCommand function")
+	}
+
+	_, err = SplitCommand(`set greeting "hello`)
+	if err == nil {
+		t.Error("Wrong behavior of SplitCommand function")
+	}
+}
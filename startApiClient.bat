@@ -1,3 +1,3 @@
 cd APITestClient
-go run main.go admin password
+go run main.go -pin d8e0d29ed175f7acaf451b4ff3da99b801aa1214969259e99a15b96997fd496e admin password
 pause
\ No newline at end of file
@@ -1,2 +1,2 @@
 cd APITestClient
-go run main.go admin password
\ No newline at end of file
+go run main.go -pin d8e0d29ed175f7acaf451b4ff3da99b801aa1214969259e99a15b96997fd496e admin password
\ No newline at end of file
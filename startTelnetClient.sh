@@ -1,2 +1,2 @@
 cd TelnetTestClient
-go run main.go user pass123
\ No newline at end of file
+go run main.go -pin d8e0d29ed175f7acaf451b4ff3da99b801aa1214969259e99a15b96997fd496e user pass123
\ No newline at end of file